@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// logLevelBody is the body of the /admin/loglevel requests and responses
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+// logLevelHandler reports the log level, and changes it on PUT requests
+// with a body such as {"level": "DEBUG"}
+func logLevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			var body logLevelBody
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil {
+				http.Error(w, "invalid body, expected {\"level\": \"DEBUG|INFO|WARN|ERROR\"}", http.StatusBadRequest)
+				return
+			}
+			level, ok := lookupLogLevel(body.Level)
+			if !ok {
+				http.Error(w, "invalid log level '"+body.Level+"', must be DEBUG, INFO, WARN or ERROR", http.StatusBadRequest)
+				return
+			}
+			changeLogLevel(level, "PUT /admin/loglevel from "+r.RemoteAddr)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(logLevelBody{Level: logLevel.Level().String()})
+	})
+}
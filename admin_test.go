@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_AdminAuthToken(t *testing.T) {
+	config := loadConfig()
+
+	if config.AdminAuthToken != "" {
+		t.Errorf("Expected AdminAuthToken to be empty, got '%s'", config.AdminAuthToken)
+	}
+
+	os.Setenv("ADMIN_AUTH_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_AUTH_TOKEN")
+
+	config = loadConfig()
+
+	if config.AdminAuthToken != "secret" {
+		t.Errorf("Expected AdminAuthToken to be 'secret', got '%s'", config.AdminAuthToken)
+	}
+}
+
+// requestLogLevel sends a request to /admin/loglevel with the token
+func requestLogLevel(t *testing.T, server *httptest.Server, method, token, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, server.URL+"/admin/loglevel", strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Failed to request log level: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result logLevelBody
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result.Level
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	buf := captureLogs(t, slog.LevelInfo)
+
+	config := Config{AdminAuthToken: "secret"}
+	server := httptest.NewServer(newHTTPHandler(config, newDispatcher(nil, config, nil)))
+	defer server.Close()
+
+	if status, level := requestLogLevel(t, server, http.MethodGet, "secret", ""); status != http.StatusOK || level != "INFO" {
+		t.Errorf("Expected 200 INFO, got %d %s", status, level)
+	}
+	if status, _ := requestLogLevel(t, server, http.MethodPut, "wrong", `{"level":"DEBUG"}`); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong token, got %d", status)
+	}
+	if status, _ := requestLogLevel(t, server, http.MethodPut, "secret", `{"level":"TRACE"}`); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid level, got %d", status)
+	}
+	if logLevel.Level() != slog.LevelInfo {
+		t.Fatalf("Expected the level to be unchanged, got %s", logLevel.Level())
+	}
+
+	if status, level := requestLogLevel(t, server, http.MethodPut, "secret", `{"level":"debug"}`); status != http.StatusOK || level != "DEBUG" {
+		t.Errorf("Expected 200 DEBUG, got %d %s", status, level)
+	}
+	if logLevel.Level() != slog.LevelDebug {
+		t.Errorf("Expected the level to be DEBUG, got %s", logLevel.Level())
+	}
+
+	// The change is logged even when switching to a level that hides it
+	requestLogLevel(t, server, http.MethodPut, "secret", `{"level":"ERROR"}`)
+	records := decodeLogs(t, buf)
+	last := records[len(records)-1]
+	if !strings.HasPrefix(last["msg"].(string), "Log level changed from DEBUG to ERROR") {
+		t.Errorf("Expected the change to be logged, got %v", last)
+	}
+}
+
+func TestAdminLogLevel_NoToken(t *testing.T) {
+	server := httptest.NewServer(newHTTPHandler(Config{}, newDispatcher(nil, Config{}, nil)))
+	defer server.Close()
+
+	// Not served without ADMIN_AUTH_TOKEN
+	if status, _ := requestLogLevel(t, server, http.MethodPut, "", `{"level":"DEBUG"}`); status != http.StatusNotFound {
+		t.Errorf("Expected 404 without an admin token, got %d", status)
+	}
+}
+
+func TestWatchLogLevelSignals(t *testing.T) {
+	captureLogs(t, slog.LevelWarn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchLogLevelSignals(ctx, slog.LevelWarn)
+
+	waitLevel := func(want slog.Level) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for logLevel.Level() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the level to become %s, got %s", want, logLevel.Level())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	waitLevel(slog.LevelDebug)
+	syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+	waitLevel(slog.LevelWarn)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// disallowedEvents counts the events dropped because their repository is not
+// in ALLOWED_REPOS or ALLOWED_ORGS
+var disallowedEvents atomic.Int64
+
+// repoAllowlist is the global allowlist of ALLOWED_REPOS and ALLOWED_ORGS.
+// Events of other repositories are dropped before they are matched against
+// the rules, so a misrouted webhook never reaches the matcher. Names are
+// compared case-insensitively, like GitHub does.
+type repoAllowlist struct {
+	repos map[string]bool
+	orgs  map[string]bool
+}
+
+func validateRepoAllowlistConfig(config Config) error {
+	for _, repo := range splitList(config.AllowedRepos) {
+		if owner, name, ok := strings.Cut(repo, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("ALLOWED_REPOS entry '%s' must be owner/name", repo)
+		}
+	}
+	for _, org := range splitList(config.AllowedOrgs) {
+		if strings.Contains(org, "/") {
+			return fmt.Errorf("ALLOWED_ORGS entry '%s' must be an organization or user, not a repository", org)
+		}
+	}
+	return nil
+}
+
+// newRepoAllowlist returns the allowlist, or nil if neither ALLOWED_REPOS nor
+// ALLOWED_ORGS is set
+func newRepoAllowlist(config Config) *repoAllowlist {
+	repos, orgs := splitList(config.AllowedRepos), splitList(config.AllowedOrgs)
+	if len(repos) == 0 && len(orgs) == 0 {
+		return nil
+	}
+	allowlist := &repoAllowlist{repos: make(map[string]bool, len(repos)), orgs: make(map[string]bool, len(orgs))}
+	for _, repo := range repos {
+		allowlist.repos[strings.ToLower(repo)] = true
+	}
+	for _, org := range orgs {
+		allowlist.orgs[strings.ToLower(org)] = true
+	}
+	return allowlist
+}
+
+// allows reports whether events of the repository may be dispatched
+func (a *repoAllowlist) allows(repo string) bool {
+	if a == nil {
+		return true
+	}
+	repo = strings.ToLower(repo)
+	owner, _, _ := strings.Cut(repo, "/")
+	return a.repos[repo] || a.orgs[owner]
+}
+
+// warnDisallowedRules warns about the rules of repositories the allowlist
+// drops the events of, which can never match
+func (a *repoAllowlist) warnDisallowedRules(rules []FilterRule) {
+	for i, rule := range rules {
+		if !a.allows(rule.Repo) {
+			logWarn("Rule %d (%s %s) never matches: '%s' is not in ALLOWED_REPOS or ALLOWED_ORGS", i, rule.Repo, rule.Branch, rule.Repo)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestLoadConfig_RepoAllowlist(t *testing.T) {
+	config := loadConfig()
+
+	if config.AllowedRepos != "" || config.AllowedOrgs != "" {
+		t.Errorf("Expected no allowlist, got repos '%s' and orgs '%s'", config.AllowedRepos, config.AllowedOrgs)
+	}
+	if newRepoAllowlist(config) != nil {
+		t.Error("Expected no allowlist by default")
+	}
+
+	os.Setenv("ALLOWED_REPOS", "partner/shared-lib")
+	os.Setenv("ALLOWED_ORGS", "its-the-vibe")
+	defer os.Unsetenv("ALLOWED_REPOS")
+	defer os.Unsetenv("ALLOWED_ORGS")
+
+	config = loadConfig()
+	if config.AllowedRepos != "partner/shared-lib" {
+		t.Errorf("Expected AllowedRepos to be 'partner/shared-lib', got '%s'", config.AllowedRepos)
+	}
+	if config.AllowedOrgs != "its-the-vibe" {
+		t.Errorf("Expected AllowedOrgs to be 'its-the-vibe', got '%s'", config.AllowedOrgs)
+	}
+	if err := validateRepoAllowlistConfig(config); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+}
+
+func TestValidateRepoAllowlistConfig(t *testing.T) {
+	for name, config := range map[string]Config{
+		"repository without owner": {AllowedRepos: "shared-lib"},
+		"repository with a path":   {AllowedRepos: "partner/shared-lib/sub"},
+		"empty owner":              {AllowedRepos: "/shared-lib"},
+		"organization with a name": {AllowedOrgs: "its-the-vibe/api"},
+	} {
+		if err := validateRepoAllowlistConfig(config); err == nil {
+			t.Errorf("Expected error for %s, got nil", name)
+		}
+	}
+}
+
+func TestRepoAllowlist_Allows(t *testing.T) {
+	allowlist := newRepoAllowlist(Config{AllowedRepos: "partner/shared-lib, other/tool", AllowedOrgs: "its-the-vibe"})
+
+	tests := []struct {
+		repo    string
+		allowed bool
+	}{
+		{"partner/shared-lib", true},
+		{"Partner/Shared-Lib", true},
+		{"partner/other", false},
+		{"its-the-vibe/api", true},
+		{"ITS-THE-VIBE/web", true},
+		{"its-the-vibe-fork/api", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := allowlist.allows(tt.repo); got != tt.allowed {
+			t.Errorf("allows(%q) = %v, expected %v", tt.repo, got, tt.allowed)
+		}
+	}
+
+	var none *repoAllowlist
+	if !none.allows("anyone/anything") {
+		t.Error("Expected every repository to be allowed without an allowlist")
+	}
+}
+
+func TestHandleWebhookMessage_DropsDisallowedRepo(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline", AllowedOrgs: "its-the-vibe"}
+	rules := []FilterRule{{Repo: "intruder/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+
+	// The event is dropped before matching, so no Redis is needed
+	d := newDispatcher(nil, config, rules)
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"intruder/repo"}}`
+	before := disallowedEvents.Load()
+	if err := d.handleWebhookMessage(context.Background(), payload); err != nil {
+		t.Fatalf("Expected the event to be dropped, got %v", err)
+	}
+	if got := disallowedEvents.Load() - before; got != 1 {
+		t.Errorf("Expected 1 disallowed event, got %d", got)
+	}
+
+	var event GitHubEvent
+	json.Unmarshal([]byte(payload), &event)
+	result, err := d.match(context.Background(), event)
+	if err != nil || result.Matched || result.Reason == "" {
+		t.Errorf("Expected no match with a reason, got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const outputModeAMQP = "amqp"
+
+// amqpReturnBuffer bounds the unroutable jobs reported per publish; it
+// exceeds the jobs of any realistic dispatch
+const amqpReturnBuffer = 256
+
+func init() {
+	registerJobSink(outputModeAMQP, func(config Config, c clients) JobSink {
+		return c.amqp
+	})
+}
+
+// amqpPublisher publishes jobs to AMQP_EXCHANGE on a channel in confirm mode.
+// The connection is opened on the first publish and reopened after it was
+// lost.
+type amqpPublisher struct {
+	config Config
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	ch      *amqp.Channel
+	returns chan amqp.Return
+}
+
+func newAMQPPublisher(config Config) *amqpPublisher {
+	return &amqpPublisher{config: config}
+}
+
+// validateAMQPConfig checks the AMQP settings when the AMQP output is used
+func validateAMQPConfig(config Config) error {
+	if config.OutputMode != outputModeAMQP {
+		return nil
+	}
+	if _, err := amqp.ParseURI(config.AMQPURL); err != nil {
+		return fmt.Errorf("invalid AMQP_URL: %w", err)
+	}
+	if config.AMQPConfirmTimeout <= 0 {
+		return errors.New("AMQP_CONFIRM_TIMEOUT must be positive")
+	}
+	return nil
+}
+
+// redactAMQPURL returns the broker URL without its credentials for logging
+func redactAMQPURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid AMQP_URL)"
+	}
+	u.User = nil
+	return u.String()
+}
+
+// open connects to the broker at AMQP_URL
+func (p *amqpPublisher) open() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.connect()
+}
+
+func (p *amqpPublisher) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.disconnect()
+}
+
+// connect opens the connection and a confirm mode channel unless they are
+// still open; it must be called with the lock held
+func (p *amqpPublisher) connect() error {
+	if p.conn != nil && !p.conn.IsClosed() && p.ch != nil && !p.ch.IsClosed() {
+		return nil
+	}
+	p.disconnect()
+
+	conn, err := amqp.DialConfig(p.config.AMQPURL, amqp.Config{Properties: amqp.Table{"connection_name": "github-dispatcher"}})
+	if err != nil {
+		return fmt.Errorf("failed to connect to AMQP broker: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open AMQP channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	p.conn = conn
+	p.ch = ch
+	p.returns = ch.NotifyReturn(make(chan amqp.Return, amqpReturnBuffer))
+	logInfo("Connected to AMQP broker at %s, publishing to exchange '%s'", redactAMQPURL(p.config.AMQPURL), p.config.AMQPExchange)
+	return nil
+}
+
+func (p *amqpPublisher) disconnect() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn = nil
+	p.ch = nil
+}
+
+// enqueue publishes the jobs with the queue names as routing keys and waits
+// for the broker to confirm them; priorities are not used. A job that is nacked, unroutable or not
+// confirmed within AMQP_CONFIRM_TIMEOUT fails the dispatch like a failed
+// Redis push, so the webhook is retried by the input.
+func (p *amqpPublisher) enqueue(ctx context.Context, config Config, queues []string, priority int, jobs [][]byte) error {
+	if len(queues) == 0 {
+		queues = []string{config.PipelineQueueName}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.connect(); err != nil {
+		return err
+	}
+
+	confirms := make([]*amqp.DeferredConfirmation, 0, len(queues)*len(jobs))
+	for _, routingKey := range queues {
+		for _, job := range jobs {
+			// Mandatory so jobs no queue is bound for are returned
+			confirm, err := p.ch.PublishWithDeferredConfirmWithContext(ctx, p.config.AMQPExchange, routingKey, true, false, amqpMessage(job))
+			if err != nil {
+				p.disconnect()
+				return fmt.Errorf("failed to publish job with routing key '%s': %w", routingKey, err)
+			}
+			confirms = append(confirms, confirm)
+		}
+	}
+
+	confirmCtx, cancel := context.WithTimeout(ctx, p.config.AMQPConfirmTimeout)
+	defer cancel()
+	for _, confirm := range confirms {
+		acked, err := confirm.WaitContext(confirmCtx)
+		if err != nil {
+			// Later confirms of the channel can no longer be told apart
+			p.disconnect()
+			return fmt.Errorf("job not confirmed by the AMQP broker within %s", p.config.AMQPConfirmTimeout)
+		}
+		if !acked {
+			return errors.New("job rejected by the AMQP broker")
+		}
+	}
+
+	// Returns are delivered before the confirm of the returned job
+	select {
+	case returned := <-p.returns:
+		return fmt.Errorf("job %s unroutable: exchange '%s' has no queue for routing key '%s'", returned.MessageId, returned.Exchange, returned.RoutingKey)
+	default:
+	}
+	return nil
+}
+
+// amqpMessage returns the persistent message of a serialized job
+func amqpMessage(job []byte) amqp.Publishing {
+	var identified struct {
+		ID string `json:"job_id"`
+	}
+	json.Unmarshal(job, &identified)
+
+	return amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    identified.ID,
+		Timestamp:    time.Now(),
+		AppId:        "github-dispatcher",
+		Body:         job,
+	}
+}
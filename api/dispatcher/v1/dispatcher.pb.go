@@ -0,0 +1,764 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: dispatcher/v1/dispatcher.proto
+
+package dispatcherv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Event is a GitHub push or pull_request event.
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Full name of the repository, e.g. owner/repo.
+	Repo string `protobuf:"bytes,1,opt,name=repo,proto3" json:"repo,omitempty"`
+	// Pushed ref of a push event, e.g. refs/heads/main or refs/tags/v1.0.0.
+	Ref string `protobuf:"bytes,2,opt,name=ref,proto3" json:"ref,omitempty"`
+	// Commit SHA after the push.
+	After string `protobuf:"bytes,3,opt,name=after,proto3" json:"after,omitempty"`
+	// Whether the push was a force push.
+	Forced bool `protobuf:"varint,4,opt,name=forced,proto3" json:"forced,omitempty"`
+	// Action of a pull_request event, e.g. opened or synchronize.
+	Action string `protobuf:"bytes,5,opt,name=action,proto3" json:"action,omitempty"`
+	// Pull request of a pull_request event; unset for push events.
+	PullRequest   *PullRequest `protobuf:"bytes,6,opt,name=pull_request,json=pullRequest,proto3" json:"pull_request,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_dispatcher_v1_dispatcher_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Event) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *Event) GetRef() string {
+	if x != nil {
+		return x.Ref
+	}
+	return ""
+}
+
+func (x *Event) GetAfter() string {
+	if x != nil {
+		return x.After
+	}
+	return ""
+}
+
+func (x *Event) GetForced() bool {
+	if x != nil {
+		return x.Forced
+	}
+	return false
+}
+
+func (x *Event) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *Event) GetPullRequest() *PullRequest {
+	if x != nil {
+		return x.PullRequest
+	}
+	return nil
+}
+
+type PullRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Number int32                  `protobuf:"varint,1,opt,name=number,proto3" json:"number,omitempty"`
+	Title  string                 `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	// Branch names without refs/heads/.
+	HeadRef string `protobuf:"bytes,3,opt,name=head_ref,json=headRef,proto3" json:"head_ref,omitempty"`
+	HeadSha string `protobuf:"bytes,4,opt,name=head_sha,json=headSha,proto3" json:"head_sha,omitempty"`
+	BaseRef string `protobuf:"bytes,5,opt,name=base_ref,json=baseRef,proto3" json:"base_ref,omitempty"`
+	// Login of the author.
+	User              string `protobuf:"bytes,6,opt,name=user,proto3" json:"user,omitempty"`
+	AuthorAssociation string `protobuf:"bytes,7,opt,name=author_association,json=authorAssociation,proto3" json:"author_association,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *PullRequest) Reset() {
+	*x = PullRequest{}
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PullRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PullRequest) ProtoMessage() {}
+
+func (x *PullRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PullRequest.ProtoReflect.Descriptor instead.
+func (*PullRequest) Descriptor() ([]byte, []int) {
+	return file_dispatcher_v1_dispatcher_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PullRequest) GetNumber() int32 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *PullRequest) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *PullRequest) GetHeadRef() string {
+	if x != nil {
+		return x.HeadRef
+	}
+	return ""
+}
+
+func (x *PullRequest) GetHeadSha() string {
+	if x != nil {
+		return x.HeadSha
+	}
+	return ""
+}
+
+func (x *PullRequest) GetBaseRef() string {
+	if x != nil {
+		return x.BaseRef
+	}
+	return ""
+}
+
+func (x *PullRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *PullRequest) GetAuthorAssociation() string {
+	if x != nil {
+		return x.AuthorAssociation
+	}
+	return ""
+}
+
+// EventSource is either a typed event or a raw GitHub webhook payload.
+type EventSource struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Source:
+	//
+	//	*EventSource_Event
+	//	*EventSource_Payload
+	Source        isEventSource_Source `protobuf_oneof:"source"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EventSource) Reset() {
+	*x = EventSource{}
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventSource) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventSource) ProtoMessage() {}
+
+func (x *EventSource) ProtoReflect() protoreflect.Message {
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventSource.ProtoReflect.Descriptor instead.
+func (*EventSource) Descriptor() ([]byte, []int) {
+	return file_dispatcher_v1_dispatcher_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *EventSource) GetSource() isEventSource_Source {
+	if x != nil {
+		return x.Source
+	}
+	return nil
+}
+
+func (x *EventSource) GetEvent() *Event {
+	if x != nil {
+		if x, ok := x.Source.(*EventSource_Event); ok {
+			return x.Event
+		}
+	}
+	return nil
+}
+
+func (x *EventSource) GetPayload() string {
+	if x != nil {
+		if x, ok := x.Source.(*EventSource_Payload); ok {
+			return x.Payload
+		}
+	}
+	return ""
+}
+
+type isEventSource_Source interface {
+	isEventSource_Source()
+}
+
+type EventSource_Event struct {
+	Event *Event `protobuf:"bytes,1,opt,name=event,proto3,oneof"`
+}
+
+type EventSource_Payload struct {
+	// Raw webhook JSON as delivered by GitHub.
+	Payload string `protobuf:"bytes,2,opt,name=payload,proto3,oneof"`
+}
+
+func (*EventSource_Event) isEventSource_Source() {}
+
+func (*EventSource_Payload) isEventSource_Source() {}
+
+type SubmitEventRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Source        *EventSource           `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitEventRequest) Reset() {
+	*x = SubmitEventRequest{}
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitEventRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitEventRequest) ProtoMessage() {}
+
+func (x *SubmitEventRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitEventRequest.ProtoReflect.Descriptor instead.
+func (*SubmitEventRequest) Descriptor() ([]byte, []int) {
+	return file_dispatcher_v1_dispatcher_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SubmitEventRequest) GetSource() *EventSource {
+	if x != nil {
+		return x.Source
+	}
+	return nil
+}
+
+type SubmitEventResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ID of the matched rule; empty when the event matched no rule.
+	RuleId string `protobuf:"bytes,1,opt,name=rule_id,json=ruleId,proto3" json:"rule_id,omitempty"`
+	// The dispatched jobs.
+	Jobs          []*Job `protobuf:"bytes,2,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitEventResponse) Reset() {
+	*x = SubmitEventResponse{}
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitEventResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitEventResponse) ProtoMessage() {}
+
+func (x *SubmitEventResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitEventResponse.ProtoReflect.Descriptor instead.
+func (*SubmitEventResponse) Descriptor() ([]byte, []int) {
+	return file_dispatcher_v1_dispatcher_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SubmitEventResponse) GetRuleId() string {
+	if x != nil {
+		return x.RuleId
+	}
+	return ""
+}
+
+func (x *SubmitEventResponse) GetJobs() []*Job {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+type TestMatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Source        *EventSource           `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TestMatchRequest) Reset() {
+	*x = TestMatchRequest{}
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TestMatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TestMatchRequest) ProtoMessage() {}
+
+func (x *TestMatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TestMatchRequest.ProtoReflect.Descriptor instead.
+func (*TestMatchRequest) Descriptor() ([]byte, []int) {
+	return file_dispatcher_v1_dispatcher_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *TestMatchRequest) GetSource() *EventSource {
+	if x != nil {
+		return x.Source
+	}
+	return nil
+}
+
+type TestMatchResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Whether the event would be dispatched.
+	Matched bool `protobuf:"varint,1,opt,name=matched,proto3" json:"matched,omitempty"`
+	// ID of the matched rule.
+	RuleId string `protobuf:"bytes,2,opt,name=rule_id,json=ruleId,proto3" json:"rule_id,omitempty"`
+	// Why the event would not be dispatched, e.g. no matching rule.
+	Reason string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	// Queues (or subjects, or routing keys) the jobs would be written to.
+	Queues []string `protobuf:"bytes,4,rep,name=queues,proto3" json:"queues,omitempty"`
+	// The jobs that would be dispatched. Their IDs are not the IDs of a later
+	// dispatch of the same event.
+	Jobs          []*Job `protobuf:"bytes,5,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TestMatchResponse) Reset() {
+	*x = TestMatchResponse{}
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TestMatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TestMatchResponse) ProtoMessage() {}
+
+func (x *TestMatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TestMatchResponse.ProtoReflect.Descriptor instead.
+func (*TestMatchResponse) Descriptor() ([]byte, []int) {
+	return file_dispatcher_v1_dispatcher_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TestMatchResponse) GetMatched() bool {
+	if x != nil {
+		return x.Matched
+	}
+	return false
+}
+
+func (x *TestMatchResponse) GetRuleId() string {
+	if x != nil {
+		return x.RuleId
+	}
+	return ""
+}
+
+func (x *TestMatchResponse) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *TestMatchResponse) GetQueues() []string {
+	if x != nil {
+		return x.Queues
+	}
+	return nil
+}
+
+func (x *TestMatchResponse) GetJobs() []*Job {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+type Job struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	RuleId        string                 `protobuf:"bytes,2,opt,name=rule_id,json=ruleId,proto3" json:"rule_id,omitempty"`
+	Repo          string                 `protobuf:"bytes,3,opt,name=repo,proto3" json:"repo,omitempty"`
+	Branch        string                 `protobuf:"bytes,4,opt,name=branch,proto3" json:"branch,omitempty"`
+	Type          string                 `protobuf:"bytes,5,opt,name=type,proto3" json:"type,omitempty"`
+	Dir           string                 `protobuf:"bytes,6,opt,name=dir,proto3" json:"dir,omitempty"`
+	Commands      []string               `protobuf:"bytes,7,rep,name=commands,proto3" json:"commands,omitempty"`
+	Metadata      map[string]string      `protobuf:"bytes,8,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Env           map[string]string      `protobuf:"bytes,9,rep,name=env,proto3" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Priority      int32                  `protobuf:"varint,10,opt,name=priority,proto3" json:"priority,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_dispatcher_v1_dispatcher_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_dispatcher_v1_dispatcher_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Job) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *Job) GetRuleId() string {
+	if x != nil {
+		return x.RuleId
+	}
+	return ""
+}
+
+func (x *Job) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *Job) GetBranch() string {
+	if x != nil {
+		return x.Branch
+	}
+	return ""
+}
+
+func (x *Job) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Job) GetDir() string {
+	if x != nil {
+		return x.Dir
+	}
+	return ""
+}
+
+func (x *Job) GetCommands() []string {
+	if x != nil {
+		return x.Commands
+	}
+	return nil
+}
+
+func (x *Job) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *Job) GetEnv() map[string]string {
+	if x != nil {
+		return x.Env
+	}
+	return nil
+}
+
+func (x *Job) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+var File_dispatcher_v1_dispatcher_proto protoreflect.FileDescriptor
+
+const file_dispatcher_v1_dispatcher_proto_rawDesc = "" +
+	"\n" +
+	"\x1edispatcher/v1/dispatcher.proto\x12\rdispatcher.v1\"\xb2\x01\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04repo\x18\x01 \x01(\tR\x04repo\x12\x10\n" +
+	"\x03ref\x18\x02 \x01(\tR\x03ref\x12\x14\n" +
+	"\x05after\x18\x03 \x01(\tR\x05after\x12\x16\n" +
+	"\x06forced\x18\x04 \x01(\bR\x06forced\x12\x16\n" +
+	"\x06action\x18\x05 \x01(\tR\x06action\x12=\n" +
+	"\fpull_request\x18\x06 \x01(\v2\x1a.dispatcher.v1.PullRequestR\vpullRequest\"\xcf\x01\n" +
+	"\vPullRequest\x12\x16\n" +
+	"\x06number\x18\x01 \x01(\x05R\x06number\x12\x14\n" +
+	"\x05title\x18\x02 \x01(\tR\x05title\x12\x19\n" +
+	"\bhead_ref\x18\x03 \x01(\tR\aheadRef\x12\x19\n" +
+	"\bhead_sha\x18\x04 \x01(\tR\aheadSha\x12\x19\n" +
+	"\bbase_ref\x18\x05 \x01(\tR\abaseRef\x12\x12\n" +
+	"\x04user\x18\x06 \x01(\tR\x04user\x12-\n" +
+	"\x12author_association\x18\a \x01(\tR\x11authorAssociation\"a\n" +
+	"\vEventSource\x12,\n" +
+	"\x05event\x18\x01 \x01(\v2\x14.dispatcher.v1.EventH\x00R\x05event\x12\x1a\n" +
+	"\apayload\x18\x02 \x01(\tH\x00R\apayloadB\b\n" +
+	"\x06source\"H\n" +
+	"\x12SubmitEventRequest\x122\n" +
+	"\x06source\x18\x01 \x01(\v2\x1a.dispatcher.v1.EventSourceR\x06source\"V\n" +
+	"\x13SubmitEventResponse\x12\x17\n" +
+	"\arule_id\x18\x01 \x01(\tR\x06ruleId\x12&\n" +
+	"\x04jobs\x18\x02 \x03(\v2\x12.dispatcher.v1.JobR\x04jobs\"F\n" +
+	"\x10TestMatchRequest\x122\n" +
+	"\x06source\x18\x01 \x01(\v2\x1a.dispatcher.v1.EventSourceR\x06source\"\x9e\x01\n" +
+	"\x11TestMatchResponse\x12\x18\n" +
+	"\amatched\x18\x01 \x01(\bR\amatched\x12\x17\n" +
+	"\arule_id\x18\x02 \x01(\tR\x06ruleId\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x12\x16\n" +
+	"\x06queues\x18\x04 \x03(\tR\x06queues\x12&\n" +
+	"\x04jobs\x18\x05 \x03(\v2\x12.dispatcher.v1.JobR\x04jobs\"\xa1\x03\n" +
+	"\x03Job\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x17\n" +
+	"\arule_id\x18\x02 \x01(\tR\x06ruleId\x12\x12\n" +
+	"\x04repo\x18\x03 \x01(\tR\x04repo\x12\x16\n" +
+	"\x06branch\x18\x04 \x01(\tR\x06branch\x12\x12\n" +
+	"\x04type\x18\x05 \x01(\tR\x04type\x12\x10\n" +
+	"\x03dir\x18\x06 \x01(\tR\x03dir\x12\x1a\n" +
+	"\bcommands\x18\a \x03(\tR\bcommands\x12<\n" +
+	"\bmetadata\x18\b \x03(\v2 .dispatcher.v1.Job.MetadataEntryR\bmetadata\x12-\n" +
+	"\x03env\x18\t \x03(\v2\x1b.dispatcher.v1.Job.EnvEntryR\x03env\x12\x1a\n" +
+	"\bpriority\x18\n" +
+	" \x01(\x05R\bpriority\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1a6\n" +
+	"\bEnvEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x012\xb2\x01\n" +
+	"\n" +
+	"Dispatcher\x12T\n" +
+	"\vSubmitEvent\x12!.dispatcher.v1.SubmitEventRequest\x1a\".dispatcher.v1.SubmitEventResponse\x12N\n" +
+	"\tTestMatch\x12\x1f.dispatcher.v1.TestMatchRequest\x1a .dispatcher.v1.TestMatchResponseBJZHgithub.com/its-the-vibe/github-dispatcher/api/dispatcher/v1;dispatcherv1b\x06proto3"
+
+var (
+	file_dispatcher_v1_dispatcher_proto_rawDescOnce sync.Once
+	file_dispatcher_v1_dispatcher_proto_rawDescData []byte
+)
+
+func file_dispatcher_v1_dispatcher_proto_rawDescGZIP() []byte {
+	file_dispatcher_v1_dispatcher_proto_rawDescOnce.Do(func() {
+		file_dispatcher_v1_dispatcher_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_dispatcher_v1_dispatcher_proto_rawDesc), len(file_dispatcher_v1_dispatcher_proto_rawDesc)))
+	})
+	return file_dispatcher_v1_dispatcher_proto_rawDescData
+}
+
+var file_dispatcher_v1_dispatcher_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_dispatcher_v1_dispatcher_proto_goTypes = []any{
+	(*Event)(nil),               // 0: dispatcher.v1.Event
+	(*PullRequest)(nil),         // 1: dispatcher.v1.PullRequest
+	(*EventSource)(nil),         // 2: dispatcher.v1.EventSource
+	(*SubmitEventRequest)(nil),  // 3: dispatcher.v1.SubmitEventRequest
+	(*SubmitEventResponse)(nil), // 4: dispatcher.v1.SubmitEventResponse
+	(*TestMatchRequest)(nil),    // 5: dispatcher.v1.TestMatchRequest
+	(*TestMatchResponse)(nil),   // 6: dispatcher.v1.TestMatchResponse
+	(*Job)(nil),                 // 7: dispatcher.v1.Job
+	nil,                         // 8: dispatcher.v1.Job.MetadataEntry
+	nil,                         // 9: dispatcher.v1.Job.EnvEntry
+}
+var file_dispatcher_v1_dispatcher_proto_depIdxs = []int32{
+	1,  // 0: dispatcher.v1.Event.pull_request:type_name -> dispatcher.v1.PullRequest
+	0,  // 1: dispatcher.v1.EventSource.event:type_name -> dispatcher.v1.Event
+	2,  // 2: dispatcher.v1.SubmitEventRequest.source:type_name -> dispatcher.v1.EventSource
+	7,  // 3: dispatcher.v1.SubmitEventResponse.jobs:type_name -> dispatcher.v1.Job
+	2,  // 4: dispatcher.v1.TestMatchRequest.source:type_name -> dispatcher.v1.EventSource
+	7,  // 5: dispatcher.v1.TestMatchResponse.jobs:type_name -> dispatcher.v1.Job
+	8,  // 6: dispatcher.v1.Job.metadata:type_name -> dispatcher.v1.Job.MetadataEntry
+	9,  // 7: dispatcher.v1.Job.env:type_name -> dispatcher.v1.Job.EnvEntry
+	3,  // 8: dispatcher.v1.Dispatcher.SubmitEvent:input_type -> dispatcher.v1.SubmitEventRequest
+	5,  // 9: dispatcher.v1.Dispatcher.TestMatch:input_type -> dispatcher.v1.TestMatchRequest
+	4,  // 10: dispatcher.v1.Dispatcher.SubmitEvent:output_type -> dispatcher.v1.SubmitEventResponse
+	6,  // 11: dispatcher.v1.Dispatcher.TestMatch:output_type -> dispatcher.v1.TestMatchResponse
+	10, // [10:12] is the sub-list for method output_type
+	8,  // [8:10] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_dispatcher_v1_dispatcher_proto_init() }
+func file_dispatcher_v1_dispatcher_proto_init() {
+	if File_dispatcher_v1_dispatcher_proto != nil {
+		return
+	}
+	file_dispatcher_v1_dispatcher_proto_msgTypes[2].OneofWrappers = []any{
+		(*EventSource_Event)(nil),
+		(*EventSource_Payload)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_dispatcher_v1_dispatcher_proto_rawDesc), len(file_dispatcher_v1_dispatcher_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_dispatcher_v1_dispatcher_proto_goTypes,
+		DependencyIndexes: file_dispatcher_v1_dispatcher_proto_depIdxs,
+		MessageInfos:      file_dispatcher_v1_dispatcher_proto_msgTypes,
+	}.Build()
+	File_dispatcher_v1_dispatcher_proto = out.File
+	file_dispatcher_v1_dispatcher_proto_goTypes = nil
+	file_dispatcher_v1_dispatcher_proto_depIdxs = nil
+}
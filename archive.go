@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const inputModeArchive = "archive"
+
+// archiveFetchCount is the number of archived webhooks read per XRANGE
+const archiveFetchCount = 500
+
+func init() {
+	registerEventSource(inputModeArchive, func(config Config, c clients) EventSource {
+		return &archiveSource{archive: newEventArchive(c.rdb, config), query: config.ArchiveReplay}
+	})
+}
+
+// eventArchive appends every accepted webhook, as it was received, to the
+// EVENT_ARCHIVE_STREAM stream capped at about EVENT_ARCHIVE_MAXLEN entries,
+// so webhooks can be fed through the rules again, e.g. after a broken rule
+// was fixed
+type eventArchive struct {
+	rdb    redis.UniversalClient
+	stream string
+	maxLen int64
+}
+
+// archiveQuery selects the archived webhooks to replay: those received
+// between From and To, if set, and of the Delivery, if set
+type archiveQuery struct {
+	From     time.Time
+	To       time.Time
+	Delivery string
+}
+
+// replayCounts is the response of POST /admin/replay
+type replayCounts struct {
+	Replayed int `json:"replayed"`
+	Failed   int `json:"failed"`
+}
+
+// archivedEventKey is the context key of the archive entry being replayed
+type archivedEventKey struct{}
+
+func newEventArchive(rdb redis.UniversalClient, config Config) *eventArchive {
+	return &eventArchive{rdb: rdb, stream: config.EventArchiveStream, maxLen: config.EventArchiveMaxLen}
+}
+
+func validateEventArchiveConfig(config Config) error {
+	if config.EventArchiveMaxLen <= 0 {
+		return fmt.Errorf("EVENT_ARCHIVE_MAXLEN must be positive, got %d", config.EventArchiveMaxLen)
+	}
+	if config.EventArchiveStream == "" {
+		if config.InputMode == inputModeArchive {
+			return errors.New("the archive input requires EVENT_ARCHIVE_STREAM")
+		}
+		return nil
+	}
+	if !usesRedis(config) {
+		return fmt.Errorf("EVENT_ARCHIVE_STREAM requires Redis, which is not used with INPUT_MODE %s and OUTPUT_MODE %s", config.InputMode, config.OutputMode)
+	}
+	return nil
+}
+
+// parseArchiveQuery parses the RFC 3339 times and the delivery ID of a
+// replay. Replaying the whole archive by mistake is avoided by requiring a
+// start time or a delivery ID.
+func parseArchiveQuery(from, to, delivery string) (archiveQuery, error) {
+	query := archiveQuery{Delivery: delivery}
+	if from == "" && delivery == "" {
+		return archiveQuery{}, errors.New("a replay requires a start time or a delivery ID")
+	}
+	var err error
+	if from != "" {
+		if query.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return archiveQuery{}, fmt.Errorf("invalid replay start time '%s', expected RFC 3339: %w", from, err)
+		}
+	}
+	if to != "" {
+		if query.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return archiveQuery{}, fmt.Errorf("invalid replay end time '%s', expected RFC 3339: %w", to, err)
+		}
+		if query.To.Before(query.From) {
+			return archiveQuery{}, fmt.Errorf("replay end time %s is before the start time %s", to, from)
+		}
+	}
+	return query, nil
+}
+
+func withArchivedEvent(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, archivedEventKey{}, id)
+}
+
+// archivedEvent returns the ID of the archive entry being replayed, or an
+// empty string for webhooks read from the input
+func archivedEvent(ctx context.Context) string {
+	id, _ := ctx.Value(archivedEventKey{}).(string)
+	return id
+}
+
+// add archives the payload. The webhook is dispatched anyway, so failing to
+// archive it is only logged.
+func (a *eventArchive) add(ctx context.Context, payload, deliveryID string) {
+	values := map[string]interface{}{"payload": payload, "event_id": eventID(ctx)}
+	if hint := eventTypeHint(ctx); hint != "" {
+		values["type"] = hint
+	}
+	if deliveryID != "" {
+		values["delivery"] = deliveryID
+	}
+	args := &redis.XAddArgs{Stream: a.stream, MaxLen: a.maxLen, Approx: true, Values: values}
+	if err := a.rdb.XAdd(ctx, args).Err(); err != nil {
+		logWarnContext(ctx, "Failed to archive webhook to '%s': %v", a.stream, err)
+	}
+}
+
+// replay hands the archived webhooks selected by the query to handle, in the
+// order they were received, each with a new event ID. A failing webhook does
+// not stop the replay.
+func (a *eventArchive) replay(ctx context.Context, query archiveQuery, handle messageHandler) (counts replayCounts, err error) {
+	start, end := "-", "+"
+	if !query.From.IsZero() {
+		start = strconv.FormatInt(query.From.UnixMilli(), 10)
+	}
+	if !query.To.IsZero() {
+		end = strconv.FormatInt(query.To.UnixMilli(), 10)
+	}
+
+	for {
+		entries, err := a.rdb.XRangeN(ctx, a.stream, start, end, archiveFetchCount).Result()
+		if err != nil {
+			return counts, fmt.Errorf("failed to read event archive '%s': %w", a.stream, err)
+		}
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return counts, nil
+			}
+			if query.Delivery != "" && entry.Values["delivery"] != query.Delivery {
+				continue
+			}
+			payload, ok := entry.Values["payload"].(string)
+			if !ok {
+				logWarn("Skipping archived webhook %s of '%s' without payload", entry.ID, a.stream)
+				continue
+			}
+
+			counts.Replayed++
+			entryCtx := withArchivedEvent(withEventID(ctx), entry.ID)
+			if hint, ok := entry.Values["type"].(string); ok {
+				entryCtx = withEventTypeHint(entryCtx, hint)
+			}
+			logInfoContext(entryCtx, "Replaying archived webhook %s, originally event %v", entry.ID, entry.Values["event_id"])
+			if err := handle(entryCtx, payload); err != nil {
+				counts.Failed++
+				logErrorContext(entryCtx, "Error replaying archived webhook %s: %v", entry.ID, err)
+			}
+		}
+		if len(entries) < archiveFetchCount {
+			return counts, nil
+		}
+		start = "(" + entries[len(entries)-1].ID
+	}
+}
+
+// replayHandler replays the archived webhooks selected by the from, to and
+// delivery query parameters and responds with how many were replayed and
+// how many failed
+func (a *eventArchive) replayHandler(handle messageHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		query, err := parseArchiveQuery(params.Get("from"), params.Get("to"), params.Get("delivery"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logInfo("Replaying archived webhooks on request from %s", r.RemoteAddr)
+		counts, err := a.replay(r.Context(), query, handle)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(counts)
+	})
+}
+
+// archiveSource replays the archived webhooks selected with the --replay-*
+// flags. Like the file input it returns once they were replayed.
+type archiveSource struct {
+	archive *eventArchive
+	query   archiveQuery
+}
+
+func (s *archiveSource) consume(ctx context.Context, handle messageHandler) error {
+	inputActive.Store(true)
+	defer inputActive.Store(false)
+
+	counts, err := s.archive.replay(ctx, s.query, handle)
+	if err != nil {
+		return err
+	}
+	logInfo("Replayed %d archived webhook(s) from '%s', %d failed", counts.Replayed, s.archive.stream, counts.Failed)
+	return nil
+}
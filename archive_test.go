@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_EventArchive(t *testing.T) {
+	config := loadConfig()
+
+	if config.EventArchiveStream != "" {
+		t.Errorf("Expected EventArchiveStream to be empty, got '%s'", config.EventArchiveStream)
+	}
+	if config.EventArchiveMaxLen != 100000 {
+		t.Errorf("Expected EventArchiveMaxLen to be 100000, got %d", config.EventArchiveMaxLen)
+	}
+
+	os.Setenv("EVENT_ARCHIVE_STREAM", "github-webhook-archive")
+	os.Setenv("EVENT_ARCHIVE_MAXLEN", "5000")
+	defer os.Unsetenv("EVENT_ARCHIVE_STREAM")
+	defer os.Unsetenv("EVENT_ARCHIVE_MAXLEN")
+
+	config = loadConfig()
+	if config.EventArchiveStream != "github-webhook-archive" {
+		t.Errorf("Expected EventArchiveStream to be 'github-webhook-archive', got '%s'", config.EventArchiveStream)
+	}
+	if config.EventArchiveMaxLen != 5000 {
+		t.Errorf("Expected EventArchiveMaxLen to be 5000, got %d", config.EventArchiveMaxLen)
+	}
+}
+
+func TestValidateEventArchiveConfig(t *testing.T) {
+	if err := validateEventArchiveConfig(Config{EventArchiveStream: "archive", EventArchiveMaxLen: 100, InputMode: inputModeStream, OutputMode: outputModeList}); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateEventArchiveConfig(Config{EventArchiveMaxLen: 0}); err == nil {
+		t.Error("Expected error for non-positive EVENT_ARCHIVE_MAXLEN, got nil")
+	}
+	if err := validateEventArchiveConfig(Config{EventArchiveStream: "archive", EventArchiveMaxLen: 100, InputMode: inputModeNATS, OutputMode: outputModeNATS}); err == nil {
+		t.Error("Expected error for the archive without Redis, got nil")
+	}
+	if err := validateEventArchiveConfig(Config{EventArchiveMaxLen: 100, InputMode: inputModeArchive}); err == nil {
+		t.Error("Expected error for the archive input without EVENT_ARCHIVE_STREAM, got nil")
+	}
+}
+
+func TestParseArchiveQuery(t *testing.T) {
+	query, err := parseArchiveQuery("2026-10-16T09:00:00Z", "2026-10-16T10:00:00+01:00", "")
+	if err != nil {
+		t.Fatalf("Expected valid query, got %v", err)
+	}
+	if !query.From.Equal(time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)) || !query.To.Equal(query.From) {
+		t.Errorf("Expected the parsed times, got %+v", query)
+	}
+
+	if _, err := parseArchiveQuery("", "", "72d3162e-cc78-11e3-81ab-4c9367dc0958"); err != nil {
+		t.Errorf("Expected a delivery ID alone to be valid, got %v", err)
+	}
+	if _, err := parseArchiveQuery("", "2026-10-16T10:00:00Z", ""); err == nil {
+		t.Error("Expected error without start time or delivery ID, got nil")
+	}
+	if _, err := parseArchiveQuery("2026-10-16T10:00:00Z", "2026-10-16T09:00:00Z", ""); err == nil {
+		t.Error("Expected error for an end time before the start time, got nil")
+	}
+}
+
+func TestEventArchive_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{PipelineQueueName: "pipeline", WebhookSecret: "secret", EventArchiveStream: "test-webhook-archive", EventArchiveMaxLen: 100}
+
+	// Clean up before test
+	rdb.Del(ctx, config.EventArchiveStream)
+	defer rdb.Del(ctx, config.EventArchiveStream)
+
+	// The rule is broken: it does not match the main branch
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/master", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(rdb, config, rules)
+	sink := &recordingSink{}
+	d.sink = sink
+
+	body := `{"ref":"refs/heads/main","after":"abc123","repository":{"full_name":"owner/repo"}}`
+	envelope, _ := json.Marshal(signedWebhook{Signature: sign("secret", body), Body: body, Delivery: "delivery-1"})
+	if err := d.handleWebhookMessage(withEventID(ctx), string(envelope)); err != nil {
+		t.Fatalf("Failed to handle webhook: %v", err)
+	}
+	forged := signedEnvelope(t, sign("wrong", body), body)
+	d.handleWebhookMessage(withEventID(ctx), forged)
+
+	if length := rdb.XLen(ctx, config.EventArchiveStream).Val(); length != 1 {
+		t.Fatalf("Expected only the accepted webhook to be archived, got %d entries", length)
+	}
+	if len(sink.jobs) != 0 {
+		t.Fatalf("Expected the broken rule not to dispatch, got %d job(s)", len(sink.jobs))
+	}
+
+	// Once the rule is fixed, the archived webhook is dispatched on replay
+	fixed := slices.Clone(rules)
+	fixed[0].Branch = "refs/heads/main"
+	d.swapRules(fixed)
+	server := httptest.NewServer(newHTTPHandler(Config{AdminAuthToken: "token"}, d))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/admin/replay?delivery=delivery-1", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to request replay: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var counts replayCounts
+	if err := json.NewDecoder(resp.Body).Decode(&counts); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if counts.Replayed != 1 || counts.Failed != 0 {
+		t.Errorf("Expected one webhook to be replayed, got %+v", counts)
+	}
+	if len(sink.jobs) != 1 {
+		t.Errorf("Expected the replayed webhook to be dispatched, got %d job(s)", len(sink.jobs))
+	}
+	if length := rdb.XLen(ctx, config.EventArchiveStream).Val(); length != 1 {
+		t.Errorf("Expected the replayed webhook not to be archived again, got %d entries", length)
+	}
+
+	query := archiveQuery{From: time.Now().Add(time.Minute)}
+	if counts, err := d.archive.replay(ctx, query, d.handleWebhookMessage); err != nil || counts.Replayed != 0 {
+		t.Errorf("Expected no webhook archived after the start time, got %+v, %v", counts, err)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	auditSinkStream = "stream"
+	auditSinkFile   = "file"
+)
+
+// auditStreamField is the field of the audit stream entries holding the record
+const auditStreamField = "record"
+
+// Decisions recorded in the audit log
+const (
+	auditMatched    = "matched"
+	auditUnmatched  = "unmatched"
+	auditIgnored    = "ignored"
+	auditDuplicate  = "duplicate"
+	auditDisallowed = "disallowed"
+	auditHeld       = "held"
+	auditFailed     = "failed"
+)
+
+// auditRecord is the decision taken for one event: whether a rule matched,
+// why not, and what happened to the jobs
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"`
+	Repo      string    `json:"repo"`
+	Ref       string    `json:"ref"`
+	SHA       string    `json:"sha,omitempty"`
+	Decision  string    `json:"decision"`
+	RuleID    string    `json:"rule_id,omitempty"`
+	Team      string    `json:"team,omitempty"`
+	Service   string    `json:"service,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Outcome   string    `json:"outcome,omitempty"`
+	Output    string    `json:"output,omitempty"`
+	JobIDs    []string  `json:"job_ids,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	KeyID     string    `json:"key_id,omitempty"`
+	Chain     string    `json:"chain,omitempty"`
+	Seq       uint64    `json:"seq,omitempty"`
+	Prev      string    `json:"prev,omitempty"`
+}
+
+// jobs records the outcome of dispatching the jobs of the matched rule
+func (r *auditRecord) jobs(outcome, output string, jobs []Job) {
+	r.Outcome, r.Output = outcome, output
+	r.JobIDs = r.JobIDs[:0]
+	for _, job := range jobs {
+		r.JobIDs = append(r.JobIDs, job.ID)
+	}
+}
+
+// auditLog appends the decision of every dispatched event to AUDIT_SINK
+type auditLog interface {
+	write(ctx context.Context, record auditRecord) error
+	close() error
+}
+
+func validateAuditConfig(config Config) error {
+	if config.AuditHMACKey != "" && len(config.AuditHMACKey) < minAuditHMACKeyLength {
+		return fmt.Errorf("AUDIT_HMAC_KEY must be at least %d characters", minAuditHMACKeyLength)
+	}
+	if config.AuditHMACKeyID != "" && config.AuditHMACKey == "" {
+		return errors.New("AUDIT_HMAC_KEY_ID requires AUDIT_HMAC_KEY")
+	}
+	switch config.AuditSink {
+	case "":
+		return nil
+	case auditSinkStream:
+		if !usesRedis(config) {
+			return fmt.Errorf("AUDIT_SINK stream requires Redis, which is not used with INPUT_MODE %s and OUTPUT_MODE %s", config.InputMode, config.OutputMode)
+		}
+		if config.AuditStream == "" {
+			return errors.New("AUDIT_STREAM must not be empty with AUDIT_SINK stream")
+		}
+		return nil
+	case auditSinkFile:
+		if config.AuditFile == "" {
+			return errors.New("AUDIT_FILE must be set with AUDIT_SINK file")
+		}
+		if config.AuditFileMaxSize <= 0 || config.AuditFileMaxBackups < 0 {
+			return errors.New("AUDIT_FILE_MAX_SIZE_MB must be positive and AUDIT_FILE_MAX_BACKUPS must not be negative")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid AUDIT_SINK '%s', must be '%s' or '%s'", config.AuditSink, auditSinkStream, auditSinkFile)
+	}
+}
+
+// openAuditLog returns the audit log of AUDIT_SINK, or nil when auditing is
+// disabled
+func openAuditLog(rdb redis.UniversalClient, config Config) (auditLog, error) {
+	switch config.AuditSink {
+	case auditSinkStream:
+		// Replicas share the stream, so every one writes its own chain
+		return &auditStream{rdb: rdb, stream: config.AuditStream, maxLen: config.AuditStreamMaxLen, signer: newAuditSigner(config)}, nil
+	case auditSinkFile:
+		return openAuditFile(config.AuditFile, int64(config.AuditFileMaxSize)<<20, config.AuditFileMaxBackups, newAuditSigner(config))
+	default:
+		return nil, nil
+	}
+}
+
+func describeAuditLog(config Config) string {
+	if config.AuditSink == auditSinkStream {
+		return fmt.Sprintf("audit stream '%s'", config.AuditStream)
+	}
+	return fmt.Sprintf("audit file '%s'", config.AuditFile)
+}
+
+// auditStream adds the records to a Redis stream, trimmed to about
+// AUDIT_STREAM_MAXLEN entries
+type auditStream struct {
+	rdb    redis.UniversalClient
+	stream string
+	maxLen int64
+	signer *auditSigner
+}
+
+func (s *auditStream) write(ctx context.Context, record auditRecord) error {
+	return s.signer.write(record, func(encoded []byte) error {
+		err := s.rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: s.stream,
+			MaxLen: s.maxLen,
+			Approx: s.maxLen > 0,
+			Values: map[string]interface{}{auditStreamField: encoded},
+		}).Err()
+		if err != nil {
+			return fmt.Errorf("failed to add audit record to stream '%s': %w", s.stream, err)
+		}
+		return nil
+	})
+}
+
+func (s *auditStream) close() error {
+	return nil
+}
+
+// auditFile appends the records as JSON lines to a file, rotated once it
+// exceeds AUDIT_FILE_MAX_SIZE_MB
+type auditFile struct {
+	file   *rotatingFile
+	signer *auditSigner
+}
+
+func openAuditFile(path string, maxSize int64, maxBackups int, signer *auditSigner) (*auditFile, error) {
+	// The file has a single writer, which continues the chain of its last
+	// record after a restart
+	if signer != nil {
+		last, err := lastAuditLine(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit file: %w", err)
+		}
+		signer.resume(last)
+	}
+	file, err := openRotatingFile(path, maxSize, maxBackups, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return &auditFile{file: file, signer: signer}, nil
+}
+
+func (f *auditFile) write(_ context.Context, record auditRecord) error {
+	return f.signer.write(record, func(encoded []byte) error {
+		if _, err := f.file.Write(append(encoded, '\n')); err != nil {
+			return fmt.Errorf("failed to write audit record: %w", err)
+		}
+		return nil
+	})
+}
+
+// lastAuditLine returns the last record of the audit file, or of its first
+// backup if the file is empty or missing
+func lastAuditLine(path string) ([]byte, error) {
+	for _, name := range []string{path, path + ".1"} {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var last []byte
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), maxReplayLine)
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				last = append(last[:0], line...)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			return last, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *auditFile) close() error {
+	return f.file.Close()
+}
+
+// audit appends the record to the audit log. Failing to do so does not fail
+// the dispatch.
+func (d *Dispatcher) audit(ctx context.Context, record auditRecord) {
+	if d.auditLog == nil {
+		return
+	}
+	if err := d.auditLog.write(context.WithoutCancel(ctx), record); err != nil {
+		logErrorContext(ctx, "Failed to write audit record: %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// recordingAuditLog keeps the audit records in memory
+type recordingAuditLog struct {
+	records []auditRecord
+}
+
+func (l *recordingAuditLog) write(ctx context.Context, record auditRecord) error {
+	l.records = append(l.records, record)
+	return nil
+}
+
+func (l *recordingAuditLog) close() error {
+	return nil
+}
+
+func TestLoadConfig_Audit(t *testing.T) {
+	config := loadConfig()
+
+	if config.AuditSink != "" {
+		t.Errorf("Expected AuditSink to be empty, got '%s'", config.AuditSink)
+	}
+	if config.AuditStream != "github-dispatcher:audit" {
+		t.Errorf("Expected AuditStream to be 'github-dispatcher:audit', got '%s'", config.AuditStream)
+	}
+	if config.AuditStreamMaxLen != 100000 {
+		t.Errorf("Expected AuditStreamMaxLen to be 100000, got %d", config.AuditStreamMaxLen)
+	}
+	if config.AuditFileMaxSize != 100 || config.AuditFileMaxBackups != 5 {
+		t.Errorf("Expected 5 backups of 100 MB, got %d of %d MB", config.AuditFileMaxBackups, config.AuditFileMaxSize)
+	}
+
+	os.Setenv("AUDIT_SINK", "FILE")
+	os.Setenv("AUDIT_FILE", "/var/log/dispatcher/audit.jsonl")
+	os.Setenv("AUDIT_FILE_MAX_SIZE_MB", "10")
+	os.Setenv("AUDIT_FILE_MAX_BACKUPS", "2")
+	os.Setenv("AUDIT_STREAM", "audit")
+	os.Setenv("AUDIT_STREAM_MAXLEN", "500")
+	defer os.Unsetenv("AUDIT_SINK")
+	defer os.Unsetenv("AUDIT_FILE")
+	defer os.Unsetenv("AUDIT_FILE_MAX_SIZE_MB")
+	defer os.Unsetenv("AUDIT_FILE_MAX_BACKUPS")
+	defer os.Unsetenv("AUDIT_STREAM")
+	defer os.Unsetenv("AUDIT_STREAM_MAXLEN")
+
+	config = loadConfig()
+
+	if config.AuditSink != auditSinkFile {
+		t.Errorf("Expected AuditSink to be 'file', got '%s'", config.AuditSink)
+	}
+	if config.AuditFile != "/var/log/dispatcher/audit.jsonl" {
+		t.Errorf("Expected AuditFile to be '/var/log/dispatcher/audit.jsonl', got '%s'", config.AuditFile)
+	}
+	if config.AuditFileMaxSize != 10 || config.AuditFileMaxBackups != 2 {
+		t.Errorf("Expected 2 backups of 10 MB, got %d of %d MB", config.AuditFileMaxBackups, config.AuditFileMaxSize)
+	}
+	if config.AuditStream != "audit" || config.AuditStreamMaxLen != 500 {
+		t.Errorf("Expected stream 'audit' of 500 entries, got '%s' of %d", config.AuditStream, config.AuditStreamMaxLen)
+	}
+}
+
+func TestValidateAuditConfig(t *testing.T) {
+	valid := []Config{
+		{},
+		{AuditSink: auditSinkStream, AuditStream: "audit", OutputMode: outputModeList},
+		{AuditSink: auditSinkFile, AuditFile: "audit.jsonl", AuditFileMaxSize: 1},
+	}
+	for _, config := range valid {
+		if err := validateAuditConfig(config); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", config, err)
+		}
+	}
+
+	invalid := []Config{
+		{AuditSink: "kafka"},
+		{AuditSink: auditSinkStream, AuditStream: "", OutputMode: outputModeList},
+		{AuditSink: auditSinkStream, AuditStream: "audit", InputMode: inputModeNATS, OutputMode: outputModeNATS},
+		{AuditSink: auditSinkFile, AuditFileMaxSize: 1},
+		{AuditSink: auditSinkFile, AuditFile: "audit.jsonl", AuditFileMaxSize: 0},
+		{AuditSink: auditSinkFile, AuditFile: "audit.jsonl", AuditFileMaxSize: 1, AuditFileMaxBackups: -1},
+	}
+	for _, config := range invalid {
+		if err := validateAuditConfig(config); err == nil {
+			t.Errorf("Expected %+v to be invalid, got nil", config)
+		}
+	}
+}
+
+func TestDispatch_Audit(t *testing.T) {
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, Config{PipelineQueueName: "pipeline"}, rules)
+	d.sink = &recordingSink{}
+	audit := &recordingAuditLog{}
+	d.auditLog = audit
+
+	ctx := context.Background()
+	for _, payload := range []string{
+		`{"ref":"refs/heads/main","after":"abc123","repository":{"full_name":"owner/repo"}}`,
+		`{"ref":"refs/heads/develop","after":"def456","repository":{"full_name":"owner/repo"}}`,
+		`{"action":"closed","pull_request":{"number":1},"repository":{"full_name":"owner/repo"}}`,
+	} {
+		if err := d.handleWebhookMessage(ctx, payload); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+
+	if len(audit.records) != 3 {
+		t.Fatalf("Expected 3 audit records, got %d", len(audit.records))
+	}
+
+	matched := audit.records[0]
+	if matched.Decision != auditMatched || matched.RuleID != "build" || matched.Outcome != outcomeDispatched {
+		t.Errorf("Expected a dispatched match of rule build, got %+v", matched)
+	}
+	if matched.SHA != "abc123" || matched.Ref != "refs/heads/main" || matched.EventID == "" || matched.Time.IsZero() {
+		t.Errorf("Expected the event details to be recorded, got %+v", matched)
+	}
+	if len(matched.JobIDs) != 1 {
+		t.Errorf("Expected the ID of the dispatched job, got %v", matched.JobIDs)
+	}
+
+	unmatched := audit.records[1]
+	if unmatched.Decision != auditUnmatched || unmatched.SHA != "def456" || !strings.Contains(unmatched.Reason, "no rule matches") {
+		t.Errorf("Expected an unmatched decision with its reason, got %+v", unmatched)
+	}
+
+	if ignored := audit.records[2]; ignored.Decision != auditIgnored || !strings.Contains(ignored.Reason, "'closed'") {
+		t.Errorf("Expected an ignored decision with its reason, got %+v", ignored)
+	}
+}
+
+func TestDispatch_AuditFailure(t *testing.T) {
+	config := Config{OutputMode: outputModeList, QueuePushCommand: queuePushRight, PipelineQueueName: "pipeline"}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	// Enqueueing to an unreachable Redis fails
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+	d := newDispatcher(rdb, config, rules)
+	audit := &recordingAuditLog{}
+	d.auditLog = audit
+
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+	if err := d.handleWebhookMessage(context.Background(), payload); err == nil {
+		t.Fatal("Expected enqueueing to fail, got nil")
+	}
+
+	if len(audit.records) != 1 {
+		t.Fatalf("Expected 1 audit record, got %d", len(audit.records))
+	}
+	if record := audit.records[0]; record.Decision != auditFailed || record.RuleID != "build" || record.Error == "" {
+		t.Errorf("Expected a failed decision of rule build with its error, got %+v", record)
+	}
+}
+
+// readAuditFile returns the records of the JSON lines file
+func readAuditFile(t *testing.T, path string) []auditRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit file: %v", err)
+	}
+	defer file.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Failed to decode audit record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditFile_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	record := auditRecord{EventID: "1", Repo: "owner/repo", Ref: "refs/heads/main", Decision: auditUnmatched}
+	encoded, _ := json.Marshal(record)
+
+	// Two records fit in a file
+	audit, err := openAuditFile(path, int64(2*(len(encoded)+1)), 2, nil)
+	if err != nil {
+		t.Fatalf("Failed to open audit file: %v", err)
+	}
+	defer audit.close()
+
+	ctx := context.Background()
+	for i := 0; i < 7; i++ {
+		if err := audit.write(ctx, record); err != nil {
+			t.Fatalf("Failed to write audit record: %v", err)
+		}
+	}
+
+	// 7 records: 1 in the current file, 2 in each of the 2 backups, and the
+	// oldest 2 removed
+	for name, want := range map[string]int{path: 1, path + ".1": 2, path + ".2": 2} {
+		if got := len(readAuditFile(t, name)); got != want {
+			t.Errorf("Expected %d record(s) in %s, got %d", want, filepath.Base(name), got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected no third backup, got %v", err)
+	}
+}
+
+func TestAuditFile_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		audit, err := openAuditFile(path, 1<<20, 1, nil)
+		if err != nil {
+			t.Fatalf("Failed to open audit file: %v", err)
+		}
+		if err := audit.write(ctx, auditRecord{Decision: auditMatched}); err != nil {
+			t.Fatalf("Failed to write audit record: %v", err)
+		}
+		audit.close()
+	}
+
+	// Records are appended after a restart
+	if got := len(readAuditFile(t, path)); got != 2 {
+		t.Errorf("Expected 2 records, got %d", got)
+	}
+}
+
+func TestAuditStream_Integration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	stream := "test-audit-stream"
+	rdb.Del(ctx, stream)
+	defer rdb.Del(ctx, stream)
+
+	audit := &auditStream{rdb: rdb, stream: stream, maxLen: 100}
+	if err := audit.write(ctx, auditRecord{EventID: "1", Decision: auditMatched, RuleID: "build"}); err != nil {
+		t.Fatalf("Failed to write audit record: %v", err)
+	}
+
+	entries, err := rdb.XRange(ctx, stream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Failed to read audit stream: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(entries))
+	}
+	var record auditRecord
+	if err := json.Unmarshal([]byte(entries[0].Values[auditStreamField].(string)), &record); err != nil {
+		t.Fatalf("Failed to decode audit record: %v", err)
+	}
+	if record.RuleID != "build" || record.Decision != auditMatched {
+		t.Errorf("Expected the matched decision of rule build, got %+v", record)
+	}
+}
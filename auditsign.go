@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// auditSignatureField ends every signed audit record, followed by the
+// signature and the closing brace
+const auditSignatureField = `,"signature":"sha256=`
+
+// minAuditHMACKeyLength is the minimum length of AUDIT_HMAC_KEY
+const minAuditHMACKeyLength = 32
+
+// auditVerifyBatch is the number of audit stream entries read at a time
+const auditVerifyBatch = 1000
+
+var (
+	errUnsignedAuditRecord   = errors.New("record is not signed")
+	errInvalidAuditSignature = errors.New("signature does not match")
+)
+
+// auditSigner signs audit records with the HMAC-SHA256 of AUDIT_HMAC_KEY, so
+// records changed after they were written can be told apart. The signature
+// covers the exact bytes of the record before its signature field, which
+// comes last. Records are chained: each carries the ID of the writer's chain,
+// its sequence number in the chain and the signature of the record before it,
+// so removed records can be told apart too.
+type auditSigner struct {
+	key   []byte
+	keyID string
+
+	// mu serializes the records, so that they are written in the order of
+	// their sequence numbers
+	mu    sync.Mutex
+	chain string
+	seq   uint64
+	prev  string
+}
+
+// newAuditSigner returns the signer of AUDIT_HMAC_KEY starting a new chain,
+// or nil if it is not set
+func newAuditSigner(config Config) *auditSigner {
+	if config.AuditHMACKey == "" {
+		return nil
+	}
+	return &auditSigner{key: []byte(config.AuditHMACKey), keyID: config.AuditHMACKeyID, chain: newUUID()}
+}
+
+// resume continues the chain of the last record of the audit log, if it is
+// signed and chained
+func (s *auditSigner) resume(entry []byte) {
+	if s == nil {
+		return
+	}
+	record, signature, ok := splitAuditSignature(entry)
+	if !ok {
+		return
+	}
+	var link auditLink
+	if err := json.Unmarshal(record, &link); err != nil || link.Chain == "" || link.Seq == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chain, s.seq, s.prev = link.Chain, link.Seq, "sha256="+string(signature)
+}
+
+// write encodes the record, signed and chained if the signer is not nil, and
+// passes it to write. The chain only moves on once the record is written.
+func (s *auditSigner) write(record auditRecord, write func(encoded []byte) error) error {
+	if s == nil {
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit record: %w", err)
+		}
+		return write(encoded)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record.KeyID, record.Chain, record.Seq, record.Prev = s.keyID, s.chain, s.seq+1, s.prev
+	encoded, signature, err := s.encode(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	if err := write(encoded); err != nil {
+		return err
+	}
+	s.seq, s.prev = record.Seq, "sha256="+signature
+	return nil
+}
+
+// encode returns the JSON of the record with its signature, and the hex
+// signature
+func (s *auditSigner) encode(record auditRecord) ([]byte, string, error) {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return nil, "", err
+	}
+	signature := auditSignature(s.key, encoded)
+	signed := append(encoded[:len(encoded)-1:len(encoded)-1], auditSignatureField...)
+	signed = append(signed, signature...)
+	return append(signed, `"}`...), signature, nil
+}
+
+// auditSignature returns the hex HMAC-SHA256 of the record without its
+// signature
+func auditSignature(key, record []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(record)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// splitAuditSignature returns the record as it was signed and the hex
+// signature of an entry of the audit log, or false if it is not signed
+func splitAuditSignature(entry []byte) ([]byte, []byte, bool) {
+	entry = bytes.TrimSpace(entry)
+	i := bytes.LastIndex(entry, []byte(auditSignatureField))
+	if i < 0 || !bytes.HasSuffix(entry, []byte(`"}`)) {
+		return nil, nil, false
+	}
+	return append(entry[:i:i], '}'), entry[i+len(auditSignatureField) : len(entry)-2], true
+}
+
+// verifyAuditRecord checks the signature of a record as written to the
+// audit log
+func verifyAuditRecord(key, entry []byte) error {
+	record, signature, ok := splitAuditSignature(entry)
+	if !ok {
+		return errUnsignedAuditRecord
+	}
+	if !hmac.Equal(signature, []byte(auditSignature(key, record))) {
+		return errInvalidAuditSignature
+	}
+	return nil
+}
+
+// auditLink is the position of a record in its chain
+type auditLink struct {
+	Chain string `json:"chain"`
+	Seq   uint64 `json:"seq"`
+	Prev  string `json:"prev"`
+}
+
+// auditChains follows the chains of the records of an audit log, in the
+// order they were written
+type auditChains map[string]auditLink
+
+// follow checks that a signed record follows the record before it in its
+// chain, and returns the gap otherwise. The first record of a chain in the
+// log is not checked, as the log may have been trimmed or rotated.
+func (c auditChains) follow(entry []byte) string {
+	record, signature, ok := splitAuditSignature(entry)
+	if !ok {
+		return ""
+	}
+	var link auditLink
+	if err := json.Unmarshal(record, &link); err != nil || link.Chain == "" || link.Seq == 0 {
+		return ""
+	}
+	last, seen := c[link.Chain]
+	c[link.Chain] = auditLink{Chain: link.Chain, Seq: link.Seq, Prev: "sha256=" + string(signature)}
+	switch {
+	case !seen:
+		return ""
+	case link.Seq > last.Seq+1:
+		return fmt.Sprintf("%d record(s) of chain %s missing before seq %d", link.Seq-last.Seq-1, link.Chain, link.Seq)
+	case link.Seq <= last.Seq:
+		return fmt.Sprintf("seq %d of chain %s follows seq %d", link.Seq, link.Chain, last.Seq)
+	case link.Prev != last.Prev:
+		return fmt.Sprintf("seq %d of chain %s does not follow the record before it", link.Seq, link.Chain)
+	}
+	return ""
+}
+
+// auditVerification counts the records checked by verifyAuditLog
+type auditVerification struct {
+	valid    int
+	invalid  int
+	unsigned int
+	gaps     int
+}
+
+// verifyAuditLog checks the signature of every record of the audit log given
+// by --verify-audit, file:PATH, stdin or stream, and that no record is
+// missing from its chain, and reports the records that fail verification to w
+func verifyAuditLog(ctx context.Context, rdb redis.UniversalClient, config Config, w io.Writer) (auditVerification, error) {
+	var result auditVerification
+	chains := auditChains{}
+	check := func(where string, entry []byte) {
+		if gap := chains.follow(entry); gap != "" {
+			result.gaps++
+			fmt.Fprintf(w, "%s: %s\n", where, gap)
+		}
+		switch err := verifyAuditRecord([]byte(config.AuditHMACKey), entry); {
+		case err == nil:
+			result.valid++
+		case errors.Is(err, errUnsignedAuditRecord):
+			result.unsigned++
+			fmt.Fprintf(w, "%s: %v\n", where, err)
+		default:
+			result.invalid++
+			fmt.Fprintf(w, "%s: %v\n", where, err)
+		}
+	}
+
+	if config.AuditVerify == auditSinkStream {
+		start := "-"
+		for {
+			entries, err := rdb.XRangeN(ctx, config.AuditStream, start, "+", auditVerifyBatch).Result()
+			if err != nil {
+				return result, fmt.Errorf("failed to read audit stream '%s': %w", config.AuditStream, err)
+			}
+			for _, entry := range entries {
+				record, _ := entry.Values[auditStreamField].(string)
+				check("entry "+entry.ID, []byte(record))
+			}
+			if len(entries) < auditVerifyBatch {
+				return result, nil
+			}
+			start = "(" + entries[len(entries)-1].ID
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if path, ok := strings.CutPrefix(config.AuditVerify, inputModeFile+":"); ok {
+		f, err := os.Open(path)
+		if err != nil {
+			return result, fmt.Errorf("failed to open audit file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		check(fmt.Sprintf("line %d", line), scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("failed to read audit records: %w", err)
+	}
+	return result, nil
+}
+
+// runAuditVerification verifies the audit log given by --verify-audit and
+// fails if any record is unsigned or does not match its signature
+func runAuditVerification(config Config, w io.Writer) error {
+	ctx := context.Background()
+	var rdb redis.UniversalClient
+	if config.AuditVerify == auditSinkStream {
+		var err error
+		if rdb, err = newRedisClient(config); err != nil {
+			return fmt.Errorf("failed to create Redis client: %w", err)
+		}
+		defer rdb.Close()
+	}
+
+	result, err := verifyAuditLog(ctx, rdb, config, w)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d valid, %d invalid, %d unsigned audit records, %d gap(s)\n", result.valid, result.invalid, result.unsigned, result.gaps)
+	if result.invalid > 0 || result.unsigned > 0 {
+		return fmt.Errorf("%d of %d audit records failed verification", result.invalid+result.unsigned, result.valid+result.invalid+result.unsigned)
+	}
+	if result.gaps > 0 {
+		return fmt.Errorf("%d gap(s) in the audit records", result.gaps)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const testAuditHMACKey = "0123456789abcdef0123456789abcdef"
+
+func TestLoadConfig_AuditHMAC(t *testing.T) {
+	config := loadConfig()
+
+	if config.AuditHMACKey != "" || config.AuditHMACKeyID != "" {
+		t.Errorf("Expected unsigned audit records, got key ID '%s'", config.AuditHMACKeyID)
+	}
+
+	os.Setenv("AUDIT_HMAC_KEY", testAuditHMACKey)
+	os.Setenv("AUDIT_HMAC_KEY_ID", "2026-10")
+	defer os.Unsetenv("AUDIT_HMAC_KEY")
+	defer os.Unsetenv("AUDIT_HMAC_KEY_ID")
+
+	config = loadConfig()
+	if config.AuditHMACKey != testAuditHMACKey {
+		t.Errorf("Expected AuditHMACKey to be set, got '%s'", config.AuditHMACKey)
+	}
+	if config.AuditHMACKeyID != "2026-10" {
+		t.Errorf("Expected AuditHMACKeyID to be '2026-10', got '%s'", config.AuditHMACKeyID)
+	}
+	if err := validateAuditConfig(config); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+}
+
+func TestValidateAuditConfig_HMAC(t *testing.T) {
+	for name, config := range map[string]Config{
+		"short key":          {AuditHMACKey: "secret"},
+		"key ID without key": {AuditHMACKeyID: "2026-10"},
+	} {
+		if err := validateAuditConfig(config); err == nil {
+			t.Errorf("Expected error for %s, got nil", name)
+		}
+	}
+}
+
+func TestAuditSigner(t *testing.T) {
+	signer := newAuditSigner(Config{AuditHMACKey: testAuditHMACKey, AuditHMACKeyID: "2026-10"})
+	var entries [][]byte
+	for _, id := range []string{"1", "2"} {
+		err := signer.write(auditRecord{EventID: id, Repo: "owner/repo", Decision: auditMatched, RuleID: "build"}, func(encoded []byte) error {
+			entries = append(entries, encoded)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to sign audit record: %v", err)
+		}
+	}
+	encoded := entries[0]
+	if !strings.Contains(string(encoded), `"key_id":"2026-10"`) {
+		t.Errorf("Expected the key ID in the record, got %s", encoded)
+	}
+	if err := verifyAuditRecord([]byte(testAuditHMACKey), encoded); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+
+	// The second record follows the first in the chain of the signer
+	var first, second auditRecord
+	json.Unmarshal(entries[0], &first)
+	json.Unmarshal(entries[1], &second)
+	if first.Chain == "" || second.Chain != first.Chain || first.Seq != 1 || second.Seq != 2 || first.Prev != "" {
+		t.Errorf("Expected seq 1 and 2 of one chain, got %+v and %+v", first, second)
+	}
+	_, signature, _ := splitAuditSignature(entries[0])
+	if second.Prev != "sha256="+string(signature) {
+		t.Errorf("Expected the signature of the first record as prev, got '%s'", second.Prev)
+	}
+
+	tampered := bytes.Replace(encoded, []byte(auditMatched), []byte(auditIgnored), 1)
+	if err := verifyAuditRecord([]byte(testAuditHMACKey), tampered); err != errInvalidAuditSignature {
+		t.Errorf("Expected an invalid signature for a changed record, got %v", err)
+	}
+	if err := verifyAuditRecord([]byte(strings.ToUpper(testAuditHMACKey)), encoded); err != errInvalidAuditSignature {
+		t.Errorf("Expected an invalid signature with another key, got %v", err)
+	}
+
+	unsigned, _ := json.Marshal(auditRecord{EventID: "1"})
+	if err := verifyAuditRecord([]byte(testAuditHMACKey), unsigned); err != errUnsignedAuditRecord {
+		t.Errorf("Expected an unsigned record, got %v", err)
+	}
+
+	// A record that fails to be written does not move the chain on
+	signer.write(auditRecord{EventID: "3"}, func([]byte) error { return errors.New("disk full") })
+	signer.write(auditRecord{EventID: "3"}, func(encoded []byte) error {
+		entries = append(entries, encoded)
+		return nil
+	})
+	chains := auditChains{}
+	for i, entry := range entries {
+		if gap := chains.follow(entry); gap != "" {
+			t.Errorf("Expected record %d to follow the one before it, got %s", i+1, gap)
+		}
+	}
+}
+
+func TestAuditChains(t *testing.T) {
+	signer := newAuditSigner(Config{AuditHMACKey: testAuditHMACKey})
+	other := newAuditSigner(Config{AuditHMACKey: testAuditHMACKey})
+	var entries [][]byte
+	collect := func(encoded []byte) error {
+		entries = append(entries, encoded)
+		return nil
+	}
+	for i := 0; i < 5; i++ {
+		signer.write(auditRecord{EventID: "1"}, collect)
+		// The chains of replicas are interleaved
+		other.write(auditRecord{EventID: "2"}, collect)
+	}
+
+	follow := func(entries ...[]byte) []string {
+		var gaps []string
+		chains := auditChains{}
+		for _, entry := range entries {
+			if gap := chains.follow(entry); gap != "" {
+				gaps = append(gaps, gap)
+			}
+		}
+		return gaps
+	}
+	if gaps := follow(entries...); gaps != nil {
+		t.Errorf("Expected no gaps, got %v", gaps)
+	}
+	// The log may be trimmed
+	if gaps := follow(entries[4:]...); gaps != nil {
+		t.Errorf("Expected no gaps in a trimmed log, got %v", gaps)
+	}
+
+	// Seq 2 and 3 of the first chain removed
+	gaps := follow(entries[0], entries[1], entries[3], entries[5], entries[6], entries[7], entries[8])
+	if len(gaps) != 1 || !strings.HasPrefix(gaps[0], "2 record(s) of chain "+signer.chain+" missing before seq 4") {
+		t.Errorf("Expected 2 missing records, got %v", gaps)
+	}
+
+	// Records swapped
+	if gaps := follow(entries[0], entries[4], entries[2]); len(gaps) != 2 {
+		t.Errorf("Expected 2 gaps for swapped records, got %v", gaps)
+	}
+
+	// A record replaced with one of the same seq from another log
+	forged := newAuditSigner(Config{AuditHMACKey: testAuditHMACKey})
+	forged.chain, forged.seq, forged.prev = signer.chain, 1, "sha256=forged"
+	forged.write(auditRecord{EventID: "forged"}, collect)
+	gaps = follow(entries[0], entries[len(entries)-1])
+	if len(gaps) != 1 || !strings.Contains(gaps[0], "does not follow the record before it") {
+		t.Errorf("Expected a record not following the one before it, got %v", gaps)
+	}
+}
+
+func TestVerifyAuditLog_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	config := Config{AuditHMACKey: testAuditHMACKey, AuditVerify: "file:" + path}
+	ctx := context.Background()
+	// The chain is continued after a restart
+	for _, ids := range [][]string{{"1", "2"}, {"3", "4"}} {
+		audit, err := openAuditFile(path, 1<<20, 1, newAuditSigner(config))
+		if err != nil {
+			t.Fatalf("Failed to open audit file: %v", err)
+		}
+		for _, id := range ids {
+			if err := audit.write(ctx, auditRecord{EventID: id, Decision: auditMatched}); err != nil {
+				t.Fatalf("Failed to write audit record: %v", err)
+			}
+		}
+		audit.close()
+	}
+	records := readAuditFile(t, path)
+	if records[3].Seq != 4 || records[3].Chain != records[0].Chain {
+		t.Errorf("Expected seq 4 of the first chain, got %+v", records[3])
+	}
+
+	var out bytes.Buffer
+	result, err := verifyAuditLog(ctx, nil, config, &out)
+	if err != nil || result != (auditVerification{valid: 4}) {
+		t.Fatalf("Expected 4 valid records, got %+v (%v): %s", result, err, out.String())
+	}
+
+	contents, _ := os.ReadFile(path)
+	lines := bytes.SplitAfter(contents, []byte("\n"))
+	lines[1] = bytes.Replace(lines[1], []byte(`"event_id":"2"`), []byte(`"event_id":"5"`), 1)
+	// The third record removed
+	contents = bytes.Join([][]byte{lines[0], lines[1], lines[3], []byte(`{"event_id":"6"}` + "\n")}, nil)
+	os.WriteFile(path, contents, 0o600)
+
+	out.Reset()
+	result, err = verifyAuditLog(ctx, nil, config, &out)
+	if err != nil || result != (auditVerification{valid: 2, invalid: 1, unsigned: 1, gaps: 1}) {
+		t.Fatalf("Expected 1 invalid and 1 unsigned record and 1 gap, got %+v (%v)", result, err)
+	}
+	if !strings.Contains(out.String(), "line 2: "+errInvalidAuditSignature.Error()) {
+		t.Errorf("Expected line 2 to be reported, got %s", out.String())
+	}
+	if !strings.Contains(out.String(), "line 3: 1 record(s) of chain") {
+		t.Errorf("Expected the gap before line 3 to be reported, got %s", out.String())
+	}
+	if err := runAuditVerification(config, &out); err == nil {
+		t.Error("Expected verification to fail, got nil")
+	}
+
+	// Gaps alone fail the verification
+	os.WriteFile(path, bytes.Join([][]byte{lines[0], lines[3]}, nil), 0o600)
+	out.Reset()
+	if err := runAuditVerification(config, &out); err == nil || !strings.Contains(err.Error(), "1 gap(s)") {
+		t.Errorf("Expected verification to fail for the gap, got %v: %s", err, out.String())
+	}
+}
+
+func TestParseFlags_VerifyAudit(t *testing.T) {
+	config := Config{AuditHMACKey: testAuditHMACKey}
+	if _, err := parseFlags(&config, []string{"--verify-audit", "stream"}); err != nil || config.AuditVerify != auditSinkStream {
+		t.Errorf("Expected the audit stream to be verified, got '%s' (%v)", config.AuditVerify, err)
+	}
+	if _, err := parseFlags(&Config{AuditHMACKey: testAuditHMACKey}, []string{"--verify-audit", "redis"}); err == nil {
+		t.Error("Expected error for an invalid audit log, got nil")
+	}
+	if _, err := parseFlags(&Config{}, []string{"--verify-audit", "stdin"}); err == nil {
+		t.Error("Expected error without AUDIT_HMAC_KEY, got nil")
+	}
+}
+
+func TestVerifyAuditLog_StreamIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	stream := "test-audit-signed-stream"
+	rdb.Del(ctx, stream)
+	defer rdb.Del(ctx, stream)
+
+	config := Config{AuditHMACKey: testAuditHMACKey, AuditStream: stream, AuditVerify: auditSinkStream}
+	audit := &auditStream{rdb: rdb, stream: stream, signer: newAuditSigner(config)}
+	for _, id := range []string{"1", "2"} {
+		if err := audit.write(ctx, auditRecord{EventID: id, Decision: auditMatched}); err != nil {
+			t.Fatalf("Failed to write audit record: %v", err)
+		}
+	}
+	rdb.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: map[string]interface{}{auditStreamField: `{"event_id":"3"}`}})
+
+	var out bytes.Buffer
+	result, err := verifyAuditLog(ctx, rdb, config, &out)
+	if err != nil || result != (auditVerification{valid: 2, unsigned: 1}) {
+		t.Errorf("Expected 2 valid and 1 unsigned record, got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// URI schemes of the settings read from AWS
+const (
+	awsSecretsManagerScheme = "aws-sm://"
+	awsParameterStoreScheme = "aws-ssm://"
+)
+
+// awsClient reads secrets from AWS Secrets Manager and SSM Parameter Store
+type awsClient struct {
+	secretsManager *secretsmanager.Client
+	ssm            *ssm.Client
+}
+
+// isAWSReference reports whether a setting refers to a secret in AWS
+func isAWSReference(value string) bool {
+	return strings.HasPrefix(value, awsSecretsManagerScheme) || strings.HasPrefix(value, awsParameterStoreScheme)
+}
+
+// resolveAWSReferences replaces every environment variable whose value is
+// an aws-sm:// or aws-ssm:// URI with the value it refers to, so it is
+// picked up by the configuration and the ${NAME} references of the rules.
+// It returns the number of variables replaced.
+func resolveAWSReferences(ctx context.Context, config Config) (int, error) {
+	references := map[string]string{}
+	for _, env := range os.Environ() {
+		if name, value, ok := strings.Cut(env, "="); ok && isAWSReference(value) {
+			references[name] = value
+		}
+	}
+	if len(references) == 0 {
+		return 0, nil
+	}
+
+	if config.AWSSecretsTimeout <= 0 {
+		return 0, fmt.Errorf("AWS_SECRETS_TIMEOUT must be positive, got %s", config.AWSSecretsTimeout)
+	}
+	// The SDK looks for credentials in the environment, a web identity (EKS
+	// IAM roles for service accounts), the shared configuration files, the
+	// container credentials (ECS task roles, EKS Pod Identity) and the
+	// instance profile, and honours AWS_ENDPOINT_URL
+	options := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(config.AWSSecretsTimeout)),
+	}
+	if config.AWSRegion != "" {
+		options = append(options, awsconfig.WithRegion(config.AWSRegion))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load the AWS configuration: %w", err)
+	}
+	client := &awsClient{secretsManager: secretsmanager.NewFromConfig(cfg), ssm: ssm.NewFromConfig(cfg)}
+
+	resolved := map[string]string{}
+	for name, reference := range references {
+		value, ok := resolved[reference]
+		if !ok {
+			if value, err = client.resolve(ctx, reference); err != nil {
+				return 0, fmt.Errorf("failed to resolve %s: %w", name, err)
+			}
+			resolved[reference] = value
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return 0, fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+	logInfo("Resolved %d setting(s) from AWS", len(references))
+	return len(references), nil
+}
+
+// resolve reads the secret a reference refers to: aws-sm://<name or ARN>,
+// optionally followed by #<key> to read one key of a JSON secret, or
+// aws-ssm://<parameter name>
+func (a *awsClient) resolve(ctx context.Context, reference string) (string, error) {
+	if name, ok := strings.CutPrefix(reference, awsParameterStoreScheme); ok {
+		return a.getParameter(ctx, name)
+	}
+
+	id, key, hasKey := strings.Cut(strings.TrimPrefix(reference, awsSecretsManagerScheme), "#")
+	secret, err := a.getSecretValue(ctx, id)
+	if err != nil || !hasKey {
+		return secret, err
+	}
+	var values map[string]any
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		return "", fmt.Errorf("secret '%s' is not a JSON object: %w", id, err)
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("secret '%s' has no key '%s'", id, key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+func (a *awsClient) getSecretValue(ctx context.Context, id string) (string, error) {
+	// The region of an ARN, arn:aws:secretsmanager:<region>:..., wins
+	var options []func(*secretsmanager.Options)
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		options = append(options, func(o *secretsmanager.Options) { o.Region = parts[3] })
+	} else if a.secretsManager.Options().Region == "" {
+		return "", errors.New("AWS_REGION is required")
+	}
+	out, err := a.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)}, options...)
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("secret '%s' is binary", id)
+	}
+	return *out.SecretString, nil
+}
+
+func (a *awsClient) getParameter(ctx context.Context, name string) (string, error) {
+	if a.ssm.Options().Region == "" {
+		return "", errors.New("AWS_REGION is required")
+	}
+	out, err := a.ssm.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(name), WithDecryption: aws.Bool(true)})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
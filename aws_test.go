@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAWS serves Secrets Manager and Parameter Store for requests signed by
+// the access key "AKID", and instance profile credentials through IMDSv2
+func fakeAWS(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", r.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds"))
+			w.Write([]byte("imds-token"))
+			return
+		case "/latest/meta-data/iam/security-credentials/":
+			if r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("dispatcher-role"))
+			return
+		case "/latest/meta-data/iam/security-credentials/dispatcher-role":
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"AKID","SecretAccessKey":"secret","Token":"session","Expiration":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`))
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/latest/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, `{"__type":"UnrecognizedClientException"}`, http.StatusBadRequest)
+			return
+		}
+		var input map[string]any
+		json.NewDecoder(r.Body).Decode(&input)
+		switch r.Header.Get("X-Amz-Target") {
+		case "secretsmanager.GetSecretValue":
+			switch input["SecretId"] {
+			case "dispatcher/webhook":
+				w.Write([]byte(`{"SecretString":"webhook"}`))
+			case "arn:aws:secretsmanager:eu-west-1:123456789012:secret:dispatcher":
+				w.Write([]byte(`{"SecretString":"{\"github_token\":\"ghp_token\"}"}`))
+			default:
+				http.Error(w, `{"__type":"ResourceNotFoundException"}`, http.StatusBadRequest)
+			}
+		case "AmazonSSM.GetParameter":
+			if input["Name"] != "/dispatcher/redis" || input["WithDecryption"] != true {
+				http.Error(w, `{"__type":"ParameterNotFound"}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"Parameter":{"Name":"/dispatcher/redis","Value":"hunter2"}}`))
+		default:
+			http.Error(w, `{"__type":"UnknownOperationException"}`, http.StatusBadRequest)
+		}
+	}))
+}
+
+func TestLoadConfig_AWSSecrets(t *testing.T) {
+	config := loadConfig()
+
+	if config.AWSRegion != "" {
+		t.Errorf("Expected AWSRegion to be empty, got '%s'", config.AWSRegion)
+	}
+	if config.AWSSecretsTimeout != 10*time.Second {
+		t.Errorf("Expected AWSSecretsTimeout to be 10s, got %s", config.AWSSecretsTimeout)
+	}
+
+	os.Setenv("AWS_DEFAULT_REGION", "us-east-1")
+	defer os.Unsetenv("AWS_DEFAULT_REGION")
+	if config = loadConfig(); config.AWSRegion != "us-east-1" {
+		t.Errorf("Expected AWSRegion to fall back to AWS_DEFAULT_REGION, got '%s'", config.AWSRegion)
+	}
+
+	os.Setenv("AWS_REGION", "eu-west-1")
+	os.Setenv("AWS_SECRETS_TIMEOUT", "5s")
+	defer os.Unsetenv("AWS_REGION")
+	defer os.Unsetenv("AWS_SECRETS_TIMEOUT")
+
+	config = loadConfig()
+	if config.AWSRegion != "eu-west-1" {
+		t.Errorf("Expected AWSRegion to be 'eu-west-1', got '%s'", config.AWSRegion)
+	}
+	if config.AWSSecretsTimeout != 5*time.Second {
+		t.Errorf("Expected AWSSecretsTimeout to be 5s, got %s", config.AWSSecretsTimeout)
+	}
+}
+
+func TestResolveAWSReferences(t *testing.T) {
+	server := fakeAWS(t)
+	defer server.Close()
+
+	for name, value := range map[string]string{
+		"AWS_ENDPOINT_URL":      server.URL,
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"TEST_AWS_REDIS":        "aws-ssm:///dispatcher/redis",
+		"TEST_AWS_WEBHOOK":      "aws-sm://dispatcher/webhook",
+		"TEST_AWS_WEBHOOK_2":    "aws-sm://dispatcher/webhook",
+		"TEST_AWS_GITHUB":       "aws-sm://arn:aws:secretsmanager:eu-west-1:123456789012:secret:dispatcher#github_token",
+	} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	config := Config{AWSRegion: "us-east-1", AWSSecretsTimeout: time.Second}
+	resolved, err := resolveAWSReferences(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Failed to resolve references: %v", err)
+	}
+	if resolved != 4 {
+		t.Errorf("Expected 4 settings to be resolved, got %d", resolved)
+	}
+	for name, expected := range map[string]string{
+		"TEST_AWS_REDIS":     "hunter2",
+		"TEST_AWS_WEBHOOK":   "webhook",
+		"TEST_AWS_WEBHOOK_2": "webhook",
+		"TEST_AWS_GITHUB":    "ghp_token",
+	} {
+		if got := os.Getenv(name); got != expected {
+			t.Errorf("Expected %s to be '%s', got '%s'", name, expected, got)
+		}
+	}
+
+	// Nothing left to resolve
+	if resolved, err := resolveAWSReferences(context.Background(), config); err != nil || resolved != 0 {
+		t.Errorf("Expected nothing to resolve, got %d (%v)", resolved, err)
+	}
+
+	os.Setenv("TEST_AWS_MISSING", "aws-sm://dispatcher/missing#key")
+	defer os.Unsetenv("TEST_AWS_MISSING")
+	_, err = resolveAWSReferences(context.Background(), config)
+	if err == nil || !strings.Contains(err.Error(), "TEST_AWS_MISSING") {
+		t.Errorf("Expected error naming TEST_AWS_MISSING, got %v", err)
+	}
+}
+
+func TestResolveAWSReferences_Credentials(t *testing.T) {
+	server := fakeAWS(t)
+	defer server.Close()
+
+	dir := t.TempDir()
+	for name, value := range map[string]string{
+		"AWS_ENDPOINT_URL":            server.URL,
+		"AWS_CONFIG_FILE":             dir + "/config",
+		"AWS_SHARED_CREDENTIALS_FILE": dir + "/credentials",
+		"TEST_AWS_REDIS":              "aws-ssm:///dispatcher/redis",
+	} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	config := Config{AWSRegion: "us-east-1", AWSSecretsTimeout: time.Second}
+
+	// The instance profile, when nothing else is configured
+	os.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", server.URL)
+	defer os.Unsetenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if _, err := resolveAWSReferences(context.Background(), config); err != nil {
+		t.Fatalf("Failed to resolve with instance credentials: %v", err)
+	}
+	if got := os.Getenv("TEST_AWS_REDIS"); got != "hunter2" {
+		t.Errorf("Expected TEST_AWS_REDIS to be 'hunter2', got '%s'", got)
+	}
+
+	// Container credentials with an authorization token
+	requested := false
+	container := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "pod-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		requested = true
+		io.WriteString(w, `{"AccessKeyId":"AKID","SecretAccessKey":"container","Token":"session","Expiration":"`+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)+`"}`)
+	}))
+	defer container.Close()
+	tokenFile := dir + "/token"
+	os.WriteFile(tokenFile, []byte("pod-token"), 0o600)
+	os.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", container.URL+"/v1/credentials")
+	os.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", tokenFile)
+	defer os.Unsetenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	defer os.Unsetenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE")
+	os.Setenv("TEST_AWS_REDIS", "aws-ssm:///dispatcher/redis")
+	if _, err := resolveAWSReferences(context.Background(), config); err != nil {
+		t.Fatalf("Failed to resolve with container credentials: %v", err)
+	}
+	if !requested {
+		t.Error("Expected the container credentials to be used")
+	}
+
+	// Without a region
+	os.Setenv("TEST_AWS_REDIS", "aws-ssm:///dispatcher/redis")
+	if _, err := resolveAWSReferences(context.Background(), Config{AWSSecretsTimeout: time.Second}); err == nil || !strings.Contains(err.Error(), "AWS_REGION") {
+		t.Errorf("Expected error naming AWS_REGION, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var errBatcherStopped = errors.New("job batcher stopped")
+
+// pendingJobs are the jobs of one dispatch waiting in the batcher, with the
+// (rendered) config and queues they are written to
+type pendingJobs struct {
+	config   Config
+	queues   []string
+	priority int
+	jobs     [][]byte
+}
+
+// jobBatcher buffers dispatched jobs and writes them in one MULTI/EXEC
+// transaction once BATCH_SIZE jobs are buffered or BATCH_FLUSH_INTERVAL has
+// passed since the first buffered job, cutting round trips during bursts
+type jobBatcher struct {
+	rdb      redis.UniversalClient
+	size     int
+	interval time.Duration
+	retry    enqueueRetry
+	pending  chan pendingJobs
+	done     chan struct{}
+
+	// spill keeps the jobs of batches that fail to be pushed, when enabled
+	spill *spillBuffer
+
+	// deadLetters keeps the jobs of batches that fail to be pushed and
+	// spilled, when enabled
+	deadLetters *deadLetterQueue
+
+	// breaker stops pushing batches to a failing Redis, when enabled
+	breaker *circuitBreaker
+}
+
+func newJobBatcher(rdb redis.UniversalClient, config Config) *jobBatcher {
+	return &jobBatcher{
+		rdb:      rdb,
+		size:     config.BatchSize,
+		interval: config.BatchFlushInterval,
+		retry:    newEnqueueRetry(config),
+		pending:  make(chan pendingJobs, config.BatchSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// add buffers the jobs for the next flush. Backpressure is applied right
+// away, so dropped jobs are reported to the caller.
+func (b *jobBatcher) add(ctx context.Context, config Config, queues []string, priority int, jobs [][]byte) error {
+	targets, err := targetQueues(ctx, b.rdb, config, queues, len(jobs))
+	if err != nil {
+		return err
+	}
+
+	select {
+	case b.pending <- pendingJobs{config: config, queues: targets, priority: priority, jobs: jobs}:
+		return nil
+	case <-b.done:
+		return errBatcherStopped
+	}
+}
+
+// run flushes buffered jobs until the context is cancelled, then flushes the
+// jobs still buffered and stops
+func (b *jobBatcher) run(ctx context.Context) {
+	defer close(b.done)
+
+	timer := time.NewTimer(b.interval)
+	timer.Stop()
+
+	var batch []pendingJobs
+	count := 0
+	flush := func() {
+		timer.Stop()
+		b.flush(batch, count)
+		batch = nil
+		count = 0
+	}
+
+	for {
+		select {
+		case p := <-b.pending:
+			if len(batch) == 0 {
+				timer.Reset(b.interval)
+			}
+			batch = append(batch, p)
+			count += len(p.jobs)
+			if count >= b.size {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case p := <-b.pending:
+					batch = append(batch, p)
+					count += len(p.jobs)
+					continue
+				default:
+				}
+				break
+			}
+			flush()
+			return
+		}
+	}
+}
+
+// wait blocks until the batcher has flushed its last jobs after shutdown
+func (b *jobBatcher) wait() {
+	<-b.done
+}
+
+func (b *jobBatcher) flush(batch []pendingJobs, count int) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	// Jobs being retried are kept in the spill buffer until they were pushed,
+	// spilled or dead-lettered
+	release := func() {}
+	defer func() { release() }()
+	var track func()
+	if b.spill != nil {
+		track = func() {
+			var jobs []deferredJob
+			for _, p := range batch {
+				jobs = append(jobs, deferredJobs(p.config, p.queues, p.priority, p.jobs)...)
+			}
+			release = b.spill.track(jobs)
+		}
+	}
+	pushes := make([]map[string]*redis.IntCmd, len(batch))
+	push := func() error {
+		_, err := b.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, p := range batch {
+				pushes[i] = queueJobs(ctx, pipe, p.config, p.queues, p.priority, p.jobs)
+			}
+			return nil
+		})
+		return err
+	}
+	err := b.retry.do(ctx, func() error {
+		if b.breaker != nil {
+			return b.breaker.call(push)
+		}
+		return push()
+	}, track)
+	if err != nil {
+		logError("Failed to push batch of %d job(s): %v", count, err)
+		if b.spill != nil {
+			batch = b.spillBatch(batch)
+		}
+		if b.deadLetters != nil {
+			batch = b.deadLetterBatch(ctx, batch, err)
+		}
+		if lost := countJobs(batch); lost > 0 {
+			logError("Lost %d job(s) of the batch", lost)
+		}
+		return
+	}
+	for i, p := range batch {
+		countTrimmedJobs(p.config, pushes[i])
+	}
+	logDebug("Pushed batch of %d job(s) from %d dispatch(es)", count, len(batch))
+}
+
+// spillBatch stores the batch in the spill buffer and returns the jobs that
+// could not be spilled
+func (b *jobBatcher) spillBatch(batch []pendingJobs) []pendingJobs {
+	for i, p := range batch {
+		if err := b.spill.store(p.config, p.queues, p.priority, p.jobs); err != nil {
+			logError("Failed to spill %d job(s): %v", len(p.jobs), err)
+			return batch[i:]
+		}
+	}
+	logWarn("Spilled batch of %d job(s) to '%s'", countJobs(batch), b.spill.config.SpillPath)
+	return nil
+}
+
+// deadLetterBatch pushes the batch to the dead-letter queue and returns the
+// jobs that could not be dead-lettered
+func (b *jobBatcher) deadLetterBatch(ctx context.Context, batch []pendingJobs, cause error) []pendingJobs {
+	for i, p := range batch {
+		if err := b.deadLetters.add(ctx, p.config, "", p.queues, p.priority, p.jobs, cause); err != nil {
+			logError("Failed to dead-letter %d job(s): %v", len(p.jobs), err)
+			return batch[i:]
+		}
+	}
+	if count := countJobs(batch); count > 0 {
+		logError("Dead-lettered batch of %d job(s) to '%s': %v", count, b.deadLetters.key, cause)
+	}
+	return nil
+}
+
+func countJobs(batch []pendingJobs) int {
+	count := 0
+	for _, p := range batch {
+		count += len(p.jobs)
+	}
+	return count
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_Batch(t *testing.T) {
+	config := loadConfig()
+
+	if config.BatchSize != 1 {
+		t.Errorf("Expected BatchSize to be 1, got %d", config.BatchSize)
+	}
+	if config.BatchFlushInterval != 50*time.Millisecond {
+		t.Errorf("Expected BatchFlushInterval to be 50ms, got %s", config.BatchFlushInterval)
+	}
+	if newDispatcher(nil, config, nil).batcher != nil {
+		t.Error("Expected batching to be disabled by default")
+	}
+
+	os.Setenv("BATCH_SIZE", "100")
+	os.Setenv("BATCH_FLUSH_INTERVAL", "10ms")
+	defer os.Unsetenv("BATCH_SIZE")
+	defer os.Unsetenv("BATCH_FLUSH_INTERVAL")
+
+	config = loadConfig()
+
+	if config.BatchSize != 100 {
+		t.Errorf("Expected BatchSize to be 100, got %d", config.BatchSize)
+	}
+	if config.BatchFlushInterval != 10*time.Millisecond {
+		t.Errorf("Expected BatchFlushInterval to be 10ms, got %s", config.BatchFlushInterval)
+	}
+	if newDispatcher(nil, config, nil).batcher == nil {
+		t.Error("Expected batching to be enabled with BATCH_SIZE 100")
+	}
+}
+
+func TestJobBatcher_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:         outputModeList,
+		PipelineQueueName:  "test-pipeline-batch",
+		BatchSize:          2,
+		BatchFlushInterval: time.Hour,
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.PipelineQueueName)
+	defer rdb.Del(ctx, config.PipelineQueueName)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	batcher := newJobBatcher(rdb, config)
+	go batcher.run(runCtx)
+
+	if err := batcher.add(ctx, config, nil, 0, [][]byte{[]byte(`{"job_id":"1"}`)}); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	if err := batcher.add(ctx, config, nil, 0, [][]byte{[]byte(`{"job_id":"2"}`)}); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+
+	// The batch is full, so it is flushed without waiting for the interval
+	deadline := time.Now().Add(5 * time.Second)
+	for rdb.LLen(ctx, config.PipelineQueueName).Val() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if length := rdb.LLen(ctx, config.PipelineQueueName).Val(); length != 2 {
+		t.Fatalf("Expected 2 jobs after a full batch, got %d", length)
+	}
+
+	// Jobs still buffered on shutdown are flushed
+	if err := batcher.add(ctx, config, nil, 0, [][]byte{[]byte(`{"job_id":"3"}`)}); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	cancel()
+	batcher.wait()
+
+	queued := rdb.LRange(ctx, config.PipelineQueueName, 0, -1).Val()
+	if len(queued) != 3 || queued[2] != `{"job_id":"3"}` {
+		t.Errorf("Expected all 3 jobs in order after shutdown, got %v", queued)
+	}
+
+	if err := batcher.add(ctx, config, nil, 0, [][]byte{[]byte(`{"job_id":"4"}`)}); err != errBatcherStopped {
+		t.Errorf("Expected errBatcherStopped after shutdown, got %v", err)
+	}
+}
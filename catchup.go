@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// catchupDispatches counts the dispatches synthesized for branches that
+// moved while the dispatcher was down
+var catchupDispatches atomic.Int64
+
+// branchCatchup records the last commit handled for every branch of the
+// rules, and on startup asks the GitHub API for the current commit of each
+// branch, so pushes missed while the dispatcher was down are dispatched
+type branchCatchup struct {
+	rdb    redis.UniversalClient
+	client *http.Client
+	apiURL string
+	token  string
+	prefix string
+	// secrets holds GITHUB_TOKEN when it is read from a file
+	secrets *secretFiles
+}
+
+// githubBranch is the part of a GitHub API branch used for the catch-up
+type githubBranch struct {
+	Commit struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+func newBranchCatchup(rdb redis.UniversalClient, config Config) *branchCatchup {
+	return &branchCatchup{
+		rdb:     rdb,
+		client:  &http.Client{Timeout: config.CatchupTimeout},
+		apiURL:  strings.TrimSuffix(config.GitHubAPIURL, "/"),
+		token:   config.GitHubToken,
+		prefix:  config.CatchupKeyPrefix,
+		secrets: config.SecretFiles,
+	}
+}
+
+func validateCatchupConfig(config Config) error {
+	if !config.CatchupOnStartup {
+		return nil
+	}
+	if !usesRedis(config) {
+		return fmt.Errorf("CATCHUP_ON_STARTUP requires Redis, which is not used with INPUT_MODE %s and OUTPUT_MODE %s", config.InputMode, config.OutputMode)
+	}
+	if config.CatchupTimeout <= 0 {
+		return fmt.Errorf("CATCHUP_TIMEOUT must be positive, got %s", config.CatchupTimeout)
+	}
+	if u, err := url.Parse(config.GitHubAPIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("GITHUB_API_URL '%s' must be an absolute http or https URL", config.GitHubAPIURL)
+	}
+	return nil
+}
+
+func (c *branchCatchup) key(repo, ref string) string {
+	return c.prefix + repo + ":" + ref
+}
+
+// record remembers the commit of a branch push that was handled. Failing to
+// record it only risks dispatching the commit again on the next catch-up,
+// so it is logged.
+func (c *branchCatchup) record(ctx context.Context, event GitHubEvent) {
+	if event.Type() != eventTypePush || !strings.HasPrefix(event.Ref, branchRefPrefix) || event.After == "" {
+		return
+	}
+	key := c.key(event.Repository.FullName, event.Ref)
+	if err := c.rdb.Set(context.WithoutCancel(ctx), key, event.After, 0).Err(); err != nil {
+		logWarnContext(ctx, "Failed to record the last commit of '%s': %v", key, err)
+	}
+}
+
+// lastSHA returns the last commit handled for the branch, or an empty string
+// if none was recorded
+func (c *branchCatchup) lastSHA(ctx context.Context, repo, ref string) (string, error) {
+	sha, err := c.rdb.Get(ctx, c.key(repo, ref)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return sha, err
+}
+
+// latestSHA asks the GitHub API for the current commit of the branch
+func (c *branchCatchup) latestSHA(ctx context.Context, repo, branch string) (string, error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/branches/%s", c.apiURL, repo, url.PathEscape(branch))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", "github-dispatcher/"+version)
+	token := c.token
+	if value, ok := c.secrets.lookup("GITHUB_TOKEN"); ok {
+		token = value
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutboundResponseLog))
+		return "", fmt.Errorf("GitHub API returned %s: %s", resp.Status, body)
+	}
+
+	var result githubBranch
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode GitHub API response: %w", err)
+	}
+	if result.Commit.SHA == "" {
+		return "", errors.New("GitHub API response has no commit")
+	}
+	return result.Commit.SHA, nil
+}
+
+// catchUp dispatches a push of the current commit of every branch of the
+// rules handling pushes that moved since the last commit recorded for it.
+// The commits missed in between are collapsed into that one push. Branches
+// without a recorded commit only get their current commit recorded.
+func (d *Dispatcher) catchUp(ctx context.Context) {
+	type branch struct{ repo, ref string }
+	seen := map[branch]bool{}
+	dispatched, failed := 0, 0
+	for _, rule := range d.rules.Load().rules {
+		b := branch{rule.Repo, rule.Branch}
+		if seen[b] || !strings.HasPrefix(rule.Branch, branchRefPrefix) || !ruleHandlesEvent(&rule, eventTypePush) {
+			continue
+		}
+		seen[b] = true
+		if ctx.Err() != nil {
+			return
+		}
+
+		ok, err := d.catchUpBranch(ctx, b.repo, b.ref)
+		if err != nil {
+			failed++
+			logWarn("Catch-up of %s %s failed: %v", b.repo, b.ref, err)
+		} else if ok {
+			dispatched++
+		}
+	}
+	logInfo("Catch-up checked %d branch(es): %d dispatched, %d failed", len(seen), dispatched, failed)
+}
+
+// catchUpBranch dispatches the current commit of the branch if it is not the
+// last one handled, and reports whether it did
+func (d *Dispatcher) catchUpBranch(ctx context.Context, repo, ref string) (bool, error) {
+	latest, err := d.catchup.latestSHA(ctx, repo, strings.TrimPrefix(ref, branchRefPrefix))
+	if err != nil {
+		return false, err
+	}
+	last, err := d.catchup.lastSHA(ctx, repo, ref)
+	if err != nil {
+		return false, fmt.Errorf("failed to read the last commit: %w", err)
+	}
+
+	var event GitHubEvent
+	event.Ref, event.After, event.TypeHint = ref, latest, eventTypePush
+	event.Repository.FullName = repo
+	switch last {
+	case latest:
+		return false, nil
+	case "":
+		logInfo("Catch-up: no commit recorded for %s %s yet, starting from %s", repo, ref, latest)
+		d.catchup.record(ctx, event)
+		return false, nil
+	}
+
+	eventCtx := withEventID(ctx)
+	logInfoContext(eventCtx, "Catch-up: %s %s moved from %s to %s while the dispatcher was down, dispatching it", repo, ref, last, latest)
+	if _, _, err := d.dispatch(eventCtx, event); err != nil && !errors.Is(err, errJobsDropped) {
+		return false, err
+	}
+	catchupDispatches.Add(1)
+	return true, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeGitHubAPI serves the current commit of the branches, keyed by
+// "owner/repo/branch"
+func fakeGitHubAPI(t *testing.T, branches map[string]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		// /repos/{owner}/{repo}/branches/{branch}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if len(parts) != 5 || parts[0] != "repos" || parts[3] != "branches" {
+			http.NotFound(w, r)
+			return
+		}
+		owner, repo, branch := parts[1], parts[2], parts[4]
+		sha, ok := branches[owner+"/"+repo+"/"+branch]
+		if !ok {
+			http.Error(w, `{"message":"Branch not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"` + branch + `","commit":{"sha":"` + sha + `"}}`))
+	}))
+}
+
+func TestLoadConfig_Catchup(t *testing.T) {
+	config := loadConfig()
+
+	if config.CatchupOnStartup {
+		t.Error("Expected CatchupOnStartup to be false")
+	}
+	if config.CatchupKeyPrefix != "github-dispatcher:last-commit:" {
+		t.Errorf("Expected CatchupKeyPrefix to be 'github-dispatcher:last-commit:', got '%s'", config.CatchupKeyPrefix)
+	}
+	if config.CatchupTimeout != 10*time.Second {
+		t.Errorf("Expected CatchupTimeout to be 10s, got %s", config.CatchupTimeout)
+	}
+	if config.GitHubAPIURL != "https://api.github.com" {
+		t.Errorf("Expected GitHubAPIURL to be 'https://api.github.com', got '%s'", config.GitHubAPIURL)
+	}
+	if config.GitHubToken != "" {
+		t.Errorf("Expected GitHubToken to be empty, got '%s'", config.GitHubToken)
+	}
+
+	os.Setenv("CATCHUP_ON_STARTUP", "true")
+	os.Setenv("CATCHUP_KEY_PREFIX", "last-commit:")
+	os.Setenv("CATCHUP_TIMEOUT", "30s")
+	os.Setenv("GITHUB_API_URL", "https://github.example.com/api/v3")
+	os.Setenv("GITHUB_TOKEN", "token")
+	defer os.Unsetenv("CATCHUP_ON_STARTUP")
+	defer os.Unsetenv("CATCHUP_KEY_PREFIX")
+	defer os.Unsetenv("CATCHUP_TIMEOUT")
+	defer os.Unsetenv("GITHUB_API_URL")
+	defer os.Unsetenv("GITHUB_TOKEN")
+
+	config = loadConfig()
+	if !config.CatchupOnStartup {
+		t.Error("Expected CatchupOnStartup to be true")
+	}
+	if config.CatchupKeyPrefix != "last-commit:" {
+		t.Errorf("Expected CatchupKeyPrefix to be 'last-commit:', got '%s'", config.CatchupKeyPrefix)
+	}
+	if config.CatchupTimeout != 30*time.Second {
+		t.Errorf("Expected CatchupTimeout to be 30s, got %s", config.CatchupTimeout)
+	}
+	if config.GitHubAPIURL != "https://github.example.com/api/v3" {
+		t.Errorf("Expected GitHubAPIURL to be 'https://github.example.com/api/v3', got '%s'", config.GitHubAPIURL)
+	}
+	if config.GitHubToken != "token" {
+		t.Errorf("Expected GitHubToken to be 'token', got '%s'", config.GitHubToken)
+	}
+}
+
+func TestValidateCatchupConfig(t *testing.T) {
+	valid := Config{CatchupOnStartup: true, CatchupTimeout: time.Second, GitHubAPIURL: "https://api.github.com", InputMode: inputModeStream, OutputMode: outputModeList}
+	if err := validateCatchupConfig(valid); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+
+	invalid := valid
+	invalid.GitHubAPIURL = "api.github.com"
+	if err := validateCatchupConfig(invalid); err == nil {
+		t.Error("Expected error for a relative GITHUB_API_URL, got nil")
+	}
+	invalid = valid
+	invalid.CatchupTimeout = 0
+	if err := validateCatchupConfig(invalid); err == nil {
+		t.Error("Expected error for non-positive CATCHUP_TIMEOUT, got nil")
+	}
+	invalid = valid
+	invalid.InputMode, invalid.OutputMode = inputModeNATS, outputModeNATS
+	if err := validateCatchupConfig(invalid); err == nil {
+		t.Error("Expected error for the catch-up without Redis, got nil")
+	}
+}
+
+func TestBranchCatchup_LatestSHA(t *testing.T) {
+	server := fakeGitHubAPI(t, map[string]string{"owner/repo/main": "abc123"})
+	defer server.Close()
+
+	catchup := newBranchCatchup(nil, Config{GitHubAPIURL: server.URL + "/", GitHubToken: "token", CatchupTimeout: time.Second})
+	sha, err := catchup.latestSHA(context.Background(), "owner/repo", "main")
+	if err != nil {
+		t.Fatalf("Failed to get the latest commit: %v", err)
+	}
+	if sha != "abc123" {
+		t.Errorf("Expected 'abc123', got '%s'", sha)
+	}
+
+	if _, err := catchup.latestSHA(context.Background(), "owner/repo", "missing"); err == nil {
+		t.Error("Expected error for a missing branch, got nil")
+	}
+	catchup.token = "wrong"
+	if _, err := catchup.latestSHA(context.Background(), "owner/repo", "main"); err == nil {
+		t.Error("Expected error for bad credentials, got nil")
+	}
+}
+
+func TestCatchUp_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	branches := map[string]string{"owner/repo/main": "abc123", "owner/repo/develop": "def456"}
+	server := fakeGitHubAPI(t, branches)
+	defer server.Close()
+
+	config := Config{PipelineQueueName: "pipeline", CatchupOnStartup: true, CatchupKeyPrefix: "test-last-commit:", CatchupTimeout: time.Second, GitHubAPIURL: server.URL, GitHubToken: "token"}
+	mainKey, developKey := config.CatchupKeyPrefix+"owner/repo:refs/heads/main", config.CatchupKeyPrefix+"owner/repo:refs/heads/develop"
+
+	// Clean up before test
+	rdb.Del(ctx, mainKey, developKey)
+	defer rdb.Del(ctx, mainKey, developKey)
+
+	rules := []FilterRule{
+		{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}},
+		{ID: "test", Repo: "owner/repo", Branch: "refs/heads/develop", Commands: []Command{{Run: "make test"}}},
+	}
+	d := newDispatcher(rdb, config, rules)
+	sink := &recordingSink{}
+	d.sink = sink
+
+	// A dispatched push is recorded
+	if err := d.handleWebhookMessage(ctx, `{"ref":"refs/heads/main","after":"000000","repository":{"full_name":"owner/repo"}}`); err != nil {
+		t.Fatalf("Failed to handle webhook: %v", err)
+	}
+	if sha := rdb.Get(ctx, mainKey).Val(); sha != "000000" {
+		t.Fatalf("Expected the dispatched commit to be recorded, got '%s'", sha)
+	}
+
+	// main moved while the dispatcher was down; develop was never recorded
+	catchups := catchupDispatches.Load()
+	d.catchUp(ctx)
+	if len(sink.jobs) != 2 {
+		t.Errorf("Expected one catch-up dispatch for main, got %d job(s) in total", len(sink.jobs))
+	}
+	if got := catchupDispatches.Load() - catchups; got != 1 {
+		t.Errorf("Expected one catch-up dispatch to be counted, got %d", got)
+	}
+	if sha := rdb.Get(ctx, mainKey).Val(); sha != "abc123" {
+		t.Errorf("Expected the caught-up commit to be recorded, got '%s'", sha)
+	}
+	if sha := rdb.Get(ctx, developKey).Val(); sha != "def456" {
+		t.Errorf("Expected the current commit of develop to be recorded as the baseline, got '%s'", sha)
+	}
+
+	// Nothing moved since
+	d.catchUp(ctx)
+	if len(sink.jobs) != 2 {
+		t.Errorf("Expected no dispatch when nothing moved, got %d job(s) in total", len(sink.jobs))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// streamCheckpoint records the ID of the last stream message each consumer
+// acknowledged in the INPUT_STREAM_CHECKPOINT_KEY hash, keyed by consumer
+// name, so a consumer group that was lost (e.g. with the stream's Redis
+// data) is recreated where the dispatchers left off instead of at the end of
+// the stream
+type streamCheckpoint struct {
+	rdb      redis.UniversalClient
+	key      string
+	consumer string
+
+	mu   sync.Mutex
+	last string
+}
+
+func newStreamCheckpoint(rdb redis.UniversalClient, config Config) *streamCheckpoint {
+	if config.InputStreamCheckpointKey == "" {
+		return nil
+	}
+	return &streamCheckpoint{rdb: rdb, key: config.InputStreamCheckpointKey, consumer: config.InputStreamConsumer}
+}
+
+// load returns the latest checkpoint of all consumers and the consumer that
+// wrote it, or an empty ID when there is none
+func (c *streamCheckpoint) load(ctx context.Context) (id, consumer string, err error) {
+	checkpoints, err := c.rdb.HGetAll(ctx, c.key).Result()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read stream checkpoint '%s': %w", c.key, err)
+	}
+	for name, checkpoint := range checkpoints {
+		if _, _, ok := parseStreamID(checkpoint); !ok {
+			logWarn("Ignoring malformed checkpoint '%s' of consumer '%s' in '%s'", checkpoint, name, c.key)
+			continue
+		}
+		if id == "" || streamIDLess(id, checkpoint) {
+			id, consumer = checkpoint, name
+		}
+	}
+
+	c.mu.Lock()
+	c.last = checkpoints[c.consumer]
+	c.mu.Unlock()
+	return id, consumer, nil
+}
+
+// advance adds the update of the consumer's checkpoint to the pipeline when
+// the message is newer than the checkpoint. Messages claimed from other
+// consumers may be older.
+func (c *streamCheckpoint) advance(ctx context.Context, pipe redis.Pipeliner, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last != "" && !streamIDLess(c.last, id) {
+		return
+	}
+	c.last = id
+	pipe.HSet(ctx, c.key, c.consumer, id)
+}
+
+// parseStreamID splits a stream ID, "<milliseconds>-<sequence>"
+func parseStreamID(id string) (ms, seq uint64, ok bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err = strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
+
+// streamIDLess reports whether the stream ID a comes before b
+func streamIDLess(a, b string) bool {
+	aMS, aSeq, _ := parseStreamID(a)
+	bMS, bSeq, _ := parseStreamID(b)
+	if aMS != bMS {
+		return aMS < bMS
+	}
+	return aSeq < bSeq
+}
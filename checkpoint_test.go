@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_StreamCheckpoint(t *testing.T) {
+	config := loadConfig()
+
+	if config.InputStreamCheckpointKey != "" {
+		t.Errorf("Expected InputStreamCheckpointKey to be empty, got '%s'", config.InputStreamCheckpointKey)
+	}
+
+	os.Setenv("INPUT_STREAM_CHECKPOINT_KEY", "github-dispatcher:checkpoint")
+	defer os.Unsetenv("INPUT_STREAM_CHECKPOINT_KEY")
+
+	config = loadConfig()
+	if config.InputStreamCheckpointKey != "github-dispatcher:checkpoint" {
+		t.Errorf("Expected InputStreamCheckpointKey to be 'github-dispatcher:checkpoint', got '%s'", config.InputStreamCheckpointKey)
+	}
+}
+
+func TestStreamIDLess(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"1-0", "2-0", true},
+		{"2-0", "1-0", false},
+		{"1700000000000-1", "1700000000000-10", true},
+		{"1700000000000-10", "1700000000000-2", false},
+		{"1-0", "1-0", false},
+		{"999-5", "1000-0", true},
+	}
+	for _, tt := range tests {
+		if got := streamIDLess(tt.a, tt.b); got != tt.expected {
+			t.Errorf("streamIDLess(%s, %s) = %v, expected %v", tt.a, tt.b, got, tt.expected)
+		}
+	}
+
+	if _, _, ok := parseStreamID("not-an-id"); ok {
+		t.Error("Expected 'not-an-id' not to parse")
+	}
+}
+
+func TestStreamCheckpoint_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		InputStream:              "test-webhook-stream-checkpoint",
+		InputStreamGroup:         "test-dispatchers",
+		InputStreamConsumer:      "test-consumer",
+		InputStreamField:         "payload",
+		InputStreamClaimIdle:     time.Minute,
+		InputStreamMaxDeliveries: 5,
+		InputStreamCheckpointKey: "test-webhook-stream-checkpoint:checkpoint",
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.InputStream, config.InputStreamCheckpointKey)
+	defer rdb.Del(ctx, config.InputStream, config.InputStreamCheckpointKey)
+
+	add := func(payload string) string {
+		return rdb.XAdd(ctx, &redis.XAddArgs{Stream: config.InputStream, Values: map[string]interface{}{"payload": payload}}).Val()
+	}
+	consume := func(expected int) []string {
+		consumeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		var received []string
+		handle := func(ctx context.Context, payload string) error {
+			received = append(received, payload)
+			if len(received) == expected {
+				cancel()
+			}
+			return nil
+		}
+		if err := consumeStream(consumeCtx, rdb, config, handle); err != nil {
+			t.Fatalf("Failed to consume stream: %v", err)
+		}
+		return received
+	}
+
+	if err := rdb.XGroupCreateMkStream(ctx, config.InputStream, config.InputStreamGroup, "$").Err(); err != nil {
+		t.Fatalf("Failed to create consumer group: %v", err)
+	}
+	// A message delivered before a crash and never acknowledged is handled
+	// right away on restart
+	add("pending")
+	rdb.XReadGroup(ctx, &redis.XReadGroupArgs{Group: config.InputStreamGroup, Consumer: config.InputStreamConsumer, Streams: []string{config.InputStream, ">"}})
+	last := add("new")
+
+	if received := consume(2); len(received) != 2 || received[0] != "pending" || received[1] != "new" {
+		t.Fatalf("Expected the pending message to be resumed first, got %v", received)
+	}
+	if checkpoint := rdb.HGet(ctx, config.InputStreamCheckpointKey, config.InputStreamConsumer).Val(); checkpoint != last {
+		t.Errorf("Expected the checkpoint to be %s, got '%s'", last, checkpoint)
+	}
+
+	// A lost consumer group is recreated after the checkpoint
+	rdb.XGroupDestroy(ctx, config.InputStream, config.InputStreamGroup)
+	add("while-lost")
+	if received := consume(1); len(received) != 1 || received[0] != "while-lost" {
+		t.Errorf("Expected the message added after the checkpoint, got %v", received)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// States of the circuit breaker, as reported by the circuit_breaker_state
+// metric
+const (
+	circuitClosed int32 = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+var errCircuitOpen = errors.New("circuit breaker open, output not tried")
+
+var (
+	// circuitState is the state of the circuit breaker of the output
+	circuitState atomic.Int32
+	// circuitOpens counts the times the circuit breaker opened
+	circuitOpens atomic.Int64
+)
+
+// circuitBreaker stops pushing jobs to the output once CIRCUIT_BREAKER_THRESHOLD
+// pushes in a row failed. While it is open, pushes fail right away, so the
+// jobs are spilled or dead-lettered without waiting for the output. After
+// CIRCUIT_BREAKER_COOLDOWN a single push is let through as a probe: the
+// breaker closes when it succeeds and opens again when it fails.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     int32
+	failures  int
+	openedAt  time.Time
+}
+
+func newCircuitBreaker(config Config) *circuitBreaker {
+	circuitState.Store(circuitClosed)
+	return &circuitBreaker{threshold: config.CircuitBreakerThreshold, cooldown: config.CircuitBreakerCooldown}
+}
+
+func validateCircuitBreakerConfig(config Config) error {
+	if config.CircuitBreakerThreshold < 0 {
+		return fmt.Errorf("CIRCUIT_BREAKER_THRESHOLD must not be negative, got %d", config.CircuitBreakerThreshold)
+	}
+	if config.CircuitBreakerThreshold > 0 && config.CircuitBreakerCooldown <= 0 {
+		return fmt.Errorf("CIRCUIT_BREAKER_COOLDOWN must be positive, got %s", config.CircuitBreakerCooldown)
+	}
+	return nil
+}
+
+// call pushes the jobs with push unless the breaker is open, and records the
+// outcome
+func (b *circuitBreaker) call(push func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := push()
+	b.record(err)
+	return err
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return errCircuitOpen
+		}
+		logInfo("Circuit breaker half-open, probing the output")
+		b.setState(circuitHalfOpen)
+		return nil
+	case circuitHalfOpen:
+		// Only the probe is let through
+		return errCircuitOpen
+	}
+	return nil
+}
+
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Full queues and cancelled dispatches don't tell whether the output works
+	if err == nil || errors.Is(err, errJobsDropped) || errors.Is(err, context.Canceled) {
+		if b.state != circuitClosed {
+			logInfo("Circuit breaker closed, the output recovered")
+		}
+		b.failures = 0
+		b.setState(circuitClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || (b.state == circuitClosed && b.failures >= b.threshold) {
+		logWarn("Circuit breaker open after %d failed push(es), not trying the output for %s: %v", b.failures, b.cooldown, err)
+		b.openedAt = time.Now()
+		b.setState(circuitOpen)
+		circuitOpens.Add(1)
+	}
+}
+
+func (b *circuitBreaker) setState(state int32) {
+	b.state = state
+	circuitState.Store(state)
+}
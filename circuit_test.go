@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_CircuitBreaker(t *testing.T) {
+	config := loadConfig()
+
+	if config.CircuitBreakerThreshold != 0 {
+		t.Errorf("Expected CircuitBreakerThreshold to be 0, got %d", config.CircuitBreakerThreshold)
+	}
+	if config.CircuitBreakerCooldown != 30*time.Second {
+		t.Errorf("Expected CircuitBreakerCooldown to be 30s, got %s", config.CircuitBreakerCooldown)
+	}
+
+	os.Setenv("CIRCUIT_BREAKER_THRESHOLD", "5")
+	os.Setenv("CIRCUIT_BREAKER_COOLDOWN", "1m")
+	defer os.Unsetenv("CIRCUIT_BREAKER_THRESHOLD")
+	defer os.Unsetenv("CIRCUIT_BREAKER_COOLDOWN")
+
+	config = loadConfig()
+	if config.CircuitBreakerThreshold != 5 {
+		t.Errorf("Expected CircuitBreakerThreshold to be 5, got %d", config.CircuitBreakerThreshold)
+	}
+	if config.CircuitBreakerCooldown != time.Minute {
+		t.Errorf("Expected CircuitBreakerCooldown to be 1m, got %s", config.CircuitBreakerCooldown)
+	}
+}
+
+func TestValidateCircuitBreakerConfig(t *testing.T) {
+	if err := validateCircuitBreakerConfig(Config{CircuitBreakerThreshold: 5, CircuitBreakerCooldown: time.Second}); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateCircuitBreakerConfig(Config{CircuitBreakerThreshold: -1}); err == nil {
+		t.Error("Expected error for negative threshold, got nil")
+	}
+	if err := validateCircuitBreakerConfig(Config{CircuitBreakerThreshold: 5}); err == nil {
+		t.Error("Expected error for missing cooldown, got nil")
+	}
+}
+
+func TestCircuitBreaker_OpensAndProbes(t *testing.T) {
+	breaker := newCircuitBreaker(Config{CircuitBreakerThreshold: 2, CircuitBreakerCooldown: 20 * time.Millisecond})
+	failing := errors.New("connection refused")
+	calls := 0
+	push := func(err error) func() error {
+		return func() error {
+			calls++
+			return err
+		}
+	}
+
+	breaker.call(push(failing))
+	if circuitState.Load() != circuitClosed {
+		t.Errorf("Expected the breaker to stay closed after 1 failure, got state %d", circuitState.Load())
+	}
+	breaker.call(push(failing))
+	if circuitState.Load() != circuitOpen {
+		t.Fatalf("Expected the breaker to open after 2 failures, got state %d", circuitState.Load())
+	}
+	if err := breaker.call(push(nil)); !errors.Is(err, errCircuitOpen) || calls != 2 {
+		t.Errorf("Expected the open breaker to fail without pushing, got %v after %d call(s)", err, calls)
+	}
+
+	// A failed probe opens the breaker again
+	time.Sleep(30 * time.Millisecond)
+	if err := breaker.call(push(failing)); !errors.Is(err, failing) || calls != 3 {
+		t.Errorf("Expected the probe to be pushed, got %v after %d call(s)", err, calls)
+	}
+	if circuitState.Load() != circuitOpen {
+		t.Fatalf("Expected the breaker to open again after a failed probe, got state %d", circuitState.Load())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := breaker.call(push(nil)); err != nil {
+		t.Errorf("Expected the probe to succeed, got %v", err)
+	}
+	if circuitState.Load() != circuitClosed {
+		t.Errorf("Expected the breaker to close after a successful probe, got state %d", circuitState.Load())
+	}
+}
+
+func TestDispatch_SpillsWhileCircuitOpen(t *testing.T) {
+	config := Config{
+		OutputMode:              outputModeList,
+		PipelineQueueName:       "pipeline",
+		SpillPath:               filepath.Join(t.TempDir(), "spill.db"),
+		CircuitBreakerThreshold: 1,
+		CircuitBreakerCooldown:  time.Minute,
+	}
+	spill, err := openSpillBuffer(nil, config)
+	if err != nil {
+		t.Fatalf("Failed to open spill buffer: %v", err)
+	}
+	defer spill.close()
+
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	d.useSpillBuffer(spill)
+	sink := &flakySink{failures: 10}
+	d.sink = sink
+
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+	for i := 0; i < 3; i++ {
+		if err := d.handleWebhookMessage(context.Background(), payload); err != nil {
+			t.Fatalf("Expected the jobs to be spilled, got %v", err)
+		}
+	}
+	if sink.attempts != 1 {
+		t.Errorf("Expected the output to be tried once before the breaker opened, got %d attempt(s)", sink.attempts)
+	}
+	if pending := spill.pending(); pending != 3 {
+		t.Errorf("Expected 3 spilled jobs, got %d", pending)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// shellMetacharacters are the characters COMMAND_DENY_METACHARACTERS rejects:
+// those chaining commands, substituting output or redirecting it
+const shellMetacharacters = "`$;&|<>()\\\n\r"
+
+// errUnsafeCommand is returned for a command the command policy rejects
+var errUnsafeCommand = errors.New("command rejected by the command policy")
+
+// unsafeCommands counts the events not dispatched because a rendered command
+// was rejected by the command policy
+var unsafeCommands atomic.Int64
+
+// commandPolicy restricts the commands of jobs, so a compromised config file
+// or event cannot run arbitrary commands on the runners
+type commandPolicy struct {
+	// programs are the programs commands may start with, any if empty
+	programs []string
+	// pattern must match commands entirely, if set
+	pattern *regexp.Regexp
+	// denyMetacharacters rejects commands containing shellMetacharacters
+	denyMetacharacters bool
+}
+
+// parseCommandPolicy parses COMMAND_ALLOWLIST, COMMAND_PATTERN and
+// COMMAND_DENY_METACHARACTERS, returning nil if none is set
+func parseCommandPolicy(config Config) (*commandPolicy, error) {
+	if config.CommandAllowlist == "" && config.CommandPattern == "" && !config.CommandDenyMetacharacters {
+		return nil, nil
+	}
+	policy := &commandPolicy{programs: splitList(config.CommandAllowlist), denyMetacharacters: config.CommandDenyMetacharacters}
+	if config.CommandPattern != "" {
+		pattern, err := regexp.Compile(`^(?:` + config.CommandPattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid COMMAND_PATTERN: %w", err)
+		}
+		policy.pattern = pattern
+	}
+	return policy, nil
+}
+
+// validateCommandPolicy checks the policy and the commands of the rules
+// against it, with their templates, if enabled, rendered for every matrix
+// combination but without event values
+func validateCommandPolicy(config Config, rules []FilterRule) error {
+	policy, err := parseCommandPolicy(config)
+	if err != nil || policy == nil {
+		return err
+	}
+	for i, rule := range rules {
+		for _, combination := range expandMatrix(rule.Matrix) {
+			for _, commands := range [][]Command{rule.Commands, rule.CommandsPush, rule.CommandsPR, rule.CommandsTag} {
+				for _, command := range commands {
+					rendered := command.Run
+					if rule.Template {
+						if text, err := renderTemplate(command.Run, TemplateData{Matrix: combination}); err == nil {
+							rendered = text
+						}
+					}
+					if err := policy.check(rendered); err != nil {
+						return fmt.Errorf("rule %d (%s %s): %w", i, rule.Repo, rule.Branch, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// check returns errUnsafeCommand if the policy rejects the command
+func (p *commandPolicy) check(command string) error {
+	if p == nil {
+		return nil
+	}
+	if p.denyMetacharacters && strings.ContainsAny(command, shellMetacharacters) {
+		return fmt.Errorf("%w: '%s' contains shell metacharacters", errUnsafeCommand, command)
+	}
+	if len(p.programs) > 0 {
+		program, _, _ := strings.Cut(strings.TrimSpace(command), " ")
+		allowed := false
+		for _, name := range p.programs {
+			allowed = allowed || name == program
+		}
+		if !allowed {
+			return fmt.Errorf("%w: '%s' does not start with one of %s", errUnsafeCommand, command, strings.Join(p.programs, ", "))
+		}
+	}
+	if p.pattern != nil && !p.pattern.MatchString(command) {
+		return fmt.Errorf("%w: '%s' does not match COMMAND_PATTERN", errUnsafeCommand, command)
+	}
+	return nil
+}
+
+// checkJobs checks the rendered commands of the jobs, which may contain
+// event values such as branch names
+func (p *commandPolicy) checkJobs(jobs []Job) error {
+	for _, job := range jobs {
+		for _, command := range job.Commands {
+			if err := p.check(command); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
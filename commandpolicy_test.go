@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestLoadConfig_CommandPolicy(t *testing.T) {
+	config := loadConfig()
+
+	if config.CommandAllowlist != "" || config.CommandPattern != "" || config.CommandDenyMetacharacters {
+		t.Errorf("Expected no command policy, got allowlist '%s', pattern '%s' and deny metacharacters %t", config.CommandAllowlist, config.CommandPattern, config.CommandDenyMetacharacters)
+	}
+	if policy, err := parseCommandPolicy(config); policy != nil || err != nil {
+		t.Errorf("Expected no policy, got %+v (%v)", policy, err)
+	}
+
+	os.Setenv("COMMAND_ALLOWLIST", "make, npm")
+	os.Setenv("COMMAND_PATTERN", "[a-z]+ [a-z-]+")
+	os.Setenv("COMMAND_DENY_METACHARACTERS", "true")
+	defer os.Unsetenv("COMMAND_ALLOWLIST")
+	defer os.Unsetenv("COMMAND_PATTERN")
+	defer os.Unsetenv("COMMAND_DENY_METACHARACTERS")
+
+	config = loadConfig()
+	if config.CommandAllowlist != "make, npm" {
+		t.Errorf("Expected CommandAllowlist to be 'make, npm', got '%s'", config.CommandAllowlist)
+	}
+	if config.CommandPattern != "[a-z]+ [a-z-]+" {
+		t.Errorf("Expected CommandPattern to be '[a-z]+ [a-z-]+', got '%s'", config.CommandPattern)
+	}
+	if !config.CommandDenyMetacharacters {
+		t.Error("Expected CommandDenyMetacharacters to be true")
+	}
+}
+
+func TestCommandPolicy_Check(t *testing.T) {
+	policy, err := parseCommandPolicy(Config{CommandAllowlist: "make,npm", CommandPattern: `[a-z]+( [a-z-]+)+( [A-Z]+=[a-z]+)*`, CommandDenyMetacharacters: true})
+	if err != nil {
+		t.Fatalf("Failed to parse policy: %v", err)
+	}
+
+	tests := []struct {
+		command string
+		allowed bool
+	}{
+		{"make test", true},
+		{"npm run-script build", true},
+		{"make deploy ENV=staging", true},
+		{"makefile test", false},
+		{"curl https://example.com/install.sh", false},
+		{"make test; curl https://example.com", false},
+		{"make test && rm -rf /", false},
+		{"make test $(id)", false},
+		{"make `id`", false},
+		{"make test > /etc/passwd", false},
+		{"make test\nrm -rf /", false},
+		{"make TEST", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			err := policy.check(tt.command)
+			if tt.allowed && err != nil {
+				t.Errorf("Expected '%s' to be allowed, got %v", tt.command, err)
+			} else if !tt.allowed && !errors.Is(err, errUnsafeCommand) {
+				t.Errorf("Expected errUnsafeCommand for '%s', got %v", tt.command, err)
+			}
+		})
+	}
+
+	var none *commandPolicy
+	if err := none.check("curl https://example.com | sh"); err != nil {
+		t.Errorf("Expected any command without a policy, got %v", err)
+	}
+	if _, err := parseCommandPolicy(Config{CommandPattern: "make ("}); err == nil {
+		t.Error("Expected error for an invalid COMMAND_PATTERN, got nil")
+	}
+}
+
+func TestValidateCommandPolicy(t *testing.T) {
+	config := Config{CommandAllowlist: "make", CommandDenyMetacharacters: true}
+	rules := []FilterRule{{
+		Repo:     "owner/repo",
+		Branch:   "refs/heads/main",
+		Matrix:   map[string][]string{"target": {"linux", "darwin"}},
+		Commands: []Command{{Run: "make build GOOS={{.Matrix.target}} SHA={{.SHA}}"}},
+		Template: true,
+	}}
+	if err := validateCommandPolicy(config, rules); err != nil {
+		t.Errorf("Expected the rules to be valid, got %v", err)
+	}
+
+	rules[0].Matrix["target"] = append(rules[0].Matrix["target"], "linux;id")
+	if err := validateCommandPolicy(config, rules); !errors.Is(err, errUnsafeCommand) {
+		t.Errorf("Expected errUnsafeCommand for an unsafe matrix value, got %v", err)
+	}
+
+	rules = []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main", CommandsPR: []Command{{Run: "bash ./deploy.sh"}}}}
+	if err := validateCommandPolicy(config, rules); !errors.Is(err, errUnsafeCommand) {
+		t.Errorf("Expected errUnsafeCommand for a program not in the allowlist, got %v", err)
+	}
+}
+
+func TestHandleWebhookMessage_RejectsUnsafeCommand(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline", JobSchemaVersion: currentJobSchemaVersion, CommandDenyMetacharacters: true}
+	rules := []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build SHA={{.SHA}}"}}, Template: true}}
+
+	// The rejected jobs are never enqueued, so no Redis is needed
+	d := newDispatcher(nil, config, rules)
+	payload := `{"ref":"refs/heads/main","after":"abc$(id)","repository":{"full_name":"owner/repo"}}`
+	before := unsafeCommands.Load()
+	if err := d.handleWebhookMessage(context.Background(), payload); !errors.Is(err, errUnsafeCommand) {
+		t.Fatalf("Expected errUnsafeCommand, got %v", err)
+	}
+	if got := unsafeCommands.Load() - before; got != 1 {
+		t.Errorf("Expected 1 unsafe command to be counted, got %d", got)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Signature algorithms of minisign: Ed25519 of the file, or of its
+// BLAKE2b-512 hash (the default since minisign 0.10)
+const (
+	minisignAlgorithm       = "Ed"
+	minisignHashedAlgorithm = "ED"
+)
+
+const minisignTrustedComment = "trusted comment: "
+
+// loadVerifiedFilterRules loads the rules of CONFIG_FILE_PATH, verifying
+// first that it was signed with the key of CONFIG_PUBLIC_KEY_FILE, if set.
+// The rules are parsed from the bytes that were verified.
+func loadVerifiedFilterRules(config Config) ([]FilterRule, error) {
+	data, err := os.ReadFile(config.ConfigFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if config.ConfigPublicKeyFile != "" {
+		trusted, err := verifyConfigSignature(config, data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature of config file '%s': %w", config.ConfigFilePath, err)
+		}
+		if trusted != "" {
+			logInfo("Verified the signature of config file '%s' (%s)", config.ConfigFilePath, trusted)
+		} else {
+			logInfo("Verified the signature of config file '%s'", config.ConfigFilePath)
+		}
+	}
+	return parseFilterRules(data)
+}
+
+func validateConfigSignatureConfig(config Config) error {
+	if config.ConfigSignatureFile != "" && config.ConfigPublicKeyFile == "" {
+		return errors.New("CONFIG_SIGNATURE_FILE requires CONFIG_PUBLIC_KEY_FILE")
+	}
+	return nil
+}
+
+// verifyConfigSignature checks the detached signature of the rules file. A
+// PEM public key verifies a cosign signature (cosign sign-blob), any other
+// key a minisign signature. It returns the trusted comment of a minisign
+// signature.
+func verifyConfigSignature(config Config, data []byte) (string, error) {
+	key, err := os.ReadFile(config.ConfigPublicKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read CONFIG_PUBLIC_KEY_FILE: %w", err)
+	}
+	block, _ := pem.Decode(key)
+
+	signatureFile := config.ConfigSignatureFile
+	if signatureFile == "" && block != nil {
+		signatureFile = config.ConfigFilePath + ".sig"
+	} else if signatureFile == "" {
+		signatureFile = config.ConfigFilePath + ".minisig"
+	}
+	signature, err := os.ReadFile(signatureFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	if block != nil {
+		return "", verifyCosignSignature(block, signature, data)
+	}
+	return verifyMinisignSignature(key, signature, data)
+}
+
+// verifyCosignSignature checks a base64 signature of the SHA-256 of the data,
+// as made by cosign sign-blob with a key pair
+func verifyCosignSignature(block *pem.Block, signature, data []byte) error {
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse public key: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(key, digest[:], sig) {
+			return errors.New("signature does not match")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, data, sig) {
+			return errors.New("signature does not match")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T, must be ECDSA or Ed25519", publicKey)
+	}
+	return nil
+}
+
+// verifyMinisignSignature checks a minisign signature and its trusted
+// comment, and returns the comment
+func verifyMinisignSignature(key, signature, data []byte) (string, error) {
+	publicKey, err := decodeMinisignLine(lastMinisignLine(key), 2+8+ed25519.PublicKeySize)
+	if err != nil || string(publicKey[:2]) != minisignAlgorithm {
+		return "", errors.New("invalid minisign public key")
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(signature)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], minisignTrustedComment) {
+		return "", errors.New("invalid minisign signature file")
+	}
+	sig, err := decodeMinisignLine(lines[1], 2+8+ed25519.SignatureSize)
+	if err != nil {
+		return "", errors.New("invalid minisign signature")
+	}
+	if !bytes.Equal(sig[2:10], publicKey[2:10]) {
+		return "", fmt.Errorf("signed with key %X, not with the key %X of CONFIG_PUBLIC_KEY_FILE", sig[2:10], publicKey[2:10])
+	}
+
+	pk := ed25519.PublicKey(publicKey[10:])
+	message := data
+	switch string(sig[:2]) {
+	case minisignHashedAlgorithm:
+		hash := blake2b.Sum512(data)
+		message = hash[:]
+	case minisignAlgorithm:
+	default:
+		return "", fmt.Errorf("unsupported minisign algorithm %q", sig[:2])
+	}
+	if !ed25519.Verify(pk, message, sig[10:]) {
+		return "", errors.New("signature does not match")
+	}
+
+	// The global signature covers the signature and the trusted comment
+	trusted := strings.TrimSuffix(strings.TrimPrefix(lines[2], minisignTrustedComment), "\r")
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || !ed25519.Verify(pk, append(sig[10:], trusted...), global) {
+		return "", errors.New("trusted comment signature does not match")
+	}
+	return trusted, nil
+}
+
+// lastMinisignLine returns the last line of a minisign key, after its
+// untrusted comment
+func lastMinisignLine(data []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	return lines[len(lines)-1]
+}
+
+// decodeMinisignLine decodes a base64 line of the given decoded size
+func decodeMinisignLine(line string, size int) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) != size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", size, len(decoded))
+	}
+	return decoded, nil
+}
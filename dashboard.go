@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dashboardPage is the web UI served on /dashboard. It is a single page
+// without external assets, polling /dashboard/data.
+//
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// dashboardErrors bounds the failed events listed on the dashboard
+const dashboardErrors = 20
+
+// dashboardData is the body of /dashboard/data: the status, the depths of
+// the queues and the recent failures
+type dashboardData struct {
+	dispatcherStatus
+	Paused bool         `json:"paused"`
+	Queues []queueDepth `json:"queues"`
+	// Errors are the last failed events, the most recent first
+	Errors []recentEvent `json:"errors"`
+}
+
+// queueDepth is the number of entries of a Redis queue the dispatcher writes
+// to
+type queueDepth struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Length int64  `json:"length"`
+	Error  string `json:"error,omitempty"`
+}
+
+// dashboardMatchRequest is the body of the rule test form
+type dashboardMatchRequest struct {
+	Repo  string `json:"repo"`
+	Ref   string `json:"ref"`
+	Event string `json:"event"`
+}
+
+func dashboardHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline' 'self'; style-src 'unsafe-inline'")
+		w.Write(dashboardPage)
+	})
+}
+
+func (d *Dispatcher) dashboardDataHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules, source := d.ruleStats.status(r.Context(), d.rules.Load().rules)
+		events := d.recentEvents.list()
+
+		var failed []recentEvent
+		for _, event := range events {
+			if (event.Decision == auditFailed || event.Error != "") && len(failed) < dashboardErrors {
+				failed = append(failed, event)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dashboardData{
+			dispatcherStatus: dispatcherStatus{
+				Version:      version,
+				Commit:       buildCommit(),
+				BuildDate:    buildTime(),
+				Locked:       d.config.Locked,
+				RuleStats:    source,
+				Rules:        rules,
+				RecentEvents: events,
+				Unmatched:    d.unmatched.list(),
+			},
+			Paused: d.paused(),
+			Queues: d.queueDepths(r.Context()),
+			Errors: failed,
+		})
+	})
+}
+
+// dashboardMatchHandler answers the rule test form with what dispatching a
+// push, pull request or release of the repository and ref would do
+func (d *Dispatcher) dashboardMatchHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body dashboardMatchRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+			http.Error(w, "invalid body, expected {\"repo\": \"owner/repo\", \"ref\": \"refs/heads/main\", \"event\": \"push\"}", http.StatusBadRequest)
+			return
+		}
+		if body.Event == "" {
+			body.Event = eventTypePush
+		}
+		event, err := testMatchEvent(body.Event, body.Repo, body.Ref, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := d.match(r.Context(), event)
+		if err != nil {
+			result.Reason = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+// queueDepths returns the lengths of the Redis queues jobs are written to:
+// the pipeline queue and the fixed queues of rules, the output stream, and
+// the delayed, held and dead letter queues. Queue names with templates are
+// left out.
+func (d *Dispatcher) queueDepths(ctx context.Context) []queueDepth {
+	if d.rdb == nil || brokerOutput(d.config.OutputMode) {
+		return nil
+	}
+
+	var queues []queueDepth
+	if d.config.OutputMode != outputModeStream {
+		kind := "list"
+		if d.config.OutputMode == outputModeSorted {
+			kind = "zset"
+		}
+		names := []string{d.config.PipelineQueueName}
+		if d.config.QueueOverflowPolicy == overflowPolicyOverflow {
+			names = append(names, d.config.QueueOverflowName)
+		}
+		for _, rule := range d.rules.Load().rules {
+			names = append(names, rule.Queues...)
+		}
+		for _, name := range names {
+			if !strings.Contains(name, "{{") && !slices.ContainsFunc(queues, func(q queueDepth) bool { return q.Name == name }) {
+				queues = append(queues, queueDepth{Name: name, Kind: kind})
+			}
+		}
+	}
+	if d.config.OutputMode == outputModeStream || d.config.OutputMode == outputModeBoth {
+		queues = append(queues, queueDepth{Name: d.config.OutputStream, Kind: "stream"})
+	}
+	queues = append(queues, queueDepth{Name: d.config.DelayedQueueName, Kind: "zset"})
+	if d.config.PauseKey != "" {
+		queues = append(queues, queueDepth{Name: d.config.HeldQueueName, Kind: "list"})
+	}
+	if d.config.DeadLetterQueue != "" {
+		queues = append(queues, queueDepth{Name: d.config.DeadLetterQueue, Kind: "list"})
+	}
+
+	cmds := make([]*redis.IntCmd, len(queues))
+	d.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, queue := range queues {
+			switch queue.Kind {
+			case "zset":
+				cmds[i] = pipe.ZCard(ctx, queue.Name)
+			case "stream":
+				cmds[i] = pipe.XLen(ctx, queue.Name)
+			default:
+				cmds[i] = pipe.LLen(ctx, queue.Name)
+			}
+		}
+		return nil
+	})
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			queues[i].Error = err.Error()
+			continue
+		}
+		queues[i].Length = cmd.Val()
+	}
+	return queues
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDashboard(t *testing.T) {
+	config := Config{StatusRecentEvents: 10, PipelineQueueName: "pipeline"}
+	rules := []FilterRule{{ID: "main", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	d.recentEvents.add(auditRecord{Repo: "owner/repo", Decision: auditMatched, RuleID: "main"}, time.Millisecond)
+	d.recentEvents.add(auditRecord{Repo: "owner/repo", Decision: auditFailed, RuleID: "main", Error: "queue full"}, time.Millisecond)
+	handler := newHTTPHandler(config, d)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(rec.Body.String(), "dashboard/data") {
+		t.Fatalf("Expected the dashboard page, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dashboard/data", nil))
+	var data dashboardData
+	if err := json.NewDecoder(rec.Body).Decode(&data); err != nil {
+		t.Fatalf("Failed to decode dashboard data: %v", err)
+	}
+	if len(data.RecentEvents) != 2 || len(data.Rules) != 1 || data.Queues != nil {
+		t.Errorf("Expected 2 events, 1 rule and no queues without Redis, got %+v", data)
+	}
+	if len(data.Errors) != 1 || data.Errors[0].Error != "queue full" {
+		t.Errorf("Expected the failed event, got %+v", data.Errors)
+	}
+
+	// The rule test form is only served with admin credentials
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/dashboard/match", strings.NewReader(`{"repo": "owner/repo", "ref": "refs/heads/main"}`)))
+	if rec.Code != http.StatusNotFound && rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected no rule test form without admin credentials, got %d", rec.Code)
+	}
+}
+
+func TestDashboardMatch(t *testing.T) {
+	config := Config{AdminAuthToken: "admin-token", PipelineQueueName: "pipeline"}
+	rules := []FilterRule{{ID: "main", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	handler := newHTTPHandler(config, newDispatcher(nil, config, rules))
+
+	request := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/dashboard/match", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("admin-token", `{"repo": "owner/repo", "ref": "refs/heads/main"}`)
+	var result matchResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil || !result.Matched || result.RuleID != "main" || len(result.Jobs) != 1 {
+		t.Errorf("Expected rule 'main' to match, got %d %+v (%v)", rec.Code, result, err)
+	}
+	if rec := request("admin-token", `{"repo": "owner/repo", "ref": "refs/heads/main", "event": "issues"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown event type, got %d", rec.Code)
+	}
+	if rec := request("wrong", `{"repo": "owner/repo", "ref": "refs/heads/main"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the admin token, got %d", rec.Code)
+	}
+}
+
+func TestQueueDepths_Integration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{OutputMode: outputModeList, PipelineQueueName: "test-dashboard-pipeline", DelayedQueueName: "test-dashboard-delayed"}
+	rules := []FilterRule{
+		{Repo: "owner/repo", Queues: []string{"test-dashboard-pipeline", "test-dashboard-audit", "pipeline:{{.RepoName}}"}},
+	}
+	for _, key := range []string{"test-dashboard-pipeline", "test-dashboard-audit", "test-dashboard-delayed"} {
+		rdb.Del(ctx, key)
+		defer rdb.Del(ctx, key)
+	}
+	rdb.RPush(ctx, "test-dashboard-pipeline", "a", "b")
+	rdb.ZAdd(ctx, "test-dashboard-delayed", redis.Z{Score: 1, Member: "c"})
+
+	depths := newDispatcher(rdb, config, rules).queueDepths(ctx)
+	expected := []queueDepth{
+		{Name: "test-dashboard-pipeline", Kind: "list", Length: 2},
+		{Name: "test-dashboard-audit", Kind: "list"},
+		{Name: "test-dashboard-delayed", Kind: "zset", Length: 1},
+	}
+	if len(depths) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, depths)
+	}
+	for i := range expected {
+		if depths[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], depths[i])
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// deadLetter is a job that could not be enqueued, with where it was going and
+// why it failed, so it can be inspected and re-enqueued by hand
+type deadLetter struct {
+	deferredJob
+	EventID  string    `json:"event_id,omitempty"`
+	RuleID   string    `json:"rule_id,omitempty"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// deadLetterQueue is the DEAD_LETTER_QUEUE list jobs are pushed to once
+// enqueueing them failed after all retries and they could not be spilled
+type deadLetterQueue struct {
+	rdb redis.UniversalClient
+	key string
+}
+
+func newDeadLetterQueue(rdb redis.UniversalClient, config Config) *deadLetterQueue {
+	return &deadLetterQueue{rdb: rdb, key: config.DeadLetterQueue}
+}
+
+func validateDeadLetterConfig(config Config) error {
+	if config.DeadLetterQueue == "" {
+		return nil
+	}
+	if !usesRedis(config) {
+		return fmt.Errorf("DEAD_LETTER_QUEUE requires Redis, which is not used with INPUT_MODE %s and OUTPUT_MODE %s", config.InputMode, config.OutputMode)
+	}
+	return nil
+}
+
+// add pushes the jobs to the dead-letter queue with the error that failed
+// them
+func (q *deadLetterQueue) add(ctx context.Context, config Config, ruleID string, queues []string, priority int, jobs [][]byte, cause error) error {
+	now := time.Now().UTC()
+	entries := make([]interface{}, 0, len(jobs))
+	for _, job := range deferredJobs(config, queues, priority, jobs) {
+		entry, err := json.Marshal(deadLetter{
+			deferredJob: job,
+			EventID:     eventID(ctx),
+			RuleID:      ruleID,
+			Error:       cause.Error(),
+			FailedAt:    now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to serialize dead-lettered job: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := q.rdb.RPush(context.WithoutCancel(ctx), q.key, entries...).Err(); err != nil {
+		return fmt.Errorf("failed to push jobs to dead-letter queue '%s': %w", q.key, err)
+	}
+	return nil
+}
+
+// deadLetterMessage is an input stream message that was delivered too often
+// without being handled, kept so it can be inspected and added back to the
+// stream by hand
+type deadLetterMessage struct {
+	Stream     string                 `json:"stream"`
+	MessageID  string                 `json:"message_id"`
+	Fields     map[string]interface{} `json:"fields"`
+	Deliveries int64                  `json:"deliveries"`
+	Error      string                 `json:"error"`
+	FailedAt   time.Time              `json:"failed_at"`
+}
+
+// addMessage pushes the stream message to the dead-letter queue
+func (q *deadLetterQueue) addMessage(ctx context.Context, stream string, msg redis.XMessage, deliveries int64) error {
+	entry, err := json.Marshal(deadLetterMessage{
+		Stream:     stream,
+		MessageID:  msg.ID,
+		Fields:     msg.Values,
+		Deliveries: deliveries,
+		Error:      fmt.Sprintf("not handled after %d deliveries", deliveries),
+		FailedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize dead-lettered message: %w", err)
+	}
+	if err := q.rdb.RPush(context.WithoutCancel(ctx), q.key, entry).Err(); err != nil {
+		return fmt.Errorf("failed to push message to dead-letter queue '%s': %w", q.key, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestValidateDeadLetterConfig(t *testing.T) {
+	if err := validateDeadLetterConfig(Config{}); err != nil {
+		t.Errorf("Expected no dead-letter queue to be valid, got %v", err)
+	}
+	if err := validateDeadLetterConfig(Config{DeadLetterQueue: "pipeline-dead", InputMode: inputModePubSub, OutputMode: outputModeList}); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateDeadLetterConfig(Config{DeadLetterQueue: "pipeline-dead", InputMode: inputModeNATS, OutputMode: outputModeNATS}); err == nil {
+		t.Error("Expected error for a dead-letter queue without Redis, got nil")
+	}
+}
+
+func TestDeadLetterQueue_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{PipelineQueueName: "test-pipeline-dlq", DeadLetterQueue: "test-pipeline-dead", EnqueueRetries: 1}
+
+	// Clean up before test
+	rdb.Del(ctx, config.DeadLetterQueue)
+	defer rdb.Del(ctx, config.DeadLetterQueue)
+
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(rdb, config, rules)
+	sink := &flakySink{failures: 10}
+	d.sink = sink
+
+	msgCtx := withEventID(ctx)
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+	if err := d.handleWebhookMessage(msgCtx, payload); err != nil {
+		t.Fatalf("Expected the dead-lettered dispatch to succeed, got %v", err)
+	}
+	if sink.attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", sink.attempts)
+	}
+
+	entries := rdb.LRange(ctx, config.DeadLetterQueue, 0, -1).Val()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 dead-lettered job, got %d", len(entries))
+	}
+	var entry deadLetter
+	if err := json.Unmarshal([]byte(entries[0]), &entry); err != nil {
+		t.Fatalf("Failed to decode dead-lettered job: %v", err)
+	}
+	if entry.RuleID != "build" || entry.EventID != eventID(msgCtx) || entry.Error != "connection reset by peer" {
+		t.Errorf("Unexpected dead-lettered job: %+v", entry)
+	}
+	if len(entry.Queues) != 1 || entry.Queues[0] != config.PipelineQueueName {
+		t.Errorf("Expected the job to keep its queue, got %v", entry.Queues)
+	}
+	var job Job
+	if err := json.Unmarshal(entry.Job, &job); err != nil || job.Repo != "owner/repo" {
+		t.Errorf("Expected the job to be kept, got %s (%v)", entry.Job, err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// duplicateDeliveries counts the webhooks dropped because the same delivery
+// arrived within DUPLICATE_WINDOW
+var duplicateDeliveries atomic.Int64
+
+// recentDeliveries remembers the webhooks handled in the last
+// DUPLICATE_WINDOW, up to DUPLICATE_CACHE_SIZE of them, so exact duplicates,
+// e.g. retried by GitHub or published by two webhook receivers, are dropped
+// before they are parsed. The least recently seen are evicted first.
+type recentDeliveries struct {
+	window time.Duration
+	size   int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type recentDelivery struct {
+	key  string
+	seen time.Time
+}
+
+func newRecentDeliveries(config Config) *recentDeliveries {
+	return &recentDeliveries{
+		window:  config.DuplicateWindow,
+		size:    config.DuplicateCacheSize,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func validateDuplicateConfig(config Config) error {
+	if config.DuplicateWindow < 0 {
+		return fmt.Errorf("DUPLICATE_WINDOW must not be negative, got %s", config.DuplicateWindow)
+	}
+	if config.DuplicateWindow > 0 && config.DuplicateCacheSize <= 0 {
+		return fmt.Errorf("DUPLICATE_CACHE_SIZE must be positive, got %d", config.DuplicateCacheSize)
+	}
+	return nil
+}
+
+// deliveryKey identifies a webhook by its GitHub delivery ID when the
+// envelope carries it, otherwise by the hash of its payload
+func deliveryKey(payload, deliveryID string) string {
+	if deliveryID != "" {
+		return "delivery:" + deliveryID
+	}
+	sum := sha256.Sum256([]byte(payload))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// claim records the delivery and reports whether it is new, i.e. not seen
+// within the window
+func (r *recentDeliveries) claim(key string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if elem, ok := r.entries[key]; ok {
+		entry := elem.Value.(*recentDelivery)
+		if now.Sub(entry.seen) < r.window {
+			r.order.MoveToFront(elem)
+			return false
+		}
+		entry.seen = now
+		r.order.MoveToFront(elem)
+		return true
+	}
+
+	r.entries[key] = r.order.PushFront(&recentDelivery{key: key, seen: now})
+	for r.order.Len() > r.size {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*recentDelivery).key)
+	}
+	return true
+}
+
+// forget removes a delivery whose handling failed, so it can be redelivered
+func (r *recentDeliveries) forget(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if elem, ok := r.entries[key]; ok {
+		r.order.Remove(elem)
+		delete(r.entries, key)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// failingSink fails every push
+type failingSink struct{}
+
+func (failingSink) enqueue(ctx context.Context, config Config, queues []string, priority int, jobs [][]byte) error {
+	return errors.New("connection refused")
+}
+
+func TestLoadConfig_Duplicates(t *testing.T) {
+	config := loadConfig()
+
+	if config.DuplicateWindow != 0 {
+		t.Errorf("Expected DuplicateWindow to be 0, got %s", config.DuplicateWindow)
+	}
+	if config.DuplicateCacheSize != 10000 {
+		t.Errorf("Expected DuplicateCacheSize to be 10000, got %d", config.DuplicateCacheSize)
+	}
+
+	os.Setenv("DUPLICATE_WINDOW", "5m")
+	os.Setenv("DUPLICATE_CACHE_SIZE", "100")
+	defer os.Unsetenv("DUPLICATE_WINDOW")
+	defer os.Unsetenv("DUPLICATE_CACHE_SIZE")
+
+	config = loadConfig()
+	if config.DuplicateWindow != 5*time.Minute {
+		t.Errorf("Expected DuplicateWindow to be 5m, got %s", config.DuplicateWindow)
+	}
+	if config.DuplicateCacheSize != 100 {
+		t.Errorf("Expected DuplicateCacheSize to be 100, got %d", config.DuplicateCacheSize)
+	}
+	if err := validateDuplicateConfig(config); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateDuplicateConfig(Config{DuplicateWindow: -time.Second}); err == nil {
+		t.Error("Expected error for negative DUPLICATE_WINDOW, got nil")
+	}
+	if err := validateDuplicateConfig(Config{DuplicateWindow: time.Minute}); err == nil {
+		t.Error("Expected error for non-positive DUPLICATE_CACHE_SIZE, got nil")
+	}
+}
+
+func TestRecentDeliveries_Claim(t *testing.T) {
+	deliveries := newRecentDeliveries(Config{DuplicateWindow: time.Minute, DuplicateCacheSize: 2})
+	now := time.Now()
+
+	if !deliveries.claim("a", now) {
+		t.Error("Expected the first delivery to be new")
+	}
+	if deliveries.claim("a", now.Add(30*time.Second)) {
+		t.Error("Expected a duplicate within the window to be dropped")
+	}
+	if !deliveries.claim("a", now.Add(2*time.Minute)) {
+		t.Error("Expected a duplicate after the window to be new")
+	}
+
+	// "a" was seen last, so "b" is evicted by "c"
+	deliveries.claim("b", now.Add(2*time.Minute))
+	deliveries.claim("a", now.Add(2*time.Minute))
+	deliveries.claim("c", now.Add(2*time.Minute))
+	if !deliveries.claim("b", now.Add(2*time.Minute)) {
+		t.Error("Expected the least recently seen delivery to be evicted")
+	}
+	if deliveries.claim("c", now.Add(2*time.Minute)) {
+		t.Error("Expected a recently seen delivery to be kept")
+	}
+
+	deliveries.forget("c")
+	if !deliveries.claim("c", now.Add(2*time.Minute)) {
+		t.Error("Expected a forgotten delivery to be new")
+	}
+}
+
+func TestDeliveryKey(t *testing.T) {
+	if key := deliveryKey(`{}`, "72d3162e"); key != "delivery:72d3162e" {
+		t.Errorf("Expected the delivery ID to be the key, got '%s'", key)
+	}
+	if deliveryKey(`{"a":1}`, "") == deliveryKey(`{"a":2}`, "") {
+		t.Error("Expected different payloads to have different keys")
+	}
+	if deliveryKey(`{"a":1}`, "") != deliveryKey(`{"a":1}`, "") {
+		t.Error("Expected the same payload to have the same key")
+	}
+}
+
+func TestHandleWebhookMessage_DropsDuplicates(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline", DuplicateWindow: time.Minute, DuplicateCacheSize: 10}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	payload := `{"ref":"refs/heads/main","after":"abc123","repository":{"full_name":"owner/repo"}}`
+
+	// A failed webhook can be redelivered
+	d.sink = failingSink{}
+	if err := d.handleWebhookMessage(context.Background(), payload); err == nil {
+		t.Fatal("Expected the push to fail, got nil")
+	}
+
+	sink := &recordingSink{}
+	d.sink = sink
+	duplicates := duplicateDeliveries.Load()
+	for i := 0; i < 2; i++ {
+		if err := d.handleWebhookMessage(context.Background(), payload); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+	if len(sink.jobs) != 1 {
+		t.Errorf("Expected the duplicate to be dropped, got %d job(s)", len(sink.jobs))
+	}
+	if got := duplicateDeliveries.Load() - duplicates; got != 1 {
+		t.Errorf("Expected one duplicate to be counted, got %d", got)
+	}
+
+	// Replays are dispatched again
+	if err := d.handleWebhookMessage(withArchivedEvent(context.Background(), "1-0"), payload); err != nil {
+		t.Fatalf("Failed to handle replayed webhook: %v", err)
+	}
+	if len(sink.jobs) != 2 {
+		t.Errorf("Expected the replayed webhook to be dispatched, got %d job(s)", len(sink.jobs))
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// delayedPromoteBatch is the maximum number of due jobs promoted per poll
+const delayedPromoteBatch = 100
+
+// deferredJob is a serialized job together with where it is enqueued later:
+// the member of the delayed sorted set, and the entry of the held list while
+// the dispatcher is paused
+type deferredJob struct {
+	Queues        []string        `json:"queues"`
+	OverflowQueue string          `json:"overflow_queue,omitempty"`
+	Priority      int             `json:"priority,omitempty"`
+	Job           json.RawMessage `json:"job"`
+	// Rule and Repo are the rule and repository of a delayed job, which is
+	// held when it is due while either is paused
+	Rule string `json:"rule,omitempty"`
+	Repo string `json:"repo,omitempty"`
+}
+
+// scheduleDelayedJobs adds the jobs to the delayed sorted set, scored by the
+// time (in Unix milliseconds) they become due
+func scheduleDelayedJobs(ctx context.Context, rdb redis.UniversalClient, config Config, rule *FilterRule, repo string, queues []string, delay time.Duration, jobs [][]byte) error {
+	due := float64(time.Now().Add(delay).UnixMilli())
+	if len(queues) == 0 {
+		queues = []string{config.PipelineQueueName}
+	}
+
+	members := make([]redis.Z, 0, len(jobs))
+	for _, job := range jobs {
+		member, err := json.Marshal(deferredJob{
+			Queues:        queues,
+			OverflowQueue: config.QueueOverflowName,
+			Priority:      rule.Priority,
+			Job:           job,
+			Rule:          rule.ID,
+			Repo:          repo,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to serialize delayed job: %w", err)
+		}
+		members = append(members, redis.Z{Score: due, Member: member})
+	}
+
+	return rdb.ZAdd(ctx, config.DelayedQueueName, members...).Err()
+}
+
+// runDelayedPromoter moves due jobs from the delayed sorted set to their
+// output every DELAYED_POLL_INTERVAL until the context is cancelled. Due jobs
+// stay in the sorted set while the dispatcher is paused, and those of a paused
+// rule or repository are held with its jobs.
+func runDelayedPromoter(ctx context.Context, rdb redis.UniversalClient, config Config, pause *pauseController) {
+	ticker := time.NewTicker(config.DelayedPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if pause != nil && pause.isPaused() {
+				continue
+			}
+			promoted, err := promoteDueJobs(ctx, rdb, config, pause, time.Now())
+			if err != nil {
+				if ctx.Err() == nil {
+					logError("Failed to promote delayed jobs: %v", err)
+				}
+				continue
+			}
+			if promoted > 0 {
+				logInfo("Promoted %d delayed job(s) from '%s'", promoted, config.DelayedQueueName)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// promoteDueJobs enqueues the jobs of the delayed sorted set that are due at
+// now. A job is removed from the set before it is enqueued, so when several
+// dispatchers share the set every job is promoted by exactly one of them.
+func promoteDueJobs(ctx context.Context, rdb redis.UniversalClient, config Config, pause *pauseController, now time.Time) (int, error) {
+	members, err := rdb.ZRangeByScoreWithScores(ctx, config.DelayedQueueName, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: delayedPromoteBatch,
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read due jobs from '%s': %w", config.DelayedQueueName, err)
+	}
+
+	promoted := 0
+	for _, member := range members {
+		raw, _ := member.Member.(string)
+
+		removed, err := rdb.ZRem(ctx, config.DelayedQueueName, raw).Result()
+		if err != nil {
+			return promoted, fmt.Errorf("failed to remove due job from '%s': %w", config.DelayedQueueName, err)
+		}
+		if removed == 0 {
+			// Promoted by another dispatcher
+			continue
+		}
+
+		var delayed deferredJob
+		if err := json.Unmarshal([]byte(raw), &delayed); err != nil {
+			logError("Dropping malformed delayed job from '%s': %v", config.DelayedQueueName, err)
+			continue
+		}
+
+		cfg := config
+		cfg.QueueOverflowName = delayed.OverflowQueue
+		if target := pausedTarget(pause, delayed.Rule, delayed.Repo); target != "" {
+			err = pause.hold(context.WithoutCancel(ctx), target, cfg, delayed.Queues, delayed.Priority, [][]byte{delayed.Job})
+		} else {
+			err = enqueueJobs(context.WithoutCancel(ctx), rdb, cfg, delayed.Queues, delayed.Priority, [][]byte{delayed.Job})
+		}
+		if errors.Is(err, errJobsDropped) {
+			continue
+		}
+		if err != nil {
+			// Put the job back so it is retried on the next poll
+			logError("Failed to enqueue delayed job to %s, rescheduling: %v", describeOutput(cfg, delayed.Queues...), err)
+			if err := rdb.ZAdd(ctx, config.DelayedQueueName, member).Err(); err != nil {
+				logError("Failed to reschedule delayed job: %v", err)
+			}
+			continue
+		}
+		promoted++
+	}
+	return promoted, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_Delayed(t *testing.T) {
+	config := loadConfig()
+
+	if config.DelayedQueueName != "pipeline-delayed" {
+		t.Errorf("Expected DelayedQueueName to be 'pipeline-delayed', got '%s'", config.DelayedQueueName)
+	}
+	if config.DelayedPollInterval != time.Second {
+		t.Errorf("Expected DelayedPollInterval to be 1s, got %s", config.DelayedPollInterval)
+	}
+
+	os.Setenv("DELAYED_QUEUE_NAME", "pipeline-later")
+	os.Setenv("DELAYED_POLL_INTERVAL", "5s")
+	defer os.Unsetenv("DELAYED_QUEUE_NAME")
+	defer os.Unsetenv("DELAYED_POLL_INTERVAL")
+
+	config = loadConfig()
+
+	if config.DelayedQueueName != "pipeline-later" {
+		t.Errorf("Expected DelayedQueueName to be 'pipeline-later', got '%s'", config.DelayedQueueName)
+	}
+	if config.DelayedPollInterval != 5*time.Second {
+		t.Errorf("Expected DelayedPollInterval to be 5s, got %s", config.DelayedPollInterval)
+	}
+}
+
+func TestPromoteDueJobs_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:        outputModeList,
+		PipelineQueueName: "test-pipeline-delayed-target",
+		DelayedQueueName:  "test-pipeline-delayed",
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.PipelineQueueName, config.DelayedQueueName)
+	defer rdb.Del(ctx, config.PipelineQueueName, config.DelayedQueueName)
+
+	if err := scheduleDelayedJobs(ctx, rdb, config, &FilterRule{}, "owner/repo", nil, time.Minute, [][]byte{[]byte(`{"job_id":"1"}`)}); err != nil {
+		t.Fatalf("Failed to schedule delayed job: %v", err)
+	}
+
+	// Nothing is due yet
+	promoted, err := promoteDueJobs(ctx, rdb, config, nil, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to promote jobs: %v", err)
+	}
+	if promoted != 0 {
+		t.Errorf("Expected no job to be promoted before it is due, got %d", promoted)
+	}
+
+	promoted, err = promoteDueJobs(ctx, rdb, config, nil, time.Now().Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to promote jobs: %v", err)
+	}
+	if promoted != 1 {
+		t.Errorf("Expected 1 job to be promoted, got %d", promoted)
+	}
+
+	queued, err := rdb.LRange(ctx, config.PipelineQueueName, 0, -1).Result()
+	if err != nil {
+		t.Fatalf("Failed to read queue: %v", err)
+	}
+	if len(queued) != 1 || queued[0] != `{"job_id":"1"}` {
+		t.Errorf("Expected the promoted job in the queue, got %v", queued)
+	}
+
+	if remaining := rdb.ZCard(ctx, config.DelayedQueueName).Val(); remaining != 0 {
+		t.Errorf("Expected the delayed queue to be empty, got %d job(s)", remaining)
+	}
+}
+
+func TestPromoteDueJobs_PausedTarget_Integration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:        outputModeList,
+		PipelineQueueName: "test-pipeline-delayed-paused",
+		DelayedQueueName:  "test-pipeline-delayed-paused-later",
+		PauseKey:          "test-dispatcher:paused-delayed",
+		HeldQueueName:     "test-pipeline-delayed-paused-held",
+	}
+	keys := []string{config.PipelineQueueName, config.DelayedQueueName, config.HeldQueueName + ":repo:owner/repo", config.HeldQueueName + ":targets"}
+	rdb.Del(ctx, keys...)
+	defer rdb.Del(ctx, keys...)
+
+	pause := newPauseController(rdb, config)
+	pause.targets.Store(&map[string]bool{"repo:owner/repo": true})
+	rule := &FilterRule{ID: "build"}
+	if err := scheduleDelayedJobs(ctx, rdb, config, rule, "owner/repo", nil, time.Minute, [][]byte{[]byte(`{"job_id":"1"}`)}); err != nil {
+		t.Fatalf("Failed to schedule delayed job: %v", err)
+	}
+	if err := scheduleDelayedJobs(ctx, rdb, config, rule, "owner/other", nil, time.Minute, [][]byte{[]byte(`{"job_id":"2"}`)}); err != nil {
+		t.Fatalf("Failed to schedule delayed job: %v", err)
+	}
+
+	// The due job of the paused repository is held instead of enqueued
+	if _, err := promoteDueJobs(ctx, rdb, config, pause, time.Now().Add(2*time.Minute)); err != nil {
+		t.Fatalf("Failed to promote jobs: %v", err)
+	}
+	if queued := rdb.LRange(ctx, config.PipelineQueueName, 0, -1).Val(); len(queued) != 1 || queued[0] != `{"job_id":"2"}` {
+		t.Errorf("Expected only the job of the other repository in the queue, got %v", queued)
+	}
+	if held := rdb.LLen(ctx, config.HeldQueueName+":repo:owner/repo").Val(); held != 1 {
+		t.Errorf("Expected the job of the paused repository to be held, got %d", held)
+	}
+}
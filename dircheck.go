@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dirCheckTimeout bounds a STRICT_STARTUP_DIR_COMMAND run
+const dirCheckTimeout = 10 * time.Second
+
+// dirChecker verifies that the runner can work in the directory of a rule
+type dirChecker interface {
+	check(ctx context.Context, dir string) error
+}
+
+// newDirChecker returns the checker of STRICT_STARTUP: the
+// STRICT_STARTUP_DIR_COMMAND when set, otherwise the local filesystem below
+// STRICT_STARTUP_DIR_ROOT, where the runner's filesystem may be mounted
+func newDirChecker(config Config) dirChecker {
+	if config.StrictStartupDirCommand != "" {
+		return &commandDirChecker{args: strings.Fields(config.StrictStartupDirCommand)}
+	}
+	return &localDirChecker{root: config.StrictStartupDirRoot}
+}
+
+func validateStrictStartupConfig(config Config) error {
+	if config.StrictStartupDirRoot != "" && config.StrictStartupDirCommand != "" {
+		return errors.New("STRICT_STARTUP_DIR_ROOT and STRICT_STARTUP_DIR_COMMAND cannot both be set")
+	}
+	return nil
+}
+
+// checkRuleDirs checks the directory of every rule that has one, each
+// directory once. It returns the number of directories checked and an error
+// listing the broken ones.
+func checkRuleDirs(ctx context.Context, checker dirChecker, rules []FilterRule) (int, error) {
+	var problems []string
+	checked := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Dir == "" || checked[rule.Dir] {
+			continue
+		}
+		checked[rule.Dir] = true
+		if err := checker.check(ctx, rule.Dir); err != nil {
+			problems = append(problems, fmt.Sprintf("rule %s: %v", rule.ID, err))
+		}
+	}
+	if len(problems) > 0 {
+		return len(checked), fmt.Errorf("%d rule(s) with a broken dir: %s", len(problems), strings.Join(problems, "; "))
+	}
+	return len(checked), nil
+}
+
+// localDirChecker checks that the directory exists and is writable by
+// creating and removing a file in it
+type localDirChecker struct {
+	root string
+}
+
+func (c *localDirChecker) check(ctx context.Context, dir string) error {
+	path := dir
+	if c.root != "" {
+		path = filepath.Join(c.root, dir)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("dir '%s' does not exist: %w", path, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("dir '%s' is not a directory", path)
+	}
+	f, err := os.CreateTemp(path, ".github-dispatcher-check-*")
+	if err != nil {
+		return fmt.Errorf("dir '%s' is not writable: %w", path, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+// commandDirChecker runs the command with the directory as its last
+// argument, e.g. "ssh runner test -w", and accepts the directory when it
+// exits with status 0
+type commandDirChecker struct {
+	args []string
+}
+
+func (c *commandDirChecker) check(ctx context.Context, dir string) error {
+	ctx, cancel := context.WithTimeout(ctx, dirCheckTimeout)
+	defer cancel()
+
+	args := append(c.args[1:len(c.args):len(c.args)], dir)
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.args[0], args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if output := strings.TrimSpace(stderr.String()); output != "" {
+			err = fmt.Errorf("%w: %s", err, output)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s", dirCheckTimeout)
+		}
+		return fmt.Errorf("dir '%s' rejected by STRICT_STARTUP_DIR_COMMAND: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_StrictStartup(t *testing.T) {
+	config := loadConfig()
+
+	if config.StrictStartup {
+		t.Error("Expected StrictStartup to be false")
+	}
+	if config.StrictStartupDirRoot != "" || config.StrictStartupDirCommand != "" {
+		t.Errorf("Expected the dir checker settings to be empty, got '%s' and '%s'", config.StrictStartupDirRoot, config.StrictStartupDirCommand)
+	}
+
+	os.Setenv("STRICT_STARTUP", "true")
+	os.Setenv("STRICT_STARTUP_DIR_ROOT", "/mnt/runner")
+	os.Setenv("STRICT_STARTUP_DIR_COMMAND", "ssh runner test -w")
+	defer os.Unsetenv("STRICT_STARTUP")
+	defer os.Unsetenv("STRICT_STARTUP_DIR_ROOT")
+	defer os.Unsetenv("STRICT_STARTUP_DIR_COMMAND")
+
+	config = loadConfig()
+	if !config.StrictStartup {
+		t.Error("Expected StrictStartup to be true")
+	}
+	if config.StrictStartupDirRoot != "/mnt/runner" {
+		t.Errorf("Expected StrictStartupDirRoot to be '/mnt/runner', got '%s'", config.StrictStartupDirRoot)
+	}
+	if config.StrictStartupDirCommand != "ssh runner test -w" {
+		t.Errorf("Expected StrictStartupDirCommand to be 'ssh runner test -w', got '%s'", config.StrictStartupDirCommand)
+	}
+	if err := validateStrictStartupConfig(config); err == nil {
+		t.Error("Expected error for both a dir root and a dir command, got nil")
+	}
+}
+
+func TestCheckRuleDirs_Local(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "srv", "app"), 0o755)
+	os.WriteFile(filepath.Join(root, "srv", "file"), nil, 0o644)
+	readOnly := filepath.Join(root, "srv", "readonly")
+	os.MkdirAll(readOnly, 0o555)
+
+	rules := []FilterRule{
+		{ID: "app", Dir: "/srv/app"},
+		{ID: "app-again", Dir: "/srv/app"},
+		{ID: "no-dir"},
+	}
+	checker := newDirChecker(Config{StrictStartupDirRoot: root})
+	checked, err := checkRuleDirs(context.Background(), checker, rules)
+	if err != nil {
+		t.Errorf("Expected the dir to pass, got %v", err)
+	}
+	if checked != 1 {
+		t.Errorf("Expected the shared dir to be checked once, got %d check(s)", checked)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "srv", "app")); len(entries) != 0 {
+		t.Errorf("Expected the check to leave no file behind, got %d", len(entries))
+	}
+
+	rules = []FilterRule{{ID: "missing", Dir: "/srv/missing"}, {ID: "file", Dir: "/srv/file"}}
+	if os.Getuid() != 0 {
+		// root can write anywhere
+		rules = append(rules, FilterRule{ID: "readonly", Dir: "/srv/readonly"})
+	}
+	_, err = checkRuleDirs(context.Background(), checker, rules)
+	if err == nil {
+		t.Fatal("Expected broken dirs to fail the check, got nil")
+	}
+	for _, rule := range rules {
+		if !strings.Contains(err.Error(), "rule "+rule.ID+":") {
+			t.Errorf("Expected rule %s to be reported, got %v", rule.ID, err)
+		}
+	}
+}
+
+func TestCheckRuleDirs_Command(t *testing.T) {
+	dir := t.TempDir()
+	rules := []FilterRule{{ID: "app", Dir: dir}}
+
+	if _, err := checkRuleDirs(context.Background(), newDirChecker(Config{StrictStartupDirCommand: "test -d"}), rules); err != nil {
+		t.Errorf("Expected the command to accept the dir, got %v", err)
+	}
+
+	rules = append(rules, FilterRule{ID: "missing", Dir: filepath.Join(dir, "missing")})
+	_, err := checkRuleDirs(context.Background(), newDirChecker(Config{StrictStartupDirCommand: "test -d"}), rules)
+	if err == nil || !strings.Contains(err.Error(), "rule missing:") || strings.Contains(err.Error(), "rule app:") {
+		t.Errorf("Expected only the missing dir to be rejected, got %v", err)
+	}
+}
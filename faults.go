@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Points where FAULTS injects failures
+const (
+	// faultRedisPush fails pushes of jobs to the output
+	faultRedisPush = "redis_push"
+	// faultWebhookDelivery fails POSTs of jobs to the webhook_url of rules
+	faultWebhookDelivery = "webhook_delivery"
+)
+
+var faultPoints = []string{faultRedisPush, faultWebhookDelivery}
+
+// errInjectedFault is the failure injected by FAULTS
+var errInjectedFault = errors.New("injected fault")
+
+// injectedFaults counts the failures injected by FAULTS
+var injectedFaults atomic.Int64
+
+// faultInjector randomly fails operations for testing, with the probability
+// FAULTS sets for their point, e.g. redis_push=0.1
+type faultInjector map[string]float64
+
+// parseFaults parses FAULTS, a comma-separated list of point=probability
+func parseFaults(value string) (faultInjector, error) {
+	faults := faultInjector{}
+	for _, item := range splitList(value) {
+		point, probability, ok := strings.Cut(item, "=")
+		point = strings.TrimSpace(point)
+		if !ok {
+			return nil, fmt.Errorf("fault '%s' must be point=probability", item)
+		}
+		known := false
+		for _, p := range faultPoints {
+			known = known || p == point
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown fault point '%s', expected one of %s", point, strings.Join(faultPoints, ", "))
+		}
+		p, err := strconv.ParseFloat(strings.TrimSpace(probability), 64)
+		if err != nil || p < 0 || p > 1 {
+			return nil, fmt.Errorf("probability of fault '%s' must be between 0 and 1, got '%s'", point, probability)
+		}
+		faults[point] = p
+	}
+	return faults, nil
+}
+
+func validateFaultsConfig(config Config) error {
+	if config.Faults == "" {
+		return nil
+	}
+	if strings.EqualFold(config.SentryEnvironment, "production") {
+		return errors.New("FAULTS must not be set in production")
+	}
+	if _, err := parseFaults(config.Faults); err != nil {
+		return fmt.Errorf("invalid FAULTS: %w", err)
+	}
+	return nil
+}
+
+// newFaultInjector returns the injector of FAULTS, or nil if it is not set
+func newFaultInjector(config Config) faultInjector {
+	faults, _ := parseFaults(config.Faults)
+	if len(faults) == 0 {
+		return nil
+	}
+	return faults
+}
+
+// inject fails with errInjectedFault with the probability of the point
+func (f faultInjector) inject(point string) error {
+	if f[point] <= 0 || rand.Float64() >= f[point] {
+		return nil
+	}
+	injectedFaults.Add(1)
+	return fmt.Errorf("%s: %w", point, errInjectedFault)
+}
+
+// faultTransport fails HTTP requests with the probability of its point
+// before they are sent
+type faultTransport struct {
+	faults faultInjector
+	point  string
+	next   http.RoundTripper
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.faults.inject(t.point); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
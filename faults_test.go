@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_Faults(t *testing.T) {
+	config := loadConfig()
+
+	if config.Faults != "" {
+		t.Errorf("Expected Faults to be empty, got '%s'", config.Faults)
+	}
+	if newFaultInjector(config) != nil {
+		t.Error("Expected no fault injector by default")
+	}
+
+	os.Setenv("FAULTS", "redis_push=0.1, webhook_delivery=1")
+	defer os.Unsetenv("FAULTS")
+
+	config = loadConfig()
+	if err := validateFaultsConfig(config); err != nil {
+		t.Fatalf("Expected valid config, got %v", err)
+	}
+	faults := newFaultInjector(config)
+	if faults[faultRedisPush] != 0.1 || faults[faultWebhookDelivery] != 1 {
+		t.Errorf("Expected redis_push=0.1 and webhook_delivery=1, got %v", faults)
+	}
+
+	config.SentryEnvironment = "production"
+	if err := validateFaultsConfig(config); err == nil {
+		t.Error("Expected error for FAULTS in production, got nil")
+	}
+}
+
+func TestParseFaults_Invalid(t *testing.T) {
+	for _, value := range []string{"redis_push", "redis_pop=0.1", "redis_push=2", "redis_push=-0.1", "redis_push=often"} {
+		if _, err := parseFaults(value); err == nil {
+			t.Errorf("Expected error for FAULTS '%s', got nil", value)
+		}
+	}
+}
+
+func TestFaultInjector_Inject(t *testing.T) {
+	var none faultInjector
+	if err := none.inject(faultRedisPush); err != nil {
+		t.Errorf("Expected no fault without FAULTS, got %v", err)
+	}
+
+	faults := faultInjector{faultRedisPush: 1, faultWebhookDelivery: 0}
+	injected := injectedFaults.Load()
+	if err := faults.inject(faultRedisPush); !errors.Is(err, errInjectedFault) {
+		t.Errorf("Expected an injected fault, got %v", err)
+	}
+	if err := faults.inject(faultWebhookDelivery); err != nil {
+		t.Errorf("Expected no fault with probability 0, got %v", err)
+	}
+	if got := injectedFaults.Load() - injected; got != 1 {
+		t.Errorf("Expected one fault to be counted, got %d", got)
+	}
+}
+
+func TestDispatch_InjectedFaults(t *testing.T) {
+	var posts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+	}))
+	defer server.Close()
+
+	config := Config{PipelineQueueName: "pipeline", Faults: "redis_push=1,webhook_delivery=1", CircuitBreakerThreshold: 2, CircuitBreakerCooldown: time.Minute}
+	rules := []FilterRule{
+		{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}},
+		{ID: "notify", Repo: "owner/repo", Branch: "refs/heads/develop", WebhookURL: server.URL, WebhookOnly: true, Commands: []Command{{Run: "make notify"}}},
+	}
+	d := newDispatcher(nil, config, rules)
+	sink := &recordingSink{}
+	d.sink = sink
+
+	for i := 0; i < 2; i++ {
+		err := d.handleWebhookMessage(context.Background(), `{"ref":"refs/heads/main","after":"abc123","repository":{"full_name":"owner/repo"}}`)
+		if !errors.Is(err, errInjectedFault) {
+			t.Fatalf("Expected the push to fail with an injected fault, got %v", err)
+		}
+	}
+	if len(sink.jobs) != 0 {
+		t.Errorf("Expected no job to be pushed, got %d", len(sink.jobs))
+	}
+	if err := d.handleWebhookMessage(context.Background(), `{"ref":"refs/heads/main","after":"abc123","repository":{"full_name":"owner/repo"}}`); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("Expected the injected faults to open the circuit breaker, got %v", err)
+	}
+
+	if err := d.handleWebhookMessage(context.Background(), `{"ref":"refs/heads/develop","after":"abc123","repository":{"full_name":"owner/repo"}}`); !errors.Is(err, errInjectedFault) {
+		t.Errorf("Expected the delivery to fail with an injected fault, got %v", err)
+	}
+	if posts != 0 {
+		t.Errorf("Expected no POST to reach the webhook, got %d", posts)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	firehoseRecordMatch = "match"
+	firehoseRecordJob   = "job"
+)
+
+const (
+	// firehoseBuffer is how many records a client may lag behind before
+	// records are dropped for it
+	firehoseBuffer = 256
+
+	firehoseWriteTimeout = 10 * time.Second
+	firehosePingInterval = 30 * time.Second
+)
+
+// firehoseDroppedRecords counts the records not sent to clients that fell
+// behind
+var firehoseDroppedRecords atomic.Int64
+
+// firehoseRecord is a match decision or a job outcome streamed to clients
+type firehoseRecord struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Repo      string    `json:"repo"`
+	Ref       string    `json:"ref,omitempty"`
+	EventType string    `json:"event_type,omitempty"`
+	Matched   bool      `json:"matched,omitempty"`
+	RuleID    string    `json:"rule_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Outcome   string    `json:"outcome,omitempty"`
+	Output    string    `json:"output,omitempty"`
+	Job       *Job      `json:"job,omitempty"`
+}
+
+// firehose fans the records of the dispatcher out to the connected WebSocket
+// clients. Clients that fall behind miss records instead of slowing down
+// dispatching.
+type firehose struct {
+	mu      sync.Mutex
+	clients map[*firehoseClient]struct{}
+	closed  bool
+}
+
+type firehoseClient struct {
+	repo    string
+	records chan []byte
+}
+
+func newFirehose() *firehose {
+	return &firehose{clients: map[*firehoseClient]struct{}{}}
+}
+
+// match streams the match decision for an event; rule is nil when the event
+// is not dispatched, with reason telling why
+func (f *firehose) match(event *GitHubEvent, rule *FilterRule, reason string) {
+	record := firehoseRecord{
+		Type:      firehoseRecordMatch,
+		Repo:      event.Repository.FullName,
+		Ref:       event.MatchRef(),
+		EventType: event.Type(),
+		Reason:    reason,
+	}
+	if rule != nil {
+		record.Matched = true
+		record.RuleID = rule.ID
+	}
+	f.publish(record)
+}
+
+// jobs streams the outcome of dispatching the jobs of a match
+func (f *firehose) jobs(outcome, output string, jobs []Job) {
+	for i := range jobs {
+		f.publish(firehoseRecord{
+			Type:    firehoseRecordJob,
+			Repo:    jobs[i].Repo,
+			RuleID:  jobs[i].RuleID,
+			Outcome: outcome,
+			Output:  output,
+			Job:     &jobs[i],
+		})
+	}
+}
+
+func (f *firehose) publish(record firehoseRecord) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.clients) == 0 {
+		return
+	}
+
+	record.Time = time.Now().UTC()
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		logError("Failed to encode firehose record: %v", err)
+		return
+	}
+	for client := range f.clients {
+		if client.repo != "" && client.repo != record.Repo {
+			continue
+		}
+		select {
+		case client.records <- encoded:
+		default:
+			firehoseDroppedRecords.Add(1)
+		}
+	}
+}
+
+func (f *firehose) subscribe(repo string) *firehoseClient {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	client := &firehoseClient{repo: repo, records: make(chan []byte, firehoseBuffer)}
+	if f.closed {
+		close(client.records)
+		return client
+	}
+	f.clients[client] = struct{}{}
+	return client
+}
+
+func (f *firehose) unsubscribe(client *firehoseClient) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.clients[client]; ok {
+		delete(f.clients, client)
+		close(client.records)
+	}
+}
+
+// close disconnects every client on shutdown
+func (f *firehose) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for client := range f.clients {
+		delete(f.clients, client)
+		close(client.records)
+	}
+}
+
+// firehoseUpgrader refuses the handshakes of pages of other origins, which
+// browsers send along with the basic auth credentials of the dispatcher
+var firehoseUpgrader = websocket.Upgrader{}
+
+// handler serves the firehose over WebSocket. The optional repo query
+// parameter limits the stream to a repository.
+func (f *firehose) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := firehoseUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader already replied with an error
+			logDebug("Failed to upgrade firehose connection: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		client := f.subscribe(strings.TrimSpace(r.URL.Query().Get("repo")))
+		defer f.unsubscribe(client)
+		logDebug("Firehose client connected from %s", r.RemoteAddr)
+
+		// Clients only read; reading detects when they disconnect
+		gone := make(chan struct{})
+		go func() {
+			defer close(gone)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ping := time.NewTicker(firehosePingInterval)
+		defer ping.Stop()
+		for {
+			select {
+			case record, ok := <-client.records:
+				conn.SetWriteDeadline(time.Now().Add(firehoseWriteTimeout))
+				if !ok {
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "dispatcher shutting down"))
+					return
+				}
+				if err := conn.WriteMessage(websocket.TextMessage, record); err != nil {
+					return
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(firehoseWriteTimeout)); err != nil {
+					return
+				}
+			case <-gone:
+				logDebug("Firehose client %s disconnected", r.RemoteAddr)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestLoadConfig_HTTP(t *testing.T) {
+	config := loadConfig()
+
+	if config.HTTPAddr != "" {
+		t.Errorf("Expected HTTPAddr to be empty, got '%s'", config.HTTPAddr)
+	}
+	if config.FirehoseAuthToken != "" {
+		t.Errorf("Expected FirehoseAuthToken to be empty, got '%s'", config.FirehoseAuthToken)
+	}
+
+	os.Setenv("HTTP_ADDR", ":8080")
+	os.Setenv("FIREHOSE_AUTH_TOKEN", "secret")
+	defer os.Unsetenv("HTTP_ADDR")
+	defer os.Unsetenv("FIREHOSE_AUTH_TOKEN")
+
+	config = loadConfig()
+
+	if config.HTTPAddr != ":8080" {
+		t.Errorf("Expected HTTPAddr to be ':8080', got '%s'", config.HTTPAddr)
+	}
+	if config.FirehoseAuthToken != "secret" {
+		t.Errorf("Expected FirehoseAuthToken to be 'secret', got '%s'", config.FirehoseAuthToken)
+	}
+}
+
+// firehoseConfig serves the firehose to the token "secret"
+var firehoseConfig = Config{FirehoseAuthToken: "secret"}
+
+// dialFirehose connects to the firehose of the server with the query and the
+// token of firehoseConfig
+func dialFirehose(t *testing.T, server *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/firehose" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer secret"}})
+	if err != nil {
+		t.Fatalf("Failed to connect to firehose: %v", err)
+	}
+	return conn
+}
+
+func readFirehoseRecord(t *testing.T, conn *websocket.Conn) firehoseRecord {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var record firehoseRecord
+	if err := conn.ReadJSON(&record); err != nil {
+		t.Fatalf("Failed to read firehose record: %v", err)
+	}
+	return record
+}
+
+// waitForFirehoseClients waits until the firehose has n clients
+func waitForFirehoseClients(t *testing.T, f *firehose, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		connected := len(f.clients)
+		f.mu.Unlock()
+		if connected == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d firehose clients, got %d", n, connected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFirehose_StreamsMatchesAndJobs(t *testing.T) {
+	config := Config{OutputMode: outputModeList, PipelineQueueName: "pipeline", FirehoseAuthToken: "secret"}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	d.sink = &recordingSink{}
+
+	server := httptest.NewServer(newHTTPHandler(config, d))
+	defer server.Close()
+	conn := dialFirehose(t, server, "")
+	defer conn.Close()
+	waitForFirehoseClients(t, d.firehose, 1)
+
+	ctx := context.Background()
+	for _, payload := range []string{
+		`{"ref":"refs/heads/develop","repository":{"full_name":"owner/repo"}}`,
+		`{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`,
+	} {
+		if err := d.handleWebhookMessage(ctx, payload); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+
+	unmatched := readFirehoseRecord(t, conn)
+	if unmatched.Type != firehoseRecordMatch || unmatched.Matched || unmatched.Ref != "refs/heads/develop" || unmatched.Reason == "" {
+		t.Errorf("Expected an unmatched record with a reason, got %+v", unmatched)
+	}
+
+	matched := readFirehoseRecord(t, conn)
+	if matched.Type != firehoseRecordMatch || !matched.Matched || matched.RuleID != "build" || matched.EventType != eventTypePush {
+		t.Errorf("Expected a match of rule 'build', got %+v", matched)
+	}
+
+	job := readFirehoseRecord(t, conn)
+	if job.Type != firehoseRecordJob || job.Outcome != outcomeDispatched || job.Output != "queue 'pipeline'" {
+		t.Errorf("Expected a dispatched job record, got %+v", job)
+	}
+	if job.Job == nil || job.Job.Repo != "owner/repo" || job.Job.ID == "" {
+		t.Errorf("Expected the dispatched job, got %+v", job.Job)
+	}
+}
+
+func TestFirehose_RepoFilter(t *testing.T) {
+	d := newDispatcher(nil, firehoseConfig, nil)
+	server := httptest.NewServer(newHTTPHandler(firehoseConfig, d))
+	defer server.Close()
+	conn := dialFirehose(t, server, "?repo=owner/other")
+	defer conn.Close()
+	waitForFirehoseClients(t, d.firehose, 1)
+
+	for _, repo := range []string{"owner/repo", "owner/other"} {
+		event := GitHubEvent{Ref: "refs/heads/main"}
+		event.Repository.FullName = repo
+		d.firehose.match(&event, nil, "no rule")
+	}
+
+	record := readFirehoseRecord(t, conn)
+	if record.Repo != "owner/other" {
+		t.Errorf("Expected only records of owner/other, got %+v", record)
+	}
+}
+
+func TestFirehose_Auth(t *testing.T) {
+	config := Config{FirehoseAuthToken: "secret", StatusBasicAuth: "viewer:password"}
+	d := newDispatcher(nil, config, nil)
+	server := httptest.NewServer(newHTTPHandler(config, d))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/firehose"
+	for name, header := range map[string]http.Header{
+		"no token":    nil,
+		"query token": nil,
+		"wrong token": {"Authorization": {"Bearer wrong"}},
+	} {
+		target := url
+		if name == "query token" {
+			target += "?token=secret"
+		}
+		_, resp, err := websocket.DefaultDialer.Dial(target, header)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 with %s, got %v", name, err)
+		}
+	}
+
+	for _, header := range []http.Header{
+		{"Authorization": {"Bearer secret"}},
+		// Browsers send the basic auth credentials of the read-only
+		// endpoints, as they cannot set headers on WebSocket requests
+		{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("viewer:password"))}},
+	} {
+		conn, _, err := websocket.DefaultDialer.Dial(url, header)
+		if err != nil {
+			t.Fatalf("Expected %v to be accepted, got %v", header, err)
+		}
+		conn.Close()
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{
+		"Authorization": {"Bearer secret"},
+		"Origin":        {"https://evil.example"},
+	})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for a cross-origin handshake, got %v", err)
+	}
+}
+
+func TestFirehose_RequiresCredentials(t *testing.T) {
+	for name, config := range map[string]Config{
+		"none":     {},
+		"admin":    {AdminAuthToken: "admin"},
+		"firehose": {FirehoseAuthToken: "secret"},
+		"status":   {StatusAuthToken: "status"},
+	} {
+		rec := httptest.NewRecorder()
+		newHTTPHandler(config, newDispatcher(nil, config, nil)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/firehose", nil))
+
+		expected := http.StatusUnauthorized
+		if name == "none" || name == "admin" {
+			expected = http.StatusNotFound
+		}
+		if rec.Code != expected {
+			t.Errorf("Expected %d with %s credentials, got %d", expected, name, rec.Code)
+		}
+	}
+}
+
+func TestFirehose_Close(t *testing.T) {
+	d := newDispatcher(nil, firehoseConfig, nil)
+	server := httptest.NewServer(newHTTPHandler(firehoseConfig, d))
+	defer server.Close()
+	conn := dialFirehose(t, server, "")
+	defer conn.Close()
+	waitForFirehoseClients(t, d.firehose, 1)
+
+	d.firehose.close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected the connection to be closed as going away, got %v", err)
+	}
+}
+
+func TestFirehose_DropsRecordsForSlowClients(t *testing.T) {
+	f := newFirehose()
+	client := f.subscribe("")
+	defer f.unsubscribe(client)
+
+	dropped := firehoseDroppedRecords.Load()
+	event := GitHubEvent{}
+	event.Repository.FullName = "owner/repo"
+	for i := 0; i < firehoseBuffer+10; i++ {
+		f.match(&event, nil, "no rule")
+	}
+
+	if len(client.records) != firehoseBuffer {
+		t.Errorf("Expected %d buffered records, got %d", firehoseBuffer, len(client.records))
+	}
+	if got := firehoseDroppedRecords.Load() - dropped; got != 10 {
+		t.Errorf("Expected 10 dropped records, got %d", got)
+	}
+
+	var record firehoseRecord
+	if err := json.Unmarshal(<-client.records, &record); err != nil || record.Repo != "owner/repo" {
+		t.Errorf("Expected a buffered record of owner/repo, got %+v (%v)", record, err)
+	}
+}
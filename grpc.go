@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	dispatcherv1 "github.com/its-the-vibe/github-dispatcher/api/dispatcher/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer implements the dispatcher.v1.Dispatcher service on top of the
+// dispatcher the webhook input feeds
+type grpcServer struct {
+	dispatcherv1.UnimplementedDispatcherServer
+
+	d *Dispatcher
+}
+
+// serveGRPC serves the gRPC API on the listener until the context is cancelled
+func serveGRPC(ctx context.Context, listener net.Listener, config Config, d *Dispatcher) error {
+	var options []grpc.ServerOption
+	if config.GRPCAuthToken != "" {
+		options = append(options,
+			grpc.UnaryInterceptor(grpcAuthInterceptor(config.GRPCAuthToken)),
+			grpc.StreamInterceptor(grpcStreamAuthInterceptor(config.GRPCAuthToken)),
+		)
+	}
+	server := grpc.NewServer(options...)
+	dispatcherv1.RegisterDispatcherServer(server, &grpcServer{d: d})
+
+	stop := context.AfterFunc(ctx, server.GracefulStop)
+	defer stop()
+
+	logInfo("Serving gRPC API on %s", listener.Addr())
+	if err := server.Serve(listener); err != nil {
+		return fmt.Errorf("failed to serve gRPC API: %w", err)
+	}
+	return nil
+}
+
+// validateGRPCConfig requires GRPC_AUTH_TOKEN with GRPC_ADDR: submitted
+// events skip the signature checks webhooks must pass
+func validateGRPCConfig(config Config) error {
+	if config.GRPCAddr != "" && config.GRPCAuthToken == "" {
+		return errors.New("GRPC_ADDR requires GRPC_AUTH_TOKEN")
+	}
+	return nil
+}
+
+// grpcAuthorize rejects calls without an "authorization: Bearer
+// <GRPC_AUTH_TOKEN>" metadata entry
+func grpcAuthorize(ctx context.Context, expected []byte) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || subtle.ConstantTimeCompare([]byte(values[0]), expected) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid or missing authorization token")
+	}
+	return nil
+}
+
+func grpcAuthInterceptor(token string) grpc.UnaryServerInterceptor {
+	expected := []byte("Bearer " + token)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := grpcAuthorize(ctx, expected); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// grpcStreamAuthInterceptor authenticates streaming calls like the unary ones
+func grpcStreamAuthInterceptor(token string) grpc.StreamServerInterceptor {
+	expected := []byte("Bearer " + token)
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := grpcAuthorize(stream.Context(), expected); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+// SubmitEvent dispatches the event like a webhook read from the input. Events
+// are trusted, as callers authenticate with GRPC_AUTH_TOKEN, so their
+// signature is not verified.
+func (s *grpcServer) SubmitEvent(ctx context.Context, req *dispatcherv1.SubmitEventRequest) (*dispatcherv1.SubmitEventResponse, error) {
+	event, err := eventFromSource(req.GetSource())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ctx = withEventID(ctx)
+	logInfoContext(ctx, "Received %s event for repo: %s via gRPC", event.Type(), event.Repository.FullName)
+	rule, jobs, err := s.d.dispatch(ctx, event)
+	if errors.Is(err, errJobsDropped) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	resp := &dispatcherv1.SubmitEventResponse{Jobs: jobsToProto(jobs)}
+	if rule != nil {
+		resp.RuleId = rule.ID
+	}
+	return resp, nil
+}
+
+// TestMatch returns the rule the event matches and the jobs it would dispatch
+// without dispatching them
+func (s *grpcServer) TestMatch(ctx context.Context, req *dispatcherv1.TestMatchRequest) (*dispatcherv1.TestMatchResponse, error) {
+	event, err := eventFromSource(req.GetSource())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	result, err := s.d.match(ctx, event)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	return &dispatcherv1.TestMatchResponse{
+		Matched: result.Matched,
+		RuleId:  result.RuleID,
+		Reason:  result.Reason,
+		Queues:  result.Queues,
+		Jobs:    jobsToProto(result.Jobs),
+	}, nil
+}
+
+// eventFromSource returns the GitHub event of a typed event or raw payload
+func eventFromSource(source *dispatcherv1.EventSource) (GitHubEvent, error) {
+	var event GitHubEvent
+	switch {
+	case source.GetEvent() != nil:
+		e := source.GetEvent()
+		event.Ref = e.GetRef()
+		event.After = e.GetAfter()
+		event.Forced = e.GetForced()
+		event.Action = e.GetAction()
+		event.Repository.FullName = e.GetRepo()
+		if pr := e.GetPullRequest(); pr != nil {
+			event.PullRequest = &GitHubPullRequest{
+				Number:            int(pr.GetNumber()),
+				Title:             pr.GetTitle(),
+				Head:              GitHubPullRequestRef{Ref: pr.GetHeadRef(), SHA: pr.GetHeadSha()},
+				Base:              GitHubPullRequestRef{Ref: pr.GetBaseRef()},
+				AuthorAssociation: pr.GetAuthorAssociation(),
+			}
+			event.PullRequest.User.Login = pr.GetUser()
+		}
+	case source.GetPayload() != "":
+		if err := json.Unmarshal([]byte(source.GetPayload()), &event); err != nil {
+			return event, fmt.Errorf("failed to parse webhook payload: %w", err)
+		}
+	default:
+		return event, errors.New("an event or a payload is required")
+	}
+
+	if strings.TrimSpace(event.Repository.FullName) == "" {
+		return event, errors.New("the event has no repository")
+	}
+	return event, nil
+}
+
+func jobsToProto(jobs []Job) []*dispatcherv1.Job {
+	converted := make([]*dispatcherv1.Job, 0, len(jobs))
+	for _, job := range jobs {
+		converted = append(converted, &dispatcherv1.Job{
+			JobId:    job.ID,
+			RuleId:   job.RuleID,
+			Repo:     job.Repo,
+			Branch:   job.Branch,
+			Type:     job.Type,
+			Dir:      job.Dir,
+			Commands: job.Commands,
+			Metadata: job.Metadata,
+			Env:      job.Env,
+			Priority: int32(job.Priority),
+		})
+	}
+	return converted
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	dispatcherv1 "github.com/its-the-vibe/github-dispatcher/api/dispatcher/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestLoadConfig_GRPC(t *testing.T) {
+	config := loadConfig()
+
+	if config.GRPCAddr != "" {
+		t.Errorf("Expected GRPCAddr to be empty, got '%s'", config.GRPCAddr)
+	}
+	if config.GRPCAuthToken != "" {
+		t.Errorf("Expected GRPCAuthToken to be empty, got '%s'", config.GRPCAuthToken)
+	}
+
+	os.Setenv("GRPC_ADDR", "127.0.0.1:9090")
+	os.Setenv("GRPC_AUTH_TOKEN", "s3cret")
+	defer os.Unsetenv("GRPC_ADDR")
+	defer os.Unsetenv("GRPC_AUTH_TOKEN")
+
+	config = loadConfig()
+
+	if config.GRPCAddr != "127.0.0.1:9090" {
+		t.Errorf("Expected GRPCAddr to be '127.0.0.1:9090', got '%s'", config.GRPCAddr)
+	}
+	if config.GRPCAuthToken != "s3cret" {
+		t.Errorf("Expected GRPCAuthToken to be 's3cret', got '%s'", config.GRPCAuthToken)
+	}
+	if err := validateGRPCConfig(config); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	config.GRPCAuthToken = ""
+	if err := validateGRPCConfig(config); err == nil {
+		t.Error("Expected error for GRPC_ADDR without GRPC_AUTH_TOKEN, got nil")
+	}
+}
+
+// startGRPCServer serves the gRPC API of the dispatcher in memory and returns
+// a client for it
+func startGRPCServer(t *testing.T, config Config, d *Dispatcher) dispatcherv1.DispatcherClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serveGRPC(ctx, listener, config, d)
+	}()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create gRPC client: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		<-done
+	})
+	return dispatcherv1.NewDispatcherClient(conn)
+}
+
+func TestGRPC_TestMatch(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline:{{.RepoName}}"}
+	rules := []FilterRule{{
+		ID:       "build",
+		Repo:     "owner/repo",
+		Branch:   "refs/heads/main",
+		Commands: []Command{{Run: "make build"}},
+		Matrix:   map[string][]string{"go": {"1.21", "1.22"}},
+	}}
+	client := startGRPCServer(t, config, newDispatcher(nil, config, rules))
+
+	resp, err := client.TestMatch(context.Background(), &dispatcherv1.TestMatchRequest{
+		Source: &dispatcherv1.EventSource{Source: &dispatcherv1.EventSource_Event{Event: &dispatcherv1.Event{
+			Repo: "owner/repo",
+			Ref:  "refs/heads/main",
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("TestMatch failed: %v", err)
+	}
+	if !resp.GetMatched() || resp.GetRuleId() != "build" {
+		t.Errorf("Expected rule 'build' to match, got %v", resp)
+	}
+	if len(resp.GetQueues()) != 1 || resp.GetQueues()[0] != "pipeline:repo" {
+		t.Errorf("Expected queue 'pipeline:repo', got %v", resp.GetQueues())
+	}
+	if len(resp.GetJobs()) != 2 || resp.GetJobs()[0].GetCommands()[0] != "make build" {
+		t.Errorf("Expected 2 jobs running 'make build', got %v", resp.GetJobs())
+	}
+
+	// Raw payloads are matched like webhooks
+	resp, err = client.TestMatch(context.Background(), &dispatcherv1.TestMatchRequest{
+		Source: &dispatcherv1.EventSource{Source: &dispatcherv1.EventSource_Payload{
+			Payload: `{"ref":"refs/heads/develop","repository":{"full_name":"owner/repo"}}`,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("TestMatch failed: %v", err)
+	}
+	if resp.GetMatched() || resp.GetReason() == "" {
+		t.Errorf("Expected no match with a reason, got %v", resp)
+	}
+}
+
+func TestGRPC_InvalidEvent(t *testing.T) {
+	client := startGRPCServer(t, Config{}, newDispatcher(nil, Config{}, nil))
+
+	for name, source := range map[string]*dispatcherv1.EventSource{
+		"empty":         nil,
+		"no repository": {Source: &dispatcherv1.EventSource_Event{Event: &dispatcherv1.Event{Ref: "refs/heads/main"}}},
+		"invalid JSON":  {Source: &dispatcherv1.EventSource_Payload{Payload: "not json"}},
+	} {
+		_, err := client.SubmitEvent(context.Background(), &dispatcherv1.SubmitEventRequest{Source: source})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %s, got %v", name, err)
+		}
+	}
+}
+
+func TestGRPC_SubmitEvent(t *testing.T) {
+	rdb := unreachableRedis()
+	defer rdb.Close()
+
+	config := Config{OutputMode: outputModeList, PipelineQueueName: "pipeline", JobSchemaVersion: currentJobSchemaVersion}
+	rules := []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	client := startGRPCServer(t, config, newDispatcher(rdb, config, rules))
+
+	// Events matching no rule are accepted without dispatching jobs
+	resp, err := client.SubmitEvent(context.Background(), &dispatcherv1.SubmitEventRequest{
+		Source: &dispatcherv1.EventSource{Source: &dispatcherv1.EventSource_Event{Event: &dispatcherv1.Event{
+			Repo: "owner/other",
+			Ref:  "refs/heads/main",
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("SubmitEvent failed: %v", err)
+	}
+	if resp.GetRuleId() != "" || len(resp.GetJobs()) != 0 {
+		t.Errorf("Expected no rule and no jobs, got %v", resp)
+	}
+
+	// Failures to enqueue are reported to the caller
+	_, err = client.SubmitEvent(context.Background(), &dispatcherv1.SubmitEventRequest{
+		Source: &dispatcherv1.EventSource{Source: &dispatcherv1.EventSource_Event{Event: &dispatcherv1.Event{
+			Repo: "owner/repo",
+			Ref:  "refs/heads/main",
+		}}},
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable while Redis is unreachable, got %v", err)
+	}
+}
+
+func TestGRPC_AuthToken(t *testing.T) {
+	config := Config{GRPCAuthToken: "s3cret"}
+	client := startGRPCServer(t, config, newDispatcher(nil, config, nil))
+
+	request := &dispatcherv1.TestMatchRequest{
+		Source: &dispatcherv1.EventSource{Source: &dispatcherv1.EventSource_Event{Event: &dispatcherv1.Event{Repo: "owner/repo"}}},
+	}
+	if _, err := client.TestMatch(context.Background(), request); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without a token, got %v", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer wrong")
+	if _, err := client.TestMatch(ctx, request); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated with a wrong token, got %v", err)
+	}
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer s3cret")
+	if _, err := client.TestMatch(ctx, request); err != nil {
+		t.Errorf("Expected the call to succeed with the token, got %v", err)
+	}
+}
+
+// authStream is a server stream of the incoming metadata
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestGRPC_StreamAuthToken(t *testing.T) {
+	interceptor := grpcStreamAuthInterceptor("s3cret")
+	handled := false
+	handler := func(any, grpc.ServerStream) error {
+		handled = true
+		return nil
+	}
+
+	for token, expected := range map[string]codes.Code{"": codes.Unauthenticated, "Bearer wrong": codes.Unauthenticated, "Bearer s3cret": codes.OK} {
+		handled = false
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", token))
+		}
+		err := interceptor(nil, authStream{ctx: ctx}, &grpc.StreamServerInfo{}, handler)
+		if status.Code(err) != expected || handled != (expected == codes.OK) {
+			t.Errorf("Expected %v for token '%s', got %v (handled: %t)", expected, token, err, handled)
+		}
+	}
+}
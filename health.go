@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// readyRedisTimeout bounds the Redis ping of a readiness check
+const readyRedisTimeout = 2 * time.Second
+
+// inputActive reports whether the input is consuming webhooks: the pub/sub
+// subscription is confirmed, the last stream read succeeded, or the broker
+// connection is up. Inputs clear it while they reconnect.
+var inputActive atomic.Bool
+
+// readiness is the body of /readyz: the result of every check
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// healthHandler reports that the process is up
+func healthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// readyHandler reports whether the dispatcher can dispatch webhooks: Redis is
+// reachable when it is used, the input is consuming, and rules are loaded.
+// It answers 503 Service Unavailable when a check fails.
+func (d *Dispatcher) readyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := d.ready(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		if result.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+func (d *Dispatcher) ready(ctx context.Context) readiness {
+	result := readiness{Status: "ok", Checks: map[string]string{}}
+	check := func(name string, err error, ok string) {
+		if err != nil {
+			result.Status = "unavailable"
+			result.Checks[name] = err.Error()
+			return
+		}
+		result.Checks[name] = ok
+	}
+
+	if d.rdb != nil {
+		pingCtx, cancel := context.WithTimeout(ctx, readyRedisTimeout)
+		defer cancel()
+		check("redis", d.rdb.Ping(pingCtx).Err(), "ok")
+	}
+
+	var err error
+	if !inputActive.Load() {
+		err = fmt.Errorf("input %s is not consuming", d.config.InputMode)
+	}
+	check("input", err, "ok")
+
+	err = nil
+	rules := d.rules.Load().rules
+	if len(rules) == 0 {
+		err = fmt.Errorf("no rules loaded from %s", d.config.ConfigFilePath)
+	}
+	check("rules", err, fmt.Sprintf("%d loaded", len(rules)))
+
+	return result
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// getReadiness requests /readyz from the dispatcher's HTTP endpoints
+func getReadiness(t *testing.T, d *Dispatcher) (int, readiness) {
+	t.Helper()
+	server := httptest.NewServer(newHTTPHandler(d.config, d))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("Failed to get readiness: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result readiness
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode readiness: %v", err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestHealthz(t *testing.T) {
+	d := newDispatcher(nil, Config{}, nil)
+	server := httptest.NewServer(newHTTPHandler(Config{}, d))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("Failed to get health: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	// The process is up even when the dispatcher is not ready
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "ok" {
+		t.Errorf("Expected 200 ok, got %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	defer inputActive.Store(false)
+
+	config := Config{InputMode: inputModePubSub, ConfigFilePath: "config.json"}
+	rules := []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main"}}
+	d := newDispatcher(nil, config, rules)
+
+	inputActive.Store(false)
+	status, result := getReadiness(t, d)
+	if status != http.StatusServiceUnavailable || result.Status != "unavailable" {
+		t.Errorf("Expected 503 while the input is not consuming, got %d %+v", status, result)
+	}
+	if !strings.Contains(result.Checks["input"], "not consuming") {
+		t.Errorf("Expected the input check to fail, got '%s'", result.Checks["input"])
+	}
+
+	inputActive.Store(true)
+	status, result = getReadiness(t, d)
+	if status != http.StatusOK || result.Status != "ok" {
+		t.Errorf("Expected 200 once the input is consuming, got %d %+v", status, result)
+	}
+	if result.Checks["rules"] != "1 loaded" {
+		t.Errorf("Expected 1 rule loaded, got '%s'", result.Checks["rules"])
+	}
+	if _, ok := result.Checks["redis"]; ok {
+		t.Error("Expected no Redis check when Redis is not used")
+	}
+
+	status, result = getReadiness(t, newDispatcher(nil, config, nil))
+	if status != http.StatusServiceUnavailable || !strings.Contains(result.Checks["rules"], "no rules") {
+		t.Errorf("Expected 503 without rules, got %d %+v", status, result)
+	}
+}
+
+func TestReadyz_RedisUnreachable(t *testing.T) {
+	defer inputActive.Store(false)
+	inputActive.Store(true)
+
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+	d := newDispatcher(rdb, Config{InputMode: inputModePubSub}, []FilterRule{{Repo: "owner/repo"}})
+
+	status, result := getReadiness(t, d)
+	if status != http.StatusServiceUnavailable || result.Checks["redis"] == "ok" || result.Checks["redis"] == "" {
+		t.Errorf("Expected 503 with a failed Redis check, got %d %+v", status, result)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// heartbeat is the value of the heartbeat key. External monitors alert when
+// the key expires, or when last_event_at falls behind the webhook traffic.
+type heartbeat struct {
+	InstanceID       string `json:"instance_id"`
+	Version          string `json:"version"`
+	Commit           string `json:"commit"`
+	BuildDate        string `json:"build_date"`
+	RulesFingerprint string `json:"rules_fingerprint"`
+	StartedAt        string `json:"started_at"`
+	UpdatedAt        string `json:"updated_at"`
+	LastEventAt      string `json:"last_event_at,omitempty"`
+}
+
+// rulesFingerprint returns a short hash of the loaded filter rules, so
+// monitors can tell whether all replicas run the same configuration
+func rulesFingerprint(rules []FilterRule) string {
+	data, _ := json.Marshal(rules)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// runHeartbeat sets the heartbeat key of this instance every
+// HEARTBEAT_INTERVAL until the context is cancelled, then deletes it
+func (d *Dispatcher) runHeartbeat(ctx context.Context) {
+	defer close(d.heartbeatDone)
+
+	rdb, config := d.rdb, d.config
+	key := config.HeartbeatKeyPrefix + config.InputStreamConsumer
+	beat := heartbeat{
+		InstanceID:       config.InputStreamConsumer,
+		Version:          version,
+		Commit:           buildCommit(),
+		BuildDate:        buildTime(),
+		RulesFingerprint: rulesFingerprint(d.rules.Load().rules),
+		StartedAt:        time.Now().UTC().Format(time.RFC3339),
+	}
+
+	ticker := time.NewTicker(config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		beat.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		if lastEvent := d.lastEvent.Load(); lastEvent > 0 {
+			beat.LastEventAt = time.Unix(0, lastEvent).UTC().Format(time.RFC3339)
+		}
+		value, _ := json.Marshal(beat)
+		if err := rdb.Set(ctx, key, value, config.HeartbeatTTL).Err(); err != nil && ctx.Err() == nil {
+			logError("Failed to set heartbeat key '%s': %v", key, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			// A stopped dispatcher is not hung, so monitors should not wait
+			// for the key to expire
+			if err := rdb.Del(context.WithoutCancel(ctx), key).Err(); err != nil {
+				logError("Failed to delete heartbeat key '%s': %v", key, err)
+			}
+			return
+		}
+	}
+}
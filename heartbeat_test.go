@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_Heartbeat(t *testing.T) {
+	config := loadConfig()
+
+	if config.HeartbeatInterval != 0 {
+		t.Errorf("Expected HeartbeatInterval to be 0, got %s", config.HeartbeatInterval)
+	}
+	if config.HeartbeatTTL != 30*time.Second {
+		t.Errorf("Expected HeartbeatTTL to be 30s, got %s", config.HeartbeatTTL)
+	}
+	if config.HeartbeatKeyPrefix != "github-dispatcher:heartbeat:" {
+		t.Errorf("Expected HeartbeatKeyPrefix to be 'github-dispatcher:heartbeat:', got '%s'", config.HeartbeatKeyPrefix)
+	}
+
+	os.Setenv("HEARTBEAT_INTERVAL", "5s")
+	os.Setenv("HEARTBEAT_TTL", "20s")
+	os.Setenv("HEARTBEAT_KEY_PREFIX", "dispatcher:alive:")
+	defer os.Unsetenv("HEARTBEAT_INTERVAL")
+	defer os.Unsetenv("HEARTBEAT_TTL")
+	defer os.Unsetenv("HEARTBEAT_KEY_PREFIX")
+
+	config = loadConfig()
+
+	if config.HeartbeatInterval != 5*time.Second {
+		t.Errorf("Expected HeartbeatInterval to be 5s, got %s", config.HeartbeatInterval)
+	}
+	if config.HeartbeatTTL != 20*time.Second {
+		t.Errorf("Expected HeartbeatTTL to be 20s, got %s", config.HeartbeatTTL)
+	}
+	if config.HeartbeatKeyPrefix != "dispatcher:alive:" {
+		t.Errorf("Expected HeartbeatKeyPrefix to be 'dispatcher:alive:', got '%s'", config.HeartbeatKeyPrefix)
+	}
+}
+
+func TestRulesFingerprint(t *testing.T) {
+	rules := []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main"}}
+
+	fingerprint := rulesFingerprint(rules)
+	if len(fingerprint) != 12 {
+		t.Errorf("Expected a 12 character fingerprint, got '%s'", fingerprint)
+	}
+	if rulesFingerprint([]FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main"}}) != fingerprint {
+		t.Error("Expected the same rules to give the same fingerprint")
+	}
+	if rulesFingerprint([]FilterRule{{Repo: "owner/repo", Branch: "refs/heads/dev"}}) == fingerprint {
+		t.Error("Expected different rules to give different fingerprints")
+	}
+}
+
+func TestHandleWebhookMessage_RecordsLastEvent(t *testing.T) {
+	d := newDispatcher(nil, Config{}, nil)
+	if d.lastEvent.Load() != 0 {
+		t.Fatal("Expected no last event before any webhook")
+	}
+
+	// Even webhooks that fail to be handled show the dispatcher is alive
+	d.handleWebhookMessage(context.Background(), "not json")
+	if d.lastEvent.Load() == 0 {
+		t.Error("Expected the last event time to be recorded")
+	}
+}
+
+func TestHeartbeat_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		InputStreamConsumer: "test-instance",
+		HeartbeatInterval:   time.Hour,
+		HeartbeatTTL:        2 * time.Hour,
+		HeartbeatKeyPrefix:  "test-heartbeat:",
+	}
+	key := "test-heartbeat:test-instance"
+
+	// Clean up before test
+	rdb.Del(ctx, key)
+	defer rdb.Del(ctx, key)
+
+	d := newDispatcher(rdb, config, []FilterRule{{Repo: "owner/repo"}})
+	d.lastEvent.Store(time.Now().UnixNano())
+
+	runCtx, cancel := context.WithCancel(ctx)
+	d.run(runCtx)
+
+	var value string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if value = rdb.Get(ctx, key).Val(); value != "" {
+			break
+		}
+	}
+
+	var beat heartbeat
+	if err := json.Unmarshal([]byte(value), &beat); err != nil {
+		t.Fatalf("Failed to parse heartbeat '%s': %v", value, err)
+	}
+	if beat.InstanceID != "test-instance" || beat.RulesFingerprint == "" || beat.LastEventAt == "" {
+		t.Errorf("Expected instance, fingerprint and last event in the heartbeat, got %+v", beat)
+	}
+	if ttl := rdb.TTL(ctx, key).Val(); ttl <= time.Hour {
+		t.Errorf("Expected the heartbeat TTL to be HEARTBEAT_TTL, got %s", ttl)
+	}
+
+	// A stopped dispatcher removes its heartbeat
+	cancel()
+	d.wait()
+	if exists := rdb.Exists(ctx, key).Val(); exists != 0 {
+		t.Error("Expected the heartbeat key to be deleted on shutdown")
+	}
+}
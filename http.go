@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpShutdownTimeout   = 5 * time.Second
+)
+
+// newHTTPHandler returns the endpoints served on HTTP_ADDR
+func newHTTPHandler(config Config, d *Dispatcher) http.Handler {
+	// The policies are checked on startup
+	readOnly, admin, _ := newHTTPAccessPolicies(config)
+
+	mux := http.NewServeMux()
+	// The firehose streams the jobs with their env and metadata, so it is
+	// only served with credentials
+	if firehose := newFirehoseAccessPolicy(config, readOnly, admin); firehose.authenticates() {
+		mux.Handle("GET /firehose", firehose.require(d.firehose.handler()))
+	}
+	mux.Handle("GET /metrics", readOnly.require(metricsHandler()))
+	// The probes of the orchestrator are never authenticated
+	mux.Handle("GET /healthz", healthHandler())
+	mux.Handle("GET /readyz", d.readyHandler())
+	mux.Handle("GET /status", readOnly.require(d.statusHandler()))
+	mux.Handle("GET /dashboard", readOnly.require(dashboardHandler()))
+	mux.Handle("GET /dashboard/data", readOnly.require(d.dashboardDataHandler()))
+	// The admin endpoints change the dispatcher, so they are only served
+	// with credentials, and those changing it only to the same origin
+	if admin.authenticates() {
+		mux.Handle("GET /admin/loglevel", admin.require(logLevelHandler()))
+		mux.Handle("PUT /admin/loglevel", admin.require(sameOriginJSON(logLevelHandler())))
+		if d.archive != nil {
+			mux.Handle("POST /admin/replay", admin.require(sameOriginJSON(d.archive.replayHandler(d.handleWebhookMessage))))
+		}
+		if d.pause != nil {
+			mux.Handle("GET /admin/pause", admin.require(d.pauseStateHandler()))
+			mux.Handle("POST /admin/pause", admin.require(sameOriginJSON(d.pauseHandler())))
+			mux.Handle("POST /admin/resume", admin.require(sameOriginJSON(d.resumeHandler())))
+		}
+
+		mux.Handle("POST /dashboard/match", admin.require(sameOriginJSON(d.dashboardMatchHandler())))
+
+		rules := newRuleEditor(config, d)
+		mux.Handle("GET /api/rules", admin.require(rules.listHandler()))
+		mux.Handle("GET /api/rules/{id...}", admin.require(rules.getHandler()))
+		mux.Handle("POST /api/rules", admin.require(sameOriginJSON(lockable(config, rules.createHandler()))))
+		mux.Handle("PUT /api/rules/{id...}", admin.require(sameOriginJSON(lockable(config, rules.updateHandler()))))
+		mux.Handle("DELETE /api/rules/{id...}", admin.require(sameOriginJSON(lockable(config, rules.deleteHandler()))))
+	}
+	return mux
+}
+
+// serveHTTP serves the HTTP endpoints on the listener until the context is
+// cancelled
+func serveHTTP(ctx context.Context, listener net.Listener, config Config, d *Dispatcher) error {
+	server := &http.Server{
+		Handler:           newHTTPHandler(config, d),
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+	}
+	// Shutdown does not close hijacked WebSocket connections
+	server.RegisterOnShutdown(d.firehose.close)
+
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	})
+	defer stop()
+
+	logInfo("Serving HTTP endpoints on %s", listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve HTTP endpoints: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// accessPolicy is who may call a class of HTTP endpoints: requests must come
+// from one of the networks, if any, and carry one of the credentials, if any
+type accessPolicy struct {
+	// credentials are the accepted Authorization headers
+	credentials [][]byte
+	networks    []netip.Prefix
+	// basic challenges browsers for a user and password
+	basic bool
+}
+
+// newAccessPolicy returns the policy of a bearer token, a user:password for
+// basic auth and a comma-separated list of IP addresses and CIDR ranges, any
+// of which may be empty
+func newAccessPolicy(token, basicAuth, allowedIPs string) (accessPolicy, error) {
+	var policy accessPolicy
+	if token != "" {
+		policy.credentials = append(policy.credentials, []byte("Bearer "+token))
+	}
+	if basicAuth != "" {
+		if user, password, ok := strings.Cut(basicAuth, ":"); !ok || user == "" || password == "" {
+			return accessPolicy{}, errors.New("basic auth must be user:password")
+		}
+		policy.credentials = append(policy.credentials, []byte("Basic "+base64.StdEncoding.EncodeToString([]byte(basicAuth))))
+		policy.basic = true
+	}
+	for _, item := range splitList(allowedIPs) {
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(item)
+			if addrErr != nil {
+				return accessPolicy{}, fmt.Errorf("'%s' is not an IP address or CIDR range", item)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		policy.networks = append(policy.networks, prefix.Masked())
+	}
+	return policy, nil
+}
+
+// newHTTPAccessPolicies returns the policies of the read-only endpoints, such
+// as /status, and of the admin endpoints. Admin credentials are accepted by
+// the read-only endpoints too.
+func newHTTPAccessPolicies(config Config) (readOnly, admin accessPolicy, err error) {
+	if admin, err = newAccessPolicy(config.AdminAuthToken, config.AdminBasicAuth, config.AdminAllowedIPs); err != nil {
+		return accessPolicy{}, accessPolicy{}, fmt.Errorf("invalid ADMIN_* access: %w", err)
+	}
+	if readOnly, err = newAccessPolicy(config.StatusAuthToken, config.StatusBasicAuth, config.StatusAllowedIPs); err != nil {
+		return accessPolicy{}, accessPolicy{}, fmt.Errorf("invalid STATUS_* access: %w", err)
+	}
+	if readOnly.authenticates() {
+		readOnly.credentials = append(readOnly.credentials, admin.credentials...)
+		readOnly.basic = readOnly.basic || admin.basic
+	}
+	return readOnly, admin, nil
+}
+
+// newFirehoseAccessPolicy returns the policy of /firehose: the read-only one,
+// also accepting FIREHOSE_AUTH_TOKEN, and then the admin credentials too
+func newFirehoseAccessPolicy(config Config, readOnly, admin accessPolicy) accessPolicy {
+	if config.FirehoseAuthToken == "" {
+		return readOnly
+	}
+	firehose := readOnly
+	firehose.credentials = append(slices.Clone(readOnly.credentials), []byte("Bearer "+config.FirehoseAuthToken))
+	if !readOnly.authenticates() {
+		firehose.credentials = append(firehose.credentials, admin.credentials...)
+		firehose.basic = admin.basic
+	}
+	return firehose
+}
+
+func validateHTTPAuthConfig(config Config) error {
+	_, admin, err := newHTTPAccessPolicies(config)
+	if err != nil {
+		return err
+	}
+	if len(admin.networks) > 0 && !admin.authenticates() {
+		return errors.New("ADMIN_ALLOWED_IPS requires ADMIN_AUTH_TOKEN or ADMIN_BASIC_AUTH")
+	}
+	return nil
+}
+
+// authenticates reports whether requests must carry credentials
+func (p accessPolicy) authenticates() bool {
+	return len(p.credentials) > 0
+}
+
+// allows reports whether a request from the address is allowed
+func (p accessPolicy) allows(remoteAddr string) bool {
+	if len(p.networks) == 0 {
+		return true
+	}
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, network := range p.networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorized reports whether the Authorization header is one of the
+// credentials, comparing all of them in constant time
+func (p accessPolicy) authorized(header string) bool {
+	matched := 0
+	for _, credential := range p.credentials {
+		matched |= subtle.ConstantTimeCompare([]byte(header), credential)
+	}
+	return matched == 1
+}
+
+// require rejects the requests the policy does not allow
+func (p accessPolicy) require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.allows(r.RemoteAddr) {
+			http.Error(w, "forbidden from this address", http.StatusForbidden)
+			return
+		}
+		if p.authenticates() && !p.authorized(r.Header.Get("Authorization")) {
+			if p.basic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="github-dispatcher"`)
+			}
+			http.Error(w, "invalid or missing authorization token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// crossOrigin rejects the unsafe requests browsers send on behalf of other
+// sites, going by their Sec-Fetch-Site or Origin header
+var crossOrigin = http.NewCrossOriginProtection()
+
+// sameOriginJSON guards the admin endpoints changing the dispatcher. Browsers
+// send basic auth credentials along with the requests of any site, so a page
+// visited by an admin could otherwise post a form to them: cross-site
+// requests are refused, and a body must be application/json, which forms
+// cannot send.
+func sameOriginJSON(next http.Handler) http.Handler {
+	return crossOrigin.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType := r.Header.Get("Content-Type"); contentType != "" || r.ContentLength != 0 {
+			if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+				http.Error(w, "the body must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_HTTPAccess(t *testing.T) {
+	config := loadConfig()
+
+	if config.AdminBasicAuth != "" || config.AdminAllowedIPs != "" || config.StatusAuthToken != "" || config.StatusBasicAuth != "" || config.StatusAllowedIPs != "" {
+		t.Errorf("Expected open read-only endpoints, got %+v", config)
+	}
+
+	os.Setenv("ADMIN_BASIC_AUTH", "admin:password")
+	os.Setenv("ADMIN_ALLOWED_IPS", "10.0.0.0/8")
+	os.Setenv("STATUS_AUTH_TOKEN", "viewer-token")
+	os.Setenv("STATUS_BASIC_AUTH", "viewer:password")
+	os.Setenv("STATUS_ALLOWED_IPS", "10.0.0.0/8,127.0.0.1")
+	defer os.Unsetenv("ADMIN_BASIC_AUTH")
+	defer os.Unsetenv("ADMIN_ALLOWED_IPS")
+	defer os.Unsetenv("STATUS_AUTH_TOKEN")
+	defer os.Unsetenv("STATUS_BASIC_AUTH")
+	defer os.Unsetenv("STATUS_ALLOWED_IPS")
+
+	config = loadConfig()
+	if config.AdminBasicAuth != "admin:password" {
+		t.Errorf("Expected AdminBasicAuth to be 'admin:password', got '%s'", config.AdminBasicAuth)
+	}
+	if config.AdminAllowedIPs != "10.0.0.0/8" {
+		t.Errorf("Expected AdminAllowedIPs to be '10.0.0.0/8', got '%s'", config.AdminAllowedIPs)
+	}
+	if config.StatusAuthToken != "viewer-token" {
+		t.Errorf("Expected StatusAuthToken to be 'viewer-token', got '%s'", config.StatusAuthToken)
+	}
+	if config.StatusBasicAuth != "viewer:password" {
+		t.Errorf("Expected StatusBasicAuth to be 'viewer:password', got '%s'", config.StatusBasicAuth)
+	}
+	if config.StatusAllowedIPs != "10.0.0.0/8,127.0.0.1" {
+		t.Errorf("Expected StatusAllowedIPs to be '10.0.0.0/8,127.0.0.1', got '%s'", config.StatusAllowedIPs)
+	}
+	if err := validateHTTPAuthConfig(config); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+}
+
+func TestValidateHTTPAuthConfig(t *testing.T) {
+	for name, config := range map[string]Config{
+		"basic auth without password": {AdminBasicAuth: "admin"},
+		"basic auth without user":     {StatusBasicAuth: ":password"},
+		"invalid address":             {StatusAllowedIPs: "10.0.0.300"},
+		"invalid range":               {AdminAuthToken: "secret", AdminAllowedIPs: "10.0.0.0/33"},
+		"admin addresses only":        {AdminAllowedIPs: "10.0.0.0/8"},
+	} {
+		if err := validateHTTPAuthConfig(config); err == nil {
+			t.Errorf("Expected error for %s, got nil", name)
+		}
+	}
+}
+
+func TestHTTPAccessControl(t *testing.T) {
+	config := Config{
+		AdminAuthToken:   "admin-token",
+		AdminAllowedIPs:  "10.0.0.0/8",
+		StatusAuthToken:  "viewer-token",
+		StatusBasicAuth:  "viewer:password",
+		StatusAllowedIPs: "10.0.0.0/8, 192.168.1.10, ::1",
+	}
+	handler := newHTTPHandler(config, newDispatcher(nil, config, nil))
+
+	request := func(path, remoteAddr string, authorize func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		if authorize != nil {
+			authorize(req)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	bearer := func(token string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	basic := func(user, password string) func(*http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(user, password) }
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		authorize  func(*http.Request)
+		status     int
+	}{
+		{"probe without credentials", "/healthz", "203.0.113.7:1234", nil, http.StatusOK},
+		{"status without credentials", "/status", "10.1.2.3:1234", nil, http.StatusUnauthorized},
+		{"status with the read-only token", "/status", "10.1.2.3:1234", bearer("viewer-token"), http.StatusOK},
+		{"status with basic auth", "/status", "192.168.1.10:1234", basic("viewer", "password"), http.StatusOK},
+		{"status with the wrong password", "/status", "10.1.2.3:1234", basic("viewer", "guess"), http.StatusUnauthorized},
+		{"status with the admin token", "/status", "10.1.2.3:1234", bearer("admin-token"), http.StatusOK},
+		{"status over IPv6", "/status", "[::1]:1234", bearer("viewer-token"), http.StatusOK},
+		{"status from another address", "/status", "192.168.1.11:1234", bearer("viewer-token"), http.StatusForbidden},
+		{"metrics with the read-only token", "/metrics", "10.1.2.3:1234", bearer("viewer-token"), http.StatusOK},
+		{"admin with the read-only token", "/admin/loglevel", "10.1.2.3:1234", bearer("viewer-token"), http.StatusUnauthorized},
+		{"admin with the admin token", "/admin/loglevel", "10.1.2.3:1234", bearer("admin-token"), http.StatusOK},
+		{"admin from another address", "/admin/loglevel", "127.0.0.1:1234", bearer("admin-token"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := request(tt.path, tt.remoteAddr, tt.authorize); rec.Code != tt.status {
+				t.Errorf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if rec := request("/status", "10.1.2.3:1234", nil); rec.Header().Get("WWW-Authenticate") == "" {
+		t.Error("Expected a basic auth challenge")
+	}
+}
+
+func TestHTTPAccessControl_BasicAuthOnlyAdmin(t *testing.T) {
+	config := Config{AdminBasicAuth: "admin:password"}
+	handler := newHTTPHandler(config, newDispatcher(nil, config, nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/loglevel", nil)
+	req.SetBasicAuth("admin", "password")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the admin endpoints to be served with basic auth, got %d", rec.Code)
+	}
+
+	// The read-only endpoints stay open
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected /status to be open, got %d", rec.Code)
+	}
+}
+
+func TestSameOriginJSON(t *testing.T) {
+	config := Config{AdminBasicAuth: "admin:password"}
+	handler := newHTTPHandler(config, newDispatcher(nil, config, nil))
+
+	tests := []struct {
+		name     string
+		header   map[string]string
+		expected int
+	}{
+		{"same origin", map[string]string{"Content-Type": "application/json", "Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"non-browser client", map[string]string{"Content-Type": "application/json; charset=utf-8"}, http.StatusOK},
+		{"form post", map[string]string{"Content-Type": "text/plain"}, http.StatusUnsupportedMediaType},
+		{"missing content type", nil, http.StatusUnsupportedMediaType},
+		{"cross-site", map[string]string{"Content-Type": "application/json", "Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"other origin", map[string]string{"Content-Type": "application/json", "Origin": "https://evil.example"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPut, "http://dispatcher.example/admin/loglevel", strings.NewReader(`{"level": "INFO"}`))
+		req.SetBasicAuth("admin", "password")
+		for key, value := range tt.header {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.expected {
+			t.Errorf("Expected %d for a %s request, got %d", tt.expected, tt.name, rec.Code)
+		}
+	}
+}
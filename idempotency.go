@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// duplicateEvents counts the events skipped because they were already
+// dispatched
+var duplicateEvents atomic.Int64
+
+// dispatchLedger records the dispatches that completed for IDEMPOTENCY_TTL,
+// so a webhook delivered again, e.g. redelivered by the stream input or
+// handled by another replica, is not dispatched twice
+type dispatchLedger struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func newDispatchLedger(rdb redis.UniversalClient, config Config) *dispatchLedger {
+	return &dispatchLedger{rdb: rdb, prefix: config.IdempotencyKeyPrefix, ttl: config.IdempotencyTTL}
+}
+
+func validateIdempotencyConfig(config Config) error {
+	if config.IdempotencyTTL < 0 {
+		return fmt.Errorf("IDEMPOTENCY_TTL must not be negative, got %s", config.IdempotencyTTL)
+	}
+	if config.IdempotencyTTL > 0 && !usesRedis(config) {
+		return fmt.Errorf("IDEMPOTENCY_TTL requires Redis, which is not used with INPUT_MODE %s and OUTPUT_MODE %s", config.InputMode, config.OutputMode)
+	}
+	return nil
+}
+
+// key identifies the dispatch of the event by the rule: the GitHub delivery
+// ID when the envelope carries it, otherwise the rule, event type, ref and
+// commit. Events with neither are not deduplicated.
+func (l *dispatchLedger) key(event GitHubEvent, rule *FilterRule) string {
+	if event.DeliveryID != "" {
+		return l.prefix + "delivery:" + event.DeliveryID
+	}
+	sha := event.CommitSHA()
+	if sha == "" {
+		return ""
+	}
+	return l.prefix + rule.ID + ":" + event.Type() + ":" + event.MatchRef() + ":" + sha
+}
+
+// dispatchedBy returns the ID of the event whose dispatch completed under
+// the key, or an empty string if there is none
+func (l *dispatchLedger) dispatchedBy(ctx context.Context, key string) (string, error) {
+	id, err := l.rdb.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return id, err
+}
+
+// record marks the dispatch under the key as completed by the event.
+// Failing to record it only risks a duplicate dispatch, so it is logged.
+func (l *dispatchLedger) record(ctx context.Context, key, eventID string) {
+	if err := l.rdb.Set(context.WithoutCancel(ctx), key, eventID, l.ttl).Err(); err != nil {
+		logWarnContext(ctx, "Failed to record dispatch '%s': %v", key, err)
+	}
+}
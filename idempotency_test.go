@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_Idempotency(t *testing.T) {
+	config := loadConfig()
+
+	if config.IdempotencyTTL != 0 {
+		t.Errorf("Expected IdempotencyTTL to be 0, got %s", config.IdempotencyTTL)
+	}
+	if config.IdempotencyKeyPrefix != "github-dispatcher:dispatched:" {
+		t.Errorf("Expected IdempotencyKeyPrefix to be 'github-dispatcher:dispatched:', got '%s'", config.IdempotencyKeyPrefix)
+	}
+
+	os.Setenv("IDEMPOTENCY_TTL", "24h")
+	os.Setenv("IDEMPOTENCY_KEY_PREFIX", "dispatched:")
+	defer os.Unsetenv("IDEMPOTENCY_TTL")
+	defer os.Unsetenv("IDEMPOTENCY_KEY_PREFIX")
+
+	config = loadConfig()
+	if config.IdempotencyTTL != 24*time.Hour {
+		t.Errorf("Expected IdempotencyTTL to be 24h, got %s", config.IdempotencyTTL)
+	}
+	if config.IdempotencyKeyPrefix != "dispatched:" {
+		t.Errorf("Expected IdempotencyKeyPrefix to be 'dispatched:', got '%s'", config.IdempotencyKeyPrefix)
+	}
+}
+
+func TestValidateIdempotencyConfig(t *testing.T) {
+	if err := validateIdempotencyConfig(Config{IdempotencyTTL: time.Hour, InputMode: inputModeStream, OutputMode: outputModeList}); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateIdempotencyConfig(Config{IdempotencyTTL: -time.Hour}); err == nil {
+		t.Error("Expected error for negative TTL, got nil")
+	}
+	if err := validateIdempotencyConfig(Config{IdempotencyTTL: time.Hour, InputMode: inputModeNATS, OutputMode: outputModeNATS}); err == nil {
+		t.Error("Expected error for idempotency without Redis, got nil")
+	}
+}
+
+func TestDispatchLedger_Key(t *testing.T) {
+	ledger := newDispatchLedger(nil, Config{IdempotencyKeyPrefix: "dispatched:"})
+	rule := &FilterRule{ID: "build"}
+
+	var event GitHubEvent
+	json.Unmarshal([]byte(`{"ref":"refs/heads/main","after":"abc123","repository":{"full_name":"owner/repo"}}`), &event)
+	if key := ledger.key(event, rule); key != "dispatched:build:push:refs/heads/main:abc123" {
+		t.Errorf("Expected the key of the rule and commit, got '%s'", key)
+	}
+
+	event.DeliveryID = "72d3162e-cc78-11e3-81ab-4c9367dc0958"
+	if key := ledger.key(event, rule); key != "dispatched:delivery:72d3162e-cc78-11e3-81ab-4c9367dc0958" {
+		t.Errorf("Expected the key of the delivery, got '%s'", key)
+	}
+
+	if key := ledger.key(GitHubEvent{}, rule); key != "" {
+		t.Errorf("Expected no key without delivery or commit, got '%s'", key)
+	}
+}
+
+func TestDispatch_SkipsDuplicates_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{PipelineQueueName: "pipeline", IdempotencyTTL: time.Minute, IdempotencyKeyPrefix: "test-dispatched:"}
+	key := config.IdempotencyKeyPrefix + "build:push:refs/heads/main:abc123"
+
+	// Clean up before test
+	rdb.Del(ctx, key)
+	defer rdb.Del(ctx, key)
+
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(rdb, config, rules)
+	sink := &recordingSink{}
+	d.sink = sink
+	audit := &recordingAuditLog{}
+	d.auditLog = audit
+
+	payload := `{"ref":"refs/heads/main","after":"abc123","repository":{"full_name":"owner/repo"}}`
+	for i := 0; i < 2; i++ {
+		if err := d.handleWebhookMessage(ctx, payload); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+
+	if len(sink.jobs) != 1 {
+		t.Errorf("Expected the redelivered webhook not to be dispatched again, got %d job(s)", len(sink.jobs))
+	}
+	if len(audit.records) != 2 || audit.records[1].Decision != auditDuplicate {
+		t.Errorf("Expected the second event to be recorded as a duplicate, got %+v", audit.records)
+	}
+	if ttl := rdb.TTL(ctx, key).Val(); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected the dispatch to be recorded for IDEMPOTENCY_TTL, got TTL %s", ttl)
+	}
+}
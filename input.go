@@ -0,0 +1,532 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	inputModePubSub = "pubsub"
+	inputModeStream = "stream"
+)
+
+const (
+	streamReadCount = 10
+	streamReadBlock = 5 * time.Second
+	streamErrorWait = time.Second
+
+	pubsubBackoffMin = 500 * time.Millisecond
+	pubsubBackoffMax = 30 * time.Second
+)
+
+// pubsubReconnects counts how often the pub/sub subscription was re-established
+var pubsubReconnects atomic.Int64
+
+type messageHandler func(ctx context.Context, payload string) error
+
+func init() {
+	registerEventSource(inputModePubSub, func(config Config, c clients) EventSource {
+		return &pubSubSource{rdb: c.rdb, config: config}
+	})
+	registerEventSource(inputModeStream, func(config Config, c clients) EventSource {
+		return &streamSource{rdb: c.rdb, config: config}
+	})
+}
+
+// pubSubSource reads webhooks from the REDIS_CHANNEL pub/sub channel
+type pubSubSource struct {
+	rdb    redis.UniversalClient
+	config Config
+}
+
+func (s *pubSubSource) consume(ctx context.Context, handle messageHandler) error {
+	if s.config.PubSubDeliveryLockTTL > 0 {
+		logInfo("Delivery locks enabled, each message is handled by one dispatcher (TTL %s)", s.config.PubSubDeliveryLockTTL)
+		handle = withDeliveryLock(s.rdb, s.config, handle)
+	}
+	channels, err := parseRedisChannels(s.config.RedisChannel)
+	if err != nil {
+		return err
+	}
+	watchdog := newSubscriptionWatchdog(s.rdb, s.config)
+	if watchdog != nil {
+		logInfo("Subscription watchdog enabled, probing '%s' after %s without messages", watchdog.channel, watchdog.interval)
+	}
+	return consumePubSub(ctx, s.rdb, channels, watchdog, handle)
+}
+
+// pubsubChannel is an entry of REDIS_CHANNEL: a channel, or a pattern when it
+// contains glob characters, with the event type of payloads that do not tell
+// theirs (e.g. "github-releases=release")
+type pubsubChannel struct {
+	name      string
+	pattern   bool
+	eventType string
+}
+
+// parseRedisChannels parses the comma-separated REDIS_CHANNEL list
+func parseRedisChannels(value string) ([]pubsubChannel, error) {
+	var channels []pubsubChannel
+	for _, item := range splitList(value) {
+		name, eventType, _ := strings.Cut(item, "=")
+		name, eventType = strings.TrimSpace(name), strings.TrimSpace(eventType)
+		if name == "" {
+			return nil, fmt.Errorf("invalid REDIS_CHANNEL entry '%s': missing channel name", item)
+		}
+		if eventType != "" && !slices.Contains(hintEventTypes, eventType) {
+			return nil, fmt.Errorf("invalid REDIS_CHANNEL entry '%s': unknown event type '%s', expected one of %s", item, eventType, strings.Join(hintEventTypes, ", "))
+		}
+		channels = append(channels, pubsubChannel{
+			name:      name,
+			pattern:   strings.ContainsAny(name, "*?["),
+			eventType: eventType,
+		})
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("REDIS_CHANNEL must name at least one channel")
+	}
+	return channels, nil
+}
+
+// eventTypeHintKey is the context key of the event type of the channel a
+// payload was received on
+type eventTypeHintKey struct{}
+
+func withEventTypeHint(ctx context.Context, eventType string) context.Context {
+	if eventType == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, eventTypeHintKey{}, eventType)
+}
+
+// eventTypeHint returns the event type of the channel the payload being
+// handled was received on, if it has one
+func eventTypeHint(ctx context.Context) string {
+	eventType, _ := ctx.Value(eventTypeHintKey{}).(string)
+	return eventType
+}
+
+// streamSource reads webhooks from the INPUT_STREAM Redis Stream
+type streamSource struct {
+	rdb    redis.UniversalClient
+	config Config
+}
+
+func (s *streamSource) consume(ctx context.Context, handle messageHandler) error {
+	return consumeStream(ctx, s.rdb, s.config, handle)
+}
+
+// consumePubSub subscribes to the webhook channels and keeps the subscription
+// alive: when receiving fails the subscription is dropped and re-established
+// with exponential backoff and jitter until the context is cancelled. So is a
+// subscription the watchdog, if any, finds silently broken.
+func consumePubSub(ctx context.Context, rdb redis.UniversalClient, channels []pubsubChannel, watchdog *subscriptionWatchdog, handle messageHandler) error {
+	attempt := 0
+	for {
+		subscribed, err := receivePubSub(ctx, rdb, channels, watchdog, handle)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if subscribed {
+			attempt = 0
+		}
+
+		delay := backoffDelay(attempt, pubsubBackoffMin, pubsubBackoffMax)
+		attempt++
+		reconnects := pubsubReconnects.Add(1)
+		logWarn("Subscription to %s lost: %v; reconnecting in %s (reconnect #%d)", describeChannels(channels), err, delay.Round(time.Millisecond), reconnects)
+		sleepContext(ctx, delay)
+	}
+}
+
+// receivePubSub handles messages of a single subscription until it fails or
+// the context is cancelled. It reports whether the subscription was confirmed
+// so callers can reset their backoff.
+func receivePubSub(ctx context.Context, rdb redis.UniversalClient, channels []pubsubChannel, watchdog *subscriptionWatchdog, handle messageHandler) (bool, error) {
+	var names, patterns []string
+	hints := make(map[string]string, len(channels))
+	for _, channel := range channels {
+		if channel.pattern {
+			patterns = append(patterns, channel.name)
+		} else {
+			names = append(names, channel.name)
+		}
+		hints[channel.name] = channel.eventType
+	}
+	if watchdog != nil {
+		names = append(names, watchdog.channel)
+	}
+
+	pubsub := rdb.Subscribe(ctx, names...)
+	defer pubsub.Close()
+	if len(patterns) > 0 {
+		if err := pubsub.PSubscribe(ctx, patterns...); err != nil {
+			return false, fmt.Errorf("failed to subscribe to patterns: %w", err)
+		}
+	}
+
+	// Closing the subscription unblocks ReceiveMessage on shutdown
+	stop := context.AfterFunc(ctx, func() { pubsub.Close() })
+	defer stop()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return false, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	inputActive.Store(true)
+	defer inputActive.Store(false)
+
+	logInfo("Subscribed to %s", describeChannels(channels))
+	logInfo("Waiting for messages...")
+
+	var timedOut atomic.Bool
+	if watchdog != nil {
+		watchCtx, stopWatch := context.WithCancel(ctx)
+		defer stopWatch()
+		go watchdog.watch(watchCtx, func() {
+			timedOut.Store(true)
+			pubsub.Close()
+		})
+	}
+
+	for {
+		msg, err := pubsub.ReceiveMessage(ctx)
+		if timedOut.Load() {
+			return true, errors.New("the watchdog probe was not received")
+		}
+		if err != nil {
+			return true, err
+		}
+		if watchdog != nil {
+			watchdog.seen()
+			if msg.Channel == watchdog.channel {
+				watchdog.observe(msg.Payload)
+				continue
+			}
+		}
+
+		// Pattern messages carry the pattern they matched
+		subscription := msg.Channel
+		if msg.Pattern != "" {
+			subscription = msg.Pattern
+		}
+		// Messages being handled are finished even when shutting down
+		msgCtx := withEventID(withEventTypeHint(context.WithoutCancel(ctx), hints[subscription]))
+		logDebugPayloadContext(msgCtx, "Received message from channel '%s':\n%s", msg.Channel, msg.Payload)
+		if err := handle(msgCtx, msg.Payload); err != nil {
+			logErrorContext(msgCtx, "Error handling webhook message: %v", err)
+		}
+	}
+}
+
+func describeChannels(channels []pubsubChannel) string {
+	described := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		kind := "channel"
+		if channel.pattern {
+			kind = "pattern"
+		}
+		entry := fmt.Sprintf("%s '%s'", kind, channel.name)
+		if channel.eventType != "" {
+			entry += fmt.Sprintf(" (%s events)", channel.eventType)
+		}
+		described = append(described, entry)
+	}
+	return strings.Join(described, ", ")
+}
+
+// releaseDeliveryLockScript deletes a delivery lock only if it is still held
+// by the replica releasing it
+var releaseDeliveryLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// withDeliveryLock lets only one of several dispatcher replicas subscribed to
+// the same channel handle each message: the replica that first sets the lock
+// key of the payload claims it and handles it, the others skip it. Identical
+// payloads published within PUBSUB_DELIVERY_LOCK_TTL are handled only once,
+// unless the handling failed: the claim is then released so the message can
+// be handled when it is published again, e.g. redelivered by GitHub.
+func withDeliveryLock(rdb redis.UniversalClient, config Config, handle messageHandler) messageHandler {
+	return func(ctx context.Context, payload string) error {
+		key := deliveryLockKey(config.PubSubDeliveryLockPrefix, payload)
+		acquired, err := rdb.SetNX(ctx, key, config.InputStreamConsumer, config.PubSubDeliveryLockTTL).Result()
+		if err != nil {
+			return fmt.Errorf("failed to acquire delivery lock '%s': %w", key, err)
+		}
+		if !acquired {
+			logDebugContext(ctx, "Skipping message handled by another dispatcher (lock '%s')", key)
+			return nil
+		}
+
+		err = handle(ctx, payload)
+		if err != nil {
+			if releaseErr := releaseDeliveryLockScript.Run(context.WithoutCancel(ctx), rdb, []string{key}, config.InputStreamConsumer).Err(); releaseErr != nil {
+				logWarnContext(ctx, "Failed to release delivery lock '%s': %v", key, releaseErr)
+			}
+		}
+		return err
+	}
+}
+
+// deliveryLockKey returns the lock key of a message, so every replica
+// computes the same key: the GitHub delivery ID when the message is a signed
+// envelope carrying it, otherwise a hash of the payload
+func deliveryLockKey(prefix, payload string) string {
+	var envelope signedWebhook
+	if json.Unmarshal([]byte(payload), &envelope) == nil && envelope.Signature != "" && envelope.Delivery != "" {
+		return prefix + envelope.Delivery
+	}
+	sum := sha256.Sum256([]byte(payload))
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+// backoffDelay returns the exponential backoff for the given attempt, capped
+// at max, with jitter spreading it over the upper half of the interval
+func backoffDelay(attempt int, min, max time.Duration) time.Duration {
+	delay := max
+	if attempt < 32 && min<<attempt < max {
+		delay = min << attempt
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// consumeStream reads webhooks from a Redis Stream as a member of a consumer
+// group. Messages are acknowledged once handled, so messages of a crashed or
+// restarted dispatcher stay pending: the dispatcher handles its own pending
+// messages first when it starts, and claims those of other consumers after
+// INPUT_STREAM_CLAIM_IDLE, giving at-least-once processing.
+func consumeStream(ctx context.Context, rdb redis.UniversalClient, config Config, handle messageHandler) error {
+	checkpoint := newStreamCheckpoint(rdb, config)
+	start := "$"
+	if checkpoint != nil {
+		id, consumer, err := checkpoint.load(ctx)
+		if err != nil {
+			return err
+		}
+		if id != "" {
+			start = id
+			logInfo("Last checkpoint of stream '%s' is %s, acknowledged by consumer '%s'", config.InputStream, id, consumer)
+		}
+	}
+
+	err := rdb.XGroupCreateMkStream(ctx, config.InputStream, config.InputStreamGroup, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group '%s' on stream '%s': %w", config.InputStreamGroup, config.InputStream, err)
+	}
+	if err == nil && start != "$" {
+		logWarn("Created missing consumer group '%s' on stream '%s' after checkpoint %s", config.InputStreamGroup, config.InputStream, start)
+	}
+
+	logInfo("Consuming stream '%s' as consumer '%s' in group '%s'", config.InputStream, config.InputStreamConsumer, config.InputStreamGroup)
+	resumePendingStreamMessages(ctx, rdb, config, checkpoint, handle)
+	logInfo("Waiting for messages...")
+	inputActive.Store(true)
+	defer inputActive.Store(false)
+
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= config.InputStreamClaimIdle {
+			claimPendingStreamMessages(ctx, rdb, config, checkpoint, handle)
+			lastClaim = time.Now()
+		}
+
+		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    config.InputStreamGroup,
+			Consumer: config.InputStreamConsumer,
+			Streams:  []string{config.InputStream, ">"},
+			Count:    streamReadCount,
+			Block:    streamReadBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			inputActive.Store(true)
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			inputActive.Store(false)
+			logError("Failed to read from stream '%s': %v", config.InputStream, err)
+			sleepContext(ctx, streamErrorWait)
+			continue
+		}
+		inputActive.Store(true)
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				processStreamMessage(ctx, rdb, config, checkpoint, handle, msg)
+			}
+		}
+	}
+	return nil
+}
+
+// resumePendingStreamMessages handles the messages that were delivered to
+// this consumer but not acknowledged before it stopped, so a restarted
+// dispatcher resumes where it left off without waiting for the claim idle
+// time. Messages that fail again stay pending and are claimed later.
+func resumePendingStreamMessages(ctx context.Context, rdb redis.UniversalClient, config Config, checkpoint *streamCheckpoint, handle messageHandler) {
+	resumed := 0
+	after := "0"
+	for ctx.Err() == nil {
+		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    config.InputStreamGroup,
+			Consumer: config.InputStreamConsumer,
+			Streams:  []string{config.InputStream, after},
+			Count:    streamReadCount,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			logError("Failed to read pending messages of stream '%s': %v", config.InputStream, err)
+			return
+		}
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			break
+		}
+		for _, msg := range streams[0].Messages {
+			processStreamMessage(ctx, rdb, config, checkpoint, handle, msg)
+			after = msg.ID
+			resumed++
+		}
+	}
+	if resumed > 0 {
+		logInfo("Resumed %d message(s) of stream '%s' left pending by consumer '%s'", resumed, config.InputStream, config.InputStreamConsumer)
+	}
+}
+
+// claimPendingStreamMessages takes over messages that were delivered to a
+// consumer of the group but not acknowledged within the claim idle time,
+// e.g. those of a crashed replica, with XAUTOCLAIM. Messages delivered too
+// often are dead-lettered and acknowledged first so a payload that can never
+// be handled doesn't block the group forever.
+func claimPendingStreamMessages(ctx context.Context, rdb redis.UniversalClient, config Config, checkpoint *streamCheckpoint, handle messageHandler) {
+	pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: config.InputStream,
+		Group:  config.InputStreamGroup,
+		Idle:   config.InputStreamClaimIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+	if err != nil {
+		logError("Failed to list pending messages of stream '%s': %v", config.InputStream, err)
+		return
+	}
+
+	for _, entry := range pending {
+		if entry.RetryCount >= int64(config.InputStreamMaxDeliveries) {
+			dropStreamMessage(ctx, rdb, config, entry)
+		}
+	}
+
+	claimed := 0
+	start := "0-0"
+	for ctx.Err() == nil {
+		messages, next, err := rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   config.InputStream,
+			Group:    config.InputStreamGroup,
+			Consumer: config.InputStreamConsumer,
+			MinIdle:  config.InputStreamClaimIdle,
+			Start:    start,
+			Count:    100,
+		}).Result()
+		if err != nil {
+			logError("Failed to claim pending messages of stream '%s': %v", config.InputStream, err)
+			break
+		}
+		for _, msg := range messages {
+			processStreamMessage(ctx, rdb, config, checkpoint, handle, msg)
+		}
+		claimed += len(messages)
+		if next == "0-0" || next == "" {
+			break
+		}
+		start = next
+	}
+	if claimed > 0 {
+		logInfo("Claimed %d pending message(s) from stream '%s'", claimed, config.InputStream)
+	}
+}
+
+func processStreamMessage(ctx context.Context, rdb redis.UniversalClient, config Config, checkpoint *streamCheckpoint, handle messageHandler, msg redis.XMessage) {
+	payload, ok := msg.Values[config.InputStreamField].(string)
+	if !ok {
+		logError("Stream message %s has no '%s' field, acknowledging without processing", msg.ID, config.InputStreamField)
+	} else {
+		// Messages being handled are finished even when shutting down
+		msgCtx := withEventID(context.WithoutCancel(ctx))
+		logDebugPayloadContext(msgCtx, "Received message %s from stream '%s':\n%s", msg.ID, config.InputStream, payload)
+		if err := handle(msgCtx, payload); err != nil {
+			// Left unacknowledged so the message is retried after the claim idle time
+			logErrorContext(msgCtx, "Error handling stream message %s: %v", msg.ID, err)
+			return
+		}
+	}
+
+	ackStreamMessage(ctx, rdb, config, checkpoint, msg.ID)
+}
+
+// dropStreamMessage acknowledges a message that was delivered too often. With
+// DEAD_LETTER_QUEUE set it is pushed there first, and left pending to be
+// dropped with the next claim if that fails, so it is never lost unseen.
+func dropStreamMessage(ctx context.Context, rdb redis.UniversalClient, config Config, entry redis.XPendingExt) {
+	if config.DeadLetterQueue != "" {
+		messages, err := rdb.XRange(ctx, config.InputStream, entry.ID, entry.ID).Result()
+		if err != nil {
+			logError("Failed to read stream message %s: %v", entry.ID, err)
+			return
+		}
+		if len(messages) == 0 {
+			// Trimmed from the stream, only its pending entry is left
+			logError("Dropping stream message %s after %d deliveries, it is no longer in the stream", entry.ID, entry.RetryCount)
+			ackStreamMessage(ctx, rdb, config, nil, entry.ID)
+			return
+		}
+		if err := newDeadLetterQueue(rdb, config).addMessage(ctx, config.InputStream, messages[0], entry.RetryCount); err != nil {
+			logError("Failed to dead-letter stream message %s: %v", entry.ID, err)
+			return
+		}
+		logError("Dead-lettered stream message %s to '%s' after %d deliveries", entry.ID, config.DeadLetterQueue, entry.RetryCount)
+	} else {
+		logError("Dropping stream message %s after %d deliveries", entry.ID, entry.RetryCount)
+	}
+	ackStreamMessage(ctx, rdb, config, nil, entry.ID)
+}
+
+// ackStreamMessage acknowledges the message and advances the checkpoint of
+// the consumer, if enabled, in the same round trip
+func ackStreamMessage(ctx context.Context, rdb redis.UniversalClient, config Config, checkpoint *streamCheckpoint, id string) {
+	ctx = context.WithoutCancel(ctx)
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, config.InputStream, config.InputStreamGroup, id)
+		if checkpoint != nil {
+			checkpoint.advance(ctx, pipe, id)
+		}
+		return nil
+	})
+	if err != nil {
+		logError("Failed to acknowledge stream message %s: %v", id, err)
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{0, 500 * time.Millisecond},
+		{1, time.Second},
+		{3, 4 * time.Second},
+		{10, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		// Jitter spreads the delay over the upper half of the interval
+		for i := 0; i < 20; i++ {
+			delay := backoffDelay(tt.attempt, 500*time.Millisecond, 30*time.Second)
+			if delay < tt.ceiling/2 || delay > tt.ceiling {
+				t.Errorf("backoffDelay(%d) = %s, expected between %s and %s", tt.attempt, delay, tt.ceiling/2, tt.ceiling)
+			}
+		}
+	}
+}
+
+func TestParseRedisChannels(t *testing.T) {
+	channels, err := parseRedisChannels("github-webhook-push, github-webhook-pr=pull_request,github:release:*=release")
+	if err != nil {
+		t.Fatalf("Failed to parse channels: %v", err)
+	}
+
+	expected := []pubsubChannel{
+		{name: "github-webhook-push"},
+		{name: "github-webhook-pr", eventType: eventTypePullRequest},
+		{name: "github:release:*", pattern: true, eventType: eventTypeRelease},
+	}
+	if len(channels) != len(expected) {
+		t.Fatalf("Expected %d channels, got %d", len(expected), len(channels))
+	}
+	for i := range expected {
+		if channels[i] != expected[i] {
+			t.Errorf("Expected channel %d to be %+v, got %+v", i, expected[i], channels[i])
+		}
+	}
+
+	for _, value := range []string{"", " , ", "=push", "github-webhook=issues"} {
+		if _, err := parseRedisChannels(value); err == nil {
+			t.Errorf("Expected REDIS_CHANNEL '%s' to be rejected", value)
+		}
+	}
+}
+
+func TestEventTypeHint(t *testing.T) {
+	ctx := context.Background()
+	if hint := eventTypeHint(ctx); hint != "" {
+		t.Errorf("Expected no hint, got '%s'", hint)
+	}
+	if hint := eventTypeHint(withEventTypeHint(ctx, eventTypeRelease)); hint != eventTypeRelease {
+		t.Errorf("Expected hint '%s', got '%s'", eventTypeRelease, hint)
+	}
+}
+
+func TestLoadConfig_DeliveryLock(t *testing.T) {
+	config := loadConfig()
+
+	if config.PubSubDeliveryLockTTL != 0 {
+		t.Errorf("Expected PubSubDeliveryLockTTL to be 0, got %s", config.PubSubDeliveryLockTTL)
+	}
+	if config.PubSubDeliveryLockPrefix != "github-dispatcher:delivery:" {
+		t.Errorf("Expected PubSubDeliveryLockPrefix to be 'github-dispatcher:delivery:', got '%s'", config.PubSubDeliveryLockPrefix)
+	}
+
+	os.Setenv("PUBSUB_DELIVERY_LOCK_TTL", "10m")
+	os.Setenv("PUBSUB_DELIVERY_LOCK_PREFIX", "dispatcher:lock:")
+	defer os.Unsetenv("PUBSUB_DELIVERY_LOCK_TTL")
+	defer os.Unsetenv("PUBSUB_DELIVERY_LOCK_PREFIX")
+
+	config = loadConfig()
+
+	if config.PubSubDeliveryLockTTL != 10*time.Minute {
+		t.Errorf("Expected PubSubDeliveryLockTTL to be 10m, got %s", config.PubSubDeliveryLockTTL)
+	}
+	if config.PubSubDeliveryLockPrefix != "dispatcher:lock:" {
+		t.Errorf("Expected PubSubDeliveryLockPrefix to be 'dispatcher:lock:', got '%s'", config.PubSubDeliveryLockPrefix)
+	}
+}
+
+func TestDeliveryLockKey(t *testing.T) {
+	key := deliveryLockKey("lock:", `{"ref":"refs/heads/main"}`)
+	if !strings.HasPrefix(key, "lock:") || len(key) != len("lock:")+64 {
+		t.Errorf("Expected the prefix and a SHA-256 hex digest, got '%s'", key)
+	}
+	if deliveryLockKey("lock:", `{"ref":"refs/heads/main"}`) != key {
+		t.Error("Expected the same payload to give the same key")
+	}
+	if deliveryLockKey("lock:", `{"ref":"refs/heads/dev"}`) == key {
+		t.Error("Expected different payloads to give different keys")
+	}
+
+	// Envelopes of the same delivery are locked together, however they
+	// were published
+	signed := `{"signature_256":"sha256:abc","body":"{}","delivery":"72d3162e"}`
+	if key := deliveryLockKey("lock:", signed); key != "lock:72d3162e" {
+		t.Errorf("Expected the delivery ID to be the key, got '%s'", key)
+	}
+	if key := deliveryLockKey("lock:", `{"body":"{}","delivery":"72d3162e","signature_256":"sha256:abc"}`); key != "lock:72d3162e" {
+		t.Errorf("Expected the delivery ID to be the key, got '%s'", key)
+	}
+}
+
+func TestWithDeliveryLock_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		InputStreamConsumer:      "test-replica",
+		PubSubDeliveryLockTTL:    time.Minute,
+		PubSubDeliveryLockPrefix: "test-delivery:",
+	}
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"owner/test-repo"}}`
+
+	// Clean up before test
+	key := deliveryLockKey(config.PubSubDeliveryLockPrefix, payload)
+	rdb.Del(ctx, key)
+	defer rdb.Del(ctx, key)
+
+	handled := 0
+	handle := func(ctx context.Context, payload string) error {
+		handled++
+		return nil
+	}
+
+	// Every replica receives the message, but only one handles it
+	for _, replica := range []messageHandler{withDeliveryLock(rdb, config, handle), withDeliveryLock(rdb, config, handle)} {
+		if err := replica(ctx, payload); err != nil {
+			t.Fatalf("Failed to handle message: %v", err)
+		}
+	}
+
+	if handled != 1 {
+		t.Errorf("Expected the message to be handled once, got %d", handled)
+	}
+
+	// A failed message is released, so it is handled when published again
+	rdb.Del(ctx, key)
+	failing := withDeliveryLock(rdb, config, func(ctx context.Context, payload string) error {
+		return errors.New("connection refused")
+	})
+	if err := failing(ctx, payload); err == nil {
+		t.Fatal("Expected the handling to fail, got nil")
+	}
+	if exists := rdb.Exists(ctx, key).Val(); exists != 0 {
+		t.Error("Expected the lock of the failed message to be released")
+	}
+	if err := withDeliveryLock(rdb, config, handle)(ctx, payload); err != nil {
+		t.Fatalf("Failed to handle message: %v", err)
+	}
+	if handled != 2 {
+		t.Errorf("Expected the message published again to be handled, got %d", handled)
+	}
+
+	// A claim taken over by another replica is not released
+	rdb.Set(ctx, key, "other-replica", time.Minute)
+	releaseDeliveryLockScript.Run(ctx, rdb, []string{key}, config.InputStreamConsumer)
+	if owner := rdb.Get(ctx, key).Val(); owner != "other-replica" {
+		t.Errorf("Expected the lock of another replica to be kept, got '%s'", owner)
+	}
+}
+
+func TestConsumePubSub_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	channels, err := parseRedisChannels("test-webhook-push,test-webhook-release:*=release")
+	if err != nil {
+		t.Fatalf("Failed to parse channels: %v", err)
+	}
+
+	var mu sync.Mutex
+	received := map[string]string{}
+	done := make(chan struct{})
+	handle := func(ctx context.Context, payload string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received[payload] = eventTypeHint(ctx)
+		if len(received) == 2 {
+			close(done)
+		}
+		return nil
+	}
+
+	consumeCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go consumePubSub(consumeCtx, rdb, channels, nil, handle)
+
+	// Publish until both subscriptions are established
+	publish := time.NewTicker(100 * time.Millisecond)
+	defer publish.Stop()
+	for waiting := true; waiting; {
+		select {
+		case <-done:
+			waiting = false
+		case <-publish.C:
+			rdb.Publish(ctx, "test-webhook-push", "push-payload")
+			rdb.Publish(ctx, "test-webhook-release:owner", "release-payload")
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for messages")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if received["push-payload"] != "" {
+		t.Errorf("Expected no hint for the push channel, got '%s'", received["push-payload"])
+	}
+	if received["release-payload"] != eventTypeRelease {
+		t.Errorf("Expected hint '%s' for the release pattern, got '%s'", eventTypeRelease, received["release-payload"])
+	}
+}
+
+func TestConsumeStream_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		InputStream:              "test-webhook-stream",
+		InputStreamGroup:         "test-dispatchers",
+		InputStreamConsumer:      "test-consumer",
+		InputStreamField:         "payload",
+		InputStreamClaimIdle:     time.Minute,
+		InputStreamMaxDeliveries: 5,
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.InputStream)
+	defer rdb.Del(ctx, config.InputStream)
+
+	if err := rdb.XGroupCreateMkStream(ctx, config.InputStream, config.InputStreamGroup, "$").Err(); err != nil {
+		t.Fatalf("Failed to create consumer group: %v", err)
+	}
+
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"owner/test-repo"}}`
+	if err := rdb.XAdd(ctx, &redis.XAddArgs{Stream: config.InputStream, Values: map[string]interface{}{"payload": payload}}).Err(); err != nil {
+		t.Fatalf("Failed to add message to stream: %v", err)
+	}
+
+	consumeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var received []string
+	handle := func(ctx context.Context, payload string) error {
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+		cancel()
+		return nil
+	}
+
+	if err := consumeStream(consumeCtx, rdb, config, handle); err != nil {
+		t.Fatalf("Failed to consume stream: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0] != payload {
+		t.Fatalf("Expected to receive the published payload, got %v", received)
+	}
+
+	// Handled messages are acknowledged
+	pending, err := rdb.XPending(ctx, config.InputStream, config.InputStreamGroup).Result()
+	if err != nil {
+		t.Fatalf("Failed to get pending messages: %v", err)
+	}
+	if pending.Count != 0 {
+		t.Errorf("Expected no pending messages, got %d", pending.Count)
+	}
+}
+
+func TestClaimPendingStreamMessages_DeadLetter_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		InputStream:              "test-webhook-stream-dlq",
+		InputStreamGroup:         "test-dispatchers",
+		InputStreamConsumer:      "test-consumer",
+		InputStreamField:         "payload",
+		InputStreamClaimIdle:     time.Millisecond,
+		InputStreamMaxDeliveries: 1,
+		DeadLetterQueue:          "test-webhook-dead",
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.InputStream, config.DeadLetterQueue)
+	defer rdb.Del(ctx, config.InputStream, config.DeadLetterQueue)
+
+	if err := rdb.XGroupCreateMkStream(ctx, config.InputStream, config.InputStreamGroup, "$").Err(); err != nil {
+		t.Fatalf("Failed to create consumer group: %v", err)
+	}
+	id, err := rdb.XAdd(ctx, &redis.XAddArgs{Stream: config.InputStream, Values: map[string]interface{}{"payload": "not json"}}).Result()
+	if err != nil {
+		t.Fatalf("Failed to add message to stream: %v", err)
+	}
+	// Delivered once to a consumer that never acknowledges it
+	if err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{Group: config.InputStreamGroup, Consumer: "crashed", Streams: []string{config.InputStream, ">"}}).Err(); err != nil {
+		t.Fatalf("Failed to read from stream: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	handle := func(ctx context.Context, payload string) error {
+		t.Errorf("Expected the message not to be handled again, got %s", payload)
+		return nil
+	}
+	claimPendingStreamMessages(ctx, rdb, config, nil, handle)
+
+	pending, err := rdb.XPending(ctx, config.InputStream, config.InputStreamGroup).Result()
+	if err != nil {
+		t.Fatalf("Failed to get pending messages: %v", err)
+	}
+	if pending.Count != 0 {
+		t.Errorf("Expected the message to be acknowledged, got %d pending", pending.Count)
+	}
+
+	entries := rdb.LRange(ctx, config.DeadLetterQueue, 0, -1).Val()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 dead-lettered message, got %d", len(entries))
+	}
+	var entry deadLetterMessage
+	if err := json.Unmarshal([]byte(entries[0]), &entry); err != nil {
+		t.Fatalf("Failed to decode dead-lettered message: %v", err)
+	}
+	if entry.Stream != config.InputStream || entry.MessageID != id || entry.Fields["payload"] != "not json" || entry.Deliveries != 1 {
+		t.Errorf("Unexpected dead-lettered message: %+v", entry)
+	}
+}
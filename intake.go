@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const inputModeList = "list"
+
+func init() {
+	registerEventSource(inputModeList, func(config Config, c clients) EventSource {
+		return &listSource{rdb: c.rdb, config: config}
+	})
+}
+
+// listSource reads webhooks that receivers RPUSH to the INPUT_LIST list. Each
+// payload is moved to the processing list of the dispatcher with BLMOVE and
+// removed from it once handled, so payloads of a dispatcher that crashed
+// while handling them are not lost.
+type listSource struct {
+	rdb    redis.UniversalClient
+	config Config
+}
+
+// inputListProcessing returns the processing list of the dispatcher,
+// INPUT_LIST_PROCESSING or by default the intake list followed by
+// ":processing:" and the instance name
+func inputListProcessing(config Config) string {
+	if config.InputListProcessing != "" {
+		return config.InputListProcessing
+	}
+	return config.InputList + ":processing:" + config.InputStreamConsumer
+}
+
+func (s *listSource) consume(ctx context.Context, handle messageHandler) error {
+	intake, processing := s.config.InputList, inputListProcessing(s.config)
+	if err := recoverProcessingList(ctx, s.rdb, intake, processing); err != nil {
+		return err
+	}
+
+	logInfo("Consuming list '%s' with processing list '%s'", intake, processing)
+	logInfo("Waiting for messages...")
+	inputActive.Store(true)
+	defer inputActive.Store(false)
+
+	for ctx.Err() == nil {
+		payload, err := s.rdb.BLMove(ctx, intake, processing, "LEFT", "RIGHT", streamReadBlock).Result()
+		if errors.Is(err, redis.Nil) {
+			inputActive.Store(true)
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			inputActive.Store(false)
+			logError("Failed to read from list '%s': %v", intake, err)
+			sleepContext(ctx, streamErrorWait)
+			continue
+		}
+		inputActive.Store(true)
+
+		if err := processListMessage(ctx, s.rdb, intake, processing, handle, payload); err != nil {
+			sleepContext(ctx, streamErrorWait)
+		}
+	}
+	return nil
+}
+
+// recoverProcessingList moves the payloads left in the processing list by an
+// earlier run back to the head of the intake list, so they are handled first
+func recoverProcessingList(ctx context.Context, rdb redis.UniversalClient, intake, processing string) error {
+	recovered := 0
+	for {
+		err := rdb.LMove(ctx, processing, intake, "RIGHT", "LEFT").Err()
+		if errors.Is(err, redis.Nil) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to recover processing list '%s': %w", processing, err)
+		}
+		recovered++
+	}
+	if recovered > 0 {
+		logWarn("Recovered %d message(s) left in processing list '%s' by an earlier run", recovered, processing)
+	}
+	return nil
+}
+
+// processListMessage handles a payload moved to the processing list. Handled
+// payloads are removed from it; payloads that fail to be handled are moved
+// back to the tail of the intake list to be retried.
+func processListMessage(ctx context.Context, rdb redis.UniversalClient, intake, processing string, handle messageHandler, payload string) error {
+	// Messages being handled are finished even when shutting down
+	msgCtx := withEventID(context.WithoutCancel(ctx))
+	logDebugPayloadContext(msgCtx, "Received message from list '%s':\n%s", intake, payload)
+
+	handleErr := handle(msgCtx, payload)
+	_, err := rdb.TxPipelined(msgCtx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(msgCtx, processing, 1, payload)
+		if handleErr != nil {
+			pipe.RPush(msgCtx, intake, payload)
+		}
+		return nil
+	})
+	if handleErr != nil {
+		logErrorContext(msgCtx, "Error handling list message, requeued to '%s': %v", intake, handleErr)
+	}
+	if err != nil {
+		// The payload stays in the processing list and is recovered on restart
+		logErrorContext(msgCtx, "Failed to remove message from processing list '%s': %v", processing, err)
+	}
+	return handleErr
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_InputList(t *testing.T) {
+	config := loadConfig()
+
+	if config.InputList != "github-webhook-intake" {
+		t.Errorf("Expected InputList to be 'github-webhook-intake', got '%s'", config.InputList)
+	}
+	if config.InputListProcessing != "" {
+		t.Errorf("Expected InputListProcessing to be empty, got '%s'", config.InputListProcessing)
+	}
+
+	os.Setenv("INPUT_LIST", "webhooks")
+	os.Setenv("INPUT_LIST_PROCESSING", "webhooks:processing")
+	defer os.Unsetenv("INPUT_LIST")
+	defer os.Unsetenv("INPUT_LIST_PROCESSING")
+
+	config = loadConfig()
+	if config.InputList != "webhooks" {
+		t.Errorf("Expected InputList to be 'webhooks', got '%s'", config.InputList)
+	}
+	if config.InputListProcessing != "webhooks:processing" {
+		t.Errorf("Expected InputListProcessing to be 'webhooks:processing', got '%s'", config.InputListProcessing)
+	}
+}
+
+func TestInputListProcessing(t *testing.T) {
+	config := Config{InputList: "webhooks", InputStreamConsumer: "dispatcher-0"}
+	if processing := inputListProcessing(config); processing != "webhooks:processing:dispatcher-0" {
+		t.Errorf("Expected the processing list of the instance, got '%s'", processing)
+	}
+
+	config.InputListProcessing = "custom"
+	if processing := inputListProcessing(config); processing != "custom" {
+		t.Errorf("Expected INPUT_LIST_PROCESSING, got '%s'", processing)
+	}
+}
+
+func TestListSource_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{InputList: "test-webhook-intake", InputStreamConsumer: "test"}
+	processing := inputListProcessing(config)
+
+	// Clean up before test
+	rdb.Del(ctx, config.InputList, processing)
+	defer rdb.Del(ctx, config.InputList, processing)
+
+	// A payload left by a crashed run is handled first
+	rdb.RPush(ctx, processing, "crashed")
+	rdb.RPush(ctx, config.InputList, "first", "second")
+
+	var handled []string
+	failed := false
+	ctx, cancel := context.WithCancel(ctx)
+	handle := func(ctx context.Context, payload string) error {
+		if payload == "first" && !failed {
+			failed = true
+			return errors.New("dispatch failed")
+		}
+		handled = append(handled, payload)
+		if len(handled) == 3 {
+			cancel()
+		}
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- (&listSource{rdb: rdb, config: config}).consume(ctx, handle)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to consume list: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the list to be consumed")
+	}
+
+	if len(handled) != 3 || handled[0] != "crashed" || handled[1] != "second" || handled[2] != "first" {
+		t.Errorf("Expected the recovered payload first and the failed one requeued, got %v", handled)
+	}
+	background := context.Background()
+	if left := rdb.LLen(background, processing).Val(); left != 0 {
+		t.Errorf("Expected the processing list to be empty, got %d", left)
+	}
+	if left := rdb.LLen(background, config.InputList).Val(); left != 0 {
+		t.Errorf("Expected the intake list to be empty, got %d", left)
+	}
+}
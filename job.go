@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+const (
+	gitCommitSHAKey   = "git_commit_sha"
+	gitCommitShortKey = "git_commit_short"
+)
+
+const (
+	prNumberKey  = "pr_number"
+	prTitleKey   = "pr_title"
+	prHeadRefKey = "pr_head_ref"
+	prBaseRefKey = "pr_base_ref"
+	prHeadSHAKey = "pr_head_sha"
+	prAuthorKey  = "pr_author"
+)
+
+const authorAssociationKey = "author_association"
+
+const shortSHALength = 7
+
+// envReferencePattern matches ${VAR} references in metadata values
+var envReferencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Versions of the job payload schema. Previous versions can still be
+// enqueued with JOB_SCHEMA_VERSION so consumers can upgrade independently:
+//
+//	1: jobs as enqueued before versioning, without schema_version
+//	2: adds schema_version to every job
+const (
+	jobSchemaV1             = 1
+	currentJobSchemaVersion = 2
+)
+
+// Job is the payload pushed to the pipeline queue for every dispatch
+type Job struct {
+	SchemaVersion int `json:"schema_version,omitempty"`
+
+	ID       string            `json:"job_id"`
+	RuleID   string            `json:"rule_id,omitempty"`
+	Repo     string            `json:"repo"`
+	Branch   string            `json:"branch"`
+	Type     string            `json:"type"`
+	Dir      string            `json:"dir"`
+	Commands []string          `json:"commands"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Priority int               `json:"priority,omitempty"`
+
+	// ExpiresAt (RFC 3339) is when the job becomes stale and should no
+	// longer be run, if JOB_TTL is set
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+const (
+	jobCompressionNone = "none"
+	jobCompressionGzip = "gzip"
+)
+
+// compressedJob is the envelope of a compressed job: payload is the
+// base64-encoded, gzipped job JSON. The fields identifying the job stay
+// readable so notifications and the queue reaper work without decoding it.
+type compressedJob struct {
+	SchemaVersion   int    `json:"schema_version,omitempty"`
+	ID              string `json:"job_id"`
+	RuleID          string `json:"rule_id,omitempty"`
+	ExpiresAt       string `json:"expires_at,omitempty"`
+	ContentEncoding string `json:"content_encoding"`
+	Payload         string `json:"payload"`
+}
+
+func validateJobSchemaVersion(version int) error {
+	if version < jobSchemaV1 || version > currentJobSchemaVersion {
+		return fmt.Errorf("unsupported job schema version %d, expected %d to %d", version, jobSchemaV1, currentJobSchemaVersion)
+	}
+	return nil
+}
+
+// encodeJob stamps the job with JOB_SCHEMA_VERSION and serializes it in the
+// shape of that version
+func encodeJob(config Config, job *Job) ([]byte, error) {
+	switch config.JobSchemaVersion {
+	case jobSchemaV1:
+		job.SchemaVersion = 0
+	default:
+		job.SchemaVersion = config.JobSchemaVersion
+	}
+
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize job: %w", err)
+	}
+	return jobJSON, nil
+}
+
+func validateJobCompression(compression string) error {
+	switch compression {
+	case jobCompressionNone, jobCompressionGzip:
+		return nil
+	default:
+		return fmt.Errorf("unknown job compression '%s'", compression)
+	}
+}
+
+// compressJob returns the serialized job to enqueue: the job JSON itself, or
+// a compressedJob envelope once the JSON reaches JOB_COMPRESSION_MIN_SIZE
+func compressJob(config Config, job Job, jobJSON []byte) ([]byte, error) {
+	if config.JobCompression != jobCompressionGzip || len(jobJSON) < config.JobCompressionMinSize {
+		return jobJSON, nil
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(jobJSON); err != nil {
+		return nil, fmt.Errorf("failed to compress job: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress job: %w", err)
+	}
+
+	return json.Marshal(compressedJob{
+		SchemaVersion:   job.SchemaVersion,
+		ID:              job.ID,
+		RuleID:          job.RuleID,
+		ExpiresAt:       job.ExpiresAt,
+		ContentEncoding: jobCompressionGzip,
+		Payload:         base64.StdEncoding.EncodeToString(compressed.Bytes()),
+	})
+}
+
+// TemplateData is the data available to templates in commands and metadata
+// values, e.g. "docker build -t app:{{.ShortSHA}}" or "{{.Matrix.go}}"
+type TemplateData struct {
+	JobID     string
+	Repo      string
+	Owner     string
+	RepoName  string
+	Ref       string
+	EventType string
+	Action    string
+	Forced    bool
+	Tag       string
+	SHA       string
+	ShortSHA  string
+	Matrix    map[string]string
+}
+
+func newTemplateData(event GitHubEvent) TemplateData {
+	repo := event.Repository.FullName
+	owner, name, _ := strings.Cut(repo, "/")
+	sha := event.CommitSHA()
+
+	var tag string
+	if event.IsTag() || event.Type() == eventTypeRelease {
+		tag = strings.TrimPrefix(event.MatchRef(), tagRefPrefix)
+	}
+
+	return TemplateData{
+		Repo:      repo,
+		Owner:     owner,
+		RepoName:  name,
+		Ref:       event.MatchRef(),
+		EventType: event.Type(),
+		Action:    event.Action,
+		Forced:    event.Forced,
+		Tag:       tag,
+		SHA:       sha,
+		ShortSHA:  shortSHA(sha),
+		Matrix:    map[string]string{},
+	}
+}
+
+// newUUID returns a random (version 4) UUID identifying a dispatched job or a
+// received event
+func newUUID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		// crypto/rand never returns an error on supported platforms
+		panic(fmt.Sprintf("failed to generate UUID: %v", err))
+	}
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+func renderTemplate(text string, data TemplateData) (string, error) {
+	return executeTemplate(text, data, false)
+}
+
+// renderMetadataTemplate renders a static metadata value, resolving the
+// ${VAR} references of the template text once it is parsed: the values of
+// environment variables are never evaluated as templates, and references in
+// rendered event values, such as a branch name, are not resolved
+func renderMetadataTemplate(text string, data TemplateData) (string, error) {
+	return executeTemplate(text, data, true)
+}
+
+func executeTemplate(text string, data TemplateData, expandEnv bool) (string, error) {
+	// Skip the template engine for the common case of plain strings
+	if !strings.Contains(text, "{{") {
+		if expandEnv {
+			return expandEnvReferences(text), nil
+		}
+		return text, nil
+	}
+
+	tmpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %q: %w", text, err)
+	}
+	if expandEnv {
+		expandTextNodes(tmpl.Tree.Root)
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("failed to render template %q: %w", text, err)
+	}
+	return rendered.String(), nil
+}
+
+// expandTextNodes resolves the ${VAR} references of the static text of a
+// parsed template
+func expandTextNodes(node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			expandTextNodes(child)
+		}
+	case *parse.TextNode:
+		node.Text = []byte(expandEnvReferences(string(node.Text)))
+	case *parse.IfNode:
+		expandTextNodes(node.List)
+		expandTextNodes(node.ElseList)
+	case *parse.RangeNode:
+		expandTextNodes(node.List)
+		expandTextNodes(node.ElseList)
+	case *parse.WithNode:
+		expandTextNodes(node.List)
+		expandTextNodes(node.ElseList)
+	}
+}
+
+// parseCondition parses a command `when` condition. Conditions are template
+// pipelines such as `eq .Ref "refs/heads/main"` and may omit the braces.
+func parseCondition(condition string) (*template.Template, error) {
+	if !strings.Contains(condition, "{{") {
+		condition = "{{" + condition + "}}"
+	}
+	return template.New("").Option("missingkey=error").Parse(condition)
+}
+
+func evaluateCondition(condition string, data TemplateData) (bool, error) {
+	tmpl, err := parseCondition(condition)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse condition %q: %w", condition, err)
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, data); err != nil {
+		return false, fmt.Errorf("failed to evaluate condition %q: %w", condition, err)
+	}
+
+	value, err := strconv.ParseBool(strings.TrimSpace(result.String()))
+	if err != nil {
+		return false, fmt.Errorf("condition %q evaluated to %q, expected true or false", condition, result.String())
+	}
+	return value, nil
+}
+
+func expandEnvReferences(value string) string {
+	return envReferencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReferencePattern.FindStringSubmatch(reference)[1]
+		resolved, ok := os.LookupEnv(name)
+		if !ok {
+			logWarn("Environment variable '%s' referenced in metadata is not set", name)
+		}
+		return resolved
+	})
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > shortSHALength {
+		return sha[:shortSHALength]
+	}
+	return sha
+}
+
+// maxMatrixCombinations bounds the jobs a matrix rule expands an event into
+const maxMatrixCombinations = 256
+
+// expandMatrix returns every combination of the matrix values, with keys
+// iterated in sorted order so the expansion is deterministic. A rule without
+// a matrix expands to a single empty combination.
+func expandMatrix(matrix map[string][]string) []map[string]string {
+	keys := make([]string, 0, len(matrix))
+	for key := range matrix {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	combinations := []map[string]string{{}}
+	for _, key := range keys {
+		expanded := make([]map[string]string, 0, len(combinations)*len(matrix[key]))
+		for _, combination := range combinations {
+			for _, value := range matrix[key] {
+				next := make(map[string]string, len(combination)+1)
+				for k, v := range combination {
+					next[k] = v
+				}
+				next[key] = value
+				expanded = append(expanded, next)
+			}
+		}
+		combinations = expanded
+	}
+	return combinations
+}
+
+// eventMetadata returns the metadata the dispatcher derives from the event
+func eventMetadata(event GitHubEvent) map[string]string {
+	metadata := make(map[string]string, 8)
+
+	sha := event.CommitSHA()
+	metadata[gitCommitSHAKey] = sha
+	metadata[gitCommitShortKey] = shortSHA(sha)
+
+	if pr := event.PullRequest; pr != nil {
+		metadata[prNumberKey] = strconv.Itoa(pr.Number)
+		metadata[prTitleKey] = pr.Title
+		metadata[prHeadRefKey] = pr.Head.Ref
+		metadata[prBaseRefKey] = pr.Base.Ref
+		metadata[prHeadSHAKey] = pr.Head.SHA
+		metadata[prAuthorKey] = pr.User.Login
+	}
+
+	if association := event.AuthorAssociation(); association != "" {
+		metadata[authorAssociationKey] = association
+	}
+
+	return metadata
+}
+
+// buildJob builds the job for a single matrix combination. With templates
+// enabled for the rule, they are rendered in the commands, static metadata
+// and env values only; event values such as PR titles are copied verbatim.
+func buildJob(rule *FilterRule, event GitHubEvent, data TemplateData) (Job, error) {
+	render := func(text string) (string, error) {
+		if !rule.Template {
+			return text, nil
+		}
+		return renderTemplate(text, data)
+	}
+
+	job := Job{
+		ID:       data.JobID,
+		RuleID:   rule.ID,
+		Repo:     rule.Repo,
+		Branch:   rule.Branch,
+		Type:     rule.Type,
+		Dir:      rule.Dir,
+		Priority: rule.Priority,
+		Metadata: make(map[string]string, len(rule.Metadata)+8),
+	}
+
+	commands := rule.CommandsFor(&event)
+	job.Commands = make([]string, 0, len(commands))
+	for _, command := range commands {
+		if command.When != "" {
+			run, err := evaluateCondition(command.When, data)
+			if err != nil {
+				return Job{}, err
+			}
+			if !run {
+				logDebug("Skipping command '%s' for %s: condition not met", command.Run, rule.Repo)
+				continue
+			}
+		}
+
+		rendered, err := render(command.Run)
+		if err != nil {
+			return Job{}, err
+		}
+		job.Commands = append(job.Commands, rendered)
+	}
+
+	// The metadata is copied so the static metadata of the loaded rule is
+	// never mutated by per-event values
+	for key, value := range rule.Metadata {
+		if !rule.Template {
+			job.Metadata[key] = expandEnvReferences(value)
+			continue
+		}
+		rendered, err := renderMetadataTemplate(value, data)
+		if err != nil {
+			return Job{}, err
+		}
+		job.Metadata[key] = rendered
+	}
+
+	for key, value := range eventMetadata(event) {
+		job.Metadata[key] = value
+	}
+
+	// Environment variables are templated, but ${VAR} references are left
+	// for the runner to resolve
+	if len(rule.Env) > 0 {
+		job.Env = make(map[string]string, len(rule.Env))
+		for key, value := range rule.Env {
+			rendered, err := render(value)
+			if err != nil {
+				return Job{}, err
+			}
+			job.Env[key] = rendered
+		}
+	}
+
+	return job, nil
+}
+
+// buildJobs builds one job per matrix combination of the rule
+func buildJobs(rule *FilterRule, event GitHubEvent) ([]Job, error) {
+	data := newTemplateData(event)
+
+	combinations := expandMatrix(rule.Matrix)
+	jobs := make([]Job, 0, len(combinations))
+	for _, combination := range combinations {
+		data.JobID = newUUID()
+		data.Matrix = combination
+
+		job, err := buildJob(rule, event, data)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,641 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustBuildJob(t *testing.T, rule *FilterRule, event GitHubEvent) Job {
+	t.Helper()
+	jobs, err := buildJobs(rule, event)
+	if err != nil {
+		t.Fatalf("Failed to build jobs: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected 1 job, got %d", len(jobs))
+	}
+	return jobs[0]
+}
+
+func TestBuildJob(t *testing.T) {
+	rule := FilterRule{
+		Repo:     "owner/test-repo",
+		Branch:   "refs/heads/main",
+		Type:     "git-webhook",
+		Dir:      "/home/user/test-repo",
+		Commands: []Command{{Run: "make build"}},
+		Metadata: map[string]string{
+			"owner_team":    "platform",
+			"alert_channel": "#platform-alerts",
+		},
+	}
+
+	var event GitHubEvent
+	event.After = "66978703a4cd8d23e8dade6b4104cdfc98582128"
+
+	dispatched := mustBuildJob(t, &rule, event)
+
+	if dispatched.Metadata["owner_team"] != "platform" {
+		t.Errorf("Expected owner_team 'platform', got '%s'", dispatched.Metadata["owner_team"])
+	}
+
+	if dispatched.Metadata["alert_channel"] != "#platform-alerts" {
+		t.Errorf("Expected alert_channel '#platform-alerts', got '%s'", dispatched.Metadata["alert_channel"])
+	}
+
+	if dispatched.Metadata[gitCommitSHAKey] != event.After {
+		t.Errorf("Expected %s '%s', got '%s'", gitCommitSHAKey, event.After, dispatched.Metadata[gitCommitSHAKey])
+	}
+
+	if dispatched.Metadata[gitCommitShortKey] != "6697870" {
+		t.Errorf("Expected %s '6697870', got '%s'", gitCommitShortKey, dispatched.Metadata[gitCommitShortKey])
+	}
+
+	// The loaded rule must not be mutated by per-event values
+	if _, exists := rule.Metadata[gitCommitSHAKey]; exists {
+		t.Errorf("Expected original rule metadata to be unchanged, got %v", rule.Metadata)
+	}
+
+	// Rule IDs and priorities are passed to the job
+	dispatched = mustBuildJob(t, &FilterRule{ID: "test-rule", Repo: "owner/test-repo", Priority: 50}, event)
+	if dispatched.RuleID != "test-rule" {
+		t.Errorf("Expected RuleID 'test-rule', got '%s'", dispatched.RuleID)
+	}
+	if dispatched.Priority != 50 {
+		t.Errorf("Expected Priority 50, got %d", dispatched.Priority)
+	}
+
+	// Rules without static metadata still receive the commit SHA
+	dispatched = mustBuildJob(t, &FilterRule{Repo: "owner/test-repo"}, event)
+	if dispatched.Metadata[gitCommitSHAKey] != event.After {
+		t.Errorf("Expected %s '%s', got '%s'", gitCommitSHAKey, event.After, dispatched.Metadata[gitCommitSHAKey])
+	}
+}
+
+func TestExpandEnvReferences(t *testing.T) {
+	os.Setenv("DEPLOY_ENV", "staging")
+	os.Setenv("DEPLOY_REGION", "eu-west-1")
+	defer os.Unsetenv("DEPLOY_ENV")
+	defer os.Unsetenv("DEPLOY_REGION")
+	os.Unsetenv("MISSING_VAR")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"${DEPLOY_ENV}", "staging"},
+		{"${DEPLOY_ENV}-${DEPLOY_REGION}", "staging-eu-west-1"},
+		{"prefix-${DEPLOY_ENV}", "prefix-staging"},
+		{"${MISSING_VAR}", ""},
+		{"$DEPLOY_ENV", "$DEPLOY_ENV"}, // only ${VAR} references are expanded
+		{"plain value", "plain value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := expandEnvReferences(tt.input)
+			if result != tt.expected {
+				t.Errorf("expandEnvReferences(%q) = %q, expected %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildJob_EnvMetadata(t *testing.T) {
+	os.Setenv("DEPLOY_ENV", "production")
+	defer os.Unsetenv("DEPLOY_ENV")
+
+	rule := FilterRule{
+		Repo:     "owner/test-repo",
+		Branch:   "refs/heads/main",
+		Metadata: map[string]string{"env": "${DEPLOY_ENV}"},
+	}
+
+	dispatched := mustBuildJob(t, &rule, GitHubEvent{})
+
+	if dispatched.Metadata["env"] != "production" {
+		t.Errorf("Expected env 'production', got '%s'", dispatched.Metadata["env"])
+	}
+
+	// References are resolved at dispatch time, not stored in the rule
+	if rule.Metadata["env"] != "${DEPLOY_ENV}" {
+		t.Errorf("Expected rule metadata to keep the reference, got '%s'", rule.Metadata["env"])
+	}
+}
+
+func TestShortSHA(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"66978703a4cd8d23e8dade6b4104cdfc98582128", "6697870"},
+		{"6697870", "6697870"},
+		{"abc", "abc"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := shortSHA(tt.input)
+			if result != tt.expected {
+				t.Errorf("shortSHA(%q) = %q, expected %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	data := TemplateData{
+		Repo:     "owner/test-repo",
+		Owner:    "owner",
+		RepoName: "test-repo",
+		SHA:      "66978703a4cd8d23e8dade6b4104cdfc98582128",
+		ShortSHA: "6697870",
+		Matrix:   map[string]string{"go": "1.22"},
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"make build", "make build"},
+		{"docker build -t {{.RepoName}}:{{.ShortSHA}} .", "docker build -t test-repo:6697870 ."},
+		{"go{{.Matrix.go}} test ./...", "go1.22 test ./..."},
+		{"{{.Owner}}/{{.RepoName}}@{{.SHA}}", "owner/test-repo@66978703a4cd8d23e8dade6b4104cdfc98582128"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := renderTemplate(tt.input, data)
+			if err != nil {
+				t.Fatalf("renderTemplate(%q) returned error: %v", tt.input, err)
+			}
+			if result != tt.expected {
+				t.Errorf("renderTemplate(%q) = %q, expected %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+
+	// Unknown matrix keys and malformed templates are errors
+	if _, err := renderTemplate("{{.Matrix.arch}}", data); err == nil {
+		t.Error("Expected error for unknown matrix key, got nil")
+	}
+	if _, err := renderTemplate("{{.ShortSHA", data); err == nil {
+		t.Error("Expected error for malformed template, got nil")
+	}
+}
+
+func TestExpandMatrix(t *testing.T) {
+	combinations := expandMatrix(nil)
+	if len(combinations) != 1 || len(combinations[0]) != 0 {
+		t.Errorf("Expected a single empty combination without a matrix, got %v", combinations)
+	}
+
+	combinations = expandMatrix(map[string][]string{
+		"go":   {"1.21", "1.22"},
+		"arch": {"amd64", "arm64"},
+	})
+
+	expected := []map[string]string{
+		{"arch": "amd64", "go": "1.21"},
+		{"arch": "amd64", "go": "1.22"},
+		{"arch": "arm64", "go": "1.21"},
+		{"arch": "arm64", "go": "1.22"},
+	}
+
+	if len(combinations) != len(expected) {
+		t.Fatalf("Expected %d combinations, got %d", len(expected), len(combinations))
+	}
+	for i := range expected {
+		if combinations[i]["arch"] != expected[i]["arch"] || combinations[i]["go"] != expected[i]["go"] {
+			t.Errorf("Combination %d: expected %v, got %v", i, expected[i], combinations[i])
+		}
+	}
+}
+
+func TestBuildJobs_Matrix(t *testing.T) {
+	rule := FilterRule{
+		Repo:     "owner/test-repo",
+		Branch:   "refs/heads/main",
+		Commands: []Command{{Run: "GOARCH={{.Matrix.arch}} go{{.Matrix.go}} build ./..."}},
+		Metadata: map[string]string{"target": "{{.Matrix.go}}-{{.Matrix.arch}}"},
+		Template: true,
+		Matrix: map[string][]string{
+			"go":   {"1.21", "1.22"},
+			"arch": {"amd64", "arm64"},
+		},
+	}
+
+	var event GitHubEvent
+	event.After = "66978703a4cd8d23e8dade6b4104cdfc98582128"
+
+	jobs, err := buildJobs(&rule, event)
+	if err != nil {
+		t.Fatalf("Failed to build jobs: %v", err)
+	}
+
+	if len(jobs) != 4 {
+		t.Fatalf("Expected 4 jobs, got %d", len(jobs))
+	}
+
+	if jobs[0].Commands[0] != "GOARCH=amd64 go1.21 build ./..." {
+		t.Errorf("Expected first command 'GOARCH=amd64 go1.21 build ./...', got '%s'", jobs[0].Commands[0])
+	}
+
+	if jobs[3].Metadata["target"] != "1.22-arm64" {
+		t.Errorf("Expected last target '1.22-arm64', got '%s'", jobs[3].Metadata["target"])
+	}
+
+	for i, job := range jobs {
+		if job.Metadata[gitCommitSHAKey] != event.After {
+			t.Errorf("Job %d: expected %s '%s', got '%s'", i, gitCommitSHAKey, event.After, job.Metadata[gitCommitSHAKey])
+		}
+	}
+
+	// The rule templates are left untouched
+	if rule.Commands[0].Run != "GOARCH={{.Matrix.arch}} go{{.Matrix.go}} build ./..." {
+		t.Errorf("Expected rule command to be unchanged, got '%s'", rule.Commands[0].Run)
+	}
+}
+
+func TestBuildJobs_EventValuesNotTemplated(t *testing.T) {
+	rule := FilterRule{Repo: "owner/test-repo", Branch: "refs/heads/main", Events: []string{"pull_request"}}
+	event := GitHubEvent{
+		Action:      "opened",
+		PullRequest: &GitHubPullRequest{Title: "{{.SHA}}"},
+	}
+
+	job := mustBuildJob(t, &rule, event)
+	if job.Metadata[prTitleKey] != "{{.SHA}}" {
+		t.Errorf("Expected PR title to be copied verbatim, got '%s'", job.Metadata[prTitleKey])
+	}
+}
+
+func TestBuildJobs_TagCommands(t *testing.T) {
+	rule := FilterRule{
+		Repo:        "owner/test-repo",
+		Branch:      "refs/heads/main",
+		Commands:    []Command{{Run: "make build"}},
+		CommandsTag: []Command{{Run: "docker build -t test-repo:{{.Tag}} ."}},
+		Template:    true,
+	}
+
+	var event GitHubEvent
+	event.Ref = "refs/tags/v1.2.3"
+	event.After = "66978703a4cd8d23e8dade6b4104cdfc98582128"
+
+	job := mustBuildJob(t, &rule, event)
+	if len(job.Commands) != 1 || job.Commands[0] != "docker build -t test-repo:v1.2.3 ." {
+		t.Errorf("Expected tag command 'docker build -t test-repo:v1.2.3 .', got %v", job.Commands)
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	data := TemplateData{Ref: "refs/heads/main", EventType: "push", Forced: false}
+
+	tests := []struct {
+		condition string
+		expected  bool
+	}{
+		{`eq .Ref "refs/heads/main"`, true},
+		{`{{eq .Ref "refs/heads/develop"}}`, false},
+		{`and (eq .Ref "refs/heads/main") (not .Forced)`, true},
+		{`.Forced`, false},
+		{`eq .EventType "pull_request"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			result, err := evaluateCondition(tt.condition, data)
+			if err != nil {
+				t.Fatalf("evaluateCondition(%q) returned error: %v", tt.condition, err)
+			}
+			if result != tt.expected {
+				t.Errorf("evaluateCondition(%q) = %v, expected %v", tt.condition, result, tt.expected)
+			}
+		})
+	}
+
+	// Conditions must evaluate to a boolean
+	if _, err := evaluateCondition(".Ref", data); err == nil {
+		t.Error("Expected error for non-boolean condition, got nil")
+	}
+}
+
+func TestBuildJobs_ConditionalCommands(t *testing.T) {
+	rule := FilterRule{
+		Repo:   "owner/test-repo",
+		Branch: "refs/heads/main",
+		Commands: []Command{
+			{Run: "make build"},
+			{Run: "make deploy", When: `and (eq .Ref "refs/heads/main") (not .Forced)`},
+		},
+	}
+
+	var event GitHubEvent
+	event.Ref = "refs/heads/main"
+
+	job := mustBuildJob(t, &rule, event)
+	if len(job.Commands) != 2 || job.Commands[1] != "make deploy" {
+		t.Errorf("Expected [make build make deploy], got %v", job.Commands)
+	}
+
+	// Force pushes skip the deploy
+	event.Forced = true
+	job = mustBuildJob(t, &rule, event)
+	if len(job.Commands) != 1 || job.Commands[0] != "make build" {
+		t.Errorf("Expected [make build], got %v", job.Commands)
+	}
+}
+
+func TestBuildJobs_Env(t *testing.T) {
+	os.Setenv("DEPLOY_ENV", "production")
+	defer os.Unsetenv("DEPLOY_ENV")
+
+	rule := FilterRule{
+		Repo:     "owner/test-repo",
+		Branch:   "refs/heads/main",
+		Commands: []Command{{Run: "make deploy"}},
+		Template: true,
+		Env: map[string]string{
+			"IMAGE_TAG": "{{.ShortSHA}}",
+			"GOFLAGS":   "-mod=vendor",
+			"TARGET":    "${DEPLOY_ENV}",
+		},
+	}
+
+	var event GitHubEvent
+	event.After = "66978703a4cd8d23e8dade6b4104cdfc98582128"
+
+	job := mustBuildJob(t, &rule, event)
+
+	expected := map[string]string{
+		"IMAGE_TAG": "6697870",
+		"GOFLAGS":   "-mod=vendor",
+		"TARGET":    "${DEPLOY_ENV}", // resolved by the runner, not the dispatcher
+	}
+	for key, value := range expected {
+		if job.Env[key] != value {
+			t.Errorf("Expected env %s '%s', got '%s'", key, value, job.Env[key])
+		}
+	}
+
+	// Rules without env don't add an empty map to the payload
+	job = mustBuildJob(t, &FilterRule{Repo: "owner/test-repo"}, event)
+	if job.Env != nil {
+		t.Errorf("Expected no env, got %v", job.Env)
+	}
+}
+
+func TestBuildJobs_TemplateOptIn(t *testing.T) {
+	os.Setenv("DEPLOY_ENV", "production")
+	defer os.Unsetenv("DEPLOY_ENV")
+
+	var event GitHubEvent
+	event.Ref = "refs/tags/${DEPLOY_ENV}{{.SHA}}"
+	event.After = "66978703a4cd8d23e8dade6b4104cdfc98582128"
+
+	// Without template, braces are passed through verbatim
+	rule := FilterRule{
+		Repo:     "owner/test-repo",
+		Commands: []Command{{Run: "docker inspect --format '{{.Id}}' image"}},
+		Metadata: map[string]string{"env": "${DEPLOY_ENV}", "filter": "{{.name}}"},
+		Env:      map[string]string{"QUERY": "{{.items}}"},
+	}
+	job := mustBuildJob(t, &rule, event)
+	if job.Commands[0] != "docker inspect --format '{{.Id}}' image" {
+		t.Errorf("Expected the command verbatim, got '%s'", job.Commands[0])
+	}
+	if job.Metadata["env"] != "production" || job.Metadata["filter"] != "{{.name}}" {
+		t.Errorf("Expected env expanded and template verbatim, got %v", job.Metadata)
+	}
+	if job.Env["QUERY"] != "{{.items}}" {
+		t.Errorf("Expected env verbatim, got '%s'", job.Env["QUERY"])
+	}
+
+	// With template, env references in the template text are resolved, but
+	// not those inserted by event values
+	rule = FilterRule{
+		Repo:     "owner/test-repo",
+		Template: true,
+		Commands: []Command{{Run: "echo {{.Tag}}"}},
+		Metadata: map[string]string{"release": "${DEPLOY_ENV}-{{.Tag}}"},
+	}
+	job = mustBuildJob(t, &rule, event)
+	if want := "production-${DEPLOY_ENV}{{.SHA}}"; job.Metadata["release"] != want {
+		t.Errorf("Expected release '%s', got '%s'", want, job.Metadata["release"])
+	}
+	if want := "echo ${DEPLOY_ENV}{{.SHA}}"; job.Commands[0] != want {
+		t.Errorf("Expected command '%s', got '%s'", want, job.Commands[0])
+	}
+}
+
+func TestNewJobID(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := newUUID()
+		if !uuidPattern.MatchString(id) {
+			t.Fatalf("Expected a version 4 UUID, got '%s'", id)
+		}
+		if seen[id] {
+			t.Fatalf("Expected unique job IDs, got duplicate '%s'", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestBuildJobs_JobID(t *testing.T) {
+	rule := FilterRule{
+		Repo:     "owner/test-repo",
+		Branch:   "refs/heads/main",
+		Commands: []Command{{Run: "make build BUILD_ID={{.JobID}}"}},
+		Matrix:   map[string][]string{"go": {"1.21", "1.22"}},
+		Template: true,
+	}
+
+	jobs, err := buildJobs(&rule, GitHubEvent{})
+	if err != nil {
+		t.Fatalf("Failed to build jobs: %v", err)
+	}
+
+	if jobs[0].ID == "" || jobs[0].ID == jobs[1].ID {
+		t.Errorf("Expected distinct job IDs per matrix job, got '%s' and '%s'", jobs[0].ID, jobs[1].ID)
+	}
+
+	if jobs[0].Commands[0] != "make build BUILD_ID="+jobs[0].ID {
+		t.Errorf("Expected job ID to be templated into the command, got '%s'", jobs[0].Commands[0])
+	}
+}
+
+func TestLoadConfig_JobCompression(t *testing.T) {
+	config := loadConfig()
+
+	if config.JobCompression != "none" {
+		t.Errorf("Expected JobCompression to be 'none', got '%s'", config.JobCompression)
+	}
+	if config.JobCompressionMinSize != 1024 {
+		t.Errorf("Expected JobCompressionMinSize to be 1024, got %d", config.JobCompressionMinSize)
+	}
+
+	os.Setenv("JOB_COMPRESSION", "GZIP")
+	os.Setenv("JOB_COMPRESSION_MIN_SIZE", "0")
+	defer os.Unsetenv("JOB_COMPRESSION")
+	defer os.Unsetenv("JOB_COMPRESSION_MIN_SIZE")
+
+	config = loadConfig()
+
+	if config.JobCompression != "gzip" {
+		t.Errorf("Expected JobCompression to be 'gzip', got '%s'", config.JobCompression)
+	}
+	if config.JobCompressionMinSize != 0 {
+		t.Errorf("Expected JobCompressionMinSize to be 0, got %d", config.JobCompressionMinSize)
+	}
+}
+
+func TestValidateJobCompression(t *testing.T) {
+	for _, compression := range []string{"none", "gzip"} {
+		if err := validateJobCompression(compression); err != nil {
+			t.Errorf("Expected job compression '%s' to be valid, got %v", compression, err)
+		}
+	}
+
+	if err := validateJobCompression("zstd"); err == nil {
+		t.Error("Expected error for unknown job compression, got nil")
+	}
+}
+
+func TestCompressJob(t *testing.T) {
+	job := Job{
+		ID:        "job-1",
+		RuleID:    "deploy",
+		Repo:      "owner/repo",
+		Commands:  []string{strings.Repeat("echo build; ", 100)},
+		ExpiresAt: "2026-01-01T00:00:00Z",
+	}
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		t.Fatalf("Failed to serialize job: %v", err)
+	}
+
+	// Compression is off by default
+	value, err := compressJob(Config{JobCompression: "none"}, job, jobJSON)
+	if err != nil || !bytes.Equal(value, jobJSON) {
+		t.Errorf("Expected the job JSON unchanged without compression, got %s (%v)", value, err)
+	}
+
+	// Small jobs are not worth compressing
+	value, err = compressJob(Config{JobCompression: "gzip", JobCompressionMinSize: len(jobJSON) + 1}, job, jobJSON)
+	if err != nil || !bytes.Equal(value, jobJSON) {
+		t.Errorf("Expected the job JSON unchanged below the minimum size, got %s (%v)", value, err)
+	}
+
+	value, err = compressJob(Config{JobCompression: "gzip", JobCompressionMinSize: 0}, job, jobJSON)
+	if err != nil {
+		t.Fatalf("Failed to compress job: %v", err)
+	}
+	if len(value) >= len(jobJSON) {
+		t.Errorf("Expected the compressed job to be smaller than %d bytes, got %d", len(jobJSON), len(value))
+	}
+
+	var envelope compressedJob
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		t.Fatalf("Failed to parse compressed job: %v", err)
+	}
+	if envelope.ID != "job-1" || envelope.RuleID != "deploy" || envelope.ContentEncoding != "gzip" {
+		t.Errorf("Expected job_id, rule_id and content_encoding to stay readable, got %+v", envelope)
+	}
+	if !jobExpired(string(value), time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Expected the expiry of a compressed job to be readable")
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("Failed to open gzip payload: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to decompress payload: %v", err)
+	}
+	if !bytes.Equal(decompressed, jobJSON) {
+		t.Errorf("Expected the payload to decompress to the job JSON, got %s", decompressed)
+	}
+}
+
+func TestLoadConfig_JobSchemaVersion(t *testing.T) {
+	config := loadConfig()
+	if config.JobSchemaVersion != 2 {
+		t.Errorf("Expected JobSchemaVersion to be 2, got %d", config.JobSchemaVersion)
+	}
+
+	os.Setenv("JOB_SCHEMA_VERSION", "1")
+	defer os.Unsetenv("JOB_SCHEMA_VERSION")
+
+	config = loadConfig()
+	if config.JobSchemaVersion != 1 {
+		t.Errorf("Expected JobSchemaVersion to be 1, got %d", config.JobSchemaVersion)
+	}
+}
+
+func TestValidateJobSchemaVersion(t *testing.T) {
+	for _, version := range []int{1, 2} {
+		if err := validateJobSchemaVersion(version); err != nil {
+			t.Errorf("Expected job schema version %d to be valid, got %v", version, err)
+		}
+	}
+
+	for _, version := range []int{0, 3} {
+		if err := validateJobSchemaVersion(version); err == nil {
+			t.Errorf("Expected error for job schema version %d, got nil", version)
+		}
+	}
+}
+
+func TestEncodeJob(t *testing.T) {
+	tests := []struct {
+		version  int
+		expected string
+	}{
+		{1, `{"job_id":"job-1","repo":"owner/repo","branch":"main","type":"build","dir":"/app","commands":["make"]}`},
+		{2, `{"schema_version":2,"job_id":"job-1","repo":"owner/repo","branch":"main","type":"build","dir":"/app","commands":["make"]}`},
+	}
+
+	for _, tt := range tests {
+		job := Job{ID: "job-1", Repo: "owner/repo", Branch: "main", Type: "build", Dir: "/app", Commands: []string{"make"}}
+		jobJSON, err := encodeJob(Config{JobSchemaVersion: tt.version}, &job)
+		if err != nil {
+			t.Fatalf("Failed to encode job as version %d: %v", tt.version, err)
+		}
+		if string(jobJSON) != tt.expected {
+			t.Errorf("Expected version %d job %s, got %s", tt.version, tt.expected, jobJSON)
+		}
+	}
+
+	// Compressed jobs keep the version readable
+	job := Job{ID: "job-1"}
+	config := Config{JobSchemaVersion: 2, JobCompression: "gzip"}
+	jobJSON, err := encodeJob(config, &job)
+	if err != nil {
+		t.Fatalf("Failed to encode job: %v", err)
+	}
+	value, err := compressJob(config, job, jobJSON)
+	if err != nil {
+		t.Fatalf("Failed to compress job: %v", err)
+	}
+	if !strings.HasPrefix(string(value), `{"schema_version":2,`) {
+		t.Errorf("Expected schema_version in the compressed envelope, got %s", value)
+	}
+}
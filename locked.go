@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// validateLockedConfig rejects, with LOCKED, the sources of configuration
+// that can be changed at runtime instead of with a deployment
+func validateLockedConfig(config Config) error {
+	if !config.Locked {
+		return nil
+	}
+	if config.ConfigPublicKeyFile == "" {
+		return errors.New("LOCKED requires a signed config file, verified with CONFIG_PUBLIC_KEY_FILE")
+	}
+	if config.WebhookSecretsKey != "" {
+		return errors.New("LOCKED does not allow WEBHOOK_SECRETS_KEY, which can be changed in Redis at runtime; use WEBHOOK_SECRETS_FILE")
+	}
+	return nil
+}
+
+// lockable refuses the requests of an endpoint changing the configuration
+// with LOCKED
+func lockable(config Config, next http.Handler) http.Handler {
+	if !config.Locked {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logWarn("Refused %s %s from %s: the configuration is locked", r.Method, r.URL.Path, r.RemoteAddr)
+		http.Error(w, "the configuration is locked (LOCKED=true)", http.StatusForbidden)
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_Locked(t *testing.T) {
+	config := loadConfig()
+
+	if config.Locked {
+		t.Error("Expected Locked to be false by default")
+	}
+
+	os.Setenv("LOCKED", "true")
+	defer os.Unsetenv("LOCKED")
+
+	config = loadConfig()
+	if !config.Locked {
+		t.Error("Expected Locked to be true")
+	}
+}
+
+func TestValidateLockedConfig(t *testing.T) {
+	if err := validateLockedConfig(Config{Locked: true, ConfigPublicKeyFile: "config.pub", WebhookSecretsFile: "secrets.json"}); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateLockedConfig(Config{Locked: true, ConfigPublicKeyFile: "config.pub", WebhookSecretsKey: "github-dispatcher:secrets"}); err == nil {
+		t.Error("Expected error for WEBHOOK_SECRETS_KEY, got nil")
+	}
+	if err := validateLockedConfig(Config{Locked: true}); err == nil {
+		t.Error("Expected error for an unsigned config file, got nil")
+	}
+	if err := validateLockedConfig(Config{WebhookSecretsKey: "github-dispatcher:secrets"}); err != nil {
+		t.Errorf("Expected valid config without LOCKED, got %v", err)
+	}
+}
+
+func TestLocked_RefusesRuleChanges(t *testing.T) {
+	config := Config{AdminAuthToken: "admin-token", Locked: true}
+	handler := newHTTPHandler(config, newDispatcher(nil, config, nil))
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request(http.MethodPost, "/api/rules", `{"id":"build","repo":"owner/repo","branch":"refs/heads/main","commands":["make"]}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected the rule change to be refused, got %d", rec.Code)
+	}
+
+	// The log level is operational, so it can still be changed
+	previousLevel := logLevel.Level()
+	defer logLevel.Set(previousLevel)
+	if rec := request(http.MethodPut, "/admin/loglevel", `{"level":"DEBUG"}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected the log level change to be accepted, got %d", rec.Code)
+	}
+	if logLevel.Level().String() != "DEBUG" {
+		t.Errorf("Expected the log level to be DEBUG, got %s", logLevel.Level())
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status dispatcherStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil || !status.Locked {
+		t.Errorf("Expected the status to report the lock, got %+v (%v)", status, err)
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// LOG_OUTPUT values: standard error, a file with the path after the prefix,
+// the local syslog daemon, or a remote one over UDP or TCP
+const (
+	logOutputStderr     = "stderr"
+	logOutputFilePrefix = "file:"
+	logOutputSyslog     = "syslog"
+	logOutputSyslogUDP  = "syslog://"
+	logOutputSyslogTCP  = "syslog+tcp://"
+)
+
+// logLevel is the minimum level of the messages logged
+var logLevel = new(slog.LevelVar)
+
+// debugSampleRate is the fraction of the debug messages carrying a full
+// payload that are logged
+var debugSampleRate = 1.0
+
+// logger writes the log messages, as text until main applies LOG_FORMAT
+var logger = newLogger(logFormatText, os.Stderr)
+
+// newLogger returns a logger writing records in the format to w. Records
+// logged with a context carry the fields attached by withLogAttrs.
+func newLogger(format string, w io.Writer) *slog.Logger {
+	return slog.New(contextHandler{newFormatHandler(format, w, &slog.HandlerOptions{Level: logLevel})})
+}
+
+func newFormatHandler(format string, w io.Writer, options *slog.HandlerOptions) slog.Handler {
+	if format == logFormatJSON {
+		return slog.NewJSONHandler(w, options)
+	}
+	return slog.NewTextHandler(w, options)
+}
+
+// setupLogging applies LOG_LEVEL, LOG_FORMAT and LOG_OUTPUT. Messages of the
+// standard log package are written through the same logger. The log file or
+// syslog connection stays open until the process exits.
+func setupLogging(config Config) error {
+	if err := validateLogFormat(config.LogFormat); err != nil {
+		return err
+	}
+	if config.DebugSampleRate < 0 || config.DebugSampleRate > 1 {
+		return fmt.Errorf("DEBUG_SAMPLE_RATE must be between 0 and 1, got %g", config.DebugSampleRate)
+	}
+	handler, err := newLogHandler(config)
+	if err != nil {
+		return err
+	}
+	logLevel.Set(parseLogLevel(config.LogLevel))
+	debugSampleRate = config.DebugSampleRate
+	logger = slog.New(contextHandler{handler})
+	slog.SetDefault(logger)
+	return nil
+}
+
+// newLogHandler returns the handler writing the records in LOG_FORMAT to
+// LOG_OUTPUT
+func newLogHandler(config Config) (slog.Handler, error) {
+	output := config.LogOutput
+	switch {
+	case output == logOutputStderr:
+		return newFormatHandler(config.LogFormat, os.Stderr, &slog.HandlerOptions{Level: logLevel}), nil
+	case strings.HasPrefix(output, logOutputFilePrefix):
+		path := strings.TrimPrefix(output, logOutputFilePrefix)
+		if path == "" {
+			return nil, errors.New("LOG_OUTPUT file: requires a path, e.g. file:/var/log/github-dispatcher.log")
+		}
+		if config.LogFileMaxSize <= 0 || config.LogFileMaxBackups < 0 || config.LogFileRotateInterval < 0 {
+			return nil, errors.New("LOG_FILE_MAX_SIZE_MB must be positive, and LOG_FILE_MAX_BACKUPS and LOG_FILE_ROTATE_INTERVAL must not be negative")
+		}
+		file, err := openRotatingFile(path, int64(config.LogFileMaxSize)<<20, config.LogFileMaxBackups, config.LogFileRotateInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		return newFormatHandler(config.LogFormat, file, &slog.HandlerOptions{Level: logLevel}), nil
+	case output == logOutputSyslog, strings.HasPrefix(output, logOutputSyslogUDP), strings.HasPrefix(output, logOutputSyslogTCP):
+		var network, addr string
+		if strings.HasPrefix(output, logOutputSyslogUDP) {
+			network, addr = "udp", strings.TrimPrefix(output, logOutputSyslogUDP)
+		} else if strings.HasPrefix(output, logOutputSyslogTCP) {
+			network, addr = "tcp", strings.TrimPrefix(output, logOutputSyslogTCP)
+		}
+		writer, err := syslog.Dial(network, addr, syslog.LOG_DAEMON|syslog.LOG_INFO, config.LogSyslogTag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		return newSyslogHandler(config.LogFormat, writer), nil
+	default:
+		return nil, fmt.Errorf("invalid LOG_OUTPUT '%s', must be '%s', '%s<path>', '%s', '%s<host:port>' or '%s<host:port>'",
+			output, logOutputStderr, logOutputFilePrefix, logOutputSyslog, logOutputSyslogUDP, logOutputSyslogTCP)
+	}
+}
+
+// syslogWriter sends messages to syslog with the severity of the method
+type syslogWriter interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+}
+
+// syslogHandler sends each record to syslog with the severity of its level,
+// formatted in LOG_FORMAT without the time, which syslog adds
+type syslogHandler struct {
+	handler slog.Handler
+	writer  syslogWriter
+
+	// mu guards buf, which the handler formats the records into
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+}
+
+func newSyslogHandler(format string, writer syslogWriter) syslogHandler {
+	buf := new(bytes.Buffer)
+	options := &slog.HandlerOptions{
+		Level: logLevel,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}
+	return syslogHandler{handler: newFormatHandler(format, buf, options), writer: writer, mu: new(sync.Mutex), buf: buf}
+}
+
+func (h syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h syslogHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buf.Reset()
+	if err := h.handler.Handle(ctx, record); err != nil {
+		return err
+	}
+	message := strings.TrimSuffix(h.buf.String(), "\n")
+	switch {
+	case record.Level >= slog.LevelError:
+		return h.writer.Err(message)
+	case record.Level >= slog.LevelWarn:
+		return h.writer.Warning(message)
+	case record.Level >= slog.LevelInfo:
+		return h.writer.Info(message)
+	default:
+		return h.writer.Debug(message)
+	}
+}
+
+func (h syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h.handler = h.handler.WithAttrs(attrs)
+	return h
+}
+
+func (h syslogHandler) WithGroup(name string) slog.Handler {
+	h.handler = h.handler.WithGroup(name)
+	return h
+}
+
+func validateLogFormat(format string) error {
+	switch format {
+	case logFormatText, logFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT '%s', must be '%s' or '%s'", format, logFormatText, logFormatJSON)
+	}
+}
+
+func parseLogLevel(level string) slog.Level {
+	parsed, ok := lookupLogLevel(level)
+	if !ok {
+		return slog.LevelInfo
+	}
+	return parsed
+}
+
+// lookupLogLevel returns the level of a LOG_LEVEL value, and whether it is
+// valid
+func lookupLogLevel(level string) (slog.Level, bool) {
+	switch strings.ToUpper(level) {
+	case "DEBUG":
+		return slog.LevelDebug, true
+	case "INFO":
+		return slog.LevelInfo, true
+	case "WARN", "WARNING":
+		return slog.LevelWarn, true
+	case "ERROR":
+		return slog.LevelError, true
+	default:
+		return slog.LevelInfo, false
+	}
+}
+
+// changeLogLevel sets the log level at runtime. The change is logged
+// whatever the new level.
+func changeLogLevel(level slog.Level, source string) {
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, fmt.Sprintf("Log level changed from %s to %s by %s", logLevel.Level(), level, source), 0)
+	logger.Handler().Handle(context.Background(), record)
+	logLevel.Set(level)
+}
+
+// watchLogLevelSignals switches to DEBUG on SIGUSR1 and back to LOG_LEVEL on
+// SIGUSR2 until the context is cancelled
+func watchLogLevelSignals(ctx context.Context, configured slog.Level) {
+	// Registered before returning, as the signals terminate the process by
+	// default
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case sig := <-signals:
+				level := configured
+				if sig == syscall.SIGUSR1 {
+					level = slog.LevelDebug
+				}
+				changeLogLevel(level, sig.String())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+type logAttrsKey struct{}
+
+type eventIDKey struct{}
+
+// withEventID returns the context of a received webhook: every log record of
+// its handling, from the input to the pushed jobs, carries a newly generated
+// event_id, which also identifies the event in the audit log and error
+// reports
+func withEventID(ctx context.Context) context.Context {
+	return withExistingEventID(ctx, newUUID())
+}
+
+// withExistingEventID returns the context of an event handled again later,
+// e.g. once the rate limit let it through, which keeps the ID it was
+// received with
+func withExistingEventID(ctx context.Context, id string) context.Context {
+	return withLogAttrs(context.WithValue(ctx, eventIDKey{}, id), slog.String("event_id", id))
+}
+
+// eventID returns the ID attached to the context by withEventID, if any
+func eventID(ctx context.Context) string {
+	id, _ := ctx.Value(eventIDKey{}).(string)
+	return id
+}
+
+// withLogAttrs returns a context whose log records carry the attributes, in
+// addition to those already attached to ctx
+func withLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, logAttrsKey{}, append(slices.Clip(existing), attrs...))
+}
+
+// contextHandler adds the attributes attached to the context of a record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// logf formats the message only when the level is enabled
+func logf(ctx context.Context, level slog.Level, format string, v []interface{}) {
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	logger.Log(ctx, level, fmt.Sprintf(format, v...))
+}
+
+func logDebug(format string, v ...interface{}) {
+	logf(context.Background(), slog.LevelDebug, format, v)
+}
+
+func logInfo(format string, v ...interface{}) {
+	logf(context.Background(), slog.LevelInfo, format, v)
+}
+
+func logWarn(format string, v ...interface{}) {
+	logf(context.Background(), slog.LevelWarn, format, v)
+}
+
+func logError(format string, v ...interface{}) {
+	logf(context.Background(), slog.LevelError, format, v)
+}
+
+// logDebugContext and the other Context helpers log with the fields attached
+// to ctx, such as the event_id, repo, ref and rule_id of a dispatch
+func logDebugContext(ctx context.Context, format string, v ...interface{}) {
+	logf(ctx, slog.LevelDebug, format, v)
+}
+
+func logInfoContext(ctx context.Context, format string, v ...interface{}) {
+	logf(ctx, slog.LevelInfo, format, v)
+}
+
+func logWarnContext(ctx context.Context, format string, v ...interface{}) {
+	logf(ctx, slog.LevelWarn, format, v)
+}
+
+func logErrorContext(ctx context.Context, format string, v ...interface{}) {
+	logf(ctx, slog.LevelError, format, v)
+}
+
+// logDebugPayload logs a debug message carrying a full payload, such as a
+// received webhook or a pushed job. Only DEBUG_SAMPLE_RATE of them are
+// logged, so debug logging stays usable under heavy traffic.
+func logDebugPayload(format string, v ...interface{}) {
+	logDebugPayloadContext(context.Background(), format, v...)
+}
+
+func logDebugPayloadContext(ctx context.Context, format string, v ...interface{}) {
+	if debugSampleRate < 1 && rand.Float64() >= debugSampleRate {
+		return
+	}
+	logf(ctx, slog.LevelDebug, format, v)
+}
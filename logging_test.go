@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_LogFormat(t *testing.T) {
+	config := loadConfig()
+
+	if config.LogFormat != logFormatText {
+		t.Errorf("Expected LogFormat to be 'text', got '%s'", config.LogFormat)
+	}
+
+	os.Setenv("LOG_FORMAT", "json")
+	defer os.Unsetenv("LOG_FORMAT")
+
+	config = loadConfig()
+
+	if config.LogFormat != logFormatJSON {
+		t.Errorf("Expected LogFormat to be 'json', got '%s'", config.LogFormat)
+	}
+}
+
+func TestValidateLogFormat(t *testing.T) {
+	for _, format := range []string{logFormatText, logFormatJSON} {
+		if err := validateLogFormat(format); err != nil {
+			t.Errorf("Expected '%s' to be valid, got %v", format, err)
+		}
+	}
+	for _, format := range []string{"", "JSON", "logfmt"} {
+		if err := validateLogFormat(format); err == nil {
+			t.Errorf("Expected '%s' to be invalid, got nil", format)
+		}
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected slog.Level
+	}{
+		{"DEBUG", slog.LevelDebug},
+		{"INFO", slog.LevelInfo},
+		{"WARN", slog.LevelWarn},
+		{"WARNING", slog.LevelWarn},
+		{"ERROR", slog.LevelError},
+		{"invalid", slog.LevelInfo}, // default to INFO
+		{"", slog.LevelInfo},        // default to INFO
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := parseLogLevel(tt.input)
+			if result != tt.expected {
+				t.Errorf("parseLogLevel(%q) = %v, expected %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// captureLogs writes the log records as JSON to the returned buffer at the
+// level until the test ends
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	previousLogger, previousLevel := logger, logLevel.Level()
+	t.Cleanup(func() {
+		logger = previousLogger
+		logLevel.Set(previousLevel)
+	})
+
+	var buf bytes.Buffer
+	logger = newLogger(logFormatJSON, &buf)
+	logLevel.Set(level)
+	return &buf
+}
+
+// decodeLogs returns the JSON log records in the buffer
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to decode log record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogHelpers(t *testing.T) {
+	buf := captureLogs(t, slog.LevelInfo)
+
+	logDebug("Not logged %d", 1)
+	logWarn("Queue '%s' is full", "pipeline")
+
+	records := decodeLogs(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record above the level, got %d: %s", len(records), buf)
+	}
+	if records[0]["level"] != "WARN" || records[0]["msg"] != "Queue 'pipeline' is full" {
+		t.Errorf("Expected the formatted warning, got %v", records[0])
+	}
+}
+
+func TestLogContext(t *testing.T) {
+	buf := captureLogs(t, slog.LevelInfo)
+
+	ctx := withLogAttrs(context.Background(), slog.String("repo", "owner/repo"))
+	child := withLogAttrs(ctx, slog.String("rule_id", "build"))
+	logInfoContext(ctx, "parent")
+	logInfoContext(child, "child")
+
+	records := decodeLogs(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d: %s", len(records), buf)
+	}
+	if records[0]["repo"] != "owner/repo" || records[0]["rule_id"] != nil {
+		t.Errorf("Expected only the repo on the parent record, got %v", records[0])
+	}
+	if records[1]["repo"] != "owner/repo" || records[1]["rule_id"] != "build" {
+		t.Errorf("Expected the repo and rule_id on the child record, got %v", records[1])
+	}
+}
+
+func TestDispatch_LogFields(t *testing.T) {
+	buf := captureLogs(t, slog.LevelDebug)
+
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, Config{PipelineQueueName: "pipeline"}, rules)
+	d.sink = &recordingSink{}
+
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+	if err := d.handleWebhookMessage(context.Background(), payload); err != nil {
+		t.Fatalf("Failed to handle webhook: %v", err)
+	}
+
+	records := decodeLogs(t, buf)
+	eventID := records[0]["event_id"]
+	if eventID == nil || eventID == "" {
+		t.Fatalf("Expected an event_id, got %v", records[0])
+	}
+	var dispatched bool
+	for _, record := range records {
+		if record["event_id"] != eventID || record["repo"] != "owner/repo" || record["ref"] != "refs/heads/main" {
+			t.Errorf("Expected every record of the dispatch to carry its fields, got %v", record)
+		}
+		if strings.HasPrefix(record["msg"].(string), "Dispatched job") {
+			dispatched = true
+			if record["rule_id"] != "build" {
+				t.Errorf("Expected the rule_id on the dispatched job, got %v", record)
+			}
+		}
+	}
+	if !dispatched {
+		t.Errorf("Expected the dispatched job to be logged, got %s", buf)
+	}
+}
+
+func TestLoadConfig_LogOutput(t *testing.T) {
+	config := loadConfig()
+
+	if config.LogOutput != logOutputStderr {
+		t.Errorf("Expected LogOutput to be 'stderr', got '%s'", config.LogOutput)
+	}
+	if config.LogFileMaxSize != 100 || config.LogFileMaxBackups != 5 || config.LogFileRotateInterval != 0 {
+		t.Errorf("Expected 100MB, 5 backups and no interval, got %dMB, %d and %s", config.LogFileMaxSize, config.LogFileMaxBackups, config.LogFileRotateInterval)
+	}
+	if config.LogSyslogTag != "github-dispatcher" {
+		t.Errorf("Expected LogSyslogTag to be 'github-dispatcher', got '%s'", config.LogSyslogTag)
+	}
+
+	os.Setenv("LOG_OUTPUT", "file:/var/log/dispatcher.log")
+	os.Setenv("LOG_FILE_MAX_SIZE_MB", "10")
+	os.Setenv("LOG_FILE_MAX_BACKUPS", "7")
+	os.Setenv("LOG_FILE_ROTATE_INTERVAL", "24h")
+	os.Setenv("LOG_SYSLOG_TAG", "dispatcher")
+	defer os.Unsetenv("LOG_OUTPUT")
+	defer os.Unsetenv("LOG_FILE_MAX_SIZE_MB")
+	defer os.Unsetenv("LOG_FILE_MAX_BACKUPS")
+	defer os.Unsetenv("LOG_FILE_ROTATE_INTERVAL")
+	defer os.Unsetenv("LOG_SYSLOG_TAG")
+
+	config = loadConfig()
+
+	if config.LogOutput != "file:/var/log/dispatcher.log" {
+		t.Errorf("Expected LogOutput to be the file, got '%s'", config.LogOutput)
+	}
+	if config.LogFileMaxSize != 10 || config.LogFileMaxBackups != 7 || config.LogFileRotateInterval != 24*time.Hour {
+		t.Errorf("Expected 10MB, 7 backups and 24h, got %dMB, %d and %s", config.LogFileMaxSize, config.LogFileMaxBackups, config.LogFileRotateInterval)
+	}
+	if config.LogSyslogTag != "dispatcher" {
+		t.Errorf("Expected LogSyslogTag to be 'dispatcher', got '%s'", config.LogSyslogTag)
+	}
+}
+
+func TestNewLogHandler_Invalid(t *testing.T) {
+	valid := Config{LogFormat: logFormatText, LogFileMaxSize: 100, LogFileMaxBackups: 5}
+	for _, output := range []string{"", "stdout", "file:", "syslog:", "udp://localhost:514"} {
+		config := valid
+		config.LogOutput = output
+		if _, err := newLogHandler(config); err == nil {
+			t.Errorf("Expected LOG_OUTPUT '%s' to be invalid, got nil", output)
+		}
+	}
+
+	config := valid
+	config.LogOutput = logOutputFilePrefix + filepath.Join(t.TempDir(), "dispatcher.log")
+	config.LogFileMaxSize = 0
+	if _, err := newLogHandler(config); err == nil {
+		t.Error("Expected LOG_FILE_MAX_SIZE_MB 0 to be invalid, got nil")
+	}
+}
+
+func TestNewLogHandler_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dispatcher.log")
+	handler, err := newLogHandler(Config{LogOutput: logOutputFilePrefix + path, LogFormat: logFormatJSON, LogFileMaxSize: 1, LogFileMaxBackups: 1})
+	if err != nil {
+		t.Fatalf("Failed to create log handler: %v", err)
+	}
+
+	slog.New(handler).Warn("Queue is full", "queue", "pipeline")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	records := decodeLogs(t, bytes.NewBuffer(data))
+	if len(records) != 1 || records[0]["msg"] != "Queue is full" || records[0]["queue"] != "pipeline" {
+		t.Errorf("Expected the record in the log file, got %s", data)
+	}
+}
+
+// recordingSyslog keeps the messages sent by severity
+type recordingSyslog struct {
+	messages []string
+}
+
+func (s *recordingSyslog) record(severity, m string) error {
+	s.messages = append(s.messages, severity+" "+m)
+	return nil
+}
+
+func (s *recordingSyslog) Debug(m string) error   { return s.record("debug", m) }
+func (s *recordingSyslog) Info(m string) error    { return s.record("info", m) }
+func (s *recordingSyslog) Warning(m string) error { return s.record("warning", m) }
+func (s *recordingSyslog) Err(m string) error     { return s.record("err", m) }
+
+func TestSyslogHandler(t *testing.T) {
+	previousLevel := logLevel.Level()
+	defer logLevel.Set(previousLevel)
+	logLevel.Set(slog.LevelDebug)
+
+	writer := &recordingSyslog{}
+	log := slog.New(contextHandler{newSyslogHandler(logFormatText, writer)}).With("service", "dispatcher")
+	ctx := withLogAttrs(context.Background(), slog.String("repo", "owner/repo"))
+
+	log.DebugContext(ctx, "debug")
+	log.InfoContext(ctx, "info")
+	log.WarnContext(ctx, "warn")
+	log.ErrorContext(ctx, "error")
+
+	expected := []string{
+		`debug level=DEBUG msg=debug service=dispatcher repo=owner/repo`,
+		`info level=INFO msg=info service=dispatcher repo=owner/repo`,
+		`warning level=WARN msg=warn service=dispatcher repo=owner/repo`,
+		`err level=ERROR msg=error service=dispatcher repo=owner/repo`,
+	}
+	if strings.Join(writer.messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the messages by severity without the time, got %q", writer.messages)
+	}
+}
+
+func TestNewLogHandler_RemoteSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP not available: %v", err)
+	}
+	defer conn.Close()
+
+	handler, err := newLogHandler(Config{LogOutput: logOutputSyslogUDP + conn.LocalAddr().String(), LogFormat: logFormatText, LogSyslogTag: "dispatcher"})
+	if err != nil {
+		t.Fatalf("Failed to create log handler: %v", err)
+	}
+	slog.New(handler).Error("Failed to dispatch")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	packet := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(packet)
+	if err != nil {
+		t.Fatalf("Failed to read syslog message: %v", err)
+	}
+	// Priority 27 is the daemon facility (3) with the err severity (3)
+	message := string(packet[:n])
+	if !strings.HasPrefix(message, "<27>") || !strings.Contains(message, "dispatcher[") || !strings.Contains(message, "msg=\"Failed to dispatch\"") {
+		t.Errorf("Expected an error of the daemon facility, got %q", message)
+	}
+}
+
+func TestLoadConfig_DebugSampleRate(t *testing.T) {
+	config := loadConfig()
+
+	if config.DebugSampleRate != 1 {
+		t.Errorf("Expected DebugSampleRate to be 1, got %g", config.DebugSampleRate)
+	}
+
+	os.Setenv("DEBUG_SAMPLE_RATE", "0.01")
+	defer os.Unsetenv("DEBUG_SAMPLE_RATE")
+
+	config = loadConfig()
+
+	if config.DebugSampleRate != 0.01 {
+		t.Errorf("Expected DebugSampleRate to be 0.01, got %g", config.DebugSampleRate)
+	}
+}
+
+func TestSetupLogging_InvalidDebugSampleRate(t *testing.T) {
+	for _, rate := range []float64{-0.1, 1.5} {
+		config := Config{LogFormat: logFormatText, LogOutput: logOutputStderr, DebugSampleRate: rate}
+		if err := setupLogging(config); err == nil {
+			t.Errorf("Expected DEBUG_SAMPLE_RATE %g to be invalid, got nil", rate)
+		}
+	}
+}
+
+func TestLogDebugPayload(t *testing.T) {
+	buf := captureLogs(t, slog.LevelDebug)
+	defer func(rate float64) { debugSampleRate = rate }(debugSampleRate)
+
+	for _, tt := range []struct {
+		rate     float64
+		min, max int
+	}{
+		{1, 1000, 1000},
+		{0, 0, 0},
+		{0.5, 350, 650},
+	} {
+		debugSampleRate = tt.rate
+		buf.Reset()
+		for i := 0; i < 1000; i++ {
+			logDebugPayload("Received message:\n%s", `{"ref":"refs/heads/main"}`)
+		}
+		// Other debug messages are not sampled
+		logDebug("Processing push event")
+
+		logged := strings.Count(buf.String(), "Received message")
+		if logged < tt.min || logged > tt.max {
+			t.Errorf("Expected %d to %d of 1000 payloads logged at rate %g, got %d", tt.min, tt.max, tt.rate, logged)
+		}
+		if !strings.Contains(buf.String(), "Processing push event") {
+			t.Errorf("Expected the other debug message to be logged at rate %g", tt.rate)
+		}
+	}
+}
+
+func TestEventID_ThroughDispatch(t *testing.T) {
+	buf := captureLogs(t, slog.LevelDebug)
+
+	config := Config{PipelineQueueName: "pipeline", WebhookSecret: "secret"}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	d.sink = &recordingSink{}
+	audit := &recordingAuditLog{}
+	d.auditLog = audit
+
+	body := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+	envelope, _ := json.Marshal(signedWebhook{Signature: signPayload("secret", []byte(body)), Body: body})
+	ctx := withEventID(context.Background())
+	id := eventID(ctx)
+	if id == "" {
+		t.Fatal("Expected an event ID")
+	}
+	if err := d.handleWebhookMessage(ctx, string(envelope)); err != nil {
+		t.Fatalf("Failed to handle webhook: %v", err)
+	}
+	// Rejected webhooks are logged with their ID too
+	rejected := withEventID(context.Background())
+	if err := d.handleWebhookMessage(rejected, body); err != nil {
+		t.Fatalf("Failed to handle webhook: %v", err)
+	}
+
+	records := decodeLogs(t, buf)
+	last := records[len(records)-1]
+	if last["level"] != "WARN" || last["event_id"] != eventID(rejected) {
+		t.Errorf("Expected the rejection to carry its event ID, got %v", last)
+	}
+	for _, record := range records[:len(records)-1] {
+		if record["event_id"] != id {
+			t.Errorf("Expected every record of the dispatch to carry event ID %s, got %v", id, record)
+		}
+	}
+	if len(audit.records) != 1 || audit.records[0].EventID != id {
+		t.Errorf("Expected the audit record to carry event ID %s, got %+v", id, audit.records)
+	}
+}
+
+func TestEventID_Replay(t *testing.T) {
+	buf := captureLogs(t, slog.LevelInfo)
+	path := writeReplayFile(t, `{"ref":"refs/heads/main"}`)
+
+	var handled string
+	handle := func(ctx context.Context, payload string) error {
+		handled = eventID(ctx)
+		return errors.New("boom")
+	}
+	if err := (&fileSource{path: path}).consume(context.Background(), handle); err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+
+	records := decodeLogs(t, buf)
+	if handled == "" || records[0]["event_id"] != handled {
+		t.Errorf("Expected the failure to be logged with the event ID %s, got %v", handled, records[0])
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -13,10 +16,22 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	// Clear environment variables
 	os.Unsetenv("REDIS_HOST")
 	os.Unsetenv("REDIS_PORT")
+	os.Unsetenv("REDIS_USERNAME")
+	os.Unsetenv("REDIS_PASSWORD")
+	os.Unsetenv("REDIS_DB")
 	os.Unsetenv("REDIS_CHANNEL")
 	os.Unsetenv("CONFIG_FILE_PATH")
 	os.Unsetenv("PIPELINE_QUEUE_NAME")
 	os.Unsetenv("LOG_LEVEL")
+	os.Unsetenv("OUTPUT_MODE")
+	os.Unsetenv("OUTPUT_STREAM")
+	os.Unsetenv("OUTPUT_STREAM_MAXLEN")
+	os.Unsetenv("INPUT_MODE")
+	os.Unsetenv("INPUT_STREAM")
+	os.Unsetenv("INPUT_STREAM_GROUP")
+	os.Unsetenv("INPUT_STREAM_FIELD")
+	os.Unsetenv("INPUT_STREAM_CLAIM_IDLE")
+	os.Unsetenv("INPUT_STREAM_MAX_DELIVERIES")
 
 	config := loadConfig()
 
@@ -28,6 +43,18 @@ func TestLoadConfig_Defaults(t *testing.T) {
 		t.Errorf("Expected RedisPort to be '6379', got '%s'", config.RedisPort)
 	}
 
+	if config.RedisUsername != "" {
+		t.Errorf("Expected RedisUsername to be empty, got '%s'", config.RedisUsername)
+	}
+
+	if config.RedisPassword != "" {
+		t.Errorf("Expected RedisPassword to be empty, got '%s'", config.RedisPassword)
+	}
+
+	if config.RedisDB != 0 {
+		t.Errorf("Expected RedisDB to be 0, got %d", config.RedisDB)
+	}
+
 	if config.RedisChannel != "github-webhook-push" {
 		t.Errorf("Expected RedisChannel to be 'github-webhook-push', got '%s'", config.RedisChannel)
 	}
@@ -43,16 +70,65 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	if config.LogLevel != "INFO" {
 		t.Errorf("Expected LogLevel to be 'INFO', got '%s'", config.LogLevel)
 	}
+
+	if config.OutputMode != "list" {
+		t.Errorf("Expected OutputMode to be 'list', got '%s'", config.OutputMode)
+	}
+
+	if config.OutputStream != "pipeline-stream" {
+		t.Errorf("Expected OutputStream to be 'pipeline-stream', got '%s'", config.OutputStream)
+	}
+
+	if config.OutputStreamMaxLen != 0 {
+		t.Errorf("Expected OutputStreamMaxLen to be 0, got %d", config.OutputStreamMaxLen)
+	}
+
+	if config.InputMode != "pubsub" {
+		t.Errorf("Expected InputMode to be 'pubsub', got '%s'", config.InputMode)
+	}
+
+	if config.InputStream != "github-webhook-push" {
+		t.Errorf("Expected InputStream to be 'github-webhook-push', got '%s'", config.InputStream)
+	}
+
+	if config.InputStreamGroup != "github-dispatcher" {
+		t.Errorf("Expected InputStreamGroup to be 'github-dispatcher', got '%s'", config.InputStreamGroup)
+	}
+
+	if config.InputStreamField != "payload" {
+		t.Errorf("Expected InputStreamField to be 'payload', got '%s'", config.InputStreamField)
+	}
+
+	if config.InputStreamClaimIdle != time.Minute {
+		t.Errorf("Expected InputStreamClaimIdle to be 1m, got %s", config.InputStreamClaimIdle)
+	}
+
+	if config.InputStreamMaxDeliveries != 5 {
+		t.Errorf("Expected InputStreamMaxDeliveries to be 5, got %d", config.InputStreamMaxDeliveries)
+	}
 }
 
 func TestLoadConfig_CustomValues(t *testing.T) {
 	// Set environment variables
 	os.Setenv("REDIS_HOST", "redis-server")
 	os.Setenv("REDIS_PORT", "6380")
+	os.Setenv("REDIS_USERNAME", "dispatcher")
+	os.Setenv("REDIS_PASSWORD", "secret")
+	os.Setenv("REDIS_DB", "3")
 	os.Setenv("REDIS_CHANNEL", "custom-channel")
 	os.Setenv("CONFIG_FILE_PATH", "/path/to/config.json")
 	os.Setenv("PIPELINE_QUEUE_NAME", "custom-pipeline")
 	os.Setenv("LOG_LEVEL", "DEBUG")
+	os.Setenv("OUTPUT_MODE", "both")
+	os.Setenv("OUTPUT_STREAM", "jobs")
+	os.Setenv("OUTPUT_STREAM_MAXLEN", "1000")
+	os.Setenv("INPUT_MODE", "stream")
+	os.Setenv("INPUT_STREAM", "webhooks")
+	os.Setenv("INPUT_STREAM_GROUP", "dispatchers")
+	os.Setenv("INPUT_STREAM_CONSUMER", "dispatcher-1")
+	os.Setenv("INPUT_STREAM_FIELD", "body")
+	os.Setenv("INPUT_STREAM_CLAIM_IDLE", "30s")
+	os.Setenv("INPUT_STREAM_MAX_DELIVERIES", "3")
 
 	config := loadConfig()
 
@@ -64,6 +140,18 @@ func TestLoadConfig_CustomValues(t *testing.T) {
 		t.Errorf("Expected RedisPort to be '6380', got '%s'", config.RedisPort)
 	}
 
+	if config.RedisUsername != "dispatcher" {
+		t.Errorf("Expected RedisUsername to be 'dispatcher', got '%s'", config.RedisUsername)
+	}
+
+	if config.RedisPassword != "secret" {
+		t.Errorf("Expected RedisPassword to be 'secret', got '%s'", config.RedisPassword)
+	}
+
+	if config.RedisDB != 3 {
+		t.Errorf("Expected RedisDB to be 3, got %d", config.RedisDB)
+	}
+
 	if config.RedisChannel != "custom-channel" {
 		t.Errorf("Expected RedisChannel to be 'custom-channel', got '%s'", config.RedisChannel)
 	}
@@ -80,13 +168,66 @@ func TestLoadConfig_CustomValues(t *testing.T) {
 		t.Errorf("Expected LogLevel to be 'DEBUG', got '%s'", config.LogLevel)
 	}
 
+	if config.OutputMode != "both" {
+		t.Errorf("Expected OutputMode to be 'both', got '%s'", config.OutputMode)
+	}
+
+	if config.OutputStream != "jobs" {
+		t.Errorf("Expected OutputStream to be 'jobs', got '%s'", config.OutputStream)
+	}
+
+	if config.OutputStreamMaxLen != 1000 {
+		t.Errorf("Expected OutputStreamMaxLen to be 1000, got %d", config.OutputStreamMaxLen)
+	}
+
+	if config.InputMode != "stream" {
+		t.Errorf("Expected InputMode to be 'stream', got '%s'", config.InputMode)
+	}
+
+	if config.InputStream != "webhooks" {
+		t.Errorf("Expected InputStream to be 'webhooks', got '%s'", config.InputStream)
+	}
+
+	if config.InputStreamGroup != "dispatchers" {
+		t.Errorf("Expected InputStreamGroup to be 'dispatchers', got '%s'", config.InputStreamGroup)
+	}
+
+	if config.InputStreamConsumer != "dispatcher-1" {
+		t.Errorf("Expected InputStreamConsumer to be 'dispatcher-1', got '%s'", config.InputStreamConsumer)
+	}
+
+	if config.InputStreamField != "body" {
+		t.Errorf("Expected InputStreamField to be 'body', got '%s'", config.InputStreamField)
+	}
+
+	if config.InputStreamClaimIdle != 30*time.Second {
+		t.Errorf("Expected InputStreamClaimIdle to be 30s, got %s", config.InputStreamClaimIdle)
+	}
+
+	if config.InputStreamMaxDeliveries != 3 {
+		t.Errorf("Expected InputStreamMaxDeliveries to be 3, got %d", config.InputStreamMaxDeliveries)
+	}
+
 	// Clean up
 	os.Unsetenv("REDIS_HOST")
 	os.Unsetenv("REDIS_PORT")
+	os.Unsetenv("REDIS_USERNAME")
+	os.Unsetenv("REDIS_PASSWORD")
+	os.Unsetenv("REDIS_DB")
 	os.Unsetenv("REDIS_CHANNEL")
 	os.Unsetenv("CONFIG_FILE_PATH")
 	os.Unsetenv("PIPELINE_QUEUE_NAME")
 	os.Unsetenv("LOG_LEVEL")
+	os.Unsetenv("OUTPUT_MODE")
+	os.Unsetenv("OUTPUT_STREAM")
+	os.Unsetenv("OUTPUT_STREAM_MAXLEN")
+	os.Unsetenv("INPUT_MODE")
+	os.Unsetenv("INPUT_STREAM")
+	os.Unsetenv("INPUT_STREAM_GROUP")
+	os.Unsetenv("INPUT_STREAM_CONSUMER")
+	os.Unsetenv("INPUT_STREAM_FIELD")
+	os.Unsetenv("INPUT_STREAM_CLAIM_IDLE")
+	os.Unsetenv("INPUT_STREAM_MAX_DELIVERIES")
 }
 
 func TestGetEnv(t *testing.T) {
@@ -105,6 +246,60 @@ func TestGetEnv(t *testing.T) {
 	}
 }
 
+func TestGetEnvInt(t *testing.T) {
+	os.Setenv("TEST_INT", "42")
+	if value := getEnvInt("TEST_INT", 7); value != 42 {
+		t.Errorf("Expected 42, got %d", value)
+	}
+
+	// Invalid values fall back to the default
+	os.Setenv("TEST_INT", "not-a-number")
+	if value := getEnvInt("TEST_INT", 7); value != 7 {
+		t.Errorf("Expected default 7, got %d", value)
+	}
+	os.Unsetenv("TEST_INT")
+
+	if value := getEnvInt("TEST_INT", 7); value != 7 {
+		t.Errorf("Expected default 7, got %d", value)
+	}
+}
+
+func TestGetEnvDuration(t *testing.T) {
+	os.Setenv("TEST_DURATION", "90s")
+	if value := getEnvDuration("TEST_DURATION", time.Second); value != 90*time.Second {
+		t.Errorf("Expected 90s, got %s", value)
+	}
+
+	// Invalid values fall back to the default
+	os.Setenv("TEST_DURATION", "soon")
+	if value := getEnvDuration("TEST_DURATION", time.Second); value != time.Second {
+		t.Errorf("Expected default 1s, got %s", value)
+	}
+	os.Unsetenv("TEST_DURATION")
+
+	if value := getEnvDuration("TEST_DURATION", time.Second); value != time.Second {
+		t.Errorf("Expected default 1s, got %s", value)
+	}
+}
+
+func TestGetEnvBool(t *testing.T) {
+	os.Setenv("TEST_BOOL", "true")
+	if value := getEnvBool("TEST_BOOL", false); !value {
+		t.Error("Expected true, got false")
+	}
+
+	// Invalid values fall back to the default
+	os.Setenv("TEST_BOOL", "maybe")
+	if value := getEnvBool("TEST_BOOL", true); !value {
+		t.Error("Expected default true, got false")
+	}
+	os.Unsetenv("TEST_BOOL")
+
+	if value := getEnvBool("TEST_BOOL", false); value {
+		t.Error("Expected default false, got true")
+	}
+}
+
 func TestLoadFilterRules(t *testing.T) {
 	// Create a temporary config file
 	tempFile, err := os.CreateTemp("", "config-*.json")
@@ -122,6 +317,7 @@ func TestLoadFilterRules(t *testing.T) {
 			"commands": ["make build", "make test"]
 		},
 		{
+			"id": "repo2-develop",
 			"repo": "owner/repo2",
 			"branch": "refs/heads/develop",
 			"type": "git-webhook",
@@ -163,6 +359,15 @@ func TestLoadFilterRules(t *testing.T) {
 	if rules[1].Dir != "/home/user/repo2" {
 		t.Errorf("Expected dir '/home/user/repo2', got '%s'", rules[1].Dir)
 	}
+
+	// Rules without an ID are identified by repo and branch
+	if rules[0].ID != "owner/repo1@refs/heads/main" {
+		t.Errorf("Expected ID 'owner/repo1@refs/heads/main', got '%s'", rules[0].ID)
+	}
+
+	if rules[1].ID != "repo2-develop" {
+		t.Errorf("Expected ID 'repo2-develop', got '%s'", rules[1].ID)
+	}
 }
 
 func TestLoadFilterRules_InvalidFile(t *testing.T) {
@@ -190,6 +395,143 @@ func TestLoadFilterRules_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestLoadFilterRules_EmptyMatrix(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "config-*.json")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	configData := `[
+		{
+			"repo": "owner/repo1",
+			"branch": "refs/heads/main",
+			"commands": ["go{{.Matrix.go}} test ./..."],
+			"matrix": {"go": []}
+		}
+	]`
+
+	if _, err := tempFile.WriteString(configData); err != nil {
+		t.Fatalf("Failed to write to temp file: %v", err)
+	}
+	tempFile.Close()
+
+	_, err = loadFilterRules(tempFile.Name())
+	if err == nil {
+		t.Error("Expected error for matrix key without values, got nil")
+	}
+}
+
+func TestValidateFilterRules_MatrixRequiresTemplate(t *testing.T) {
+	rules := []FilterRule{{Repo: "owner/repo1", Matrix: map[string][]string{"go": {"1.22"}}}}
+	if err := validateFilterRules(rules); err == nil || !strings.Contains(err.Error(), "matrix requires template") {
+		t.Errorf("Expected error for matrix without template, got %v", err)
+	}
+
+	rules[0].Template = true
+	if err := validateFilterRules(rules); err != nil {
+		t.Errorf("Expected templated matrix rule to be valid, got %v", err)
+	}
+}
+
+func TestValidateFilterRules_MatrixCombinations(t *testing.T) {
+	values := make([]string, 16)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	rules := []FilterRule{{Repo: "owner/repo1", Template: true, Matrix: map[string][]string{"a": values, "b": values}}}
+	if err := validateFilterRules(rules); err != nil {
+		t.Errorf("Expected %d combinations to be valid, got %v", maxMatrixCombinations, err)
+	}
+
+	rules[0].Matrix["c"] = []string{"x", "y"}
+	if err := validateFilterRules(rules); err == nil || !strings.Contains(err.Error(), "combinations") {
+		t.Errorf("Expected error for too many combinations, got %v", err)
+	}
+}
+
+func TestValidateFilterRules_Priority(t *testing.T) {
+	rules := []FilterRule{{Repo: "owner/repo1", Priority: 100}, {Repo: "owner/repo2", Priority: -5}}
+	if err := validateFilterRules(rules); err != nil {
+		t.Errorf("Expected priorities to be valid, got %v", err)
+	}
+
+	rules = []FilterRule{{Repo: "owner/repo1", Priority: maxPriority + 1}}
+	if err := validateFilterRules(rules); err == nil {
+		t.Error("Expected error for priority out of range, got nil")
+	}
+
+	rules = []FilterRule{{Repo: "owner/repo1", DelaySeconds: -1}}
+	if err := validateFilterRules(rules); err == nil {
+		t.Error("Expected error for negative delay_seconds, got nil")
+	}
+
+	rules = []FilterRule{{Repo: "owner/repo1", Queues: []string{"pipeline", "audit:{{.RepoName"}}}
+	if err := validateFilterRules(rules); err == nil {
+		t.Error("Expected error for invalid queue name template, got nil")
+	}
+}
+
+func TestCommand_JSON(t *testing.T) {
+	var commands []Command
+	data := `["make build", {"run": "make deploy", "when": "eq .Ref \"refs/heads/main\""}]`
+	if err := json.Unmarshal([]byte(data), &commands); err != nil {
+		t.Fatalf("Failed to parse commands: %v", err)
+	}
+
+	if len(commands) != 2 {
+		t.Fatalf("Expected 2 commands, got %d", len(commands))
+	}
+
+	if commands[0].Run != "make build" || commands[0].When != "" {
+		t.Errorf("Expected plain command 'make build', got %+v", commands[0])
+	}
+
+	if commands[1].Run != "make deploy" || commands[1].When != `eq .Ref "refs/heads/main"` {
+		t.Errorf("Expected conditional command 'make deploy', got %+v", commands[1])
+	}
+
+	// Commands without a condition are written back as plain strings
+	encoded, err := json.Marshal(commands)
+	if err != nil {
+		t.Fatalf("Failed to serialize commands: %v", err)
+	}
+	expected := `["make build",{"run":"make deploy","when":"eq .Ref \"refs/heads/main\""}]`
+	if string(encoded) != expected {
+		t.Errorf("Expected %s, got %s", expected, string(encoded))
+	}
+
+	if err := json.Unmarshal([]byte(`[42]`), &commands); err == nil {
+		t.Error("Expected error for invalid command, got nil")
+	}
+}
+
+func TestLoadFilterRules_InvalidCondition(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "config-*.json")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	configData := `[
+		{
+			"repo": "owner/repo1",
+			"branch": "refs/heads/main",
+			"commands": [{"run": "make deploy", "when": "eq .Ref"}}]
+		}
+	]`
+
+	if _, err := tempFile.WriteString(configData); err != nil {
+		t.Fatalf("Failed to write to temp file: %v", err)
+	}
+	tempFile.Close()
+
+	_, err = loadFilterRules(tempFile.Name())
+	if err == nil {
+		t.Error("Expected error for invalid when condition, got nil")
+	}
+}
+
 func TestFindMatchingRule(t *testing.T) {
 	rules := []FilterRule{
 		{
@@ -197,19 +539,19 @@ func TestFindMatchingRule(t *testing.T) {
 			Branch:   "refs/heads/main",
 			Type:     "git-webhook",
 			Dir:      "/home/user/repo1",
-			Commands: []string{"make build"},
+			Commands: []Command{{Run: "make build"}},
 		},
 		{
 			Repo:     "owner/repo2",
 			Branch:   "refs/heads/develop",
 			Type:     "git-webhook",
 			Dir:      "/home/user/repo2",
-			Commands: []string{"npm test"},
+			Commands: []Command{{Run: "npm test"}},
 		},
 	}
 
 	// Test matching rule
-	rule := findMatchingRule(rules, "owner/repo1", "refs/heads/main")
+	rule := findMatchingRule(rules, eventTypePush, "owner/repo1", "refs/heads/main")
 	if rule == nil {
 		t.Error("Expected to find matching rule, got nil")
 	} else {
@@ -222,18 +564,331 @@ func TestFindMatchingRule(t *testing.T) {
 	}
 
 	// Test non-matching rule
-	rule = findMatchingRule(rules, "owner/repo3", "refs/heads/main")
+	rule = findMatchingRule(rules, eventTypePush, "owner/repo3", "refs/heads/main")
 	if rule != nil {
 		t.Error("Expected no matching rule, got one")
 	}
 
 	// Test with wrong branch
-	rule = findMatchingRule(rules, "owner/repo1", "refs/heads/develop")
+	rule = findMatchingRule(rules, eventTypePush, "owner/repo1", "refs/heads/develop")
 	if rule != nil {
 		t.Error("Expected no matching rule for wrong branch, got one")
 	}
 }
 
+func TestFindMatchingRule_Events(t *testing.T) {
+	rules := []FilterRule{
+		{
+			Repo:     "owner/repo1",
+			Branch:   "refs/heads/main",
+			Commands: []Command{{Run: "make deploy"}},
+		},
+		{
+			Repo:     "owner/repo1",
+			Branch:   "refs/heads/main",
+			Commands: []Command{{Run: "make test"}},
+			Events:   []string{"pull_request"},
+		},
+	}
+
+	// Rules without events only handle pushes
+	rule := findMatchingRule(rules, eventTypePush, "owner/repo1", "refs/heads/main")
+	if rule == nil || rule.Commands[0].Run != "make deploy" {
+		t.Errorf("Expected push to match the push rule, got %+v", rule)
+	}
+
+	rule = findMatchingRule(rules, eventTypePullRequest, "owner/repo1", "refs/heads/main")
+	if rule == nil || rule.Commands[0].Run != "make test" {
+		t.Errorf("Expected pull_request to match the pull_request rule, got %+v", rule)
+	}
+
+	rule = findMatchingRule(rules[:1], eventTypePullRequest, "owner/repo1", "refs/heads/main")
+	if rule != nil {
+		t.Error("Expected no match for pull_request against a push-only rule, got one")
+	}
+}
+
+func TestFilterRule_CommandsFor(t *testing.T) {
+	rule := FilterRule{
+		Commands:     []Command{{Run: "make build"}},
+		CommandsPR:   []Command{{Run: "make test"}},
+		CommandsTag:  []Command{{Run: "make release"}},
+		CommandsPush: []Command{{Run: "make deploy"}},
+	}
+
+	tests := []struct {
+		name     string
+		event    GitHubEvent
+		expected string
+	}{
+		{"push", GitHubEvent{Ref: "refs/heads/main"}, "make deploy"},
+		{"pull request", GitHubEvent{PullRequest: &GitHubPullRequest{}}, "make test"},
+		{"tag", GitHubEvent{Ref: "refs/tags/v1.0.0"}, "make release"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands := rule.CommandsFor(&tt.event)
+			if len(commands) != 1 || commands[0].Run != tt.expected {
+				t.Errorf("Expected commands [%s], got %v", tt.expected, commands)
+			}
+		})
+	}
+
+	// Event types without a command set fall back to the default commands
+	fallback := FilterRule{Commands: []Command{{Run: "make build"}}}
+	commands := fallback.CommandsFor(&GitHubEvent{Ref: "refs/tags/v1.0.0"})
+	if len(commands) != 1 || commands[0].Run != "make build" {
+		t.Errorf("Expected fallback commands [make build], got %v", commands)
+	}
+}
+
+func TestFindMatchingRule_CommandSets(t *testing.T) {
+	rules := []FilterRule{
+		{
+			Repo:     "owner/repo1",
+			Branch:   "refs/heads/main",
+			Commands: []Command{{Run: "make build"}},
+		},
+		{
+			Repo:        "owner/repo2",
+			Branch:      "refs/heads/main",
+			CommandsPR:  []Command{{Run: "make test"}},
+			CommandsTag: []Command{{Run: "make release"}},
+		},
+	}
+
+	// Tag pushes match rules of the repository that define commands_tag
+	rule := findMatchingRule(rules, eventTypePush, "owner/repo2", "refs/tags/v1.0.0")
+	if rule == nil || rule.Repo != "owner/repo2" {
+		t.Errorf("Expected tag push to match the rule with commands_tag, got %+v", rule)
+	}
+
+	rule = findMatchingRule(rules, eventTypePush, "owner/repo1", "refs/tags/v1.0.0")
+	if rule != nil {
+		t.Error("Expected no match for tag push against a rule without commands_tag, got one")
+	}
+
+	// Pull requests match rules that define commands_pr without listing events
+	rule = findMatchingRule(rules, eventTypePullRequest, "owner/repo2", "refs/heads/main")
+	if rule == nil || rule.Repo != "owner/repo2" {
+		t.Errorf("Expected pull_request to match the rule with commands_pr, got %+v", rule)
+	}
+
+	rule = findMatchingRule(rules, eventTypePullRequest, "owner/repo1", "refs/heads/main")
+	if rule != nil {
+		t.Error("Expected no match for pull_request against a rule without commands_pr, got one")
+	}
+}
+
+func TestGitHubEvent_PullRequest(t *testing.T) {
+	payload := `{
+		"action": "synchronize",
+		"number": 42,
+		"pull_request": {
+			"number": 42,
+			"title": "Add feature",
+			"head": {"ref": "feature/x", "sha": "1234567890abcdef1234567890abcdef12345678"},
+			"base": {"ref": "main", "sha": "abcdefabcdefabcdefabcdefabcdefabcdefabcd"},
+			"user": {"login": "octocat"},
+			"author_association": "FIRST_TIME_CONTRIBUTOR"
+		},
+		"repository": {
+			"full_name": "owner/test-repo"
+		}
+	}`
+
+	var event GitHubEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatalf("Failed to parse pull_request payload: %v", err)
+	}
+
+	if event.Type() != eventTypePullRequest {
+		t.Errorf("Expected type '%s', got '%s'", eventTypePullRequest, event.Type())
+	}
+
+	if event.MatchRef() != "refs/heads/main" {
+		t.Errorf("Expected match ref 'refs/heads/main', got '%s'", event.MatchRef())
+	}
+
+	if event.CommitSHA() != "1234567890abcdef1234567890abcdef12345678" {
+		t.Errorf("Expected commit SHA of the PR head, got '%s'", event.CommitSHA())
+	}
+
+	if !event.IsDispatchable() {
+		t.Error("Expected synchronize action to be dispatchable")
+	}
+
+	event.Action = "labeled"
+	if event.IsDispatchable() {
+		t.Error("Expected labeled action not to be dispatchable")
+	}
+
+	rule := FilterRule{Repo: "owner/test-repo", Branch: "refs/heads/main", Events: []string{"pull_request"}}
+	dispatched := mustBuildJob(t, &rule, event)
+
+	expected := map[string]string{
+		prNumberKey:          "42",
+		prTitleKey:           "Add feature",
+		prHeadRefKey:         "feature/x",
+		prBaseRefKey:         "main",
+		prHeadSHAKey:         "1234567890abcdef1234567890abcdef12345678",
+		prAuthorKey:          "octocat",
+		gitCommitSHAKey:      "1234567890abcdef1234567890abcdef12345678",
+		gitCommitShortKey:    "1234567",
+		authorAssociationKey: "FIRST_TIME_CONTRIBUTOR",
+	}
+	for key, value := range expected {
+		if dispatched.Metadata[key] != value {
+			t.Errorf("Expected metadata %s '%s', got '%s'", key, value, dispatched.Metadata[key])
+		}
+	}
+}
+
+func TestGitHubEvent_Release(t *testing.T) {
+	payload := `{
+		"action": "published",
+		"release": {"tag_name": "v1.2.0"},
+		"repository": {"full_name": "owner/test-repo"}
+	}`
+
+	var event GitHubEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatalf("Failed to parse release payload: %v", err)
+	}
+
+	// Without the hint of its channel the payload is taken for a push
+	if event.Type() != eventTypePush {
+		t.Errorf("Expected type '%s', got '%s'", eventTypePush, event.Type())
+	}
+
+	event.TypeHint = eventTypeRelease
+	if event.Type() != eventTypeRelease {
+		t.Errorf("Expected type '%s', got '%s'", eventTypeRelease, event.Type())
+	}
+	if event.MatchRef() != "refs/tags/v1.2.0" {
+		t.Errorf("Expected match ref 'refs/tags/v1.2.0', got '%s'", event.MatchRef())
+	}
+	if !event.IsDispatchable() {
+		t.Error("Expected published action to be dispatchable")
+	}
+
+	rules := []FilterRule{
+		{ID: "push", Repo: "owner/test-repo", Branch: "refs/heads/main"},
+		{ID: "release", Repo: "owner/test-repo", Branch: "refs/heads/main", Events: []string{"release"}},
+	}
+	rule := findMatchingRule(rules, event.Type(), event.Repository.FullName, event.MatchRef())
+	if rule == nil || rule.ID != "release" {
+		t.Fatalf("Expected the release rule to match, got %v", rule)
+	}
+
+	data := newTemplateData(event)
+	if data.Tag != "v1.2.0" || data.EventType != eventTypeRelease {
+		t.Errorf("Expected tag 'v1.2.0' and event type '%s', got '%s' and '%s'", eventTypeRelease, data.Tag, data.EventType)
+	}
+
+	event.Action = "created"
+	if event.IsDispatchable() {
+		t.Error("Expected created action not to be dispatchable")
+	}
+}
+
+func TestGitHubEvent_AuthorAssociation(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    GitHubEvent
+		expected string
+	}{
+		{"push", GitHubEvent{}, ""},
+		{"pull request", GitHubEvent{PullRequest: &GitHubPullRequest{AuthorAssociation: "MEMBER"}}, "MEMBER"},
+		{
+			"review comment",
+			GitHubEvent{
+				PullRequest: &GitHubPullRequest{AuthorAssociation: "MEMBER"},
+				Comment:     &GitHubComment{AuthorAssociation: "CONTRIBUTOR"},
+			},
+			"CONTRIBUTOR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.event.AuthorAssociation()
+			if result != tt.expected {
+				t.Errorf("AuthorAssociation() = %q, expected %q", result, tt.expected)
+			}
+		})
+	}
+
+	// Push events carry no association, so the key is omitted
+	dispatched := mustBuildJob(t, &FilterRule{}, GitHubEvent{})
+	if _, exists := dispatched.Metadata[authorAssociationKey]; exists {
+		t.Errorf("Expected no %s for push events, got '%s'", authorAssociationKey, dispatched.Metadata[authorAssociationKey])
+	}
+
+	// The association of a pull request webhook reaches the enqueued job
+	config := Config{PipelineQueueName: "pipeline"}
+	rules := []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main", CommandsPR: []Command{{Run: "make test"}}}}
+	d := newDispatcher(nil, config, rules)
+	sink := &recordingSink{}
+	d.sink = sink
+	payload := `{"action": "opened", "pull_request": {"number": 1, "head": {"ref": "feature", "sha": "abc1234"}, "base": {"ref": "main"}, "author_association": "FIRST_TIME_CONTRIBUTOR"}, "repository": {"full_name": "owner/repo"}}`
+	if err := d.handleWebhookMessage(context.Background(), payload); err != nil || len(sink.jobs) != 1 {
+		t.Fatalf("Expected the pull request to be dispatched, got %d job(s) (%v)", len(sink.jobs), err)
+	}
+	var job Job
+	if err := json.Unmarshal(sink.jobs[0], &job); err != nil || job.Metadata[authorAssociationKey] != "FIRST_TIME_CONTRIBUTOR" {
+		t.Errorf("Expected %s 'FIRST_TIME_CONTRIBUTOR' in the job, got %v (%v)", authorAssociationKey, job.Metadata, err)
+	}
+}
+
+func TestDispatch_ReviewComment(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline"}
+	rules := []FilterRule{
+		{ID: "trusted", Repo: "owner/repo", Branch: "refs/heads/main", Events: []string{eventTypeReviewComment}, AuthorAssociations: []string{"OWNER", "MEMBER"}, CommandsPR: []Command{{Run: "make test"}}},
+		{ID: "pr", Repo: "owner/repo", Branch: "refs/heads/main", CommandsPR: []Command{{Run: "make lint"}}},
+	}
+	d := newDispatcher(nil, config, rules)
+	sink := &recordingSink{}
+	d.sink = sink
+	audit := &recordingAuditLog{}
+	d.auditLog = audit
+
+	comment := func(action, association string) string {
+		return `{"action": "` + action + `", "comment": {"author_association": "` + association + `"}, "pull_request": {"number": 1, "base": {"ref": "main"}, "author_association": "OWNER"}, "repository": {"full_name": "owner/repo"}}`
+	}
+	for _, payload := range []string{comment("created", "MEMBER"), comment("created", "NONE"), comment("edited", "MEMBER")} {
+		if err := d.handleWebhookMessage(context.Background(), payload); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+
+	if len(sink.jobs) != 1 {
+		t.Fatalf("Expected only the comment of a member to be dispatched, got %d job(s)", len(sink.jobs))
+	}
+	var job Job
+	if err := json.Unmarshal(sink.jobs[0], &job); err != nil || job.RuleID != "trusted" || job.Commands[0] != "make test" || job.Metadata[authorAssociationKey] != "MEMBER" {
+		t.Errorf("Expected the PR commands of rule 'trusted' with the comment author's association, got %+v (%v)", job, err)
+	}
+	if len(audit.records) != 3 || audit.records[1].Decision != auditIgnored || !strings.Contains(audit.records[1].Reason, "'NONE'") || audit.records[2].Decision != auditIgnored {
+		t.Errorf("Expected the other comments to be ignored, got %+v", audit.records)
+	}
+
+	// Pull requests are checked too, while pushes carry no association
+	rules = []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main", Events: []string{eventTypePush, eventTypePullRequest}, AuthorAssociations: []string{"MEMBER"}}}
+	pr := GitHubEvent{PullRequest: &GitHubPullRequest{AuthorAssociation: "FIRST_TIME_CONTRIBUTOR"}}
+	if ruleAllowsAuthor(&rules[0], &pr) {
+		t.Error("Expected a pull request of a first-time contributor not to be allowed")
+	}
+	if !ruleAllowsAuthor(&rules[0], &GitHubEvent{}) {
+		t.Error("Expected a push to be allowed")
+	}
+	rules[0].AuthorAssociations = []string{"member"}
+	if err := validateFilterRules(rules); err == nil {
+		t.Error("Expected error for an unknown author association, got nil")
+	}
+}
+
 func TestHandleWebhookMessage(t *testing.T) {
 	rules := []FilterRule{
 		{
@@ -241,7 +896,7 @@ func TestHandleWebhookMessage(t *testing.T) {
 			Branch:   "refs/heads/main",
 			Type:     "git-webhook",
 			Dir:      "/home/user/test-repo",
-			Commands: []string{"make build"},
+			Commands: []Command{{Run: "make build"}},
 		},
 	}
 
@@ -254,7 +909,7 @@ func TestHandleWebhookMessage(t *testing.T) {
 		}
 	}`
 
-	var event GitHubPushEvent
+	var event GitHubEvent
 	if err := json.Unmarshal([]byte(payload), &event); err != nil {
 		t.Fatalf("Failed to parse valid webhook payload: %v", err)
 	}
@@ -272,14 +927,14 @@ func TestHandleWebhookMessage(t *testing.T) {
 	}
 
 	// Test finding the rule
-	rule := findMatchingRule(rules, event.Repository.FullName, event.Ref)
+	rule := findMatchingRule(rules, event.Type(), event.Repository.FullName, event.MatchRef())
 	if rule == nil {
 		t.Error("Expected to find matching rule, got nil")
 	}
 
 	// Test invalid payload
 	invalidPayload := "not a json"
-	var invalidEvent GitHubPushEvent
+	var invalidEvent GitHubEvent
 	if err := json.Unmarshal([]byte(invalidPayload), &invalidEvent); err == nil {
 		t.Error("Expected error for invalid JSON, got nil")
 	}
@@ -316,7 +971,7 @@ func TestHandleWebhookMessage_Integration(t *testing.T) {
 			Branch:   "refs/heads/main",
 			Type:     "git-webhook",
 			Dir:      "/home/user/test-repo",
-			Commands: []string{"make build", "make test"},
+			Commands: []Command{{Run: "make build"}, {Run: "make test"}},
 		},
 	}
 
@@ -328,7 +983,8 @@ func TestHandleWebhookMessage_Integration(t *testing.T) {
 		}
 	}`
 
-	err := handleWebhookMessage(ctx, rdb, queueName, rules, payload)
+	config := Config{PipelineQueueName: queueName, OutputMode: outputModeList}
+	err := newDispatcher(rdb, config, rules).handleWebhookMessage(ctx, payload)
 	if err != nil {
 		t.Fatalf("Failed to handle webhook message: %v", err)
 	}
@@ -339,9 +995,9 @@ func TestHandleWebhookMessage_Integration(t *testing.T) {
 		t.Fatalf("Failed to pop from Redis queue: %v", err)
 	}
 
-	var pushedRule FilterRule
+	var pushedRule Job
 	if err := json.Unmarshal([]byte(result), &pushedRule); err != nil {
-		t.Fatalf("Failed to parse pushed rule: %v", err)
+		t.Fatalf("Failed to parse pushed job: %v", err)
 	}
 
 	if pushedRule.Repo != "owner/test-repo" {
@@ -360,6 +1016,10 @@ func TestHandleWebhookMessage_Integration(t *testing.T) {
 		t.Errorf("Expected dir '/home/user/test-repo', got '%s'", pushedRule.Dir)
 	}
 
+	if pushedRule.ID == "" {
+		t.Error("Expected job_id to be present, got empty")
+	}
+
 	// Verify metadata contains git_commit_sha
 	if pushedRule.Metadata == nil {
 		t.Error("Expected metadata to be present, got nil")
@@ -372,27 +1032,3 @@ func TestHandleWebhookMessage_Integration(t *testing.T) {
 		}
 	}
 }
-
-func TestParseLogLevel(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected LogLevel
-	}{
-		{"DEBUG", LogLevelDebug},
-		{"INFO", LogLevelInfo},
-		{"WARN", LogLevelWarn},
-		{"WARNING", LogLevelWarn},
-		{"ERROR", LogLevelError},
-		{"invalid", LogLevelInfo}, // default to INFO
-		{"", LogLevelInfo},        // default to INFO
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			result := parseLogLevel(tt.input)
-			if result != tt.expected {
-				t.Errorf("parseLogLevel(%q) = %v, expected %v", tt.input, result, tt.expected)
-			}
-		})
-	}
-}
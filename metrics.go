@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+)
+
+const metricsNamespace = "github_dispatcher"
+
+// metricsRegistry holds the metrics served on /metrics
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	eventsReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_received_total",
+		Help:      "Webhook payloads read from the input.",
+	})
+	parseFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "parse_failures_total",
+		Help:      "Webhook payloads that could not be parsed.",
+	})
+	eventsMatched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "matches_total",
+		Help:      "Events that matched a rule.",
+	}, []string{"repo", "rule_id", "team", "service"})
+	eventsUnmatched = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "unmatched_events_total",
+		Help:      "Events that matched no rule or whose action is not dispatched.",
+	})
+	jobsDispatched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dispatches_total",
+		Help:      "Jobs by outcome: dispatched, batched, scheduled, held, delivered, spilled, dead_lettered, or dropped.",
+	}, []string{"repo", "rule_id", "team", "service", "outcome"})
+	dispatchFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dispatch_failures_total",
+		Help:      "Matched events whose jobs could not be built, delivered, or enqueued.",
+	}, []string{"repo", "rule_id", "team", "service"})
+	redisErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "redis_errors_total",
+		Help:      "Failed Redis commands and connection attempts.",
+	}, []string{"command"})
+	handlingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "handling_duration_seconds",
+		Help:      "Time to match and dispatch an event; the rule labels are empty for unmatched events.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"repo", "rule_id", "team", "service"})
+)
+
+func init() {
+	buildInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "build_info",
+		Help:      "Always 1, labeled with the build of the dispatcher.",
+		ConstLabels: prometheus.Labels{
+			"version":    version,
+			"commit":     buildCommit(),
+			"build_date": buildTime(),
+			"go_version": runtime.Version(),
+		},
+	})
+	buildInfo.Set(1)
+
+	metricsRegistry.MustRegister(
+		buildInfo,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		eventsReceived,
+		parseFailures,
+		eventsMatched,
+		eventsUnmatched,
+		jobsDispatched,
+		dispatchFailures,
+		redisErrors,
+		handlingDuration,
+	)
+
+	metricsRegistry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "circuit_breaker_state",
+		Help:      "State of the circuit breaker of the output: 0 closed, 1 open, 2 half-open.",
+	}, func() float64 { return float64(circuitState.Load()) }))
+
+	// Counters the dispatcher already keeps for its logs
+	for _, counter := range []struct {
+		name, help string
+		value      func() int64
+	}{
+		{"webhooks_rejected_total", "Webhooks rejected by signature verification.", rejectedWebhooks.Load},
+		{"jobs_dropped_total", "Jobs dropped or trimmed because the pipeline queue was full.", droppedJobs.Load},
+		{"enqueue_retries_total", "Failed pushes of jobs that were retried.", enqueueRetries.Load},
+		{"circuit_breaker_opens_total", "Times the circuit breaker of the output opened.", circuitOpens.Load},
+		{"catchup_dispatches_total", "Dispatches synthesized for branches that moved while the dispatcher was down.", catchupDispatches.Load},
+		{"disallowed_events_total", "Events dropped because their repository is not in ALLOWED_REPOS or ALLOWED_ORGS.", disallowedEvents.Load},
+		{"duplicate_deliveries_total", "Webhooks dropped because the same delivery arrived within DUPLICATE_WINDOW.", duplicateDeliveries.Load},
+		{"duplicate_events_total", "Events skipped because they were already dispatched.", duplicateEvents.Load},
+		{"metadata_sanitized_total", "Job metadata values stripped of control characters or truncated.", sanitizedMetadata.Load},
+		{"unsafe_commands_total", "Events not dispatched because the command policy rejected a command.", unsafeCommands.Load},
+		{"rate_limit_deferred_events_total", "Events whose jobs were delayed because their repository exceeded RATE_LIMIT_PER_REPO.", deferredEvents.Load},
+		{"rate_limit_coalesced_events_total", "Events held back by RATE_LIMIT_PER_REPO and replaced by a later event of the same ref.", coalescedEvents.Load},
+		{"message_timeouts_total", "Messages given up on after MESSAGE_TIMEOUT.", messageTimeouts.Load},
+		{"redis_timeouts_total", "Redis commands that timed out after REDIS_OP_TIMEOUT.", redisTimeouts.Load},
+		{"pubsub_reconnects_total", "Times the pub/sub subscription was re-established.", pubsubReconnects.Load},
+		{"pubsub_watchdog_timeouts_total", "Pub/sub subscriptions rebuilt because the watchdog probe was not received.", pubsubWatchdogTimeouts.Load},
+		{"faults_injected_total", "Failures injected by FAULTS.", injectedFaults.Load},
+		{"firehose_dropped_records_total", "Firehose records not sent to clients that fell behind.", firehoseDroppedRecords.Load},
+	} {
+		value := counter.value
+		metricsRegistry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      counter.name,
+			Help:      counter.help,
+		}, func() float64 { return float64(value()) }))
+	}
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// recordMatch streams the match decision for an event and counts it; rule is
+// nil when the event is not dispatched, with reason telling why
+func (d *Dispatcher) recordMatch(event *GitHubEvent, rule *FilterRule, reason string) {
+	d.firehose.match(event, rule, reason)
+	if rule == nil {
+		eventsUnmatched.Inc()
+		return
+	}
+	eventsMatched.WithLabelValues(rule.Repo, rule.ID, rule.Team, rule.Service).Inc()
+}
+
+// recordJobs streams the outcome of dispatching the jobs of the rule and
+// counts them
+func (d *Dispatcher) recordJobs(rule *FilterRule, outcome, output string, jobs []Job) {
+	d.firehose.jobs(outcome, output, jobs)
+	for _, job := range jobs {
+		jobsDispatched.WithLabelValues(job.Repo, job.RuleID, rule.Team, rule.Service, outcome).Inc()
+	}
+}
+
+// redisMetricsHook counts failed Redis commands by name. Misses (redis.Nil)
+// and commands cancelled on shutdown are not failures.
+type redisMetricsHook struct{}
+
+func (redisMetricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			redisErrors.WithLabelValues("dial").Inc()
+		}
+		return conn, err
+	}
+}
+
+func (redisMetricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		countRedisError(cmd, err)
+		return err
+	}
+}
+
+func (redisMetricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			countRedisError(cmd, cmd.Err())
+		}
+		return err
+	}
+}
+
+func countRedisError(cmd redis.Cmder, err error) {
+	if err == nil || errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) {
+		return
+	}
+	redisErrors.WithLabelValues(cmd.Name()).Inc()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMetrics_Dispatch(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline"}
+	rules := []FilterRule{{ID: "metrics-build", Repo: "owner/metrics", Branch: "refs/heads/main", Team: "platform", Service: "api", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	d.sink = &recordingSink{}
+
+	received := testutil.ToFloat64(eventsReceived)
+	failed := testutil.ToFloat64(parseFailures)
+	unmatched := testutil.ToFloat64(eventsUnmatched)
+	matched := testutil.ToFloat64(eventsMatched.WithLabelValues("owner/metrics", "metrics-build", "platform", "api"))
+	dispatched := testutil.ToFloat64(jobsDispatched.WithLabelValues("owner/metrics", "metrics-build", "platform", "api", outcomeDispatched))
+
+	ctx := context.Background()
+	for _, payload := range []string{
+		`{"ref":"refs/heads/main","repository":{"full_name":"owner/metrics"}}`,
+		`{"ref":"refs/heads/develop","repository":{"full_name":"owner/metrics"}}`,
+	} {
+		if err := d.handleWebhookMessage(ctx, payload); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+	if err := d.handleWebhookMessage(ctx, "not json"); err == nil {
+		t.Error("Expected error for an invalid payload, got nil")
+	}
+
+	if got := testutil.ToFloat64(eventsReceived) - received; got != 3 {
+		t.Errorf("Expected 3 received events, got %v", got)
+	}
+	if got := testutil.ToFloat64(parseFailures) - failed; got != 1 {
+		t.Errorf("Expected 1 parse failure, got %v", got)
+	}
+	if got := testutil.ToFloat64(eventsUnmatched) - unmatched; got != 1 {
+		t.Errorf("Expected 1 unmatched event, got %v", got)
+	}
+	if got := testutil.ToFloat64(eventsMatched.WithLabelValues("owner/metrics", "metrics-build", "platform", "api")) - matched; got != 1 {
+		t.Errorf("Expected 1 match of rule metrics-build, got %v", got)
+	}
+	if got := testutil.ToFloat64(jobsDispatched.WithLabelValues("owner/metrics", "metrics-build", "platform", "api", outcomeDispatched)) - dispatched; got != 1 {
+		t.Errorf("Expected 1 dispatched job of rule metrics-build, got %v", got)
+	}
+}
+
+func TestMetrics_DispatchFailures(t *testing.T) {
+	config := Config{OutputMode: outputModeList, QueuePushCommand: queuePushRight, PipelineQueueName: "pipeline"}
+	rules := []FilterRule{{ID: "metrics-fail", Repo: "owner/metrics", Branch: "refs/heads/fail", Commands: []Command{{Run: "make build"}}}}
+	// Enqueueing to an unreachable Redis fails
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+	d := newDispatcher(rdb, config, rules)
+	failures := testutil.ToFloat64(dispatchFailures.WithLabelValues("owner/metrics", "metrics-fail", "", ""))
+
+	payload := `{"ref":"refs/heads/fail","repository":{"full_name":"owner/metrics"}}`
+	if err := d.handleWebhookMessage(context.Background(), payload); err == nil {
+		t.Fatal("Expected enqueueing to fail, got nil")
+	}
+	if got := testutil.ToFloat64(dispatchFailures.WithLabelValues("owner/metrics", "metrics-fail", "", "")) - failures; got != 1 {
+		t.Errorf("Expected 1 dispatch failure of rule metrics-fail, got %v", got)
+	}
+}
+
+func TestRedisMetricsHook(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+	rdb.AddHook(redisMetricsHook{})
+
+	gets := testutil.ToFloat64(redisErrors.WithLabelValues("get"))
+	dials := testutil.ToFloat64(redisErrors.WithLabelValues("dial"))
+
+	if err := rdb.Get(context.Background(), "key").Err(); err == nil {
+		t.Fatal("Expected GET to fail while Redis is unreachable")
+	}
+	if got := testutil.ToFloat64(redisErrors.WithLabelValues("get")) - gets; got != 1 {
+		t.Errorf("Expected 1 failed GET, got %v", got)
+	}
+	if got := testutil.ToFloat64(redisErrors.WithLabelValues("dial")) - dials; got < 1 {
+		t.Errorf("Expected a failed dial, got %v", got)
+	}
+
+	// Misses are not failures
+	countRedisError(redis.NewStringCmd(context.Background(), "get", "key"), redis.Nil)
+	if got := testutil.ToFloat64(redisErrors.WithLabelValues("get")) - gets; got != 1 {
+		t.Errorf("Expected a miss not to be counted, got %v failures", got)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	d := newDispatcher(nil, Config{}, nil)
+	d.sink = &recordingSink{}
+	if err := d.handleWebhookMessage(context.Background(), `{"ref":"refs/heads/main","repository":{"full_name":"owner/metrics"}}`); err != nil {
+		t.Fatalf("Failed to handle webhook: %v", err)
+	}
+
+	server := httptest.NewServer(newHTTPHandler(Config{}, d))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to get metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, name := range []string{
+		"github_dispatcher_events_received_total",
+		"github_dispatcher_parse_failures_total",
+		"github_dispatcher_webhooks_rejected_total",
+		"github_dispatcher_pubsub_reconnects_total",
+		`github_dispatcher_build_info{build_date=`,
+		`github_dispatcher_handling_duration_seconds_count{repo="",rule_id="",service="",team=""}`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("Expected metric %s to be served", name)
+		}
+	}
+}
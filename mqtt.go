@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	inputModeMQTT  = "mqtt"
+	outputModeMQTT = "mqtt"
+)
+
+// mqttConnectTimeout bounds connecting to the broker on startup
+const mqttConnectTimeout = 10 * time.Second
+
+func init() {
+	registerEventSource(inputModeMQTT, func(config Config, c clients) EventSource {
+		return &mqttSource{client: c.mqtt, config: config}
+	})
+	registerJobSink(outputModeMQTT, func(config Config, c clients) JobSink {
+		return &mqttSink{client: c.mqtt}
+	})
+}
+
+// connectMQTT connects to the broker at MQTT_BROKER_URL. The session is kept
+// by the broker (clean session off), so subscriptions survive reconnects and
+// QoS 1 and 2 messages published while the dispatcher is disconnected are
+// delivered once it is back.
+func connectMQTT(config Config) (mqtt.Client, error) {
+	options := mqtt.NewClientOptions().
+		AddBroker(config.MQTTBrokerURL).
+		SetClientID(config.MQTTClientID).
+		SetUsername(config.MQTTUsername).
+		SetPassword(config.MQTTPassword).
+		SetCleanSession(false).
+		SetAutoReconnect(true).
+		SetConnectTimeout(mqttConnectTimeout).
+		// Messages are acknowledged once they have been handled
+		SetAutoAckDisabled(true).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logWarn("Disconnected from MQTT broker: %v", err)
+		}).
+		SetReconnectingHandler(func(_ mqtt.Client, _ *mqtt.ClientOptions) {
+			logInfo("Reconnecting to MQTT broker at %s", redactMQTTURL(config.MQTTBrokerURL))
+		})
+
+	client := mqtt.NewClient(options)
+	token := client.Connect()
+	if !token.WaitTimeout(mqttConnectTimeout) {
+		client.Disconnect(0)
+		return nil, fmt.Errorf("failed to connect to MQTT broker: timed out after %s", mqttConnectTimeout)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+	return client, nil
+}
+
+// validateMQTTConfig checks the MQTT settings when the MQTT input or output is
+// used
+func validateMQTTConfig(config Config) error {
+	if config.InputMode != inputModeMQTT && config.OutputMode != outputModeMQTT {
+		return nil
+	}
+	u, err := url.Parse(config.MQTTBrokerURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid MQTT_BROKER_URL '%s'", redactMQTTURL(config.MQTTBrokerURL))
+	}
+	if config.MQTTClientID == "" {
+		return errors.New("MQTT_CLIENT_ID must not be empty")
+	}
+	if config.MQTTQoS < 0 || config.MQTTQoS > 2 {
+		return fmt.Errorf("MQTT_QOS must be 0, 1 or 2, got %d", config.MQTTQoS)
+	}
+	if config.InputMode == inputModeMQTT && config.MQTTInputTopic == "" {
+		return errors.New("MQTT_INPUT_TOPIC must not be empty with INPUT_MODE mqtt")
+	}
+	return nil
+}
+
+// redactMQTTURL returns the broker URL without its credentials for logging
+func redactMQTTURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid MQTT_BROKER_URL)"
+	}
+	u.User = nil
+	return u.String()
+}
+
+// mqttSource reads webhooks from the MQTT_INPUT_TOPIC topic
+type mqttSource struct {
+	client mqtt.Client
+	config Config
+}
+
+// consume subscribes to MQTT_INPUT_TOPIC and handles messages until the
+// context is cancelled. Messages are acknowledged once handled; the broker
+// redelivers the others when the session reconnects.
+func (s *mqttSource) consume(ctx context.Context, handle messageHandler) error {
+	var (
+		mu       sync.Mutex
+		handling sync.WaitGroup
+		stopped  bool
+	)
+	callback := func(_ mqtt.Client, msg mqtt.Message) {
+		mu.Lock()
+		if stopped {
+			// Left unacknowledged so the message is redelivered
+			mu.Unlock()
+			return
+		}
+		handling.Add(1)
+		mu.Unlock()
+		defer handling.Done()
+
+		// Messages being handled are finished even when shutting down
+		msgCtx := withEventID(context.WithoutCancel(ctx))
+		logDebugPayloadContext(msgCtx, "Received message from topic '%s':\n%s", msg.Topic(), msg.Payload())
+		if err := handle(msgCtx, string(msg.Payload())); err != nil {
+			logErrorContext(msgCtx, "Error handling MQTT message from topic '%s': %v", msg.Topic(), err)
+			return
+		}
+		msg.Ack()
+	}
+
+	token := s.client.Subscribe(s.config.MQTTInputTopic, byte(s.config.MQTTQoS), callback)
+	if err := waitMQTT(ctx, token); err != nil {
+		return fmt.Errorf("failed to subscribe to MQTT topic '%s': %w", s.config.MQTTInputTopic, err)
+	}
+
+	logInfo("Subscribed to MQTT topic '%s' (QoS %d)", s.config.MQTTInputTopic, s.config.MQTTQoS)
+	logInfo("Waiting for messages...")
+
+	// The subscription is kept by the broker, so the input consumes while
+	// the connection is up
+	defer inputActive.Store(false)
+	poll := time.NewTicker(time.Second)
+	defer poll.Stop()
+	for ctx.Err() == nil {
+		inputActive.Store(s.client.IsConnectionOpen())
+		select {
+		case <-poll.C:
+		case <-ctx.Done():
+		}
+	}
+
+	mu.Lock()
+	stopped = true
+	mu.Unlock()
+	handling.Wait()
+	return nil
+}
+
+// mqttSink publishes jobs to MQTT, using the queue names as topics
+type mqttSink struct {
+	client mqtt.Client
+}
+
+func (s *mqttSink) enqueue(ctx context.Context, config Config, queues []string, priority int, jobs [][]byte) error {
+	if len(queues) == 0 {
+		queues = []string{config.PipelineQueueName}
+	}
+
+	for _, topic := range queues {
+		for _, job := range jobs {
+			token := s.client.Publish(topic, byte(config.MQTTQoS), false, job)
+			if err := waitMQTT(ctx, token); err != nil {
+				return fmt.Errorf("failed to publish job to MQTT topic '%s': %w", topic, err)
+			}
+		}
+	}
+	return nil
+}
+
+// waitMQTT waits until the broker acknowledged the operation of the token,
+// or the context is cancelled
+func waitMQTT(ctx context.Context, token mqtt.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	inputModeNATS  = "nats"
+	outputModeNATS = "nats"
+)
+
+// natsErrorWait is how long to wait before reading again after a failed read
+const natsErrorWait = time.Second
+
+func init() {
+	registerEventSource(inputModeNATS, func(config Config, c clients) EventSource {
+		return &natsSource{js: c.js, config: config}
+	})
+	registerJobSink(outputModeNATS, func(config Config, c clients) JobSink {
+		return &natsSink{js: c.js}
+	})
+}
+
+// natsSource reads webhooks from the INPUT_STREAM JetStream stream
+type natsSource struct {
+	js     jetstream.JetStream
+	config Config
+}
+
+func (s *natsSource) consume(ctx context.Context, handle messageHandler) error {
+	return consumeNATS(ctx, s.js, s.config, handle)
+}
+
+// natsSink publishes jobs to JetStream
+type natsSink struct {
+	js jetstream.JetStream
+}
+
+func (s *natsSink) enqueue(ctx context.Context, config Config, queues []string, priority int, jobs [][]byte) error {
+	return publishNATSJobs(ctx, s.js, config, queues, jobs)
+}
+
+// connectNATS connects to the NATS server at NATS_URL and returns the
+// JetStream context used for the input and output
+func connectNATS(config Config) (*nats.Conn, jetstream.JetStream, error) {
+	options := []nats.Option{
+		nats.Name("github-dispatcher"),
+		// Keep reconnecting for as long as the dispatcher runs
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logWarn("Disconnected from NATS: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logInfo("Reconnected to NATS at %s", nc.ConnectedUrlRedacted())
+		}),
+	}
+	if config.NATSCredsFile != "" {
+		options = append(options, nats.UserCredentials(config.NATSCredsFile))
+	}
+
+	nc, err := nats.Connect(config.NATSURL, options...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+	return nc, js, nil
+}
+
+// consumeNATS reads webhooks from the INPUT_STREAM JetStream stream through
+// the durable INPUT_STREAM_GROUP consumer, which replicas share so every
+// message is handled by one of them. Messages are acknowledged once handled;
+// others are redelivered after INPUT_STREAM_CLAIM_IDLE, at most
+// INPUT_STREAM_MAX_DELIVERIES times.
+func consumeNATS(ctx context.Context, js jetstream.JetStream, config Config, handle messageHandler) error {
+	consumer, err := js.CreateOrUpdateConsumer(ctx, config.InputStream, jetstream.ConsumerConfig{
+		Durable:       config.InputStreamGroup,
+		FilterSubject: config.NATSInputSubject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       config.InputStreamClaimIdle,
+		MaxDeliver:    config.InputStreamMaxDeliveries,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consumer '%s' on JetStream stream '%s': %w", config.InputStreamGroup, config.InputStream, err)
+	}
+
+	messages, err := consumer.Messages()
+	if err != nil {
+		return fmt.Errorf("failed to consume JetStream stream '%s': %w", config.InputStream, err)
+	}
+	defer messages.Stop()
+
+	// Stopping the iterator unblocks Next on shutdown
+	stop := context.AfterFunc(ctx, messages.Stop)
+	defer stop()
+
+	logInfo("Consuming JetStream stream '%s' as durable consumer '%s'", config.InputStream, config.InputStreamGroup)
+	logInfo("Waiting for messages...")
+	inputActive.Store(true)
+	defer inputActive.Store(false)
+
+	for {
+		msg, err := messages.Next()
+		if errors.Is(err, jetstream.ErrMsgIteratorClosed) || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			inputActive.Store(false)
+			logError("Failed to read from JetStream stream '%s': %v", config.InputStream, err)
+			sleepContext(ctx, natsErrorWait)
+			continue
+		}
+		inputActive.Store(true)
+
+		// Messages being handled are finished even when shutting down
+		msgCtx := withEventID(context.WithoutCancel(ctx))
+		logDebugPayloadContext(msgCtx, "Received message from subject '%s':\n%s", msg.Subject(), msg.Data())
+		if err := handle(msgCtx, string(msg.Data())); err != nil {
+			// Left unacknowledged so the message is redelivered after the ack wait
+			logErrorContext(msgCtx, "Error handling JetStream message from subject '%s': %v", msg.Subject(), err)
+			continue
+		}
+		if err := msg.Ack(); err != nil {
+			logError("Failed to acknowledge JetStream message: %v", err)
+		}
+	}
+}
+
+// publishNATSJobs publishes the jobs to JetStream, using the queue names as
+// subjects. Every job is published with a message ID so JetStream discards
+// duplicates of a retried publish.
+func publishNATSJobs(ctx context.Context, js jetstream.JetStream, config Config, queues []string, jobs [][]byte) error {
+	if len(queues) == 0 {
+		queues = []string{config.PipelineQueueName}
+	}
+
+	for _, subject := range queues {
+		for _, job := range jobs {
+			if _, err := js.Publish(ctx, subject, job, jetstream.WithMsgID(natsMsgID(job, subject))); err != nil {
+				return fmt.Errorf("failed to publish job to subject '%s': %w", subject, err)
+			}
+		}
+	}
+	return nil
+}
+
+// natsMsgID returns the JetStream message ID of a job published to subject
+func natsMsgID(job []byte, subject string) string {
+	var identified struct {
+		ID string `json:"job_id"`
+	}
+	json.Unmarshal(job, &identified)
+	return identified.ID + "@" + subject
+}
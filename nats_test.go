@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestLoadConfig_NATS(t *testing.T) {
+	config := loadConfig()
+
+	if config.NATSURL != "nats://localhost:4222" {
+		t.Errorf("Expected NATSURL to be 'nats://localhost:4222', got '%s'", config.NATSURL)
+	}
+	if config.NATSCredsFile != "" {
+		t.Errorf("Expected NATSCredsFile to be empty, got '%s'", config.NATSCredsFile)
+	}
+	if config.NATSInputSubject != "" {
+		t.Errorf("Expected NATSInputSubject to be empty, got '%s'", config.NATSInputSubject)
+	}
+
+	os.Setenv("NATS_URL", "nats://nats.example.com:4222")
+	os.Setenv("NATS_CREDS_FILE", "/etc/nats/dispatcher.creds")
+	os.Setenv("NATS_INPUT_SUBJECT", "github.webhook.push")
+	defer os.Unsetenv("NATS_URL")
+	defer os.Unsetenv("NATS_CREDS_FILE")
+	defer os.Unsetenv("NATS_INPUT_SUBJECT")
+
+	config = loadConfig()
+
+	if config.NATSURL != "nats://nats.example.com:4222" {
+		t.Errorf("Expected NATSURL to be 'nats://nats.example.com:4222', got '%s'", config.NATSURL)
+	}
+	if config.NATSCredsFile != "/etc/nats/dispatcher.creds" {
+		t.Errorf("Expected NATSCredsFile to be '/etc/nats/dispatcher.creds', got '%s'", config.NATSCredsFile)
+	}
+	if config.NATSInputSubject != "github.webhook.push" {
+		t.Errorf("Expected NATSInputSubject to be 'github.webhook.push', got '%s'", config.NATSInputSubject)
+	}
+}
+
+func TestUsesRedis(t *testing.T) {
+	tests := []struct {
+		input    string
+		output   string
+		expected bool
+	}{
+		{inputModePubSub, outputModeList, true},
+		{inputModeNATS, outputModeList, true},
+		{inputModeStream, outputModeNATS, true},
+		{inputModeNATS, outputModeNATS, false},
+		{inputModeNATS, outputModeAMQP, false},
+		{inputModePubSub, outputModeAMQP, true},
+		{inputModeFile, outputModeNATS, false},
+		{inputModeFile, outputModeList, true},
+	}
+
+	for _, tt := range tests {
+		if result := usesRedis(Config{InputMode: tt.input, OutputMode: tt.output}); result != tt.expected {
+			t.Errorf("usesRedis(%s, %s) = %v, expected %v", tt.input, tt.output, result, tt.expected)
+		}
+	}
+}
+
+func TestValidateBrokerOutput_NATS(t *testing.T) {
+	config := Config{InputMode: inputModeNATS, OutputMode: outputModeNATS, BatchSize: 1}
+	if err := validateBrokerOutput(config, []FilterRule{{Repo: "owner/repo"}}); err != nil {
+		t.Errorf("Expected NATS config to be valid, got %v", err)
+	}
+
+	if err := validateBrokerOutput(config, []FilterRule{{Repo: "owner/repo", DelaySeconds: 60}}); err == nil {
+		t.Error("Expected error for delayed rules with the NATS output, got nil")
+	}
+
+	for name, invalid := range map[string]Config{
+		"batching":      {OutputMode: outputModeNATS, BatchSize: 10},
+		"backpressure":  {OutputMode: outputModeNATS, QueueMaxLength: 100},
+		"notifications": {OutputMode: outputModeNATS, NotifyChannel: "pipeline-notifications"},
+		"pause":         {OutputMode: outputModeNATS, PauseKey: "dispatcher:paused"},
+		"heartbeat":     {InputMode: inputModeNATS, OutputMode: outputModeNATS, HeartbeatInterval: time.Second},
+		"spill":         {OutputMode: outputModeNATS, SpillPath: "/tmp/spill.db"},
+		"reaper":        {OutputMode: outputModeNATS, QueueReaperInterval: time.Minute},
+	} {
+		if err := validateBrokerOutput(invalid, nil); err == nil {
+			t.Errorf("Expected error for %s with the NATS output, got nil", name)
+		}
+	}
+
+	// Redis features stay available with the NATS input and the Redis output
+	config = Config{InputMode: inputModeNATS, OutputMode: outputModeList, BatchSize: 10, HeartbeatInterval: time.Second}
+	if err := validateBrokerOutput(config, []FilterRule{{Repo: "owner/repo", DelaySeconds: 60}}); err != nil {
+		t.Errorf("Expected NATS input with Redis output to be valid, got %v", err)
+	}
+}
+
+func TestNATSMsgID(t *testing.T) {
+	job := []byte(`{"job_id":"3f0c2a6e","repo":"owner/repo"}`)
+	if id := natsMsgID(job, "pipeline"); id != "3f0c2a6e@pipeline" {
+		t.Errorf("Expected '3f0c2a6e@pipeline', got '%s'", id)
+	}
+	// Fan-out copies of a job are distinct messages
+	if natsMsgID(job, "audit") == natsMsgID(job, "pipeline") {
+		t.Error("Expected different message IDs per subject")
+	}
+}
+
+func TestDescribeOutput_NATS(t *testing.T) {
+	config := Config{OutputMode: outputModeNATS, PipelineQueueName: "pipeline.jobs"}
+	if output := describeOutput(config); output != "NATS subject 'pipeline.jobs'" {
+		t.Errorf("Expected NATS subject 'pipeline.jobs', got '%s'", output)
+	}
+	if output := describeOutput(config, "pipeline.jobs", "audit.jobs"); output != "NATS subjects 'pipeline.jobs', 'audit.jobs'" {
+		t.Errorf("Expected NATS subjects, got '%s'", output)
+	}
+}
+
+func TestNATS_Integration(t *testing.T) {
+	// Skip this test if NATS is not available
+	// This is an integration test that requires a NATS server with JetStream
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	nc, err := nats.Connect(nats.DefaultURL, nats.Timeout(time.Second))
+	if err != nil {
+		t.Skip("NATS not available, skipping integration test")
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to create JetStream context: %v", err)
+	}
+
+	ctx := context.Background()
+	config := Config{
+		PipelineQueueName:        "test.pipeline.jobs",
+		InputStream:              "TEST_WEBHOOKS",
+		InputStreamGroup:         "test-dispatchers",
+		InputStreamClaimIdle:     time.Minute,
+		InputStreamMaxDeliveries: 5,
+		NATSInputSubject:         "test.webhooks.>",
+	}
+
+	// Clean up before test
+	js.DeleteStream(ctx, "TEST_WEBHOOKS")
+	js.DeleteStream(ctx, "TEST_PIPELINE")
+	defer js.DeleteStream(ctx, "TEST_WEBHOOKS")
+	defer js.DeleteStream(ctx, "TEST_PIPELINE")
+
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST_WEBHOOKS", Subjects: []string{"test.webhooks.>"}}); err != nil {
+		t.Skipf("JetStream not available, skipping integration test: %v", err)
+	}
+	pipeline, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST_PIPELINE", Subjects: []string{"test.pipeline.>"}})
+	if err != nil {
+		t.Fatalf("Failed to create pipeline stream: %v", err)
+	}
+
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"owner/test-repo"}}`
+	if _, err := js.Publish(ctx, "test.webhooks.push", []byte(payload)); err != nil {
+		t.Fatalf("Failed to publish webhook: %v", err)
+	}
+
+	consumeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var received []string
+	handle := func(ctx context.Context, payload string) error {
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+		cancel()
+		return nil
+	}
+
+	if err := consumeNATS(consumeCtx, js, config, handle); err != nil {
+		t.Fatalf("Failed to consume JetStream stream: %v", err)
+	}
+
+	mu.Lock()
+	if len(received) != 1 || received[0] != payload {
+		t.Errorf("Expected to receive the published payload, got %v", received)
+	}
+	mu.Unlock()
+
+	// Publishing the same job twice stores it once
+	job := []byte(`{"job_id":"1"}`)
+	for i := 0; i < 2; i++ {
+		if err := publishNATSJobs(ctx, js, config, nil, [][]byte{job}); err != nil {
+			t.Fatalf("Failed to publish job: %v", err)
+		}
+	}
+
+	info, err := pipeline.Info(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get pipeline stream info: %v", err)
+	}
+	if info.State.Msgs != 1 {
+		t.Errorf("Expected 1 job in the pipeline stream, got %d", info.State.Msgs)
+	}
+}
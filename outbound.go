@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	outboundSignatureHeader = "X-Dispatcher-Signature-256"
+	outboundJobIDHeader     = "X-Dispatcher-Job-ID"
+)
+
+// maxOutboundResponseLog bounds the part of an error response that is logged
+const maxOutboundResponseLog = 512
+
+// errPermanentDelivery marks deliveries the endpoint rejected in a way
+// retrying does not fix, e.g. 400 Bad Request or 404 Not Found
+var errPermanentDelivery = errors.New("delivery rejected")
+
+// newOutboundClient returns the HTTP client jobs are POSTed to webhook_url
+// endpoints with
+func newOutboundClient(config Config) *http.Client {
+	return &http.Client{Timeout: config.OutboundWebhookTimeout}
+}
+
+// deliverJobs POSTs every job to the webhook_url of the rule, stopping at the
+// first job that cannot be delivered
+func deliverJobs(ctx context.Context, client *http.Client, config Config, rule *FilterRule, ids []string, jobs [][]byte) error {
+	for i, job := range jobs {
+		if err := deliverJob(ctx, client, config, rule, ids[i], job); err != nil {
+			return fmt.Errorf("failed to deliver job %s to %s: %w", ids[i], redactWebhookURL(rule.WebhookURL), err)
+		}
+	}
+	return nil
+}
+
+// deliverJob POSTs a job, retrying connection errors, 429 and 5xx responses
+// up to OUTBOUND_WEBHOOK_RETRIES times with an exponential backoff
+func deliverJob(ctx context.Context, client *http.Client, config Config, rule *FilterRule, id string, job []byte) error {
+	backoff := config.OutboundWebhookBackoff
+	for attempt := 0; ; attempt++ {
+		err := postJob(ctx, client, config, rule, id, job)
+		if err == nil || errors.Is(err, errPermanentDelivery) || attempt >= config.OutboundWebhookRetries {
+			return err
+		}
+
+		logWarnContext(ctx, "Delivery of job %s to %s failed, retrying in %s: %v", id, redactWebhookURL(rule.WebhookURL), backoff, err)
+		sleepContext(ctx, backoff)
+		if ctx.Err() != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func postJob(ctx context.Context, client *http.Client, config Config, rule *FilterRule, id string, job []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.WebhookURL, bytes.NewReader(job))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanentDelivery, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "github-dispatcher/"+version)
+	req.Header.Set(outboundJobIDHeader, id)
+	for name, value := range rule.WebhookHeaders {
+		req.Header.Set(name, value)
+	}
+	if secret := outboundSecret(config, rule); secret != "" {
+		req.Header.Set(outboundSignatureHeader, signPayload(secret, job))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutboundResponseLog))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("endpoint returned %s: %s", resp.Status, body)
+	default:
+		return fmt.Errorf("%w: endpoint returned %s: %s", errPermanentDelivery, resp.Status, body)
+	}
+}
+
+// outboundSecret returns the secret deliveries of the rule are signed with:
+// its webhook_signing_secret, falling back to OUTBOUND_WEBHOOK_SECRET
+func outboundSecret(config Config, rule *FilterRule) string {
+	if rule.WebhookSigningSecret != "" {
+		return rule.WebhookSigningSecret
+	}
+	return config.OutboundWebhookSecret
+}
+
+// signPayload returns the HMAC-SHA256 signature of a delivery in the format
+// of GitHub's X-Hub-Signature-256, so receivers can reuse their verification
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhookURL checks that a webhook_url is an absolute HTTP(S) URL
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// redactWebhookURL returns the endpoint without credentials and query, which
+// often carries a token (e.g. Jenkins' ?token=), for logging
+func redactWebhookURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid webhook_url)"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
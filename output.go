@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	outputModeList   = "list"
+	outputModeStream = "stream"
+	outputModeBoth   = "both"
+	outputModeSorted = "priority"
+)
+
+const outputStreamField = "job"
+
+// Commands jobs are pushed onto the pipeline queue list with. Consumers pop
+// from the opposite end to get jobs first in, first out: BLPOP for RPUSH and
+// BRPOP for LPUSH.
+const (
+	queuePushRight = "rpush"
+	queuePushLeft  = "lpush"
+)
+
+const (
+	// maxPriority bounds rule priorities so scores stay exact in a float64
+	maxPriority = 1000
+	// priorityScoreStep is the score difference between two priorities, in
+	// milliseconds; it exceeds any realistic queueing time so a higher
+	// priority always wins over an older job
+	priorityScoreStep = float64(365 * 24 * time.Hour / time.Millisecond)
+)
+
+const (
+	overflowPolicyBlock    = "block"
+	overflowPolicyDrop     = "drop"
+	overflowPolicyOverflow = "overflow"
+	// overflowPolicyDropOldest trims the oldest jobs after each push instead
+	// of checking the length before it
+	overflowPolicyDropOldest = "drop-oldest"
+)
+
+// errJobsDropped is returned when jobs were not enqueued because the pipeline
+// queue is full and the overflow policy is drop
+var errJobsDropped = errors.New("pipeline queue is full")
+
+// droppedJobs counts the jobs dropped because the pipeline queue was full,
+// including the oldest jobs trimmed with the drop-oldest policy
+var droppedJobs atomic.Int64
+
+func init() {
+	for _, mode := range []string{outputModeList, outputModeStream, outputModeBoth, outputModeSorted} {
+		registerJobSink(mode, func(config Config, c clients) JobSink {
+			return &redisSink{rdb: c.rdb}
+		})
+	}
+}
+
+// redisSink writes jobs to the Redis lists, sorted sets and/or stream of the
+// OUTPUT_MODE
+type redisSink struct {
+	rdb redis.UniversalClient
+}
+
+func (s *redisSink) enqueue(ctx context.Context, config Config, queues []string, priority int, jobs [][]byte) error {
+	return enqueueJobs(ctx, s.rdb, config, queues, priority, jobs)
+}
+
+// brokerOutput reports whether jobs are published to a message broker
+// instead of Redis
+func brokerOutput(mode string) bool {
+	switch mode {
+	case outputModeNATS, outputModeAMQP, outputModeMQTT, outputModeServiceBus:
+		return true
+	}
+	return false
+}
+
+// usesRedis reports whether the dispatcher needs a Redis connection, which is
+// the case unless neither the input nor the output uses Redis
+func usesRedis(config Config) bool {
+	return config.InputMode == inputModePubSub || config.InputMode == inputModeStream || config.InputMode == inputModeList || config.InputMode == inputModeArchive || !brokerOutput(config.OutputMode)
+}
+
+// validateBrokerOutput rejects the features that rely on Redis lists with the
+// message broker outputs, and the features that rely on Redis when it is not
+// used at all
+func validateBrokerOutput(config Config, rules []FilterRule) error {
+	if brokerOutput(config.OutputMode) {
+		unsupported := []struct {
+			setting string
+			set     bool
+		}{
+			{"BATCH_SIZE", config.BatchSize > 1},
+			{"QUEUE_MAX_LENGTH", config.QueueMaxLength > 0},
+			{"QUEUE_REAPER_INTERVAL", config.QueueReaperInterval > 0},
+			{"NOTIFY_CHANNEL", config.NotifyChannel != ""},
+			{"PAUSE_KEY", config.PauseKey != ""},
+			{"SPILL_PATH", config.SpillPath != ""},
+		}
+		for _, u := range unsupported {
+			if u.set {
+				return fmt.Errorf("%s is not supported with OUTPUT_MODE %s", u.setting, config.OutputMode)
+			}
+		}
+		for i, rule := range rules {
+			if rule.DelaySeconds > 0 {
+				return fmt.Errorf("rule %d (%s %s): delay_seconds is not supported with OUTPUT_MODE %s", i, rule.Repo, rule.Branch, config.OutputMode)
+			}
+		}
+	}
+	if !usesRedis(config) && config.HeartbeatInterval > 0 {
+		return fmt.Errorf("HEARTBEAT_INTERVAL requires Redis, which is not used with INPUT_MODE %s and OUTPUT_MODE %s", config.InputMode, config.OutputMode)
+	}
+	return nil
+}
+
+func validateOverflowPolicy(policy string) error {
+	switch policy {
+	case overflowPolicyBlock, overflowPolicyDrop, overflowPolicyOverflow, overflowPolicyDropOldest:
+		return nil
+	default:
+		return fmt.Errorf("unknown queue overflow policy '%s'", policy)
+	}
+}
+
+func validateQueuePushCommand(command string) error {
+	switch command {
+	case queuePushRight, queuePushLeft:
+		return nil
+	default:
+		return fmt.Errorf("unknown queue push command '%s'", command)
+	}
+}
+
+// validateQueueNames checks that the queue names, which may be templates,
+// render with the template data of an event
+func validateQueueNames(config Config) error {
+	data := TemplateData{Matrix: map[string]string{}}
+	for _, name := range []string{config.PipelineQueueName, config.QueueOverflowName} {
+		if _, err := renderTemplate(name, data); err != nil {
+			return fmt.Errorf("invalid queue name: %w", err)
+		}
+	}
+	return nil
+}
+
+// resolveQueueNames returns the config with the queue name templates rendered
+// for the event, e.g. `pipeline:{{.RepoName}}` for a queue per repository
+func resolveQueueNames(config Config, data TemplateData) (Config, error) {
+	queue, err := renderTemplate(config.PipelineQueueName, data)
+	if err != nil {
+		return config, err
+	}
+	if queue == "" {
+		return config, fmt.Errorf("queue name template %q rendered an empty name", config.PipelineQueueName)
+	}
+	overflow, err := renderTemplate(config.QueueOverflowName, data)
+	if err != nil {
+		return config, err
+	}
+
+	config.PipelineQueueName = queue
+	config.QueueOverflowName = overflow
+	return config, nil
+}
+
+// resolveRuleQueues returns the queues of a fan-out rule with their names
+// rendered for the event, or nil for rules using PIPELINE_QUEUE_NAME
+func resolveRuleQueues(rule *FilterRule, data TemplateData) ([]string, error) {
+	if len(rule.Queues) == 0 {
+		return nil, nil
+	}
+
+	queues := make([]string, 0, len(rule.Queues))
+	for _, name := range rule.Queues {
+		queue, err := renderTemplate(name, data)
+		if err != nil {
+			return nil, err
+		}
+		if queue == "" {
+			return nil, fmt.Errorf("queue name template %q rendered an empty name", name)
+		}
+		if !slices.Contains(queues, queue) {
+			queues = append(queues, queue)
+		}
+	}
+	return queues, nil
+}
+
+// priorityScore returns the sorted set score of a job: jobs are ordered by
+// priority first and by enqueue time within a priority, so consumers popping
+// the lowest score (ZPOPMIN) get the most urgent, oldest job
+func priorityScore(priority int, now time.Time) float64 {
+	return float64(now.UnixMilli()) - float64(priority)*priorityScoreStep
+}
+
+// enqueueJobs writes the serialized jobs to the pipeline queues - lists or, in
+// priority mode, sorted sets - and/or the output stream. Without explicit
+// queues the jobs go to PIPELINE_QUEUE_NAME. All writes happen in one
+// MULTI/EXEC transaction so a job is never written to only some outputs.
+func enqueueJobs(ctx context.Context, rdb redis.UniversalClient, config Config, queues []string, priority int, jobs [][]byte) error {
+	targets, err := targetQueues(ctx, rdb, config, queues, len(jobs))
+	if err != nil {
+		return err
+	}
+
+	var pushes map[string]*redis.IntCmd
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pushes = queueJobs(ctx, pipe, config, targets, priority, jobs)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	countTrimmedJobs(config, pushes)
+	return nil
+}
+
+// targetQueues returns the queues the jobs are pushed to after applying
+// backpressure to each of them, counting the jobs if they are dropped. Jobs
+// are dropped from all queues when one of them is full, so fan-out stays
+// all or nothing.
+func targetQueues(ctx context.Context, rdb redis.UniversalClient, config Config, queues []string, count int) ([]string, error) {
+	if len(queues) == 0 {
+		queues = []string{config.PipelineQueueName}
+	}
+	if config.OutputMode == outputModeStream {
+		return queues, nil
+	}
+
+	targets := make([]string, 0, len(queues))
+	for _, queue := range queues {
+		queueConfig := config
+		queueConfig.PipelineQueueName = queue
+
+		target, err := checkQueueCapacity(ctx, rdb, queueConfig)
+		if errors.Is(err, errJobsDropped) {
+			dropped := droppedJobs.Add(int64(count))
+			logErrorContext(ctx, "Queue '%s' is full, dropping %d job(s) (%d dropped in total)", queue, count, dropped)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Several full queues may divert to the same overflow queue
+		if !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// jobNotification is published on NOTIFY_CHANNEL for every enqueued job
+type jobNotification struct {
+	RuleID string `json:"rule_id,omitempty"`
+	JobID  string `json:"job_id"`
+	Queue  string `json:"queue"`
+}
+
+// queueJobs adds the commands writing the jobs to their outputs to pipe. With
+// the drop-oldest policy it returns the pushes to the trimmed queues by queue,
+// so the trimmed jobs can be counted once the transaction has run.
+func queueJobs(ctx context.Context, pipe redis.Pipeliner, config Config, queues []string, priority int, jobs [][]byte) map[string]*redis.IntCmd {
+	useList := config.OutputMode == outputModeList || config.OutputMode == outputModeBoth
+	useStream := config.OutputMode == outputModeStream || config.OutputMode == outputModeBoth
+	useSorted := config.OutputMode == outputModeSorted
+	trim := useList && config.QueueOverflowPolicy == overflowPolicyDropOldest && config.QueueMaxLength > 0
+
+	var pushes map[string]*redis.IntCmd
+	for _, queue := range queues {
+		if useList {
+			values := make([]interface{}, 0, len(jobs))
+			for _, job := range jobs {
+				values = append(values, job)
+			}
+			var push *redis.IntCmd
+			if config.QueuePushCommand == queuePushLeft {
+				push = pipe.LPush(ctx, queue, values...)
+			} else {
+				push = pipe.RPush(ctx, queue, values...)
+			}
+
+			if trim {
+				// Keep the newest QUEUE_MAX_LENGTH jobs, which are at the
+				// end the jobs were pushed to
+				if config.QueuePushCommand == queuePushLeft {
+					pipe.LTrim(ctx, queue, 0, config.QueueMaxLength-1)
+				} else {
+					pipe.LTrim(ctx, queue, -config.QueueMaxLength, -1)
+				}
+				if pushes == nil {
+					pushes = map[string]*redis.IntCmd{}
+				}
+				pushes[queue] = push
+			}
+		}
+
+		if useSorted {
+			score := priorityScore(priority, time.Now())
+			members := make([]redis.Z, 0, len(jobs))
+			for _, job := range jobs {
+				members = append(members, redis.Z{Score: score, Member: job})
+			}
+			pipe.ZAdd(ctx, queue, members...)
+		}
+
+		// Notifications are part of the transaction, so they are only
+		// published when the jobs were written
+		if config.NotifyChannel != "" && (useList || useSorted) {
+			for _, job := range jobs {
+				pipe.Publish(ctx, config.NotifyChannel, newJobNotification(job, queue))
+			}
+		}
+	}
+
+	if useStream {
+		for _, job := range jobs {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: config.OutputStream,
+				MaxLen: config.OutputStreamMaxLen,
+				Approx: config.OutputStreamMaxLen > 0,
+				Values: map[string]interface{}{outputStreamField: job},
+			})
+			if config.NotifyChannel != "" && !useList {
+				pipe.Publish(ctx, config.NotifyChannel, newJobNotification(job, config.OutputStream))
+			}
+		}
+	}
+	return pushes
+}
+
+// countTrimmedJobs counts the oldest jobs trimmed from each queue after the
+// pushes, using the queue length the push returned
+func countTrimmedJobs(config Config, pushes map[string]*redis.IntCmd) {
+	for queue, push := range pushes {
+		trimmed := push.Val() - config.QueueMaxLength
+		if trimmed <= 0 {
+			continue
+		}
+		dropped := droppedJobs.Add(trimmed)
+		logWarn("Queue '%s' is full, dropped %d oldest job(s) (%d dropped in total)", queue, trimmed, dropped)
+	}
+}
+
+func newJobNotification(job []byte, queue string) []byte {
+	var notification jobNotification
+	// Jobs are always serialized by the dispatcher, so decoding only fails
+	// for foreign payloads, which are still announced with their queue
+	json.Unmarshal(job, &notification)
+	notification.Queue = queue
+
+	data, _ := json.Marshal(notification)
+	return data
+}
+
+// checkQueueCapacity returns the queue jobs should be pushed to, applying the
+// overflow policy when the pipeline queue has reached QUEUE_MAX_LENGTH. The
+// length is checked before pushing, so the limit is a soft one: concurrent
+// dispatches may push it slightly past the maximum.
+func checkQueueCapacity(ctx context.Context, rdb redis.UniversalClient, config Config) (string, error) {
+	if config.QueueMaxLength <= 0 || config.QueueOverflowPolicy == overflowPolicyDropOldest {
+		return config.PipelineQueueName, nil
+	}
+
+	queueLength := rdb.LLen
+	if config.OutputMode == outputModeSorted {
+		queueLength = rdb.ZCard
+	}
+
+	deadline := time.Now().Add(config.QueueBlockTimeout)
+	for {
+		length, err := queueLength(ctx, config.PipelineQueueName).Result()
+		if err != nil {
+			return "", fmt.Errorf("failed to get length of queue '%s': %w", config.PipelineQueueName, err)
+		}
+		if length < config.QueueMaxLength {
+			return config.PipelineQueueName, nil
+		}
+
+		switch config.QueueOverflowPolicy {
+		case overflowPolicyDrop:
+			return "", errJobsDropped
+		case overflowPolicyOverflow:
+			logWarnContext(ctx, "Queue '%s' is full (%d jobs), diverting to overflow queue '%s'", config.PipelineQueueName, length, config.QueueOverflowName)
+			return config.QueueOverflowName, nil
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("queue '%s' still full (%d jobs) after waiting %s", config.PipelineQueueName, length, config.QueueBlockTimeout)
+		}
+		logWarnContext(ctx, "Queue '%s' is full (%d jobs), waiting %s before retrying", config.PipelineQueueName, length, config.QueueBlockInterval)
+		sleepContext(ctx, config.QueueBlockInterval)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+}
+
+// describeOutput describes where jobs are written, with the queues of a
+// fan-out rule if given
+func describeOutput(config Config, queues ...string) string {
+	queue := fmt.Sprintf("queue '%s'", config.PipelineQueueName)
+	if len(queues) > 1 {
+		queue = fmt.Sprintf("queues '%s'", strings.Join(queues, "', '"))
+	} else if len(queues) == 1 {
+		queue = fmt.Sprintf("queue '%s'", queues[0])
+	}
+
+	switch config.OutputMode {
+	case outputModeStream:
+		return fmt.Sprintf("stream '%s'", config.OutputStream)
+	case outputModeBoth:
+		return fmt.Sprintf("%s and stream '%s'", queue, config.OutputStream)
+	case outputModeSorted:
+		return "priority " + queue
+	case outputModeNATS:
+		return "NATS " + strings.Replace(queue, "queue", "subject", 1)
+	case outputModeMQTT:
+		return "MQTT " + strings.Replace(queue, "queue", "topic", 1)
+	case outputModeServiceBus:
+		if len(queues) > 1 {
+			return "Azure Service Bus " + strings.Replace(queue, "queues", "entities", 1)
+		}
+		return "Azure Service Bus " + strings.Replace(queue, "queue", "entity", 1)
+	case outputModeAMQP:
+		return fmt.Sprintf("AMQP exchange '%s' with %s", config.AMQPExchange, strings.Replace(queue, "queue", "routing key", 1))
+	default:
+		return queue
+	}
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestValidateOutputMode(t *testing.T) {
+	for _, mode := range []string{"list", "stream", "both", "priority"} {
+		if err := validateOutputMode(mode); err != nil {
+			t.Errorf("Expected output mode '%s' to be valid, got %v", mode, err)
+		}
+	}
+
+	if err := validateOutputMode("kafka"); err == nil {
+		t.Error("Expected error for unknown output mode, got nil")
+	}
+}
+
+func TestPriorityScore(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+
+	// Within a priority, older jobs come first
+	if priorityScore(0, now) >= priorityScore(0, later) {
+		t.Error("Expected older job to have a lower score than newer job of the same priority")
+	}
+
+	// A higher priority beats any older job of a lower priority
+	if priorityScore(10, later) >= priorityScore(0, now.Add(-30*24*time.Hour)) {
+		t.Error("Expected higher priority job to have a lower score than older lower priority job")
+	}
+	if priorityScore(1, later) >= priorityScore(0, now) {
+		t.Error("Expected priority 1 job to have a lower score than priority 0 job")
+	}
+
+	// Negative priorities queue behind the default
+	if priorityScore(-1, now) <= priorityScore(0, later) {
+		t.Error("Expected priority -1 job to have a higher score than priority 0 job")
+	}
+}
+
+func TestNewJobNotification(t *testing.T) {
+	notification := newJobNotification([]byte(`{"job_id":"1234","rule_id":"deploy","repo":"owner/repo"}`), "pipeline")
+	expected := `{"rule_id":"deploy","job_id":"1234","queue":"pipeline"}`
+	if string(notification) != expected {
+		t.Errorf("Expected %s, got %s", expected, notification)
+	}
+}
+
+func TestValidateOverflowPolicy(t *testing.T) {
+	for _, policy := range []string{"block", "drop", "overflow", "drop-oldest"} {
+		if err := validateOverflowPolicy(policy); err != nil {
+			t.Errorf("Expected overflow policy '%s' to be valid, got %v", policy, err)
+		}
+	}
+
+	if err := validateOverflowPolicy("ignore"); err == nil {
+		t.Error("Expected error for unknown overflow policy, got nil")
+	}
+}
+
+func TestValidateQueuePushCommand(t *testing.T) {
+	for _, command := range []string{"rpush", "lpush"} {
+		if err := validateQueuePushCommand(command); err != nil {
+			t.Errorf("Expected queue push command '%s' to be valid, got %v", command, err)
+		}
+	}
+
+	if err := validateQueuePushCommand("sadd"); err == nil {
+		t.Error("Expected error for unknown queue push command, got nil")
+	}
+}
+
+func TestLoadConfig_QueuePushCommand(t *testing.T) {
+	if config := loadConfig(); config.QueuePushCommand != "rpush" {
+		t.Errorf("Expected QueuePushCommand to be 'rpush', got '%s'", config.QueuePushCommand)
+	}
+	if config := loadConfig(); config.NotifyChannel != "" {
+		t.Errorf("Expected NotifyChannel to be empty, got '%s'", config.NotifyChannel)
+	}
+
+	os.Setenv("NOTIFY_CHANNEL", "pipeline-notifications")
+	defer os.Unsetenv("NOTIFY_CHANNEL")
+	if config := loadConfig(); config.NotifyChannel != "pipeline-notifications" {
+		t.Errorf("Expected NotifyChannel to be 'pipeline-notifications', got '%s'", config.NotifyChannel)
+	}
+
+	os.Setenv("QUEUE_PUSH_COMMAND", "LPUSH")
+	defer os.Unsetenv("QUEUE_PUSH_COMMAND")
+
+	if config := loadConfig(); config.QueuePushCommand != "lpush" {
+		t.Errorf("Expected QueuePushCommand to be 'lpush', got '%s'", config.QueuePushCommand)
+	}
+}
+
+func TestValidateQueueNames(t *testing.T) {
+	valid := []string{"pipeline", "pipeline:{{.RepoName}}", "{{.Owner}}/{{.RepoName}}:jobs"}
+	for _, name := range valid {
+		if err := validateQueueNames(Config{PipelineQueueName: name}); err != nil {
+			t.Errorf("Expected queue name %q to be valid, got %v", name, err)
+		}
+	}
+
+	invalid := []string{"pipeline:{{.RepoName", "pipeline:{{.Repository}}"}
+	for _, name := range invalid {
+		if err := validateQueueNames(Config{PipelineQueueName: name}); err == nil {
+			t.Errorf("Expected error for queue name %q, got nil", name)
+		}
+	}
+}
+
+func TestResolveQueueNames(t *testing.T) {
+	event := GitHubEvent{Ref: "refs/heads/main"}
+	event.Repository.FullName = "owner/repo"
+	data := newTemplateData(event)
+
+	config := Config{
+		PipelineQueueName: "pipeline:{{.RepoName}}",
+		QueueOverflowName: "pipeline-overflow:{{.RepoName}}",
+	}
+	resolved, err := resolveQueueNames(config, data)
+	if err != nil {
+		t.Fatalf("Failed to resolve queue names: %v", err)
+	}
+	if resolved.PipelineQueueName != "pipeline:repo" {
+		t.Errorf("Expected queue 'pipeline:repo', got '%s'", resolved.PipelineQueueName)
+	}
+	if resolved.QueueOverflowName != "pipeline-overflow:repo" {
+		t.Errorf("Expected overflow queue 'pipeline-overflow:repo', got '%s'", resolved.QueueOverflowName)
+	}
+
+	// Plain names are used as is
+	resolved, err = resolveQueueNames(Config{PipelineQueueName: "pipeline"}, data)
+	if err != nil || resolved.PipelineQueueName != "pipeline" {
+		t.Errorf("Expected queue 'pipeline', got '%s' (%v)", resolved.PipelineQueueName, err)
+	}
+
+	if _, err := resolveQueueNames(Config{PipelineQueueName: "{{.Tag}}"}, data); err == nil {
+		t.Error("Expected error for queue name rendering empty, got nil")
+	}
+}
+
+func TestResolveRuleQueues(t *testing.T) {
+	event := GitHubEvent{Ref: "refs/heads/main"}
+	event.Repository.FullName = "owner/repo"
+	data := newTemplateData(event)
+
+	queues, err := resolveRuleQueues(&FilterRule{}, data)
+	if err != nil || queues != nil {
+		t.Errorf("Expected no queues for rule without queues, got %v (%v)", queues, err)
+	}
+
+	rule := &FilterRule{Queues: []string{"pipeline", "audit:{{.RepoName}}", "pipeline"}}
+	queues, err = resolveRuleQueues(rule, data)
+	if err != nil {
+		t.Fatalf("Failed to resolve queues: %v", err)
+	}
+	expected := []string{"pipeline", "audit:repo"}
+	if !slices.Equal(queues, expected) {
+		t.Errorf("Expected queues %v, got %v", expected, queues)
+	}
+
+	if _, err := resolveRuleQueues(&FilterRule{Queues: []string{"{{.Tag}}"}}, data); err == nil {
+		t.Error("Expected error for queue name rendering empty, got nil")
+	}
+}
+
+func TestDescribeOutput(t *testing.T) {
+	tests := []struct {
+		config   Config
+		queues   []string
+		expected string
+	}{
+		{Config{OutputMode: outputModeList, PipelineQueueName: "pipeline"}, nil, "queue 'pipeline'"},
+		{Config{OutputMode: outputModeList, PipelineQueueName: "pipeline"}, []string{"pipeline", "audit"}, "queues 'pipeline', 'audit'"},
+		{Config{OutputMode: outputModeSorted, PipelineQueueName: "pipeline"}, nil, "priority queue 'pipeline'"},
+		{Config{OutputMode: outputModeStream, OutputStream: "jobs"}, []string{"pipeline", "audit"}, "stream 'jobs'"},
+		{Config{OutputMode: outputModeBoth, PipelineQueueName: "pipeline", OutputStream: "jobs"}, []string{"audit"}, "queue 'audit' and stream 'jobs'"},
+	}
+
+	for _, tt := range tests {
+		if result := describeOutput(tt.config, tt.queues...); result != tt.expected {
+			t.Errorf("describeOutput(%s, %v) = %q, expected %q", tt.config.OutputMode, tt.queues, result, tt.expected)
+		}
+	}
+}
+
+func TestLoadConfig_Backpressure(t *testing.T) {
+	config := loadConfig()
+
+	if config.QueueMaxLength != 0 {
+		t.Errorf("Expected QueueMaxLength to be 0, got %d", config.QueueMaxLength)
+	}
+	if config.QueueOverflowPolicy != "block" {
+		t.Errorf("Expected QueueOverflowPolicy to be 'block', got '%s'", config.QueueOverflowPolicy)
+	}
+	if config.QueueOverflowName != "pipeline-overflow" {
+		t.Errorf("Expected QueueOverflowName to be 'pipeline-overflow', got '%s'", config.QueueOverflowName)
+	}
+	if config.QueueBlockInterval != time.Second {
+		t.Errorf("Expected QueueBlockInterval to be 1s, got %s", config.QueueBlockInterval)
+	}
+	if config.QueueBlockTimeout != time.Minute {
+		t.Errorf("Expected QueueBlockTimeout to be 1m, got %s", config.QueueBlockTimeout)
+	}
+
+	os.Setenv("QUEUE_MAX_LENGTH", "500")
+	os.Setenv("QUEUE_OVERFLOW_POLICY", "overflow")
+	os.Setenv("QUEUE_OVERFLOW_NAME", "pipeline-spill")
+	os.Setenv("QUEUE_BLOCK_INTERVAL", "250ms")
+	os.Setenv("QUEUE_BLOCK_TIMEOUT", "10s")
+	defer os.Unsetenv("QUEUE_MAX_LENGTH")
+	defer os.Unsetenv("QUEUE_OVERFLOW_POLICY")
+	defer os.Unsetenv("QUEUE_OVERFLOW_NAME")
+	defer os.Unsetenv("QUEUE_BLOCK_INTERVAL")
+	defer os.Unsetenv("QUEUE_BLOCK_TIMEOUT")
+
+	config = loadConfig()
+
+	if config.QueueMaxLength != 500 {
+		t.Errorf("Expected QueueMaxLength to be 500, got %d", config.QueueMaxLength)
+	}
+	if config.QueueOverflowPolicy != "overflow" {
+		t.Errorf("Expected QueueOverflowPolicy to be 'overflow', got '%s'", config.QueueOverflowPolicy)
+	}
+	if config.QueueOverflowName != "pipeline-spill" {
+		t.Errorf("Expected QueueOverflowName to be 'pipeline-spill', got '%s'", config.QueueOverflowName)
+	}
+	if config.QueueBlockInterval != 250*time.Millisecond {
+		t.Errorf("Expected QueueBlockInterval to be 250ms, got %s", config.QueueBlockInterval)
+	}
+	if config.QueueBlockTimeout != 10*time.Second {
+		t.Errorf("Expected QueueBlockTimeout to be 10s, got %s", config.QueueBlockTimeout)
+	}
+}
+
+func TestEnqueueJobs_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:        outputModeBoth,
+		PipelineQueueName: "test-pipeline-both",
+		OutputStream:      "test-pipeline-stream",
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.PipelineQueueName, config.OutputStream)
+	defer rdb.Del(ctx, config.PipelineQueueName, config.OutputStream)
+
+	jobs := [][]byte{[]byte(`{"job_id":"1"}`), []byte(`{"job_id":"2"}`)}
+	if err := enqueueJobs(ctx, rdb, config, nil, 0, jobs); err != nil {
+		t.Fatalf("Failed to enqueue jobs: %v", err)
+	}
+
+	queued, err := rdb.LRange(ctx, config.PipelineQueueName, 0, -1).Result()
+	if err != nil {
+		t.Fatalf("Failed to read queue: %v", err)
+	}
+	if len(queued) != 2 || queued[0] != `{"job_id":"1"}` {
+		t.Errorf("Expected both jobs in the queue in order, got %v", queued)
+	}
+
+	entries, err := rdb.XRange(ctx, config.OutputStream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	if len(entries) != 2 || entries[1].Values[outputStreamField] != `{"job_id":"2"}` {
+		t.Errorf("Expected both jobs in the stream in order, got %v", entries)
+	}
+}
+
+func TestEnqueueJobs_Backpressure_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:         outputModeList,
+		PipelineQueueName:  "test-pipeline-full",
+		QueueMaxLength:     1,
+		QueueOverflowName:  "test-pipeline-overflow",
+		QueueBlockInterval: 10 * time.Millisecond,
+		QueueBlockTimeout:  50 * time.Millisecond,
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.PipelineQueueName, config.QueueOverflowName)
+	defer rdb.Del(ctx, config.PipelineQueueName, config.QueueOverflowName)
+
+	jobs := [][]byte{[]byte(`{"job_id":"1"}`)}
+	if err := enqueueJobs(ctx, rdb, config, nil, 0, jobs); err != nil {
+		t.Fatalf("Failed to enqueue jobs: %v", err)
+	}
+
+	// The queue is now full
+	config.QueueOverflowPolicy = overflowPolicyBlock
+	if err := enqueueJobs(ctx, rdb, config, nil, 0, jobs); err == nil || errors.Is(err, errJobsDropped) {
+		t.Errorf("Expected timeout error with block policy, got %v", err)
+	}
+
+	config.QueueOverflowPolicy = overflowPolicyDrop
+	if err := enqueueJobs(ctx, rdb, config, nil, 0, jobs); !errors.Is(err, errJobsDropped) {
+		t.Errorf("Expected errJobsDropped with drop policy, got %v", err)
+	}
+
+	config.QueueOverflowPolicy = overflowPolicyOverflow
+	if err := enqueueJobs(ctx, rdb, config, nil, 0, jobs); err != nil {
+		t.Fatalf("Failed to enqueue jobs with overflow policy: %v", err)
+	}
+
+	if length := rdb.LLen(ctx, config.PipelineQueueName).Val(); length != 1 {
+		t.Errorf("Expected 1 job in the queue, got %d", length)
+	}
+	if length := rdb.LLen(ctx, config.QueueOverflowName).Val(); length != 1 {
+		t.Errorf("Expected 1 job in the overflow queue, got %d", length)
+	}
+}
+
+func TestEnqueueJobs_DropOldest_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:          outputModeList,
+		PipelineQueueName:   "test-pipeline-drop-oldest",
+		QueueMaxLength:      2,
+		QueueOverflowPolicy: overflowPolicyDropOldest,
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.PipelineQueueName)
+	defer rdb.Del(ctx, config.PipelineQueueName)
+
+	for _, command := range []string{queuePushRight, queuePushLeft} {
+		t.Run(command, func(t *testing.T) {
+			rdb.Del(ctx, config.PipelineQueueName)
+			config.QueuePushCommand = command
+
+			before := droppedJobs.Load()
+			for _, id := range []string{"1", "2", "3"} {
+				if err := enqueueJobs(ctx, rdb, config, nil, 0, [][]byte{[]byte(`{"job_id":"` + id + `"}`)}); err != nil {
+					t.Fatalf("Failed to enqueue job %s: %v", id, err)
+				}
+			}
+
+			queued := rdb.LRange(ctx, config.PipelineQueueName, 0, -1).Val()
+			if len(queued) != 2 || slices.Contains(queued, `{"job_id":"1"}`) {
+				t.Errorf("Expected the 2 newest jobs in the queue, got %v", queued)
+			}
+			if dropped := droppedJobs.Load() - before; dropped != 1 {
+				t.Errorf("Expected 1 dropped job to be counted, got %d", dropped)
+			}
+		})
+	}
+}
+
+func TestEnqueueJobs_Priority_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:        outputModeSorted,
+		PipelineQueueName: "test-pipeline-priority",
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.PipelineQueueName)
+	defer rdb.Del(ctx, config.PipelineQueueName)
+
+	if err := enqueueJobs(ctx, rdb, config, nil, 0, [][]byte{[]byte(`{"job_id":"routine"}`)}); err != nil {
+		t.Fatalf("Failed to enqueue routine job: %v", err)
+	}
+	if err := enqueueJobs(ctx, rdb, config, nil, 100, [][]byte{[]byte(`{"job_id":"hotfix"}`)}); err != nil {
+		t.Fatalf("Failed to enqueue hotfix job: %v", err)
+	}
+
+	popped, err := rdb.ZPopMin(ctx, config.PipelineQueueName).Result()
+	if err != nil {
+		t.Fatalf("Failed to pop job: %v", err)
+	}
+	if len(popped) != 1 || popped[0].Member != `{"job_id":"hotfix"}` {
+		t.Errorf("Expected hotfix job to be popped first, got %v", popped)
+	}
+}
+
+func TestEnqueueJobs_LPush_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:        outputModeList,
+		PipelineQueueName: "test-pipeline-lpush",
+		QueuePushCommand:  queuePushLeft,
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.PipelineQueueName)
+	defer rdb.Del(ctx, config.PipelineQueueName)
+
+	jobs := [][]byte{[]byte(`{"job_id":"1"}`), []byte(`{"job_id":"2"}`)}
+	if err := enqueueJobs(ctx, rdb, config, nil, 0, jobs); err != nil {
+		t.Fatalf("Failed to enqueue jobs: %v", err)
+	}
+
+	// BRPOP consumers receive the jobs in dispatch order
+	popped, err := rdb.RPop(ctx, config.PipelineQueueName).Result()
+	if err != nil {
+		t.Fatalf("Failed to pop job: %v", err)
+	}
+	if popped != `{"job_id":"1"}` {
+		t.Errorf("Expected first dispatched job to be popped first, got %s", popped)
+	}
+}
+
+func TestEnqueueJobs_Notify_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:        outputModeList,
+		PipelineQueueName: "test-pipeline-notify",
+		NotifyChannel:     "test-pipeline-notifications",
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.PipelineQueueName)
+	defer rdb.Del(ctx, config.PipelineQueueName)
+
+	pubsub := rdb.Subscribe(ctx, config.NotifyChannel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if err := enqueueJobs(ctx, rdb, config, nil, 0, [][]byte{[]byte(`{"job_id":"1","rule_id":"deploy"}`)}); err != nil {
+		t.Fatalf("Failed to enqueue jobs: %v", err)
+	}
+
+	receiveCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	msg, err := pubsub.ReceiveMessage(receiveCtx)
+	if err != nil {
+		t.Fatalf("Failed to receive notification: %v", err)
+	}
+	expected := `{"rule_id":"deploy","job_id":"1","queue":"test-pipeline-notify"}`
+	if msg.Payload != expected {
+		t.Errorf("Expected notification %s, got %s", expected, msg.Payload)
+	}
+}
+
+func TestEnqueueJobs_FanOut_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:          outputModeList,
+		QueueMaxLength:      1,
+		QueueOverflowPolicy: overflowPolicyDrop,
+	}
+	queues := []string{"test-pipeline-fanout", "test-audit-fanout"}
+
+	// Clean up before test
+	rdb.Del(ctx, queues...)
+	defer rdb.Del(ctx, queues...)
+
+	if err := enqueueJobs(ctx, rdb, config, queues, 0, [][]byte{[]byte(`{"job_id":"1"}`)}); err != nil {
+		t.Fatalf("Failed to enqueue jobs: %v", err)
+	}
+	for _, queue := range queues {
+		if length := rdb.LLen(ctx, queue).Val(); length != 1 {
+			t.Errorf("Expected 1 job in queue '%s', got %d", queue, length)
+		}
+	}
+
+	// A full queue drops the jobs from every queue of the fan-out
+	rdb.LPop(ctx, queues[1])
+	if err := enqueueJobs(ctx, rdb, config, queues, 0, [][]byte{[]byte(`{"job_id":"2"}`)}); !errors.Is(err, errJobsDropped) {
+		t.Errorf("Expected errJobsDropped, got %v", err)
+	}
+	if length := rdb.LLen(ctx, queues[1]).Val(); length != 0 {
+		t.Errorf("Expected no job in queue '%s' after dropping, got %d", queues[1], length)
+	}
+}
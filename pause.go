@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// pauseController watches the PAUSE_KEY control key. While the key exists,
+// dispatched jobs are held in the HELD_QUEUE_NAME list instead of being
+// enqueued; once it is removed the held jobs are enqueued in order. Single
+// rules and repositories are paused by adding them to the PAUSE_KEY:targets
+// set, their jobs are held in a list of their own.
+type pauseController struct {
+	rdb     redis.UniversalClient
+	config  Config
+	paused  atomic.Bool
+	targets atomic.Pointer[map[string]bool]
+}
+
+// pauseState is the pause state shared by the replicas through Redis
+type pauseState struct {
+	Paused bool     `json:"paused"`
+	Reason string   `json:"reason,omitempty"`
+	Rules  []string `json:"rules"`
+	Repos  []string `json:"repos"`
+}
+
+const (
+	pauseTargetRule = "rule:"
+	pauseTargetRepo = "repo:"
+)
+
+func newPauseController(rdb redis.UniversalClient, config Config) *pauseController {
+	p := &pauseController{rdb: rdb, config: config}
+	p.targets.Store(&map[string]bool{})
+	return p
+}
+
+func (p *pauseController) isPaused() bool {
+	return p.paused.Load()
+}
+
+// targetsKey is the set of the paused rules and repositories
+func (p *pauseController) targetsKey() string {
+	return p.config.PauseKey + ":targets"
+}
+
+// heldTargetsKey is the set of the paused rules and repositories that have
+// held jobs, which are drained once they are resumed
+func (p *pauseController) heldTargetsKey() string {
+	return p.config.HeldQueueName + ":targets"
+}
+
+// heldQueue is the list holding the jobs of the target, or those held while
+// the dispatcher is paused for an empty target
+func (p *pauseController) heldQueue(target string) string {
+	if target == "" {
+		return p.config.HeldQueueName
+	}
+	return p.config.HeldQueueName + ":" + target
+}
+
+func (p *pauseController) targetPaused(target string) bool {
+	return target != "" && (*p.targets.Load())[target]
+}
+
+// holding returns the target whose held list the jobs of the rule for the
+// repository go to, and whether they are held at all. A paused rule or
+// repository keeps its jobs until it is resumed, even if the dispatcher is
+// resumed first.
+func (p *pauseController) holding(rule *FilterRule, repo string) (string, bool) {
+	if target := pausedTarget(p, rule.ID, repo); target != "" {
+		return target, true
+	}
+	return "", p.isPaused()
+}
+
+// pausedTarget returns the paused rule or repository holding the jobs of the
+// rule for the repository, if any, without pause control too
+func pausedTarget(p *pauseController, ruleID, repo string) string {
+	if p == nil {
+		return ""
+	}
+	if target := pauseTargetRule + ruleID; ruleID != "" && p.targetPaused(target) {
+		return target
+	}
+	if target := pauseTargetRepo + strings.ToLower(repo); repo != "" && p.targetPaused(target) {
+		return target
+	}
+	return ""
+}
+
+// run checks the control key every PAUSE_POLL_INTERVAL until the context is
+// cancelled, draining the held jobs whenever the dispatcher is not paused
+func (p *pauseController) run(ctx context.Context) {
+	ticker := time.NewTicker(p.config.PausePollInterval)
+	defer ticker.Stop()
+
+	for {
+		p.check(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *pauseController) check(ctx context.Context) {
+	if _, err := p.refresh(ctx); err != nil {
+		// Keep the last known state while Redis is unreachable
+		if ctx.Err() == nil {
+			logError("Failed to check pause key '%s': %v", p.config.PauseKey, err)
+		}
+		return
+	}
+
+	p.drainTargets(ctx)
+	if p.isPaused() {
+		return
+	}
+
+	drained, err := p.drain(ctx, "")
+	if err != nil && ctx.Err() == nil {
+		logError("Failed to drain held jobs: %v", err)
+	}
+	if drained > 0 {
+		logInfo("Enqueued %d held job(s) from '%s'", drained, p.config.HeldQueueName)
+	}
+}
+
+// refresh reads the pause state from Redis and applies it
+func (p *pauseController) refresh(ctx context.Context) (pauseState, error) {
+	var reason *redis.StringCmd
+	var members *redis.StringSliceCmd
+	p.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		reason = pipe.Get(ctx, p.config.PauseKey)
+		members = pipe.SMembers(ctx, p.targetsKey())
+		return nil
+	})
+	if err := reason.Err(); err != nil && !errors.Is(err, redis.Nil) {
+		return pauseState{}, err
+	}
+	if err := members.Err(); err != nil {
+		return pauseState{}, err
+	}
+
+	state := pauseState{Paused: reason.Err() == nil, Reason: reason.Val(), Rules: []string{}, Repos: []string{}}
+	if p.paused.Swap(state.Paused) != state.Paused {
+		if state.Paused {
+			logWarn("Dispatcher paused by key '%s', holding jobs in '%s'", p.config.PauseKey, p.config.HeldQueueName)
+		} else {
+			logInfo("Dispatcher resumed, draining held jobs from '%s'", p.config.HeldQueueName)
+		}
+	}
+
+	targets := make(map[string]bool, len(members.Val()))
+	for _, target := range members.Val() {
+		targets[target] = true
+		if rule, ok := strings.CutPrefix(target, pauseTargetRule); ok {
+			state.Rules = append(state.Rules, rule)
+		} else if repo, ok := strings.CutPrefix(target, pauseTargetRepo); ok {
+			state.Repos = append(state.Repos, repo)
+		}
+	}
+	slices.Sort(state.Rules)
+	slices.Sort(state.Repos)
+
+	previous := *p.targets.Swap(&targets)
+	for target := range targets {
+		if !previous[target] {
+			logWarn("Dispatching paused for %s, holding its jobs in '%s'", target, p.heldQueue(target))
+		}
+	}
+	for target := range previous {
+		if !targets[target] {
+			logInfo("Dispatching resumed for %s", target)
+		}
+	}
+	return state, nil
+}
+
+// drainTargets enqueues the held jobs of the rules and repositories that are
+// no longer paused
+func (p *pauseController) drainTargets(ctx context.Context) {
+	held, err := p.rdb.SMembers(ctx, p.heldTargetsKey()).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			logError("Failed to read held targets from '%s': %v", p.heldTargetsKey(), err)
+		}
+		return
+	}
+
+	for _, target := range held {
+		if p.targetPaused(target) || p.isPaused() || ctx.Err() != nil {
+			continue
+		}
+		drained, err := p.drain(ctx, target)
+		if err != nil {
+			if ctx.Err() == nil {
+				logError("Failed to drain held jobs of %s: %v", target, err)
+			}
+			continue
+		}
+		if drained > 0 {
+			logInfo("Enqueued %d held job(s) of %s from '%s'", drained, target, p.heldQueue(target))
+		}
+
+		// Jobs held by a replica that has not seen the resume yet may be
+		// added concurrently: the target is added back if any was
+		if err := p.rdb.SRem(ctx, p.heldTargetsKey(), target).Err(); err != nil {
+			continue
+		}
+		if length, err := p.rdb.LLen(ctx, p.heldQueue(target)).Result(); err != nil || length > 0 {
+			p.rdb.SAdd(context.WithoutCancel(ctx), p.heldTargetsKey(), target)
+		}
+	}
+}
+
+// pause pauses the target, or the dispatcher for an empty target
+func (p *pauseController) pause(ctx context.Context, target, reason string) (pauseState, error) {
+	var err error
+	if target == "" {
+		if reason == "" {
+			reason = "paused by admin API"
+		}
+		err = p.rdb.Set(ctx, p.config.PauseKey, reason, 0).Err()
+	} else {
+		err = p.rdb.SAdd(ctx, p.targetsKey(), target).Err()
+	}
+	if err != nil {
+		return pauseState{}, fmt.Errorf("failed to pause: %w", err)
+	}
+	return p.refresh(ctx)
+}
+
+// resume resumes the target, or the dispatcher for an empty target. The held
+// jobs are enqueued on the next check.
+func (p *pauseController) resume(ctx context.Context, target string) (pauseState, error) {
+	var err error
+	if target == "" {
+		err = p.rdb.Del(ctx, p.config.PauseKey).Err()
+	} else {
+		err = p.rdb.SRem(ctx, p.targetsKey(), target).Err()
+	}
+	if err != nil {
+		return pauseState{}, fmt.Errorf("failed to resume: %w", err)
+	}
+	return p.refresh(ctx)
+}
+
+// hold adds the jobs to the held list of the target, remembering where they
+// are enqueued
+func (p *pauseController) hold(ctx context.Context, target string, config Config, queues []string, priority int, jobs [][]byte) error {
+	if len(queues) == 0 {
+		queues = []string{config.PipelineQueueName}
+	}
+
+	entries := make([]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		entry, err := json.Marshal(deferredJob{
+			Queues:        queues,
+			OverflowQueue: config.QueueOverflowName,
+			Priority:      priority,
+			Job:           job,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to serialize held job: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := p.rdb.RPush(ctx, p.heldQueue(target), entries...).Err(); err != nil {
+		return err
+	}
+	if target != "" {
+		return p.rdb.SAdd(ctx, p.heldTargetsKey(), target).Err()
+	}
+	return nil
+}
+
+// drain enqueues the held jobs of the target in the order they were held
+// until the list is empty or the dispatcher or target is paused again
+func (p *pauseController) drain(ctx context.Context, target string) (int, error) {
+	queue := p.heldQueue(target)
+	drained := 0
+	for !p.isPaused() && !p.targetPaused(target) && ctx.Err() == nil {
+		entry, err := p.rdb.LPop(ctx, queue).Result()
+		if errors.Is(err, redis.Nil) {
+			return drained, nil
+		}
+		if err != nil {
+			return drained, fmt.Errorf("failed to read held jobs from '%s': %w", queue, err)
+		}
+
+		var held deferredJob
+		if err := json.Unmarshal([]byte(entry), &held); err != nil {
+			logError("Dropping malformed held job from '%s': %v", queue, err)
+			continue
+		}
+
+		cfg := p.config
+		cfg.QueueOverflowName = held.OverflowQueue
+		err = enqueueJobs(context.WithoutCancel(ctx), p.rdb, cfg, held.Queues, held.Priority, [][]byte{held.Job})
+		if errors.Is(err, errJobsDropped) {
+			continue
+		}
+		if err != nil {
+			// Put the job back at the head so the order is kept for the next attempt
+			if err := p.rdb.LPush(context.WithoutCancel(ctx), queue, entry).Err(); err != nil {
+				logError("Failed to return held job to '%s': %v", queue, err)
+			}
+			return drained, fmt.Errorf("failed to enqueue held job to %s: %w", describeOutput(cfg, held.Queues...), err)
+		}
+		drained++
+	}
+	return drained, nil
+}
+
+// pauseRequest is the optional body of POST /admin/pause and /admin/resume,
+// selecting a rule or repository instead of the whole dispatcher
+type pauseRequest struct {
+	Rule   string `json:"rule"`
+	Repo   string `json:"repo"`
+	Reason string `json:"reason"`
+}
+
+// pauseTarget returns the rule or repository the request selects, or an
+// empty target for the whole dispatcher. A rule must be loaded to be paused,
+// but a paused rule can be resumed after it was removed.
+func (d *Dispatcher) pauseTarget(w http.ResponseWriter, r *http.Request, resume bool) (pauseRequest, string, bool) {
+	var body pauseRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid body, expected {\"rule\": \"id\"}, {\"repo\": \"owner/repo\"} or no body", http.StatusBadRequest)
+		return body, "", false
+	}
+
+	switch {
+	case body.Rule != "" && body.Repo != "":
+		http.Error(w, "only one of rule and repo can be given", http.StatusBadRequest)
+		return body, "", false
+	case body.Rule != "":
+		target := pauseTargetRule + body.Rule
+		if slices.ContainsFunc(d.rules.Load().rules, func(rule FilterRule) bool { return rule.ID == body.Rule }) {
+			return body, target, true
+		}
+		paused := false
+		if resume {
+			var err error
+			if paused, err = d.pause.rdb.SIsMember(r.Context(), d.pause.targetsKey(), target).Result(); err != nil {
+				http.Error(w, fmt.Sprintf("failed to read pause state: %v", err), http.StatusServiceUnavailable)
+				return body, "", false
+			}
+		}
+		if !paused {
+			http.Error(w, fmt.Sprintf("rule '%s' not found", body.Rule), http.StatusNotFound)
+			return body, "", false
+		}
+		return body, target, true
+	case body.Repo != "":
+		if owner, name, ok := strings.Cut(body.Repo, "/"); !ok || owner == "" || name == "" {
+			http.Error(w, fmt.Sprintf("invalid repo '%s', expected owner/repo", body.Repo), http.StatusBadRequest)
+			return body, "", false
+		}
+		return body, pauseTargetRepo + strings.ToLower(body.Repo), true
+	}
+	return body, "", true
+}
+
+func writePauseState(w http.ResponseWriter, state pauseState, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// pauseStateHandler reports the pause state
+func (d *Dispatcher) pauseStateHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, err := d.pause.refresh(r.Context())
+		writePauseState(w, state, err)
+	})
+}
+
+// pauseHandler pauses the dispatcher, or the rule or repository of the body
+func (d *Dispatcher) pauseHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, target, ok := d.pauseTarget(w, r, false)
+		if !ok {
+			return
+		}
+		logInfo("Pausing %s on request from %s", describePauseTarget(target), r.RemoteAddr)
+		state, err := d.pause.pause(r.Context(), target, body.Reason)
+		writePauseState(w, state, err)
+	})
+}
+
+// resumeHandler resumes the dispatcher, or the rule or repository of the body
+func (d *Dispatcher) resumeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, target, ok := d.pauseTarget(w, r, true)
+		if !ok {
+			return
+		}
+		logInfo("Resuming %s on request from %s", describePauseTarget(target), r.RemoteAddr)
+		state, err := d.pause.resume(r.Context(), target)
+		writePauseState(w, state, err)
+	})
+}
+
+func describePauseTarget(target string) string {
+	if target == "" {
+		return "dispatching"
+	}
+	return target
+}
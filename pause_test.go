@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_Pause(t *testing.T) {
+	config := loadConfig()
+
+	if config.PauseKey != "" {
+		t.Errorf("Expected PauseKey to be empty, got '%s'", config.PauseKey)
+	}
+	if config.PausePollInterval != time.Second {
+		t.Errorf("Expected PausePollInterval to be 1s, got %s", config.PausePollInterval)
+	}
+	if config.HeldQueueName != "pipeline-held" {
+		t.Errorf("Expected HeldQueueName to be 'pipeline-held', got '%s'", config.HeldQueueName)
+	}
+	if newDispatcher(nil, config, nil).pause != nil {
+		t.Error("Expected pause control to be disabled by default")
+	}
+
+	os.Setenv("PAUSE_KEY", "dispatcher:paused")
+	os.Setenv("PAUSE_POLL_INTERVAL", "5s")
+	os.Setenv("HELD_QUEUE_NAME", "dispatcher:held")
+	defer os.Unsetenv("PAUSE_KEY")
+	defer os.Unsetenv("PAUSE_POLL_INTERVAL")
+	defer os.Unsetenv("HELD_QUEUE_NAME")
+
+	config = loadConfig()
+
+	if config.PauseKey != "dispatcher:paused" {
+		t.Errorf("Expected PauseKey to be 'dispatcher:paused', got '%s'", config.PauseKey)
+	}
+	if config.PausePollInterval != 5*time.Second {
+		t.Errorf("Expected PausePollInterval to be 5s, got %s", config.PausePollInterval)
+	}
+	if config.HeldQueueName != "dispatcher:held" {
+		t.Errorf("Expected HeldQueueName to be 'dispatcher:held', got '%s'", config.HeldQueueName)
+	}
+	if newDispatcher(nil, config, nil).pause == nil {
+		t.Error("Expected pause control to be enabled with PAUSE_KEY")
+	}
+}
+
+func TestPauseController_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:        outputModeList,
+		PipelineQueueName: "test-pipeline-pause",
+		PauseKey:          "test-dispatcher:paused",
+		HeldQueueName:     "test-pipeline-held",
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.PipelineQueueName, config.PauseKey, config.HeldQueueName)
+	defer rdb.Del(ctx, config.PipelineQueueName, config.PauseKey, config.HeldQueueName)
+
+	pause := newPauseController(rdb, config)
+	rdb.Set(ctx, config.PauseKey, "maintenance", 0)
+	pause.check(ctx)
+	if !pause.isPaused() {
+		t.Fatal("Expected dispatcher to be paused while the pause key exists")
+	}
+
+	jobs := [][]byte{[]byte(`{"job_id":"1"}`), []byte(`{"job_id":"2"}`)}
+	if err := pause.hold(ctx, "", config, nil, 0, jobs); err != nil {
+		t.Fatalf("Failed to hold jobs: %v", err)
+	}
+
+	// Held jobs stay held while paused
+	pause.check(ctx)
+	if length := rdb.LLen(ctx, config.PipelineQueueName).Val(); length != 0 {
+		t.Errorf("Expected no jobs in the queue while paused, got %d", length)
+	}
+
+	rdb.Del(ctx, config.PauseKey)
+	pause.check(ctx)
+	if pause.isPaused() {
+		t.Fatal("Expected dispatcher to be resumed once the pause key is removed")
+	}
+
+	queued := rdb.LRange(ctx, config.PipelineQueueName, 0, -1).Val()
+	if len(queued) != 2 || queued[0] != `{"job_id":"1"}` {
+		t.Errorf("Expected the held jobs in order after resuming, got %v", queued)
+	}
+	if length := rdb.LLen(ctx, config.HeldQueueName).Val(); length != 0 {
+		t.Errorf("Expected the held list to be empty, got %d", length)
+	}
+}
+
+func TestPauseController_Holding(t *testing.T) {
+	pause := newPauseController(nil, Config{PauseKey: "dispatcher:paused", HeldQueueName: "pipeline-held"})
+	pause.targets.Store(&map[string]bool{"rule:deploy": true, "repo:owner/frozen": true})
+	build := &FilterRule{ID: "build"}
+
+	tests := []struct {
+		rule   *FilterRule
+		repo   string
+		target string
+		held   bool
+	}{
+		{build, "owner/repo", "", false},
+		{&FilterRule{ID: "deploy"}, "owner/repo", "rule:deploy", true},
+		{build, "Owner/Frozen", "repo:owner/frozen", true},
+	}
+	for _, tt := range tests {
+		if target, held := pause.holding(tt.rule, tt.repo); target != tt.target || held != tt.held {
+			t.Errorf("Expected rule %s of %s to be held %v in '%s', got %v in '%s'", tt.rule.ID, tt.repo, tt.held, tt.target, held, target)
+		}
+	}
+	if queue := pause.heldQueue("rule:deploy"); queue != "pipeline-held:rule:deploy" {
+		t.Errorf("Expected held queue 'pipeline-held:rule:deploy', got '%s'", queue)
+	}
+
+	// A paused rule keeps its jobs in its own list while the dispatcher is paused
+	pause.paused.Store(true)
+	if target, held := pause.holding(build, "owner/repo"); target != "" || !held {
+		t.Errorf("Expected jobs to be held in the held queue while paused, got %v in '%s'", held, target)
+	}
+	if target, _ := pause.holding(&FilterRule{ID: "deploy"}, "owner/repo"); target != "rule:deploy" {
+		t.Errorf("Expected jobs of the paused rule to be held in its list, got '%s'", target)
+	}
+}
+
+func TestPauseHandlers(t *testing.T) {
+	config := Config{AdminAuthToken: "admin-token", PauseKey: "dispatcher:paused", PausePollInterval: time.Second}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main"}}
+	handler := newHTTPHandler(config, newDispatcher(nil, config, rules))
+
+	request := func(path, body string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		body     string
+		expected int
+	}{
+		{`{"rule": "build", "repo": "owner/repo"}`, http.StatusBadRequest},
+		{`{"repo": "owner"}`, http.StatusBadRequest},
+		{`[]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		for _, path := range []string{"/admin/pause", "/admin/resume"} {
+			if code := request(path, tt.body); code != tt.expected {
+				t.Errorf("Expected %d for %s with %s, got %d", tt.expected, path, tt.body, code)
+			}
+		}
+	}
+	if code := request("/admin/pause", `{"rule": "unknown"}`); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for pausing an unknown rule, got %d", code)
+	}
+
+	// The endpoints are only served with PAUSE_KEY
+	config.PauseKey = ""
+	handler = newHTTPHandler(config, newDispatcher(nil, config, rules))
+	if code := request("/admin/pause", ""); code != http.StatusNotFound && code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected no pause endpoint without PAUSE_KEY, got %d", code)
+	}
+}
+
+func TestPauseTargets_Integration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:        outputModeList,
+		PipelineQueueName: "test-pipeline-pause-targets",
+		PauseKey:          "test-dispatcher:paused-targets",
+		PausePollInterval: time.Second,
+		HeldQueueName:     "test-pipeline-held-targets",
+		AdminAuthToken:    "admin-token",
+	}
+	keys := []string{config.PipelineQueueName, config.PauseKey, config.PauseKey + ":targets", config.HeldQueueName, config.HeldQueueName + ":targets", config.HeldQueueName + ":rule:deploy"}
+	rdb.Del(ctx, keys...)
+	defer rdb.Del(ctx, keys...)
+
+	d := newDispatcher(rdb, config, []FilterRule{{ID: "deploy", Repo: "owner/repo", Branch: "refs/heads/main"}})
+	handler := newHTTPHandler(config, d)
+	request := func(method, path, body string) pauseState {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var state pauseState
+		if err := json.NewDecoder(rec.Body).Decode(&state); err != nil {
+			t.Fatalf("Failed to decode pause state of %s %s (%d): %v", method, path, rec.Code, err)
+		}
+		return state
+	}
+
+	state := request(http.MethodPost, "/admin/pause", `{"rule": "deploy"}`)
+	if state.Paused || len(state.Rules) != 1 || state.Rules[0] != "deploy" {
+		t.Fatalf("Expected rule 'deploy' to be paused, got %+v", state)
+	}
+	// Another replica reads the state from Redis
+	replica := newPauseController(rdb, config)
+	replica.check(ctx)
+	target, held := replica.holding(&FilterRule{ID: "deploy"}, "owner/repo")
+	if !held || target != "rule:deploy" {
+		t.Fatalf("Expected the replica to hold the jobs of rule 'deploy', got %v in '%s'", held, target)
+	}
+	if err := replica.hold(ctx, target, config, nil, 0, [][]byte{[]byte(`{"job_id":"1"}`)}); err != nil {
+		t.Fatalf("Failed to hold job: %v", err)
+	}
+
+	// Resuming the dispatcher does not release the jobs of the paused rule
+	request(http.MethodPost, "/admin/pause", `{"reason": "upgrade"}`)
+	if state := request(http.MethodGet, "/admin/pause", ""); !state.Paused || state.Reason != "upgrade" {
+		t.Errorf("Expected the dispatcher to be paused for 'upgrade', got %+v", state)
+	}
+	request(http.MethodPost, "/admin/resume", "")
+	replica.check(ctx)
+	if length := rdb.LLen(ctx, config.PipelineQueueName).Val(); length != 0 {
+		t.Errorf("Expected the job of the paused rule to stay held, got %d queued", length)
+	}
+
+	// The rule can be resumed after it was removed
+	d.swapRules(nil)
+	state = request(http.MethodPost, "/admin/resume", `{"rule": "deploy"}`)
+	if state.Paused || len(state.Rules) != 0 {
+		t.Errorf("Expected nothing to be paused, got %+v", state)
+	}
+	replica.check(ctx)
+	if queued := rdb.LRange(ctx, config.PipelineQueueName, 0, -1).Val(); len(queued) != 1 || queued[0] != `{"job_id":"1"}` {
+		t.Errorf("Expected the held job to be enqueued once the rule is resumed, got %v", queued)
+	}
+	if exists := rdb.Exists(ctx, config.HeldQueueName+":targets").Val(); exists != 0 {
+		t.Error("Expected the drained rule to be removed from the held targets")
+	}
+}
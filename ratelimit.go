@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	rateLimitDefer    = "defer"
+	rateLimitCoalesce = "coalesce"
+)
+
+// rateLimitSweepSize is the number of repositories above which the buckets
+// that refilled are forgotten
+const rateLimitSweepSize = 10000
+
+var (
+	// deferredEvents counts the events whose jobs were delayed by
+	// RATE_LIMIT_PER_REPO
+	deferredEvents atomic.Int64
+	// coalescedEvents counts the events held back by RATE_LIMIT_PER_REPO that
+	// were replaced by a later event of the same repository and ref
+	coalescedEvents atomic.Int64
+)
+
+func validateRateLimitConfig(config Config) error {
+	if config.RateLimitPerRepo < 0 {
+		return errors.New("RATE_LIMIT_PER_REPO must not be negative")
+	}
+	if config.RateLimitPerRepo == 0 {
+		return nil
+	}
+	if config.RateLimitBurst < 1 {
+		return errors.New("RATE_LIMIT_BURST must be at least 1")
+	}
+	switch config.RateLimitPolicy {
+	case rateLimitDefer:
+		// Deferred jobs go through the delayed queue
+		if brokerOutput(config.OutputMode) {
+			return fmt.Errorf("RATE_LIMIT_POLICY defer is not supported with OUTPUT_MODE %s, use coalesce", config.OutputMode)
+		}
+		return nil
+	case rateLimitCoalesce:
+		return nil
+	default:
+		return fmt.Errorf("invalid RATE_LIMIT_POLICY '%s', must be '%s' or '%s'", config.RateLimitPolicy, rateLimitDefer, rateLimitCoalesce)
+	}
+}
+
+// tokenBucket holds the events a repository may dispatch right away
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// heldEvent is the latest event of a repository and ref waiting for the rate
+// limit, dispatched with the ID it was received with
+type heldEvent struct {
+	id    string
+	event GitHubEvent
+}
+
+// rateLimitReleasedKey marks the context of an event the rate limit held
+// back and released, which is not limited again
+type rateLimitReleasedKey struct{}
+
+func withRateLimitReleased(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rateLimitReleasedKey{}, true)
+}
+
+func rateLimitReleased(ctx context.Context) bool {
+	released, _ := ctx.Value(rateLimitReleasedKey{}).(bool)
+	return released
+}
+
+// repoRateLimiter limits the events dispatched per repository to
+// RATE_LIMIT_PER_REPO a second, with bursts of RATE_LIMIT_BURST. The jobs of
+// excess events are either delayed until the repository has a token again
+// (defer), or the latest excess event of every ref is held back and
+// dispatched then, dropping the events it replaced (coalesce). As the
+// messages of held events were already acknowledged, those still held on
+// shutdown are dispatched right away.
+type repoRateLimiter struct {
+	rate   float64
+	burst  float64
+	policy string
+	// release dispatches a held event
+	release func(ctx context.Context, event GitHubEvent)
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	held    map[string]*heldEvent
+	timers  map[string]*time.Timer
+	// ctx is the context of run, nil until it started
+	ctx context.Context
+	// stopped is set on shutdown, once the held events were taken to be
+	// dispatched
+	stopped bool
+	// releasing counts the held events being dispatched
+	releasing sync.WaitGroup
+	done      chan struct{}
+}
+
+func newRepoRateLimiter(config Config, release func(ctx context.Context, event GitHubEvent)) *repoRateLimiter {
+	if config.RateLimitPerRepo <= 0 {
+		return nil
+	}
+	return &repoRateLimiter{
+		rate:    config.RateLimitPerRepo,
+		burst:   float64(config.RateLimitBurst),
+		policy:  config.RateLimitPolicy,
+		release: release,
+		buckets: make(map[string]*tokenBucket),
+		held:    make(map[string]*heldEvent),
+		timers:  make(map[string]*time.Timer),
+		done:    make(chan struct{}),
+	}
+}
+
+// defers reports whether the jobs of the rule's excess events are delayed
+// rather than held back. Jobs POSTed to a webhook_url cannot be delayed.
+func (l *repoRateLimiter) defers(rule *FilterRule) bool {
+	return l.policy == rateLimitDefer && rule.WebhookURL == ""
+}
+
+// take takes a token of the repository and returns 0, or returns how long
+// until the repository has one if it has none. With borrow, the token is
+// taken anyway, so later events wait for it to be paid back.
+func (l *repoRateLimiter) take(repo string, now time.Time, borrow bool) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[repo]
+	if !ok {
+		if len(l.buckets) >= rateLimitSweepSize {
+			l.sweep(now)
+		}
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[repo] = bucket
+	}
+	if elapsed := now.Sub(bucket.updated); elapsed > 0 {
+		bucket.tokens = min(l.burst, bucket.tokens+elapsed.Seconds()*l.rate)
+		bucket.updated = now
+	}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	if borrow {
+		bucket.tokens--
+	}
+	return wait
+}
+
+// sweep forgets the buckets that are full again, as they are the same as new
+// ones
+func (l *repoRateLimiter) sweep(now time.Time) {
+	for repo, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, repo)
+		}
+	}
+}
+
+// hold keeps the event until the wait is over, replacing the event of the
+// same repository and ref held before, and reports whether an event was
+// replaced. Once the limiter stopped on shutdown, the event is not held, so
+// it must be dispatched right away.
+func (l *repoRateLimiter) hold(ctx context.Context, event GitHubEvent, wait time.Duration) (held, replaced bool) {
+	key := event.Repository.FullName + " " + event.MatchRef()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return false, false
+	}
+	_, replaced = l.held[key]
+	l.held[key] = &heldEvent{id: eventID(ctx), event: event}
+	if !replaced {
+		l.timers[key] = time.AfterFunc(wait, func() { l.releaseHeld(key) })
+	}
+	return true, replaced
+}
+
+// releaseHeld dispatches the event held under the key
+func (l *repoRateLimiter) releaseHeld(key string) {
+	l.mu.Lock()
+	held, ok := l.held[key]
+	delete(l.held, key)
+	delete(l.timers, key)
+	ctx := l.ctx
+	if ok {
+		l.releasing.Add(1)
+	}
+	l.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	defer l.releasing.Done()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	l.dispatch(ctx, held)
+}
+
+// dispatch releases a held event with the ID it was received with. It is
+// dispatched even if the context is cancelled, as it cannot be redelivered.
+func (l *repoRateLimiter) dispatch(ctx context.Context, held *heldEvent) {
+	ctx = withRateLimitReleased(withExistingEventID(context.WithoutCancel(ctx), held.id))
+	l.release(ctx, held.event)
+}
+
+// run releases the held events until the context is cancelled, then
+// dispatches those still held and stops holding events
+func (l *repoRateLimiter) run(ctx context.Context) {
+	defer close(l.done)
+
+	l.mu.Lock()
+	l.ctx = ctx
+	l.mu.Unlock()
+
+	<-ctx.Done()
+
+	l.mu.Lock()
+	l.stopped = true
+	for key, timer := range l.timers {
+		timer.Stop()
+		delete(l.timers, key)
+	}
+	held := l.held
+	l.held = make(map[string]*heldEvent)
+	l.mu.Unlock()
+
+	if len(held) > 0 {
+		logInfo("Dispatching %d event(s) held back by RATE_LIMIT_PER_REPO on shutdown", len(held))
+	}
+	for _, event := range held {
+		l.dispatch(ctx, event)
+	}
+	l.releasing.Wait()
+}
+
+// wait blocks until the held events were dispatched after shutdown
+func (l *repoRateLimiter) wait() {
+	<-l.done
+}
+
+// dispatchHeld dispatches an event the rate limit held back. Its message was
+// already acknowledged, so a failure is only logged and audited.
+func (d *Dispatcher) dispatchHeld(ctx context.Context, event GitHubEvent) {
+	ctx, cancel := withMessageDeadline(ctx, d.config.MessageTimeout)
+	defer cancel()
+	if _, _, err := d.dispatch(ctx, event); err != nil && !errors.Is(err, errJobsDropped) {
+		logErrorContext(ctx, "Failed to dispatch %s event held back by RATE_LIMIT_PER_REPO: %v", event.Type(), err)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_RateLimit(t *testing.T) {
+	config := loadConfig()
+
+	if config.RateLimitPerRepo != 0 {
+		t.Errorf("Expected RateLimitPerRepo to be 0, got %v", config.RateLimitPerRepo)
+	}
+	if config.RateLimitBurst != 10 {
+		t.Errorf("Expected RateLimitBurst to be 10, got %d", config.RateLimitBurst)
+	}
+	if config.RateLimitPolicy != rateLimitDefer {
+		t.Errorf("Expected RateLimitPolicy to be '%s', got '%s'", rateLimitDefer, config.RateLimitPolicy)
+	}
+
+	os.Setenv("RATE_LIMIT_PER_REPO", "0.5")
+	os.Setenv("RATE_LIMIT_BURST", "3")
+	os.Setenv("RATE_LIMIT_POLICY", "Coalesce")
+	defer os.Unsetenv("RATE_LIMIT_PER_REPO")
+	defer os.Unsetenv("RATE_LIMIT_BURST")
+	defer os.Unsetenv("RATE_LIMIT_POLICY")
+
+	config = loadConfig()
+	if config.RateLimitPerRepo != 0.5 {
+		t.Errorf("Expected RateLimitPerRepo to be 0.5, got %v", config.RateLimitPerRepo)
+	}
+	if config.RateLimitBurst != 3 {
+		t.Errorf("Expected RateLimitBurst to be 3, got %d", config.RateLimitBurst)
+	}
+	if config.RateLimitPolicy != rateLimitCoalesce {
+		t.Errorf("Expected RateLimitPolicy to be '%s', got '%s'", rateLimitCoalesce, config.RateLimitPolicy)
+	}
+	if err := validateRateLimitConfig(config); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+}
+
+func TestValidateRateLimitConfig(t *testing.T) {
+	if err := validateRateLimitConfig(Config{RateLimitBurst: 0, RateLimitPolicy: "throttle"}); err != nil {
+		t.Errorf("Expected the disabled rate limit to be valid, got %v", err)
+	}
+
+	for name, config := range map[string]Config{
+		"negative rate":     {RateLimitPerRepo: -1},
+		"no burst":          {RateLimitPerRepo: 1, RateLimitBurst: 0, RateLimitPolicy: rateLimitDefer},
+		"invalid policy":    {RateLimitPerRepo: 1, RateLimitBurst: 1, RateLimitPolicy: "drop"},
+		"defer to a broker": {RateLimitPerRepo: 1, RateLimitBurst: 1, RateLimitPolicy: rateLimitDefer, OutputMode: outputModeNATS},
+	} {
+		if err := validateRateLimitConfig(config); err == nil {
+			t.Errorf("Expected error for %s, got nil", name)
+		}
+	}
+}
+
+func TestRepoRateLimiter_Take(t *testing.T) {
+	limiter := newRepoRateLimiter(Config{RateLimitPerRepo: 2, RateLimitBurst: 2, RateLimitPolicy: rateLimitDefer}, nil)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if wait := limiter.take("owner/repo", now, false); wait != 0 {
+			t.Fatalf("Expected event %d of the burst to pass, got a wait of %s", i, wait)
+		}
+	}
+	if wait := limiter.take("owner/repo", now, false); wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms, got %s", wait)
+	}
+	if wait := limiter.take("owner/other", now, false); wait != 0 {
+		t.Errorf("Expected another repository to have its own bucket, got a wait of %s", wait)
+	}
+
+	// Borrowed tokens are paid back in turn
+	if wait := limiter.take("owner/repo", now, true); wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms, got %s", wait)
+	}
+	if wait := limiter.take("owner/repo", now, true); wait != time.Second {
+		t.Errorf("Expected to wait 1s, got %s", wait)
+	}
+	if wait := limiter.take("owner/repo", now.Add(1500*time.Millisecond), false); wait != 0 {
+		t.Errorf("Expected a token after the borrowed ones were paid back, got a wait of %s", wait)
+	}
+
+	if newRepoRateLimiter(Config{}, nil) != nil {
+		t.Error("Expected no rate limiter without RATE_LIMIT_PER_REPO")
+	}
+}
+
+func TestDispatch_RateLimitCoalesce(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline", RateLimitPerRepo: 20, RateLimitBurst: 1, RateLimitPolicy: rateLimitCoalesce}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	sink := &recordingSink{}
+	d.sink = sink
+	audit := &recordingAuditLog{}
+	d.auditLog = audit
+
+	type release struct {
+		id  string
+		sha string
+	}
+	released := make(chan release, 1)
+	d.rateLimit.release = func(ctx context.Context, event GitHubEvent) {
+		released <- release{id: eventID(ctx), sha: event.CommitSHA()}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.rateLimit.run(ctx)
+
+	coalesced := coalescedEvents.Load()
+	for _, sha := range []string{"aaa", "bbb", "ccc"} {
+		if err := d.handleWebhookMessage(withEventID(ctx), `{"ref":"refs/heads/main","after":"`+sha+`","repository":{"full_name":"owner/repo"}}`); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+
+	if len(sink.jobs) != 1 {
+		t.Fatalf("Expected only the first event to be dispatched right away, got %d job(s)", len(sink.jobs))
+	}
+	if len(audit.records) != 3 || audit.records[1].Decision != auditHeld || audit.records[2].Decision != auditHeld {
+		t.Fatalf("Expected the other events to be held, got %+v", audit.records)
+	}
+	if got := coalescedEvents.Load() - coalesced; got != 1 {
+		t.Errorf("Expected 1 coalesced event, got %d", got)
+	}
+
+	select {
+	case r := <-released:
+		if r.sha != "ccc" || r.id != audit.records[2].EventID {
+			t.Errorf("Expected the latest event to be released with its ID, got %+v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the held event to be released")
+	}
+}
+
+func TestRepoRateLimiter_DispatchesHeldOnShutdown(t *testing.T) {
+	type release struct {
+		id       string
+		released bool
+		live     bool
+	}
+	released := make(chan release, 2)
+	limiter := newRepoRateLimiter(Config{RateLimitPerRepo: 1, RateLimitBurst: 1, RateLimitPolicy: rateLimitCoalesce}, func(ctx context.Context, event GitHubEvent) {
+		released <- release{id: eventID(ctx), released: rateLimitReleased(ctx), live: ctx.Err() == nil}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		limiter.run(ctx)
+	}()
+
+	event := GitHubEvent{Ref: "refs/heads/main"}
+	event.Repository.FullName = "owner/repo"
+	if held, _ := limiter.hold(withExistingEventID(ctx, "held"), event, time.Hour); !held {
+		t.Fatal("Expected the event to be held")
+	}
+	cancel()
+	<-done
+
+	select {
+	case r := <-released:
+		if r.id != "held" || !r.released || !r.live {
+			t.Errorf("Expected the held event to be released on shutdown with its ID, got %+v", r)
+		}
+	default:
+		t.Fatal("Expected the held event to be dispatched on shutdown")
+	}
+	limiter.wait()
+
+	// Events are no longer held once the limiter stopped
+	if held, _ := limiter.hold(ctx, event, time.Hour); held {
+		t.Error("Expected no event to be held after shutdown")
+	}
+}
+
+func TestDispatch_RateLimitReleased(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline", RateLimitPerRepo: 0.001, RateLimitBurst: 1, RateLimitPolicy: rateLimitCoalesce}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	sink := &recordingSink{}
+	d.sink = sink
+	event := GitHubEvent{Ref: "refs/heads/main"}
+	event.Repository.FullName = "owner/repo"
+
+	// The burst is used up, but a released event is dispatched anyway and
+	// takes the next token
+	d.rateLimit.take("owner/repo", time.Now(), false)
+	if _, _, err := d.dispatch(withRateLimitReleased(context.Background()), event); err != nil {
+		t.Fatalf("Failed to dispatch released event: %v", err)
+	}
+	if len(sink.jobs) != 1 {
+		t.Fatalf("Expected the released event to be dispatched, got %d job(s)", len(sink.jobs))
+	}
+	if wait := d.rateLimit.take("owner/repo", time.Now(), false); wait < 1500*time.Second {
+		t.Errorf("Expected the released event to take a token, got a wait of %s", wait)
+	}
+	if len(d.rateLimit.held) != 0 {
+		t.Errorf("Expected the released event not to be held again, got %d held", len(d.rateLimit.held))
+	}
+}
+
+func TestDispatch_RateLimitDeferIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	queue, delayed := "test-ratelimit-pipeline", "test-ratelimit-delayed"
+	rdb.Del(ctx, queue, delayed)
+	defer rdb.Del(ctx, queue, delayed)
+
+	config := Config{
+		OutputMode:        outputModeList,
+		QueuePushCommand:  queuePushRight,
+		PipelineQueueName: queue,
+		DelayedQueueName:  delayed,
+		RateLimitPerRepo:  1,
+		RateLimitBurst:    1,
+		RateLimitPolicy:   rateLimitDefer,
+	}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(rdb, config, rules)
+
+	deferred := deferredEvents.Load()
+	for _, sha := range []string{"aaa", "bbb", "ccc"} {
+		if err := d.handleWebhookMessage(ctx, `{"ref":"refs/heads/main","after":"`+sha+`","repository":{"full_name":"owner/repo"}}`); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+
+	if n := rdb.LLen(ctx, queue).Val(); n != 1 {
+		t.Errorf("Expected 1 job enqueued right away, got %d", n)
+	}
+	scores, err := rdb.ZRangeWithScores(ctx, delayed, 0, -1).Result()
+	if err != nil || len(scores) != 2 {
+		t.Fatalf("Expected 2 deferred jobs, got %v (%v)", scores, err)
+	}
+	if spread := scores[1].Score - scores[0].Score; spread < 900 {
+		t.Errorf("Expected the deferred jobs to be spread by about a second, got %vms", spread)
+	}
+	if got := deferredEvents.Load() - deferred; got != 2 {
+		t.Errorf("Expected 2 deferred events, got %d", got)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// reaperReadBatch is the number of queued jobs read per request while
+// looking for expired jobs
+const reaperReadBatch = 500
+
+// jobExpired reports whether the serialized job carries an expires_at that
+// has passed at now. Jobs without an expiry never expire.
+func jobExpired(job string, now time.Time) bool {
+	var stamped struct {
+		ExpiresAt string `json:"expires_at"`
+	}
+	if err := json.Unmarshal([]byte(job), &stamped); err != nil || stamped.ExpiresAt == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, stamped.ExpiresAt)
+	if err != nil {
+		return false
+	}
+	return now.After(expiresAt)
+}
+
+// runQueueReaper removes expired jobs from the pipeline queue every
+// QUEUE_REAPER_INTERVAL until the context is cancelled
+func runQueueReaper(ctx context.Context, rdb redis.UniversalClient, config Config) {
+	if config.OutputMode == outputModeStream {
+		logWarn("Queue reaper disabled: OUTPUT_MODE '%s' has no pipeline queue", config.OutputMode)
+		return
+	}
+	if strings.Contains(config.PipelineQueueName, "{{") {
+		logWarn("Queue reaper disabled: PIPELINE_QUEUE_NAME '%s' is a template", config.PipelineQueueName)
+		return
+	}
+
+	ticker := time.NewTicker(config.QueueReaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reaped, err := reapExpiredJobs(ctx, rdb, config, time.Now())
+			if err != nil {
+				if ctx.Err() == nil {
+					logError("Failed to reap expired jobs: %v", err)
+				}
+				continue
+			}
+			if reaped > 0 {
+				logWarn("Removed %d expired job(s) from queue '%s'", reaped, config.PipelineQueueName)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reapExpiredJobs removes the jobs whose expires_at has passed at now from the
+// pipeline queue list, or sorted set in priority mode
+func reapExpiredJobs(ctx context.Context, rdb redis.UniversalClient, config Config, now time.Time) (int, error) {
+	sorted := config.OutputMode == outputModeSorted
+
+	var expired []string
+	for start := int64(0); ; start += reaperReadBatch {
+		stop := start + reaperReadBatch - 1
+
+		var jobs []string
+		var err error
+		if sorted {
+			jobs, err = rdb.ZRange(ctx, config.PipelineQueueName, start, stop).Result()
+		} else {
+			jobs, err = rdb.LRange(ctx, config.PipelineQueueName, start, stop).Result()
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read queue '%s': %w", config.PipelineQueueName, err)
+		}
+
+		for _, job := range jobs {
+			if jobExpired(job, now) {
+				expired = append(expired, job)
+			}
+		}
+		if len(jobs) < reaperReadBatch {
+			break
+		}
+	}
+
+	reaped := 0
+	for _, job := range expired {
+		var removed int64
+		var err error
+		if sorted {
+			removed, err = rdb.ZRem(ctx, config.PipelineQueueName, job).Result()
+		} else {
+			removed, err = rdb.LRem(ctx, config.PipelineQueueName, 1, job).Result()
+		}
+		if err != nil {
+			return reaped, fmt.Errorf("failed to remove expired job from queue '%s': %w", config.PipelineQueueName, err)
+		}
+		// Jobs consumed in the meantime are simply no longer there
+		reaped += int(removed)
+	}
+	return reaped, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestJobExpired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		job      string
+		expected bool
+	}{
+		{"expired", `{"job_id":"1","expires_at":"2024-05-01T11:59:59Z"}`, true},
+		{"not yet expired", `{"job_id":"1","expires_at":"2024-05-01T12:00:01Z"}`, false},
+		{"no expiry", `{"job_id":"1"}`, false},
+		{"invalid expiry", `{"job_id":"1","expires_at":"tomorrow"}`, false},
+		{"not a job", `not json`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := jobExpired(tt.job, now); result != tt.expected {
+				t.Errorf("jobExpired(%s) = %v, expected %v", tt.job, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_TTL(t *testing.T) {
+	config := loadConfig()
+
+	if config.JobTTL != 0 {
+		t.Errorf("Expected JobTTL to be 0, got %s", config.JobTTL)
+	}
+	if config.QueueReaperInterval != 0 {
+		t.Errorf("Expected QueueReaperInterval to be 0, got %s", config.QueueReaperInterval)
+	}
+
+	os.Setenv("JOB_TTL", "24h")
+	os.Setenv("QUEUE_REAPER_INTERVAL", "5m")
+	defer os.Unsetenv("JOB_TTL")
+	defer os.Unsetenv("QUEUE_REAPER_INTERVAL")
+
+	config = loadConfig()
+
+	if config.JobTTL != 24*time.Hour {
+		t.Errorf("Expected JobTTL to be 24h, got %s", config.JobTTL)
+	}
+	if config.QueueReaperInterval != 5*time.Minute {
+		t.Errorf("Expected QueueReaperInterval to be 5m, got %s", config.QueueReaperInterval)
+	}
+}
+
+func TestReapExpiredJobs_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:        outputModeList,
+		PipelineQueueName: "test-pipeline-reaper",
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.PipelineQueueName)
+	defer rdb.Del(ctx, config.PipelineQueueName)
+
+	now := time.Now()
+	stale := `{"job_id":"stale","expires_at":"` + now.Add(-time.Hour).UTC().Format(time.RFC3339) + `"}`
+	fresh := `{"job_id":"fresh","expires_at":"` + now.Add(time.Hour).UTC().Format(time.RFC3339) + `"}`
+	rdb.RPush(ctx, config.PipelineQueueName, stale, fresh, `{"job_id":"forever"}`)
+
+	reaped, err := reapExpiredJobs(ctx, rdb, config, now)
+	if err != nil {
+		t.Fatalf("Failed to reap expired jobs: %v", err)
+	}
+	if reaped != 1 {
+		t.Errorf("Expected 1 reaped job, got %d", reaped)
+	}
+
+	queued := rdb.LRange(ctx, config.PipelineQueueName, 0, -1).Val()
+	if len(queued) != 2 || queued[0] != fresh {
+		t.Errorf("Expected only the fresh and unexpiring jobs to remain, got %v", queued)
+	}
+}
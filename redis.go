@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedisClient creates the Redis client for the configured deployment: a
+// cluster client when cluster addresses are configured, a Sentinel-backed
+// failover client when sentinel addresses are configured, otherwise a client
+// for a single Redis server, given by REDIS_URL when set
+// redisTimeouts counts the Redis commands that timed out after
+// REDIS_OP_TIMEOUT
+var redisTimeouts atomic.Int64
+
+func newRedisClient(config Config) (redis.UniversalClient, error) {
+	tlsConfig, err := newRedisTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.RedisURL != "" {
+		return newRedisURLClient(config, tlsConfig)
+	}
+
+	if len(config.RedisClusterAddrs) > 0 {
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     config.RedisClusterAddrs,
+			Username:  config.RedisUsername,
+			Password:  config.RedisPassword,
+			TLSConfig: tlsConfig,
+
+			CredentialsProvider: redisCredentials(config),
+
+			PoolSize:     config.RedisPoolSize,
+			MinIdleConns: config.RedisMinIdleConns,
+			DialTimeout:  config.RedisDialTimeout,
+			ReadTimeout:  config.RedisReadTimeout,
+			WriteTimeout: config.RedisWriteTimeout,
+		}), nil
+	}
+
+	if len(config.RedisSentinelAddrs) > 0 {
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       config.RedisMasterName,
+			SentinelAddrs:    config.RedisSentinelAddrs,
+			SentinelPassword: config.RedisSentinelPassword,
+			Username:         config.RedisUsername,
+			Password:         config.RedisPassword,
+			DB:               config.RedisDB,
+			TLSConfig:        tlsConfig,
+
+			CredentialsProvider: redisCredentials(config),
+
+			PoolSize:     config.RedisPoolSize,
+			MinIdleConns: config.RedisMinIdleConns,
+			DialTimeout:  config.RedisDialTimeout,
+			ReadTimeout:  config.RedisReadTimeout,
+			WriteTimeout: config.RedisWriteTimeout,
+		}), nil
+	}
+
+	return redis.NewClient(&redis.Options{
+		Network:   config.RedisNetwork,
+		Addr:      redisAddr(config),
+		Username:  config.RedisUsername,
+		Password:  config.RedisPassword,
+		DB:        config.RedisDB,
+		TLSConfig: tlsConfig,
+
+		CredentialsProvider: redisCredentials(config),
+
+		PoolSize:     config.RedisPoolSize,
+		MinIdleConns: config.RedisMinIdleConns,
+		DialTimeout:  config.RedisDialTimeout,
+		ReadTimeout:  config.RedisReadTimeout,
+		WriteTimeout: config.RedisWriteTimeout,
+	}), nil
+}
+
+// newRedisURLClient creates a client for the server, credentials and database
+// given by REDIS_URL. REDIS_TLS_* settings (e.g. a private CA) apply on top of
+// a rediss:// URL, and the pool and timeout settings override the URL's
+// options when set.
+func newRedisURLClient(config Config, tlsConfig *tls.Config) (redis.UniversalClient, error) {
+	opts, err := redis.ParseURL(config.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse REDIS_URL: %w", err)
+	}
+
+	if tlsConfig != nil {
+		if opts.TLSConfig != nil && tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = opts.TLSConfig.ServerName
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	if config.RedisPoolSize > 0 {
+		opts.PoolSize = config.RedisPoolSize
+	}
+	if config.RedisMinIdleConns > 0 {
+		opts.MinIdleConns = config.RedisMinIdleConns
+	}
+	if config.RedisDialTimeout > 0 {
+		opts.DialTimeout = config.RedisDialTimeout
+	}
+	if config.RedisReadTimeout > 0 {
+		opts.ReadTimeout = config.RedisReadTimeout
+	}
+	if config.RedisWriteTimeout > 0 {
+		opts.WriteTimeout = config.RedisWriteTimeout
+	}
+
+	return redis.NewClient(opts), nil
+}
+
+// newRedisTLSConfig builds the TLS settings for Redis connections, or returns
+// nil when TLS is disabled. The server name is REDIS_TLS_SERVER_NAME, or
+// taken from each dialed address.
+func newRedisTLSConfig(config Config) (*tls.Config, error) {
+	if !config.RedisTLSEnabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.RedisTLSServerName,
+		InsecureSkipVerify: config.RedisTLSInsecureSkipVerify,
+	}
+
+	if config.RedisTLSCAFile != "" {
+		caCert, err := os.ReadFile(config.RedisTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in Redis TLS CA file %s", config.RedisTLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.RedisTLSCertFile != "" {
+		certificate := &clientCertificate{certFile: config.RedisTLSCertFile, keyFile: config.RedisTLSKeyFile}
+		if err := certificate.load(); err != nil {
+			return nil, fmt.Errorf("failed to load Redis TLS client certificate: %w", err)
+		}
+		tlsConfig.GetClientCertificate = certificate.get
+	}
+
+	return tlsConfig, nil
+}
+
+// clientCertificate is the client certificate presented to Redis. It is
+// reloaded when its files change, so short-lived certificates can be rotated
+// on disk, e.g. by cert-manager, without restarting the dispatcher.
+type clientCertificate struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+// load reads the certificate and its key if either file changed since they
+// were read last
+func (c *clientCertificate) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTime, err := latestModTime(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	if c.certificate != nil && modTime.Equal(c.modTime) {
+		return nil
+	}
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.certificate, c.modTime = &certificate, modTime
+	return nil
+}
+
+// get returns the certificate for a new connection. When a rotated
+// certificate cannot be loaded, e.g. because only one of the files was
+// replaced yet, the previous one is presented.
+func (c *clientCertificate) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if err := c.load(); err != nil {
+		logWarn("Failed to reload the Redis TLS client certificate, presenting the previous one: %v", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.certificate, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// redisAddr returns the address of a single Redis server: the socket path
+// for Unix socket connections, otherwise host:port
+func redisAddr(config Config) string {
+	if config.RedisNetwork == "unix" {
+		return config.RedisSocketPath
+	}
+	return fmt.Sprintf("%s:%s", config.RedisHost, config.RedisPort)
+}
+
+func validateRedisConfig(config Config) error {
+	switch config.RedisNetwork {
+	case "", "tcp":
+	case "unix":
+		if config.RedisSocketPath == "" {
+			return fmt.Errorf("REDIS_SOCKET_PATH is required when REDIS_NETWORK is unix")
+		}
+		if len(config.RedisClusterAddrs) > 0 || len(config.RedisSentinelAddrs) > 0 {
+			return fmt.Errorf("REDIS_NETWORK unix cannot be used with REDIS_CLUSTER_ADDRS or REDIS_SENTINEL_ADDRS")
+		}
+	default:
+		return fmt.Errorf("unknown REDIS_NETWORK '%s', expected tcp or unix", config.RedisNetwork)
+	}
+	if config.RedisURL != "" {
+		if _, err := redis.ParseURL(config.RedisURL); err != nil {
+			return fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		if len(config.RedisClusterAddrs) > 0 || len(config.RedisSentinelAddrs) > 0 {
+			return fmt.Errorf("REDIS_URL cannot be used with REDIS_CLUSTER_ADDRS or REDIS_SENTINEL_ADDRS")
+		}
+		if config.RedisNetwork == "unix" {
+			return fmt.Errorf("REDIS_URL cannot be used with REDIS_NETWORK unix, use a unix:// URL instead")
+		}
+	}
+	if config.RedisPoolSize < 0 || config.RedisMinIdleConns < 0 {
+		return fmt.Errorf("REDIS_POOL_SIZE and REDIS_MIN_IDLE_CONNS must not be negative")
+	}
+	if config.RedisDB < 0 {
+		return fmt.Errorf("REDIS_DB must not be negative, got %d", config.RedisDB)
+	}
+	if len(config.RedisClusterAddrs) > 0 && config.RedisDB != 0 {
+		return fmt.Errorf("REDIS_DB cannot be used with REDIS_CLUSTER_ADDRS, Redis Cluster only supports database 0")
+	}
+	if len(config.RedisClusterAddrs) > 0 && len(config.RedisSentinelAddrs) > 0 {
+		return fmt.Errorf("REDIS_CLUSTER_ADDRS and REDIS_SENTINEL_ADDRS cannot both be set")
+	}
+	if len(config.RedisSentinelAddrs) > 0 && config.RedisMasterName == "" {
+		return fmt.Errorf("REDIS_MASTER_NAME is required when REDIS_SENTINEL_ADDRS is set")
+	}
+	if (config.RedisTLSCertFile == "") != (config.RedisTLSKeyFile == "") {
+		return fmt.Errorf("REDIS_TLS_CERT_FILE and REDIS_TLS_KEY_FILE must be set together")
+	}
+	if !config.RedisTLSEnabled && (config.RedisTLSCAFile != "" || config.RedisTLSCertFile != "" || config.RedisTLSServerName != "") {
+		return fmt.Errorf("REDIS_TLS_CA_FILE, REDIS_TLS_CERT_FILE and REDIS_TLS_SERVER_NAME require REDIS_TLS_ENABLED")
+	}
+	if config.RedisTLSInsecureSkipVerify && (config.RedisTLSCAFile != "" || config.RedisTLSServerName != "") {
+		return fmt.Errorf("REDIS_TLS_INSECURE_SKIP_VERIFY cannot be used with REDIS_TLS_CA_FILE or REDIS_TLS_SERVER_NAME, which would not be verified")
+	}
+	if config.RedisOpTimeout < 0 {
+		return fmt.Errorf("REDIS_OP_TIMEOUT must not be negative, got %s", config.RedisOpTimeout)
+	}
+	return nil
+}
+
+// redisTimeoutHook bounds every Redis command and pipeline by
+// REDIS_OP_TIMEOUT, so a hung Redis node fails the operation, which is
+// logged and retried by its caller, instead of blocking the handler.
+// Blocking commands wait on purpose and are bounded by the read timeout,
+// which go-redis extends by their block time.
+type redisTimeoutHook struct {
+	timeout time.Duration
+}
+
+func (h redisTimeoutHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h redisTimeoutHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if blockingCommand(cmd) {
+			return next(ctx, cmd)
+		}
+		opCtx, cancel := context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+		err := next(opCtx, cmd)
+		h.logTimeout(ctx, cmd.Name(), err)
+		return err
+	}
+}
+
+func (h redisTimeoutHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		opCtx, cancel := context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+		err := next(opCtx, cmds)
+		h.logTimeout(ctx, "pipeline", err)
+		return err
+	}
+}
+
+// logTimeout logs an operation that failed because of REDIS_OP_TIMEOUT
+// rather than the deadline of the caller
+func (h redisTimeoutHook) logTimeout(ctx context.Context, name string, err error) {
+	if !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		return
+	}
+	timeouts := redisTimeouts.Add(1)
+	logWarnContext(ctx, "Redis %s timed out after %s (%d timeout(s) in total)", name, h.timeout, timeouts)
+}
+
+// blockingCommand reports whether the command blocks on the server until
+// data is available
+func blockingCommand(cmd redis.Cmder) bool {
+	switch cmd.Name() {
+	case "blpop", "brpop", "brpoplpush", "blmove", "blmpop", "bzpopmin", "bzpopmax", "bzmpop", "wait":
+		return true
+	case "xread", "xreadgroup":
+		for _, arg := range cmd.Args() {
+			if s, ok := arg.(string); ok && strings.EqualFold(s, "block") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func describeRedis(config Config) string {
+	var description string
+	switch {
+	case len(config.RedisClusterAddrs) > 0:
+		description = fmt.Sprintf("cluster %s", strings.Join(config.RedisClusterAddrs, ","))
+	case len(config.RedisSentinelAddrs) > 0:
+		description = fmt.Sprintf("sentinel master '%s' via %s", config.RedisMasterName, strings.Join(config.RedisSentinelAddrs, ","))
+	case config.RedisURL != "":
+		description = redactRedisURL(config.RedisURL)
+	case config.RedisNetwork == "unix":
+		description = fmt.Sprintf("unix:%s", config.RedisSocketPath)
+	default:
+		description = redisAddr(config)
+	}
+	if config.RedisDB != 0 {
+		description += fmt.Sprintf(" db %d", config.RedisDB)
+	}
+	if config.RedisTLSEnabled {
+		description += " (TLS)"
+	}
+	return description
+}
+
+// redactRedisURL returns the URL without its credentials, so it can be logged
+func redactRedisURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid REDIS_URL)"
+	}
+	u.User = nil
+	return u.String()
+}
+
+// splitList splits a comma-separated setting into its trimmed, non-empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
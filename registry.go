@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redis/go-redis/v9"
+)
+
+// EventSource reads webhook payloads from an input and passes them to the
+// handler until the context is cancelled
+type EventSource interface {
+	consume(ctx context.Context, handle messageHandler) error
+}
+
+// JobSink writes serialized jobs to an output, to the queues or, when none
+// are given, to PIPELINE_QUEUE_NAME
+type JobSink interface {
+	enqueue(ctx context.Context, config Config, queues []string, priority int, jobs [][]byte) error
+}
+
+// clients are the connections sources and sinks are created with; only the
+// connections the configured modes need are set
+type clients struct {
+	rdb        redis.UniversalClient
+	js         jetstream.JetStream
+	amqp       *amqpPublisher
+	mqtt       mqtt.Client
+	servicebus *azservicebus.Client
+}
+
+// connectBrokers opens the connections to the NATS, AMQP, MQTT and Service
+// Bus brokers the input and output modes need, and returns a function closing
+// them. The Redis connection is left to the caller.
+func connectBrokers(config Config, inputMode, outputMode string) (clients, func(), error) {
+	var c clients
+	var closers []func()
+	closeAll := func() {
+		for _, closer := range slices.Backward(closers) {
+			closer()
+		}
+	}
+
+	if inputMode == inputModeNATS || outputMode == outputModeNATS {
+		nc, js, err := connectNATS(config)
+		if err != nil {
+			return clients{}, nil, fmt.Errorf("failed to connect to NATS: %w", err)
+		}
+		closers = append(closers, nc.Close)
+		c.js = js
+		logInfo("Successfully connected to NATS at %s", nc.ConnectedUrlRedacted())
+	}
+
+	if outputMode == outputModeAMQP {
+		publisher := newAMQPPublisher(config)
+		if err := publisher.open(); err != nil {
+			closeAll()
+			return clients{}, nil, fmt.Errorf("failed to connect to AMQP broker: %w", err)
+		}
+		closers = append(closers, publisher.close)
+		c.amqp = publisher
+	}
+
+	if inputMode == inputModeMQTT || outputMode == outputModeMQTT {
+		client, err := connectMQTT(config)
+		if err != nil {
+			closeAll()
+			return clients{}, nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+		}
+		// Give in-flight acknowledgements a moment to be sent
+		closers = append(closers, func() { client.Disconnect(250) })
+		c.mqtt = client
+		logInfo("Successfully connected to MQTT broker at %s", redactMQTTURL(config.MQTTBrokerURL))
+	}
+
+	if outputMode == outputModeServiceBus {
+		client, err := newServiceBusClient(config)
+		if err != nil {
+			closeAll()
+			return clients{}, nil, fmt.Errorf("failed to create Service Bus client: %w", err)
+		}
+		closers = append(closers, func() { client.Close(context.Background()) })
+		c.servicebus = client
+	}
+	return c, closeAll, nil
+}
+
+type (
+	sourceFactory func(config Config, c clients) EventSource
+	sinkFactory   func(config Config, c clients) JobSink
+)
+
+// eventSources and jobSinks map the INPUT_MODE and OUTPUT_MODE values to the
+// factories registered for them
+var (
+	eventSources = map[string]sourceFactory{}
+	jobSinks     = map[string]sinkFactory{}
+)
+
+// registerEventSource makes an input selectable with INPUT_MODE
+func registerEventSource(mode string, factory sourceFactory) {
+	if _, ok := eventSources[mode]; ok {
+		panic(fmt.Sprintf("input mode '%s' registered twice", mode))
+	}
+	eventSources[mode] = factory
+}
+
+// registerJobSink makes an output selectable with OUTPUT_MODE
+func registerJobSink(mode string, factory sinkFactory) {
+	if _, ok := jobSinks[mode]; ok {
+		panic(fmt.Sprintf("output mode '%s' registered twice", mode))
+	}
+	jobSinks[mode] = factory
+}
+
+func validateInputMode(mode string) error {
+	if _, ok := eventSources[mode]; !ok {
+		return fmt.Errorf("unknown input mode '%s', expected one of %s", mode, registeredModes(eventSources))
+	}
+	return nil
+}
+
+func validateOutputMode(mode string) error {
+	if _, ok := jobSinks[mode]; !ok {
+		return fmt.Errorf("unknown output mode '%s', expected one of %s", mode, registeredModes(jobSinks))
+	}
+	return nil
+}
+
+// newEventSource returns the source of the configured INPUT_MODE
+func newEventSource(config Config, c clients) (EventSource, error) {
+	if err := validateInputMode(config.InputMode); err != nil {
+		return nil, err
+	}
+	return eventSources[config.InputMode](config, c), nil
+}
+
+// newJobSink returns the sink of the configured OUTPUT_MODE
+func newJobSink(config Config, c clients) (JobSink, error) {
+	if err := validateOutputMode(config.OutputMode); err != nil {
+		return nil, err
+	}
+	return jobSinks[config.OutputMode](config, c), nil
+}
+
+func registeredModes[F any](factories map[string]F) string {
+	modes := make([]string, 0, len(factories))
+	for mode := range factories {
+		modes = append(modes, mode)
+	}
+	slices.Sort(modes)
+	return strings.Join(modes, ", ")
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordingSink keeps the jobs enqueued to it
+type recordingSink struct {
+	queues [][]string
+	jobs   [][]byte
+}
+
+func (s *recordingSink) enqueue(ctx context.Context, config Config, queues []string, priority int, jobs [][]byte) error {
+	s.queues = append(s.queues, queues)
+	s.jobs = append(s.jobs, jobs...)
+	return nil
+}
+
+// payloadSource passes a fixed list of payloads to the handler
+type payloadSource struct {
+	payloads []string
+}
+
+func (s *payloadSource) consume(ctx context.Context, handle messageHandler) error {
+	for _, payload := range s.payloads {
+		if err := handle(ctx, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestValidateInputMode(t *testing.T) {
+	for _, mode := range []string{inputModePubSub, inputModeStream, inputModeNATS, inputModeFile} {
+		if err := validateInputMode(mode); err != nil {
+			t.Errorf("Expected input mode '%s' to be valid, got %v", mode, err)
+		}
+	}
+
+	err := validateInputMode("kafka")
+	if err == nil {
+		t.Fatal("Expected error for unknown input mode, got nil")
+	}
+	if !strings.Contains(err.Error(), "nats, pubsub, stream") {
+		t.Errorf("Expected the error to list the input modes, got %v", err)
+	}
+}
+
+func TestNewJobSink(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected string
+	}{
+		{outputModeList, "*main.redisSink"},
+		{outputModeStream, "*main.redisSink"},
+		{outputModeBoth, "*main.redisSink"},
+		{outputModeSorted, "*main.redisSink"},
+		{outputModeNATS, "*main.natsSink"},
+		{outputModeAMQP, "*main.amqpPublisher"},
+	}
+
+	c := clients{amqp: newAMQPPublisher(Config{})}
+	for _, tt := range tests {
+		sink, err := newJobSink(Config{OutputMode: tt.mode}, c)
+		if err != nil {
+			t.Errorf("Failed to create sink for output mode '%s': %v", tt.mode, err)
+			continue
+		}
+		if fmt.Sprintf("%T", sink) != tt.expected {
+			t.Errorf("Expected %s for output mode '%s', got %s", tt.expected, tt.mode, fmt.Sprintf("%T", sink))
+		}
+	}
+
+	if _, err := newJobSink(Config{OutputMode: "kafka"}, c); err == nil {
+		t.Error("Expected error for unknown output mode, got nil")
+	}
+}
+
+func TestNewEventSource(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected string
+	}{
+		{inputModePubSub, "*main.pubSubSource"},
+		{inputModeStream, "*main.streamSource"},
+		{inputModeNATS, "*main.natsSource"},
+		{inputModeFile, "*main.fileSource"},
+	}
+
+	for _, tt := range tests {
+		source, err := newEventSource(Config{InputMode: tt.mode}, clients{})
+		if err != nil {
+			t.Errorf("Failed to create source for input mode '%s': %v", tt.mode, err)
+			continue
+		}
+		if fmt.Sprintf("%T", source) != tt.expected {
+			t.Errorf("Expected %s for input mode '%s', got %s", tt.expected, tt.mode, fmt.Sprintf("%T", source))
+		}
+	}
+}
+
+func TestRegisterEventSource(t *testing.T) {
+	source := &payloadSource{payloads: []string{`{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`}}
+	registerEventSource("test", func(config Config, c clients) EventSource { return source })
+	defer delete(eventSources, "test")
+
+	created, err := newEventSource(Config{InputMode: "test"}, clients{})
+	if err != nil {
+		t.Fatalf("Failed to create registered source: %v", err)
+	}
+	if created != source {
+		t.Error("Expected the registered source to be created")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering an input mode twice to panic")
+		}
+	}()
+	registerEventSource("test", func(config Config, c clients) EventSource { return source })
+}
+
+func TestDispatcher_EnqueuesToSink(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline", JobSchemaVersion: currentJobSchemaVersion}
+	rules := []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+
+	sink := &recordingSink{}
+	d := newDispatcher(nil, config, rules)
+	d.sink = sink
+
+	source := &payloadSource{payloads: []string{
+		`{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`,
+		`{"ref":"refs/heads/develop","repository":{"full_name":"owner/repo"}}`,
+	}}
+	if err := source.consume(context.Background(), d.handleWebhookMessage); err != nil {
+		t.Fatalf("Failed to handle webhooks: %v", err)
+	}
+
+	if len(sink.jobs) != 1 {
+		t.Fatalf("Expected 1 job in the sink, got %d", len(sink.jobs))
+	}
+	if !strings.Contains(string(sink.jobs[0]), `"commands":["make build"]`) {
+		t.Errorf("Expected the job of the matching rule, got %s", sink.jobs[0])
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const inputModeFile = "file"
+
+// replayStdin is the INPUT_FILE replaying payloads from standard input
+const replayStdin = "-"
+
+// maxReplayLine bounds the size of a recorded webhook payload
+const maxReplayLine = 16 * 1024 * 1024
+
+func init() {
+	registerEventSource(inputModeFile, func(config Config, c clients) EventSource {
+		return &fileSource{path: config.InputFile}
+	})
+}
+
+// fileSource replays recorded webhook payloads, one JSON document per line
+// (NDJSON), from INPUT_FILE or, for "-", from standard input. Unlike the other
+// inputs it returns once every payload was handled.
+type fileSource struct {
+	path string
+}
+
+func (s *fileSource) consume(ctx context.Context, handle messageHandler) error {
+	var r io.Reader = os.Stdin
+	if s.path != replayStdin {
+		f, err := os.Open(s.path)
+		if err != nil {
+			return fmt.Errorf("failed to open replay file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	inputActive.Store(true)
+	defer inputActive.Store(false)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLine)
+
+	replayed, failed := 0, 0
+	for line := 1; scanner.Scan(); line++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+		payload := strings.TrimSpace(scanner.Text())
+		if payload == "" {
+			continue
+		}
+
+		replayed++
+		lineCtx := withEventID(ctx)
+		if err := handle(lineCtx, payload); err != nil {
+			failed++
+			logErrorContext(lineCtx, "Error handling line %d of %s: %v", line, s.describe(), err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", s.describe(), err)
+	}
+
+	logInfo("Replayed %d webhook(s) from %s, %d failed", replayed, s.describe(), failed)
+	return nil
+}
+
+func (s *fileSource) describe() string {
+	if s.path == replayStdin {
+		return "standard input"
+	}
+	return fmt.Sprintf("'%s'", s.path)
+}
+
+// replayMatches prints what dispatching every payload of INPUT_FILE would do,
+// one JSON match result per line, without dispatching anything
+func replayMatches(ctx context.Context, d *Dispatcher, out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	source := &fileSource{path: d.config.InputFile}
+	return source.consume(ctx, func(ctx context.Context, payload string) error {
+		rules := d.rulesFor(ctx)
+		ctx = withRuleSet(ctx, rules)
+		if rules.verifySignatures {
+			envelope, err := verifySignature(d.config, rules.rules, d.secrets, payload)
+			if err != nil {
+				return encoder.Encode(matchResult{Reason: err.Error()})
+			}
+			payload = envelope.Body
+		}
+
+		var event GitHubEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			return fmt.Errorf("failed to parse webhook payload: %w", err)
+		}
+		result, err := d.match(ctx, event)
+		if err != nil {
+			return err
+		}
+		return encoder.Encode(result)
+	})
+}
+
+// parseFlags applies the command line flags to the configuration and reports
+// whether matches are only printed (--dry-run)
+func parseFlags(config *Config, args []string) (bool, error) {
+	flags := flag.NewFlagSet("github-dispatcher", flag.ContinueOnError)
+	input := flags.String("input", "", "input to read webhooks from instead of INPUT_MODE: a mode, file:PATH to replay recorded webhooks (NDJSON), or stdin")
+	dryRun := flags.Bool("dry-run", false, "print the match result of every replayed webhook instead of dispatching it")
+	replayFrom := flags.String("replay-from", "", "replay the webhooks archived since this time (RFC 3339) instead of reading INPUT_MODE")
+	replayTo := flags.String("replay-to", "", "with --replay-from, replay the webhooks archived until this time (RFC 3339)")
+	replayDelivery := flags.String("replay-delivery", "", "replay the archived webhooks of this GitHub delivery ID instead of reading INPUT_MODE")
+	verifyAudit := flags.String("verify-audit", "", "verify the signatures of the audit records of file:PATH, stdin or stream with AUDIT_HMAC_KEY and exit")
+	showVersion := flags.Bool("version", false, "print the version, commit and build date and exit")
+	if err := flags.Parse(args); err != nil {
+		return false, err
+	}
+	if *showVersion {
+		return false, errVersionRequested
+	}
+	if *verifyAudit != "" {
+		if *verifyAudit != "stdin" && *verifyAudit != auditSinkStream && !strings.HasPrefix(*verifyAudit, inputModeFile+":") {
+			return false, fmt.Errorf("invalid --verify-audit '%s', must be file:PATH, stdin or stream", *verifyAudit)
+		}
+		if config.AuditHMACKey == "" {
+			return false, errors.New("--verify-audit requires AUDIT_HMAC_KEY")
+		}
+		config.AuditVerify = *verifyAudit
+		return false, nil
+	}
+
+	switch {
+	case *input == "stdin":
+		config.InputMode = inputModeFile
+		config.InputFile = replayStdin
+	case strings.HasPrefix(*input, inputModeFile+":"):
+		config.InputMode = inputModeFile
+		config.InputFile = strings.TrimPrefix(*input, inputModeFile+":")
+	case *input != "":
+		config.InputMode = *input
+	}
+
+	if *replayFrom != "" || *replayTo != "" || *replayDelivery != "" {
+		if *input != "" {
+			return false, errors.New("--replay-from, --replay-to and --replay-delivery cannot be combined with --input")
+		}
+		query, err := parseArchiveQuery(*replayFrom, *replayTo, *replayDelivery)
+		if err != nil {
+			return false, err
+		}
+		config.InputMode = inputModeArchive
+		config.ArchiveReplay = query
+	}
+	if config.InputMode == inputModeArchive && config.ArchiveReplay == (archiveQuery{}) {
+		return false, errors.New("the archive input requires --replay-from or --replay-delivery")
+	}
+
+	if config.InputMode == inputModeFile && config.InputFile == "" {
+		return false, errors.New("the file input requires INPUT_FILE or --input file:PATH")
+	}
+	if *dryRun && config.InputMode != inputModeFile {
+		return false, errors.New("--dry-run requires the file input (--input file:PATH or --input stdin)")
+	}
+	return *dryRun, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_InputFile(t *testing.T) {
+	config := loadConfig()
+
+	if config.InputFile != "" {
+		t.Errorf("Expected InputFile to be empty, got '%s'", config.InputFile)
+	}
+
+	os.Setenv("INPUT_FILE", "events.ndjson")
+	defer os.Unsetenv("INPUT_FILE")
+
+	config = loadConfig()
+
+	if config.InputFile != "events.ndjson" {
+		t.Errorf("Expected InputFile to be 'events.ndjson', got '%s'", config.InputFile)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		args     []string
+		mode     string
+		file     string
+		dryRun   bool
+		hasError bool
+	}{
+		{nil, inputModePubSub, "", false, false},
+		{[]string{"--input", "file:events.ndjson"}, inputModeFile, "events.ndjson", false, false},
+		{[]string{"--input", "stdin", "--dry-run"}, inputModeFile, "-", true, false},
+		{[]string{"--input=stream"}, inputModeStream, "", false, false},
+		{[]string{"--dry-run"}, inputModePubSub, "", false, true},
+		{[]string{"--input", "file:"}, inputModeFile, "", false, true},
+		{[]string{"--unknown"}, inputModePubSub, "", false, true},
+		{[]string{"--replay-delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958"}, inputModeArchive, "", false, false},
+		{[]string{"--replay-from", "2026-10-16T09:00:00Z", "--replay-to", "2026-10-16T10:00:00Z"}, inputModeArchive, "", false, false},
+		{[]string{"--replay-to", "2026-10-16T10:00:00Z"}, inputModePubSub, "", false, true},
+		{[]string{"--replay-from", "yesterday"}, inputModePubSub, "", false, true},
+		{[]string{"--input", "stream", "--replay-delivery", "abc"}, inputModePubSub, "", false, true},
+		{[]string{"--input", inputModeArchive}, inputModePubSub, "", false, true},
+	}
+
+	for _, tt := range tests {
+		config := Config{InputMode: inputModePubSub}
+		dryRun, err := parseFlags(&config, tt.args)
+		if (err != nil) != tt.hasError {
+			t.Errorf("parseFlags(%v) error = %v, expected error: %v", tt.args, err, tt.hasError)
+			continue
+		}
+		if tt.hasError {
+			continue
+		}
+		if config.InputMode != tt.mode || config.InputFile != tt.file || dryRun != tt.dryRun {
+			t.Errorf("parseFlags(%v) = (%s, '%s', %v), expected (%s, '%s', %v)", tt.args, config.InputMode, config.InputFile, dryRun, tt.mode, tt.file, tt.dryRun)
+		}
+	}
+}
+
+func writeReplayFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write replay file: %v", err)
+	}
+	return path
+}
+
+func TestFileSource(t *testing.T) {
+	path := writeReplayFile(t, `{"n":1}`, "", `{"n":2}`, `{"n":3}`)
+
+	var handled []string
+	handle := func(ctx context.Context, payload string) error {
+		handled = append(handled, payload)
+		if payload == `{"n":2}` {
+			return errors.New("failed")
+		}
+		return nil
+	}
+
+	// A failing payload does not stop the replay
+	if err := (&fileSource{path: path}).consume(context.Background(), handle); err != nil {
+		t.Fatalf("Failed to replay file: %v", err)
+	}
+	if len(handled) != 3 || handled[2] != `{"n":3}` {
+		t.Errorf("Expected the 3 payloads in order, got %v", handled)
+	}
+
+	if err := (&fileSource{path: filepath.Join(t.TempDir(), "missing.ndjson")}).consume(context.Background(), handle); err == nil {
+		t.Error("Expected error for a missing file, got nil")
+	}
+}
+
+func TestReplayMatches(t *testing.T) {
+	path := writeReplayFile(t,
+		`{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`,
+		`{"ref":"refs/heads/develop","repository":{"full_name":"owner/repo"}}`,
+	)
+
+	config := Config{PipelineQueueName: "pipeline", InputMode: inputModeFile, InputFile: path}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+
+	var out bytes.Buffer
+	if err := replayMatches(context.Background(), newDispatcher(nil, config, rules), &out); err != nil {
+		t.Fatalf("Failed to replay matches: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one result per webhook, got %q", out.String())
+	}
+
+	var matched, unmatched matchResult
+	json.Unmarshal([]byte(lines[0]), &matched)
+	json.Unmarshal([]byte(lines[1]), &unmatched)
+
+	if !matched.Matched || matched.RuleID != "build" || len(matched.Jobs) != 1 || matched.Queues[0] != "pipeline" {
+		t.Errorf("Expected the first webhook to match rule 'build', got %s", lines[0])
+	}
+	if unmatched.Matched || unmatched.Reason == "" || unmatched.Ref != "refs/heads/develop" {
+		t.Errorf("Expected the second webhook not to match, got %s", lines[1])
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// enqueueRetries counts the pushes of jobs that were retried after failing
+var enqueueRetries atomic.Int64
+
+// enqueueRetry is how failed pushes of jobs are retried: up to retries times,
+// waiting backoff and twice as long for every further retry, each wait
+// randomly lengthened or shortened by up to the jitter fraction
+type enqueueRetry struct {
+	retries int
+	backoff time.Duration
+	jitter  float64
+}
+
+func newEnqueueRetry(config Config) enqueueRetry {
+	return enqueueRetry{
+		retries: config.EnqueueRetries,
+		backoff: config.EnqueueRetryBackoff,
+		jitter:  config.EnqueueRetryJitter,
+	}
+}
+
+func validateEnqueueRetryConfig(config Config) error {
+	if config.EnqueueRetries < 0 {
+		return fmt.Errorf("ENQUEUE_RETRIES must not be negative, got %d", config.EnqueueRetries)
+	}
+	if config.EnqueueRetryBackoff < 0 {
+		return fmt.Errorf("ENQUEUE_RETRY_BACKOFF must not be negative, got %s", config.EnqueueRetryBackoff)
+	}
+	if config.EnqueueRetryJitter < 0 || config.EnqueueRetryJitter > 1 {
+		return fmt.Errorf("ENQUEUE_RETRY_JITTER must be between 0 and 1, got %g", config.EnqueueRetryJitter)
+	}
+	return nil
+}
+
+// do calls push until it succeeds or the retries are exhausted, returning the
+// last error. Jobs dropped by backpressure are not retried, and neither are
+// pushes while the circuit breaker is open or once the context is cancelled. onRetry, if not nil, is called before
+// the first retry.
+func (r enqueueRetry) do(ctx context.Context, push func() error, onRetry func()) error {
+	for attempt := 0; ; attempt++ {
+		err := push()
+		if err == nil || errors.Is(err, errJobsDropped) || errors.Is(err, errCircuitOpen) || attempt >= r.retries || ctx.Err() != nil {
+			return err
+		}
+		if attempt == 0 && onRetry != nil {
+			onRetry()
+		}
+
+		delay := r.delay(attempt)
+		enqueueRetries.Add(1)
+		logWarnContext(ctx, "Failed to enqueue jobs, retrying in %s (retry %d of %d): %v", delay.Round(time.Millisecond), attempt+1, r.retries, err)
+		sleepContext(ctx, delay)
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+func (r enqueueRetry) delay(attempt int) time.Duration {
+	delay := r.backoff
+	for i := 0; i < attempt && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if r.jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + r.jitter*(2*rand.Float64()-1)))
+	}
+	return delay
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_EnqueueRetry(t *testing.T) {
+	config := loadConfig()
+
+	if config.EnqueueRetries != 3 {
+		t.Errorf("Expected EnqueueRetries to be 3, got %d", config.EnqueueRetries)
+	}
+	if config.EnqueueRetryBackoff != 100*time.Millisecond {
+		t.Errorf("Expected EnqueueRetryBackoff to be 100ms, got %s", config.EnqueueRetryBackoff)
+	}
+	if config.EnqueueRetryJitter != 0.2 {
+		t.Errorf("Expected EnqueueRetryJitter to be 0.2, got %g", config.EnqueueRetryJitter)
+	}
+	if config.DeadLetterQueue != "" {
+		t.Errorf("Expected DeadLetterQueue to be empty, got '%s'", config.DeadLetterQueue)
+	}
+
+	os.Setenv("ENQUEUE_RETRIES", "5")
+	os.Setenv("ENQUEUE_RETRY_BACKOFF", "1s")
+	os.Setenv("ENQUEUE_RETRY_JITTER", "0.5")
+	os.Setenv("DEAD_LETTER_QUEUE", "pipeline-dead")
+	defer os.Unsetenv("ENQUEUE_RETRIES")
+	defer os.Unsetenv("ENQUEUE_RETRY_BACKOFF")
+	defer os.Unsetenv("ENQUEUE_RETRY_JITTER")
+	defer os.Unsetenv("DEAD_LETTER_QUEUE")
+
+	config = loadConfig()
+	if config.EnqueueRetries != 5 {
+		t.Errorf("Expected EnqueueRetries to be 5, got %d", config.EnqueueRetries)
+	}
+	if config.EnqueueRetryBackoff != time.Second {
+		t.Errorf("Expected EnqueueRetryBackoff to be 1s, got %s", config.EnqueueRetryBackoff)
+	}
+	if config.EnqueueRetryJitter != 0.5 {
+		t.Errorf("Expected EnqueueRetryJitter to be 0.5, got %g", config.EnqueueRetryJitter)
+	}
+	if config.DeadLetterQueue != "pipeline-dead" {
+		t.Errorf("Expected DeadLetterQueue to be 'pipeline-dead', got '%s'", config.DeadLetterQueue)
+	}
+}
+
+func TestValidateEnqueueRetryConfig(t *testing.T) {
+	valid := Config{EnqueueRetries: 3, EnqueueRetryBackoff: 100 * time.Millisecond, EnqueueRetryJitter: 0.2}
+	if err := validateEnqueueRetryConfig(valid); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+
+	for _, config := range []Config{
+		{EnqueueRetries: -1},
+		{EnqueueRetryBackoff: -time.Second},
+		{EnqueueRetryJitter: 1.5},
+	} {
+		if err := validateEnqueueRetryConfig(config); err == nil {
+			t.Errorf("Expected error for %+v, got nil", config)
+		}
+	}
+}
+
+// flakySink fails the first failures pushes
+type flakySink struct {
+	recordingSink
+	failures int
+	attempts int
+}
+
+func (s *flakySink) enqueue(ctx context.Context, config Config, queues []string, priority int, jobs [][]byte) error {
+	s.attempts++
+	if s.attempts <= s.failures {
+		return errors.New("connection reset by peer")
+	}
+	return s.recordingSink.enqueue(ctx, config, queues, priority, jobs)
+}
+
+func TestDispatch_RetriesFailedPush(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline", EnqueueRetries: 3, EnqueueRetryBackoff: time.Millisecond, EnqueueRetryJitter: 0.2}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	sink := &flakySink{failures: 2}
+	d.sink = sink
+
+	before := enqueueRetries.Load()
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+	if err := d.handleWebhookMessage(context.Background(), payload); err != nil {
+		t.Fatalf("Expected the push to succeed once retried, got %v", err)
+	}
+	if sink.attempts != 3 || len(sink.jobs) != 1 {
+		t.Errorf("Expected 1 job pushed on the third attempt, got %d job(s) after %d attempt(s)", len(sink.jobs), sink.attempts)
+	}
+	if retried := enqueueRetries.Load() - before; retried != 2 {
+		t.Errorf("Expected 2 retries to be counted, got %d", retried)
+	}
+}
+
+func TestDispatch_FailsAfterRetries(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline", EnqueueRetries: 2, EnqueueRetryBackoff: time.Millisecond}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	sink := &flakySink{failures: 10}
+	d.sink = sink
+
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+	if err := d.handleWebhookMessage(context.Background(), payload); err == nil {
+		t.Fatal("Expected the dispatch to fail once the retries are exhausted")
+	}
+	if sink.attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", sink.attempts)
+	}
+}
+
+func TestEnqueueRetry_DoesNotRetryDroppedJobs(t *testing.T) {
+	retry := enqueueRetry{retries: 3, backoff: time.Millisecond}
+	attempts := 0
+	err := retry.do(context.Background(), func() error {
+		attempts++
+		return errJobsDropped
+	}, nil)
+	if !errors.Is(err, errJobsDropped) || attempts != 1 {
+		t.Errorf("Expected dropped jobs to fail after 1 attempt, got %v after %d", err, attempts)
+	}
+}
+
+func TestEnqueueRetry_Delay(t *testing.T) {
+	retry := enqueueRetry{retries: 5, backoff: 100 * time.Millisecond}
+	for attempt, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		if delay := retry.delay(attempt); delay != expected {
+			t.Errorf("Expected retry %d to wait %s, got %s", attempt+1, expected, delay)
+		}
+	}
+
+	retry.jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := retry.delay(1); delay < 100*time.Millisecond || delay > 300*time.Millisecond {
+			t.Fatalf("Expected the jittered wait to be between 100ms and 300ms, got %s", delay)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// rotatingFile appends to a file that is rotated once it exceeds maxSize
+// bytes and, with a non-zero interval, on the first write of every interval
+// (e.g. daily at midnight UTC for 24h), keeping maxBackups older files as
+// path.1 (the newest) to path.N. Each Write is kept whole in one file.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	interval   time.Duration
+	file       *os.File
+	size       int64
+
+	// period is the start of the interval the file was last written in
+	period time.Time
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int, interval time.Duration) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups, interval: interval}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open file '%s': %w", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open file '%s': %w", f.path, err)
+	}
+	f.file, f.size = file, info.Size()
+	// A file last written in an earlier interval, before a restart, is
+	// rotated on the next write
+	f.period = f.truncate(info.ModTime())
+	return nil
+}
+
+func (f *rotatingFile) truncate(t time.Time) time.Time {
+	if f.interval <= 0 {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(f.interval)
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	period := f.truncate(time.Now())
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxSize || !period.Equal(f.period)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	f.period = period
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("failed to write file '%s': %w", f.path, err)
+	}
+	return n, nil
+}
+
+// rotate renames the current file to path.1, shifting the older backups and
+// removing the oldest, and opens a new file. Writes keep being appended to
+// the current file when it cannot be renamed.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close file '%s': %w", f.path, err)
+	}
+
+	var err error
+	if f.maxBackups == 0 {
+		err = os.Remove(f.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+		for i := f.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		}
+		err = os.Rename(f.path, f.path+".1")
+	}
+	if openErr := f.open(); openErr != nil {
+		return openErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rotate file '%s': %w", f.path, err)
+	}
+	return nil
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile_Interval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dispatcher.log")
+	if err := os.WriteFile(path, []byte("yesterday\n"), 0o640); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+	yesterday := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(path, yesterday, yesterday); err != nil {
+		t.Fatalf("Failed to set the modification time: %v", err)
+	}
+
+	file, err := openRotatingFile(path, 1<<20, 1, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	// The file written before the restart is rotated on the first write,
+	// later writes of the same day are appended
+	for _, line := range []string{"today\n", "again\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	for name, want := range map[string]string{path: "today\nagain\n", path + ".1": "yesterday\n"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", filepath.Base(name), err)
+		}
+		if string(data) != want {
+			t.Errorf("Expected %q in %s, got %q", want, filepath.Base(name), data)
+		}
+	}
+}
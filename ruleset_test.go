@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestSwapRules_KeepsSnapshot(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline"}
+	d := newDispatcher(nil, config, []FilterRule{{ID: "old", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}})
+
+	var event GitHubEvent
+	json.Unmarshal([]byte(`{"ref":"refs/heads/main","after":"abc123","repository":{"full_name":"owner/repo"}}`), &event)
+
+	// A message that started before the swap keeps its snapshot
+	ctx := context.Background()
+	pinned := withRuleSet(ctx, d.rulesFor(ctx))
+	d.swapRules([]FilterRule{{ID: "new", Repo: "owner/repo", Branch: "refs/heads/main", WebhookSecret: "secret", Commands: []Command{{Run: "make test"}}}})
+
+	result, err := d.match(pinned, event)
+	if err != nil {
+		t.Fatalf("Failed to match: %v", err)
+	}
+	if result.RuleID != "old" {
+		t.Errorf("Expected the pinned message to match the old rule, got '%s'", result.RuleID)
+	}
+	if d.rulesFor(pinned).verifySignatures {
+		t.Error("Expected the pinned snapshot not to verify signatures")
+	}
+
+	result, err = d.match(ctx, event)
+	if err != nil {
+		t.Fatalf("Failed to match: %v", err)
+	}
+	if result.RuleID != "new" {
+		t.Errorf("Expected a new message to match the new rule, got '%s'", result.RuleID)
+	}
+	if !d.rulesFor(ctx).verifySignatures {
+		t.Error("Expected the new snapshot to verify signatures of the rule's secret")
+	}
+}
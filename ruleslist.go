@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+)
+
+// rulesCommand is the subcommand printing the rules of CONFIG_FILE_PATH:
+// github-dispatcher rules list [--repo owner/x]
+const rulesCommand = "rules"
+
+// runRulesCommand runs a rules subcommand; list is the only one
+func runRulesCommand(config Config, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "list" {
+		return fmt.Errorf("usage: github-dispatcher %s list [--repo owner/repo]", rulesCommand)
+	}
+	flags := flag.NewFlagSet("github-dispatcher "+rulesCommand+" list", flag.ContinueOnError)
+	repo := flags.String("repo", "", "only list the rules of this repository; may be a pattern such as owner/*")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if _, err := path.Match(*repo, ""); err != nil {
+		return fmt.Errorf("invalid --repo '%s': %w", *repo, err)
+	}
+
+	rules, err := loadVerifiedFilterRules(config)
+	if err != nil {
+		return err
+	}
+	return writeRulesTable(out, config, rules, *repo)
+}
+
+// writeRulesTable prints the rules, in the order they are matched, as a
+// table, keeping those of the repositories matching the pattern, if any
+func writeRulesTable(out io.Writer, config Config, rules []FilterRule, repo string) error {
+	allowlist := newRepoAllowlist(config)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tREPO\tBRANCH\tEVENTS\tQUEUE\tENABLED")
+	for i, rule := range rules {
+		if matched, _ := path.Match(repo, rule.Repo); repo != "" && !matched {
+			continue
+		}
+		queues := rule.Queues
+		if len(queues) == 0 {
+			queues = []string{config.PipelineQueueName}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", rule.ID, rule.Repo, ruleBranches(&rule),
+			strings.Join(ruleEventTypes(&rule), ","), strings.Join(queues, ","), ruleEnabled(allowlist, rules[:i], &rule))
+	}
+	return w.Flush()
+}
+
+// ruleBranches describes the refs the rule matches
+func ruleBranches(rule *FilterRule) string {
+	if handlesTags(rule) {
+		return rule.Branch + "," + tagRefPrefix + "*"
+	}
+	return rule.Branch
+}
+
+// handlesTags reports whether the rule matches tag pushes
+func handlesTags(rule *FilterRule) bool {
+	return len(rule.CommandsTag) > 0 && ruleHandlesEvent(rule, eventTypePush)
+}
+
+// ruleEventTypes returns the event types the rule handles
+func ruleEventTypes(rule *FilterRule) []string {
+	var types []string
+	for _, eventType := range []string{eventTypePush, eventTypePullRequest, eventTypeReviewComment, eventTypeRelease} {
+		if ruleHandlesEvent(rule, eventType) {
+			types = append(types, eventType)
+		}
+	}
+	return types
+}
+
+// ruleEnabled tells whether the rule can fire: its repository must be
+// allowed, and an earlier rule must not match every event it handles first
+func ruleEnabled(allowlist *repoAllowlist, earlier []FilterRule, rule *FilterRule) string {
+	if !allowlist.allows(rule.Repo) {
+		return "no (repository not allowed)"
+	}
+
+	var shadowing *FilterRule
+	fires := func(eventType, ref string) bool {
+		first := findMatchingRule(earlier, eventType, rule.Repo, ref)
+		if first != nil {
+			shadowing = first
+		}
+		return first == nil
+	}
+	for _, eventType := range ruleEventTypes(rule) {
+		if fires(eventType, rule.Branch) {
+			return "yes"
+		}
+	}
+	if handlesTags(rule) && fires(eventTypePush, tagRefPrefix+"*") {
+		return "yes"
+	}
+	if shadowing == nil {
+		return "no (handles no event)"
+	}
+	return fmt.Sprintf("no (shadowed by %s)", shadowing.ID)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteRulesTable(t *testing.T) {
+	rules := []FilterRule{
+		{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}},
+		{ID: "deploy", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make deploy"}}},
+		{ID: "release", Repo: "owner/repo", Branch: "refs/heads/main", Events: []string{"push", "release"}, Queues: []string{"releases", "audit"}},
+		{ID: "tags", Repo: "owner/repo", Branch: "refs/heads/main", CommandsTag: []Command{{Run: "make publish"}}},
+		{ID: "docs", Repo: "owner/docs", Branch: "refs/heads/main", CommandsPR: []Command{{Run: "make docs"}}},
+		{ID: "other", Repo: "other/repo", Branch: "refs/heads/main"},
+	}
+	config := Config{PipelineQueueName: "pipeline", AllowedOrgs: "owner"}
+
+	var out bytes.Buffer
+	if err := writeRulesTable(&out, config, rules, ""); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 7 || strings.Join(strings.Fields(lines[0]), " ") != "ID REPO BRANCH EVENTS QUEUE ENABLED" {
+		t.Fatalf("Expected a header and 6 rules, got:\n%s", out.String())
+	}
+	for i, expected := range []string{
+		"build owner/repo refs/heads/main push pipeline yes",
+		"deploy owner/repo refs/heads/main push pipeline no (shadowed by build)",
+		"release owner/repo refs/heads/main push,release releases,audit yes",
+		"tags owner/repo refs/heads/main,refs/tags/* push pipeline yes",
+		"docs owner/docs refs/heads/main push,pull_request pipeline yes",
+		"other other/repo refs/heads/main push pipeline no (repository not allowed)",
+	} {
+		if got := strings.Join(strings.Fields(lines[i+1]), " "); got != expected {
+			t.Errorf("Expected row '%s', got '%s'", expected, got)
+		}
+	}
+
+	out.Reset()
+	writeRulesTable(&out, config, rules, "owner/d*")
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], "docs") {
+		t.Errorf("Expected only the rule of owner/docs, got:\n%s", out.String())
+	}
+}
+
+func TestRunRulesCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`[{"repo": "owner/repo", "branch": "refs/heads/main", "commands": ["make build"]}]`), 0o600)
+	config := Config{ConfigFilePath: path, PipelineQueueName: "pipeline"}
+
+	var out bytes.Buffer
+	if err := runRulesCommand(config, []string{"list", "--repo", "owner/repo"}, &out); err != nil || !strings.Contains(out.String(), "owner/repo@refs/heads/main") {
+		t.Errorf("Expected the rule to be listed, got %v:\n%s", err, out.String())
+	}
+	if err := runRulesCommand(config, []string{"show"}, &out); err == nil {
+		t.Error("Expected error for an unknown command, got nil")
+	}
+	if err := runRulesCommand(config, []string{"list", "--repo", "owner/["}, &out); err == nil {
+		t.Error("Expected error for an invalid pattern, got nil")
+	}
+}
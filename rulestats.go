@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ruleStatsMemory = "memory"
+	ruleStatsRedis  = "redis"
+)
+
+// ruleHits is how often a rule matched an event, and when it last did
+type ruleHits struct {
+	count     int64
+	lastFired time.Time
+}
+
+// ruleStats counts the events matched by each rule. The counts of this
+// process are kept in memory; with RULE_STATS_KEY_PREFIX set and Redis used,
+// the totals of all replicas are also kept in Redis, where they survive
+// restarts.
+type ruleStats struct {
+	mu   sync.Mutex
+	hits map[string]ruleHits
+
+	rdb          redis.UniversalClient
+	hitsKey      string
+	lastFiredKey string
+}
+
+func newRuleStats(rdb redis.UniversalClient, config Config) *ruleStats {
+	s := &ruleStats{hits: map[string]ruleHits{}}
+	if rdb != nil && config.RuleStatsKeyPrefix != "" {
+		s.rdb = rdb
+		s.hitsKey = config.RuleStatsKeyPrefix + "hits"
+		s.lastFiredKey = config.RuleStatsKeyPrefix + "last-fired"
+	}
+	return s
+}
+
+// hit records that the rule matched an event. Failing to update Redis does
+// not fail the dispatch.
+func (s *ruleStats) hit(ctx context.Context, ruleID string) {
+	now := time.Now()
+	s.mu.Lock()
+	hits := s.hits[ruleID]
+	hits.count++
+	hits.lastFired = now
+	s.hits[ruleID] = hits
+	s.mu.Unlock()
+
+	if s.rdb == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, s.hitsKey, ruleID, 1)
+		pipe.HSet(ctx, s.lastFiredKey, ruleID, now.UnixMilli())
+		return nil
+	})
+	if err != nil {
+		logWarnContext(ctx, "Failed to record hit of rule '%s' in Redis: %v", ruleID, err)
+	}
+}
+
+// ruleStatus is the hit count of a loaded rule. LastFired is nil for rules
+// that never matched.
+type ruleStatus struct {
+	ID        string     `json:"id"`
+	Repo      string     `json:"repo"`
+	Branch    string     `json:"branch,omitempty"`
+	Type      string     `json:"type,omitempty"`
+	Hits      int64      `json:"hits"`
+	LastFired *time.Time `json:"last_fired"`
+}
+
+// status returns the hit counts of the rules and where they come from: the
+// totals in Redis, or the counts of this process when Redis is not used or
+// cannot be read
+func (s *ruleStats) status(ctx context.Context, rules []FilterRule) ([]ruleStatus, string) {
+	hits, source := s.redisHits(ctx)
+	if hits == nil {
+		hits, source = s.memoryHits(), ruleStatsMemory
+	}
+
+	statuses := make([]ruleStatus, 0, len(rules))
+	for _, rule := range rules {
+		status := ruleStatus{ID: rule.ID, Repo: rule.Repo, Branch: rule.Branch, Type: rule.Type}
+		if h, ok := hits[rule.ID]; ok {
+			status.Hits = h.count
+			if !h.lastFired.IsZero() {
+				lastFired := h.lastFired.UTC()
+				status.LastFired = &lastFired
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, source
+}
+
+func (s *ruleStats) memoryHits() map[string]ruleHits {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hits := make(map[string]ruleHits, len(s.hits))
+	for id, h := range s.hits {
+		hits[id] = h
+	}
+	return hits
+}
+
+// redisHits reads the totals from Redis, returning nil when they are not kept
+// or cannot be read
+func (s *ruleStats) redisHits(ctx context.Context) (map[string]ruleHits, string) {
+	if s.rdb == nil {
+		return nil, ""
+	}
+	var counts, lastFired *redis.MapStringStringCmd
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		counts = pipe.HGetAll(ctx, s.hitsKey)
+		lastFired = pipe.HGetAll(ctx, s.lastFiredKey)
+		return nil
+	})
+	if err != nil {
+		logWarn("Failed to read rule hits from Redis, reporting the hits of this instance: %v", err)
+		return nil, ""
+	}
+
+	hits := map[string]ruleHits{}
+	for id, value := range counts.Val() {
+		h := hits[id]
+		h.count, _ = strconv.ParseInt(value, 10, 64)
+		hits[id] = h
+	}
+	for id, value := range lastFired.Val() {
+		h := hits[id]
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+			h.lastFired = time.UnixMilli(ms)
+		}
+		hits[id] = h
+	}
+	return hits, ruleStatsRedis
+}
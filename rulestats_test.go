@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_RuleStats(t *testing.T) {
+	config := loadConfig()
+
+	if config.RuleStatsKeyPrefix != "github-dispatcher:rules:" {
+		t.Errorf("Expected RuleStatsKeyPrefix to be 'github-dispatcher:rules:', got '%s'", config.RuleStatsKeyPrefix)
+	}
+
+	os.Setenv("RULE_STATS_KEY_PREFIX", "ci:rules:")
+	defer os.Unsetenv("RULE_STATS_KEY_PREFIX")
+
+	config = loadConfig()
+
+	if config.RuleStatsKeyPrefix != "ci:rules:" {
+		t.Errorf("Expected RuleStatsKeyPrefix to be 'ci:rules:', got '%s'", config.RuleStatsKeyPrefix)
+	}
+}
+
+// getStatus requests /status from the dispatcher's HTTP endpoints
+func getStatus(t *testing.T, d *Dispatcher) dispatcherStatus {
+	t.Helper()
+	server := httptest.NewServer(newHTTPHandler(d.config, d))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/status")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result dispatcherStatus
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	return result
+}
+
+func TestStatus_RuleHits(t *testing.T) {
+	rules := []FilterRule{
+		{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}},
+		{ID: "stale", Repo: "owner/old", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}},
+	}
+	d := newDispatcher(nil, Config{PipelineQueueName: "pipeline"}, rules)
+	d.sink = &recordingSink{}
+
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+	for i := 0; i < 2; i++ {
+		if err := d.handleWebhookMessage(context.Background(), payload); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+
+	result := getStatus(t, d)
+	if result.RuleStats != ruleStatsMemory {
+		t.Errorf("Expected the hits of this instance without Redis, got '%s'", result.RuleStats)
+	}
+	if len(result.Rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(result.Rules))
+	}
+	if build := result.Rules[0]; build.ID != "build" || build.Hits != 2 || build.LastFired == nil {
+		t.Errorf("Expected 2 hits of rule build, got %+v", build)
+	}
+	// Rules that never matched are listed too
+	if stale := result.Rules[1]; stale.ID != "stale" || stale.Hits != 0 || stale.LastFired != nil {
+		t.Errorf("Expected no hits of rule stale, got %+v", stale)
+	}
+}
+
+func TestRuleStats_RedisUnreachable(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+	stats := newRuleStats(rdb, Config{RuleStatsKeyPrefix: "test-rules:"})
+
+	// Hits are counted in memory even when Redis cannot be updated
+	ctx := context.Background()
+	stats.hit(ctx, "build")
+
+	statuses, source := stats.status(ctx, []FilterRule{{ID: "build"}})
+	if source != ruleStatsMemory || statuses[0].Hits != 1 {
+		t.Errorf("Expected 1 hit from memory, got %d from %s", statuses[0].Hits, source)
+	}
+}
+
+func TestRuleStats_Integration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{RuleStatsKeyPrefix: "test-rule-stats:"}
+	rdb.Del(ctx, "test-rule-stats:hits", "test-rule-stats:last-fired")
+	defer rdb.Del(ctx, "test-rule-stats:hits", "test-rule-stats:last-fired")
+
+	// Two replicas share their totals
+	newRuleStats(rdb, config).hit(ctx, "build")
+	stats := newRuleStats(rdb, config)
+	stats.hit(ctx, "build")
+
+	statuses, source := stats.status(ctx, []FilterRule{{ID: "build"}, {ID: "stale"}})
+	if source != ruleStatsRedis {
+		t.Errorf("Expected the totals from Redis, got '%s'", source)
+	}
+	if statuses[0].Hits != 2 || statuses[0].LastFired == nil {
+		t.Errorf("Expected 2 hits of rule build, got %+v", statuses[0])
+	}
+	if statuses[1].Hits != 0 || statuses[1].LastFired != nil {
+		t.Errorf("Expected no hits of rule stale, got %+v", statuses[1])
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+// truncationMarker ends metadata values cut at METADATA_MAX_VALUE_LENGTH
+const truncationMarker = "…"
+
+// sanitizedMetadata counts the metadata values that had control characters
+// stripped or were truncated
+var sanitizedMetadata atomic.Int64
+
+func validateMetadataConfig(config Config, rules []FilterRule) error {
+	if config.MetadataMaxValueLength < 0 || config.MetadataMaxSize < 0 {
+		return fmt.Errorf("METADATA_MAX_VALUE_LENGTH and METADATA_MAX_SIZE must not be negative")
+	}
+	if config.MetadataMaxValueLength > 0 && config.MetadataMaxValueLength < len(truncationMarker) {
+		return fmt.Errorf("METADATA_MAX_VALUE_LENGTH must be at least %d, got %d", len(truncationMarker), config.MetadataMaxValueLength)
+	}
+	if config.MetadataMaxSize == 0 {
+		return nil
+	}
+	// The static metadata of a rule alone must leave room for the event's
+	for i, rule := range rules {
+		if size := metadataSize(rule.Metadata); size > config.MetadataMaxSize {
+			return fmt.Errorf("rule %d (%s %s): metadata of %d bytes exceeds METADATA_MAX_SIZE (%d)", i, rule.Repo, rule.Branch, size, config.MetadataMaxSize)
+		}
+	}
+	return nil
+}
+
+// sanitizeMetadata strips the control characters of the metadata values of
+// the jobs, such as line breaks and bidirectional overrides, and truncates
+// them to METADATA_MAX_VALUE_LENGTH, as they may come from the event, e.g. a
+// PR title. Jobs whose metadata still exceeds METADATA_MAX_SIZE are
+// rejected.
+func sanitizeMetadata(config Config, jobs []Job) error {
+	for _, job := range jobs {
+		for key, value := range job.Metadata {
+			sanitized := sanitizeMetadataValue(value, config.MetadataMaxValueLength)
+			if sanitized != value {
+				sanitizedMetadata.Add(1)
+				job.Metadata[key] = sanitized
+			}
+		}
+		if size := metadataSize(job.Metadata); config.MetadataMaxSize > 0 && size > config.MetadataMaxSize {
+			return fmt.Errorf("metadata of job %s is %d bytes, more than METADATA_MAX_SIZE (%d)", job.ID, size, config.MetadataMaxSize)
+		}
+	}
+	return nil
+}
+
+// sanitizeMetadataValue returns the value as valid UTF-8 without control
+// characters, cut at a character boundary to at most maxLength bytes if
+// maxLength is positive
+func sanitizeMetadataValue(value string, maxLength int) string {
+	value = strings.ToValidUTF8(value, string(utf8.RuneError))
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r) {
+			return -1
+		}
+		return r
+	}, value)
+
+	if maxLength <= 0 || len(value) <= maxLength {
+		return value
+	}
+	cut := maxLength - len(truncationMarker)
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut] + truncationMarker
+}
+
+// metadataSize is the number of bytes of the keys and values of the metadata
+func metadataSize(metadata map[string]string) int {
+	size := 0
+	for key, value := range metadata {
+		size += len(key) + len(value)
+	}
+	return size
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLoadConfig_MetadataLimits(t *testing.T) {
+	config := loadConfig()
+
+	if config.MetadataMaxValueLength != 1024 {
+		t.Errorf("Expected MetadataMaxValueLength to be 1024, got %d", config.MetadataMaxValueLength)
+	}
+	if config.MetadataMaxSize != 16384 {
+		t.Errorf("Expected MetadataMaxSize to be 16384, got %d", config.MetadataMaxSize)
+	}
+
+	os.Setenv("METADATA_MAX_VALUE_LENGTH", "256")
+	os.Setenv("METADATA_MAX_SIZE", "0")
+	defer os.Unsetenv("METADATA_MAX_VALUE_LENGTH")
+	defer os.Unsetenv("METADATA_MAX_SIZE")
+
+	config = loadConfig()
+	if config.MetadataMaxValueLength != 256 {
+		t.Errorf("Expected MetadataMaxValueLength to be 256, got %d", config.MetadataMaxValueLength)
+	}
+	if config.MetadataMaxSize != 0 {
+		t.Errorf("Expected MetadataMaxSize to be 0, got %d", config.MetadataMaxSize)
+	}
+}
+
+func TestValidateMetadataConfig(t *testing.T) {
+	rules := []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main", Metadata: map[string]string{"team": "platform"}}}
+	if err := validateMetadataConfig(Config{MetadataMaxValueLength: 1024, MetadataMaxSize: 16384}, rules); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+
+	for name, config := range map[string]Config{
+		"negative value length":         {MetadataMaxValueLength: -1},
+		"negative size":                 {MetadataMaxSize: -1},
+		"value length below the marker": {MetadataMaxValueLength: 2},
+		"static metadata too large":     {MetadataMaxSize: 8},
+	} {
+		if err := validateMetadataConfig(config, rules); err == nil {
+			t.Errorf("Expected error for %s, got nil", name)
+		}
+	}
+}
+
+func TestSanitizeMetadataValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		maxLength int
+		expected  string
+	}{
+		{"plain", "Fix the build", 1024, "Fix the build"},
+		{"line breaks", "Fix\r\nthe build\t", 1024, "Fixthe build"},
+		{"escape sequences", "\x1b[31mred\x1b[0m", 1024, "[31mred[0m"},
+		{"bidirectional overrides", "access‮⁦level", 1024, "accesslevel"},
+		{"invalid UTF-8", "caf\xe9", 1024, "caf�"},
+		{"emoji", "🚀 Ship it", 1024, "🚀 Ship it"},
+		{"truncated", strings.Repeat("a", 20), 10, "aaaaaaa…"},
+		{"truncated at a character boundary", "ééééé", 8, "éé…"},
+		{"unlimited", strings.Repeat("a", 2000), 0, strings.Repeat("a", 2000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeMetadataValue(tt.value, tt.maxLength)
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+			if tt.maxLength > 0 && len(got) > tt.maxLength || !utf8.ValidString(got) {
+				t.Errorf("Expected valid UTF-8 of at most %d bytes, got %q", tt.maxLength, got)
+			}
+		})
+	}
+}
+
+func TestSanitizeMetadata_MaxSize(t *testing.T) {
+	config := Config{MetadataMaxValueLength: 100, MetadataMaxSize: 250}
+	jobs := []Job{{ID: "1", Metadata: map[string]string{"a": strings.Repeat("x", 200)}}}
+	if err := sanitizeMetadata(config, jobs); err != nil {
+		t.Errorf("Expected the truncated metadata to fit, got %v", err)
+	}
+
+	jobs = []Job{{ID: "2", Metadata: map[string]string{"a": strings.Repeat("x", 100), "b": strings.Repeat("x", 100), "c": strings.Repeat("x", 100)}}}
+	if err := sanitizeMetadata(config, jobs); err == nil {
+		t.Error("Expected error for metadata over METADATA_MAX_SIZE, got nil")
+	}
+}
+
+func TestMatch_SanitizesPRTitle(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline", JobSchemaVersion: currentJobSchemaVersion, MetadataMaxValueLength: 64, MetadataMaxSize: 16384}
+	rules := []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main", Events: []string{eventTypePullRequest}, Commands: []Command{{Run: "make test"}}}}
+	d := newDispatcher(nil, config, rules)
+
+	payload := `{"action":"opened","number":1,"pull_request":{"number":1,"title":"Fix\nbuild` + strings.Repeat("!", 100) + `","head":{"ref":"fix","sha":"abc"},"base":{"ref":"main"}},"repository":{"full_name":"owner/repo"}}`
+	var event GitHubEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+	result, err := d.match(context.Background(), event)
+	if err != nil || len(result.Jobs) != 1 {
+		t.Fatalf("Expected a job, got %+v (%v)", result, err)
+	}
+	title := result.Jobs[0].Metadata[prTitleKey]
+	if strings.Contains(title, "\n") || len(title) > 64 || !strings.HasPrefix(title, "Fixbuild!") {
+		t.Errorf("Expected a sanitized title, got %q", title)
+	}
+}
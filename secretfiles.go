@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// secretFileNames are the secrets that can be read from the file named by
+// their *_FILE variable, e.g. REDIS_PASSWORD from REDIS_PASSWORD_FILE, as
+// Kubernetes mounts secrets
+var secretFileNames = []string{"REDIS_PASSWORD", "WEBHOOK_SECRET", "OUTBOUND_WEBHOOK_SECRET", "GITHUB_TOKEN"}
+
+// secretFiles are the secrets read from files. They are read again every
+// SECRET_FILES_RELOAD_INTERVAL, so the kubelet updating a mounted secret
+// rotates it without a restart.
+type secretFiles struct {
+	// paths maps the names of the secrets to their files
+	paths  map[string]string
+	values atomic.Pointer[map[string]string]
+}
+
+// loadSecretFiles reads the secrets of the *_FILE variables that are set and
+// exports them as environment variables, so they are picked up by the
+// configuration and the ${NAME} references of the rules. It returns nil if
+// no *_FILE variable is set.
+func loadSecretFiles() (*secretFiles, error) {
+	paths := make(map[string]string)
+	for _, name := range secretFileNames {
+		path := os.Getenv(name + "_FILE")
+		if path == "" {
+			continue
+		}
+		if os.Getenv(name) != "" {
+			return nil, fmt.Errorf("%s and %s_FILE cannot both be set", name, name)
+		}
+		paths[name] = path
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	s := &secretFiles{paths: paths}
+	values, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	s.values.Store(&values)
+	for name, value := range values {
+		os.Setenv(name, value)
+	}
+	return s, nil
+}
+
+// read returns the contents of the files, without trailing line breaks
+func (s *secretFiles) read() (map[string]string, error) {
+	values := make(map[string]string, len(s.paths))
+	for name, path := range s.paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s_FILE: %w", name, err)
+		}
+		value := strings.TrimRight(string(data), "\r\n")
+		if value == "" {
+			return nil, fmt.Errorf("%s_FILE '%s' is empty", name, path)
+		}
+		// References would not be resolved again on reload
+		if isAWSReference(value) {
+			return nil, fmt.Errorf("%s_FILE '%s' must hold the secret, not an AWS reference", name, path)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// lookup returns the current value of a secret read from a file
+func (s *secretFiles) lookup(name string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	value, ok := (*s.values.Load())[name]
+	return value, ok
+}
+
+// reload reads the files again and returns the names of the secrets that
+// changed. If a file cannot be read, e.g. while it is being replaced, the
+// current secrets are kept.
+func (s *secretFiles) reload() ([]string, error) {
+	values, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for name, value := range values {
+		if previous, _ := s.lookup(name); previous != value {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	s.values.Store(&values)
+	return changed, nil
+}
+
+// watch reloads the secrets every interval until the context is done
+func (s *secretFiles) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			changed, err := s.reload()
+			if err != nil {
+				logWarn("Failed to reload the secret files, keeping the current secrets: %v", err)
+				continue
+			}
+			for _, name := range changed {
+				logInfo("Reloaded %s from %s", name, s.paths[name])
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// withFileSecrets returns the configuration with the current values of the
+// secrets read from files
+func withFileSecrets(config Config) Config {
+	if value, ok := config.SecretFiles.lookup("WEBHOOK_SECRET"); ok {
+		config.WebhookSecret = value
+	}
+	if value, ok := config.SecretFiles.lookup("OUTBOUND_WEBHOOK_SECRET"); ok {
+		config.OutboundWebhookSecret = value
+	}
+	if value, ok := config.SecretFiles.lookup("GITHUB_TOKEN"); ok {
+		config.GitHubToken = value
+	}
+	if value, ok := config.SecretFiles.lookup("REDIS_PASSWORD"); ok {
+		config.RedisPassword = value
+	}
+	return config
+}
+
+// redisCredentials returns the credentials of new Redis connections when
+// REDIS_PASSWORD is read from a file, so connections opened after a rotation
+// use the new password, or nil to use the static password
+func redisCredentials(config Config) func() (string, string) {
+	if _, ok := config.SecretFiles.lookup("REDIS_PASSWORD"); !ok {
+		return nil
+	}
+	return func() (string, string) {
+		return config.RedisUsername, withFileSecrets(config).RedisPassword
+	}
+}
+
+func validateSecretFilesConfig(config Config) error {
+	if config.SecretFilesReloadInterval < 0 {
+		return errors.New("SECRET_FILES_RELOAD_INTERVAL must not be negative")
+	}
+	if _, ok := config.SecretFiles.lookup("REDIS_PASSWORD"); ok && config.RedisURL != "" {
+		return errors.New("REDIS_PASSWORD_FILE is not used with REDIS_URL, which carries its own password")
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_SecretFilesReloadInterval(t *testing.T) {
+	config := loadConfig()
+
+	if config.SecretFilesReloadInterval != 30*time.Second {
+		t.Errorf("Expected SecretFilesReloadInterval to be 30s, got %s", config.SecretFilesReloadInterval)
+	}
+
+	os.Setenv("SECRET_FILES_RELOAD_INTERVAL", "5s")
+	defer os.Unsetenv("SECRET_FILES_RELOAD_INTERVAL")
+
+	config = loadConfig()
+	if config.SecretFilesReloadInterval != 5*time.Second {
+		t.Errorf("Expected SecretFilesReloadInterval to be 5s, got %s", config.SecretFilesReloadInterval)
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	if files, err := loadSecretFiles(); files != nil || err != nil {
+		t.Fatalf("Expected no secret files, got %v (%v)", files, err)
+	}
+
+	dir := t.TempDir()
+	webhookSecret := filepath.Join(dir, "webhook-secret")
+	token := filepath.Join(dir, "github-token")
+	os.WriteFile(webhookSecret, []byte("s3cret\n"), 0o600)
+	os.WriteFile(token, []byte("ghp_token"), 0o600)
+	os.Setenv("WEBHOOK_SECRET_FILE", webhookSecret)
+	os.Setenv("GITHUB_TOKEN_FILE", token)
+	defer os.Unsetenv("WEBHOOK_SECRET_FILE")
+	defer os.Unsetenv("GITHUB_TOKEN_FILE")
+	defer os.Unsetenv("WEBHOOK_SECRET")
+	defer os.Unsetenv("GITHUB_TOKEN")
+
+	files, err := loadSecretFiles()
+	if err != nil {
+		t.Fatalf("Failed to load secret files: %v", err)
+	}
+	config := loadConfig()
+	if config.WebhookSecret != "s3cret" || config.GitHubToken != "ghp_token" {
+		t.Errorf("Expected the secrets to be exported, got '%s' and '%s'", config.WebhookSecret, config.GitHubToken)
+	}
+	if _, ok := files.lookup("REDIS_PASSWORD"); ok {
+		t.Error("Expected REDIS_PASSWORD not to be read from a file")
+	}
+
+	// The secret is now set in the environment as well
+	if _, err := loadSecretFiles(); err == nil {
+		t.Error("Expected error for WEBHOOK_SECRET and WEBHOOK_SECRET_FILE both set, got nil")
+	}
+
+	os.Unsetenv("WEBHOOK_SECRET")
+	os.Unsetenv("GITHUB_TOKEN")
+	os.WriteFile(webhookSecret, []byte("\n"), 0o600)
+	if _, err := loadSecretFiles(); err == nil {
+		t.Error("Expected error for an empty secret file, got nil")
+	}
+}
+
+func TestSecretFiles_Reload(t *testing.T) {
+	dir := t.TempDir()
+	webhookSecret := filepath.Join(dir, "webhook-secret")
+	password := filepath.Join(dir, "redis-password")
+	os.WriteFile(webhookSecret, []byte("old-secret"), 0o600)
+	os.WriteFile(password, []byte("old-password"), 0o600)
+
+	files := &secretFiles{paths: map[string]string{"WEBHOOK_SECRET": webhookSecret, "REDIS_PASSWORD": password}}
+	values, err := files.read()
+	if err != nil {
+		t.Fatalf("Failed to read secret files: %v", err)
+	}
+	files.values.Store(&values)
+	config := Config{WebhookSecret: "old-secret", RedisUsername: "dispatcher", SecretFiles: files}
+	credentials := redisCredentials(config)
+
+	// Kubernetes replaces the files of a mounted secret
+	os.WriteFile(webhookSecret, []byte("new-secret\n"), 0o600)
+	changed, err := files.reload()
+	if err != nil || !reflect.DeepEqual(changed, []string{"WEBHOOK_SECRET"}) {
+		t.Fatalf("Expected WEBHOOK_SECRET to change, got %v (%v)", changed, err)
+	}
+	if got := withFileSecrets(config).WebhookSecret; got != "new-secret" {
+		t.Errorf("Expected the new webhook secret, got '%s'", got)
+	}
+
+	os.WriteFile(password, []byte("new-password"), 0o600)
+	if _, err := files.reload(); err != nil {
+		t.Fatalf("Failed to reload secret files: %v", err)
+	}
+	if user, pass := credentials(); user != "dispatcher" || pass != "new-password" {
+		t.Errorf("Expected new connections to use the new password, got %s:%s", user, pass)
+	}
+
+	// A file being replaced keeps the current secrets
+	os.Remove(password)
+	if _, err := files.reload(); err == nil {
+		t.Error("Expected error for a missing file, got nil")
+	}
+	if got := withFileSecrets(config).RedisPassword; got != "new-password" {
+		t.Errorf("Expected the current password to be kept, got '%s'", got)
+	}
+
+	if redisCredentials(Config{RedisPassword: "static"}) != nil {
+		t.Error("Expected the static password without REDIS_PASSWORD_FILE")
+	}
+}
+
+func TestValidateSecretFilesConfig(t *testing.T) {
+	files := &secretFiles{}
+	files.values.Store(&map[string]string{"REDIS_PASSWORD": "password"})
+
+	if err := validateSecretFilesConfig(Config{SecretFiles: files}); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateSecretFilesConfig(Config{SecretFilesReloadInterval: -time.Second}); err == nil {
+		t.Error("Expected error for a negative interval, got nil")
+	}
+	if err := validateSecretFilesConfig(Config{SecretFiles: files, RedisURL: "redis://localhost:6379"}); err == nil {
+		t.Error("Expected error for REDIS_PASSWORD_FILE with REDIS_URL, got nil")
+	}
+}
+
+func TestHandleWebhookMessage_RotatedWebhookSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhook-secret")
+	os.WriteFile(path, []byte("old-secret"), 0o600)
+	files := &secretFiles{paths: map[string]string{"WEBHOOK_SECRET": path}}
+	values, _ := files.read()
+	files.values.Store(&values)
+
+	config := Config{PipelineQueueName: "pipeline", WebhookSecret: "old-secret", SecretFiles: files}
+	rules := []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	sink := &recordingSink{}
+	d.sink = sink
+
+	os.WriteFile(path, []byte("new-secret"), 0o600)
+	if _, err := files.reload(); err != nil {
+		t.Fatalf("Failed to reload secret files: %v", err)
+	}
+
+	body := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+	ctx := context.Background()
+	for _, secret := range []string{"old-secret", "new-secret"} {
+		if err := d.handleWebhookMessage(ctx, signedEnvelope(t, sign(secret, body), body)); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+	if len(sink.jobs) != 1 {
+		t.Errorf("Expected only the webhook signed with the new secret to be dispatched, got %d job(s)", len(sink.jobs))
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// repoSecret is the webhook secret of a repository in the secret registry.
+// While it is rotated, webhooks signed with the previous secret are still
+// accepted until previous_expires_at, so GitHub and the dispatcher don't
+// have to switch at the same time.
+type repoSecret struct {
+	Secret            string    `json:"secret"`
+	Previous          string    `json:"previous,omitempty"`
+	PreviousExpiresAt time.Time `json:"previous_expires_at,omitzero"`
+}
+
+// verifying returns the secrets webhooks may be signed with at the time
+func (s repoSecret) verifying(now time.Time) []string {
+	secrets := []string{s.Secret}
+	if s.Previous != "" && now.Before(s.PreviousExpiresAt) {
+		secrets = append(secrets, s.Previous)
+	}
+	return secrets
+}
+
+func (s repoSecret) validate() error {
+	if s.Secret == "" {
+		return errors.New("secret is required")
+	}
+	if s.Previous != "" && s.PreviousExpiresAt.IsZero() {
+		return errors.New("previous_expires_at is required with a previous secret")
+	}
+	return nil
+}
+
+// secretRegistry maps repositories to their webhook secret, read from
+// WEBHOOK_SECRETS_FILE and the WEBHOOK_SECRETS_KEY hash, whose entries win.
+// It is reloaded every WEBHOOK_SECRETS_REFRESH, so rotations apply without a
+// restart.
+type secretRegistry struct {
+	rdb     redis.UniversalClient
+	file    string
+	key     string
+	secrets atomic.Pointer[map[string]repoSecret]
+}
+
+func newSecretRegistry(rdb redis.UniversalClient, config Config) *secretRegistry {
+	return &secretRegistry{rdb: rdb, file: config.WebhookSecretsFile, key: config.WebhookSecretsKey}
+}
+
+func validateSecretRegistryConfig(config Config) error {
+	if config.WebhookSecretsFile == "" && config.WebhookSecretsKey == "" {
+		return nil
+	}
+	if config.WebhookSecretsKey != "" && !usesRedis(config) {
+		return fmt.Errorf("WEBHOOK_SECRETS_KEY requires Redis, which is not used with INPUT_MODE %s and OUTPUT_MODE %s", config.InputMode, config.OutputMode)
+	}
+	if config.WebhookSecretsRefresh <= 0 {
+		return fmt.Errorf("WEBHOOK_SECRETS_REFRESH must be positive, got %s", config.WebhookSecretsRefresh)
+	}
+	return nil
+}
+
+// load reads the secrets and replaces the ones in use once all of them are
+// valid. Without a Redis client, e.g. in a dry run, only the file is read.
+func (r *secretRegistry) load(ctx context.Context) error {
+	secrets := map[string]repoSecret{}
+	if r.file != "" {
+		data, err := os.ReadFile(r.file)
+		if err != nil {
+			return fmt.Errorf("failed to read WEBHOOK_SECRETS_FILE: %w", err)
+		}
+		if err := json.Unmarshal(data, &secrets); err != nil {
+			return fmt.Errorf("failed to parse WEBHOOK_SECRETS_FILE: %w", err)
+		}
+	}
+	if r.key != "" && r.rdb != nil {
+		entries, err := r.rdb.HGetAll(ctx, r.key).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", r.key, err)
+		}
+		for repo, entry := range entries {
+			var secret repoSecret
+			if err := json.Unmarshal([]byte(entry), &secret); err != nil {
+				return fmt.Errorf("failed to parse the secret of '%s' in '%s': %w", repo, r.key, err)
+			}
+			secrets[repo] = secret
+		}
+	}
+	for repo, secret := range secrets {
+		if err := secret.validate(); err != nil {
+			return fmt.Errorf("invalid secret of '%s': %w", repo, err)
+		}
+	}
+
+	r.secrets.Store(&secrets)
+	return nil
+}
+
+// lookup returns the secret of the repository, if it is in the registry
+func (r *secretRegistry) lookup(repo string) (repoSecret, bool) {
+	if r == nil {
+		return repoSecret{}, false
+	}
+	secrets := r.secrets.Load()
+	if secrets == nil {
+		return repoSecret{}, false
+	}
+	secret, ok := (*secrets)[repo]
+	return secret, ok
+}
+
+// refresh reloads the secrets every interval until the context is done. A
+// failed reload is logged and the secrets loaded last stay in use.
+func (r *secretRegistry) refresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.load(ctx); err != nil && ctx.Err() == nil {
+				logWarn("Failed to reload the webhook secrets, keeping the current ones: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_WebhookSecrets(t *testing.T) {
+	config := loadConfig()
+
+	if config.WebhookSecretsFile != "" || config.WebhookSecretsKey != "" {
+		t.Errorf("Expected the secret registry to be disabled, got file '%s' and key '%s'", config.WebhookSecretsFile, config.WebhookSecretsKey)
+	}
+	if config.WebhookSecretsRefresh != time.Minute {
+		t.Errorf("Expected WebhookSecretsRefresh to be 1m, got %s", config.WebhookSecretsRefresh)
+	}
+
+	os.Setenv("WEBHOOK_SECRETS_FILE", "/etc/github-dispatcher/webhook-secrets.json")
+	os.Setenv("WEBHOOK_SECRETS_KEY", "github-dispatcher:webhook-secrets")
+	os.Setenv("WEBHOOK_SECRETS_REFRESH", "30s")
+	defer os.Unsetenv("WEBHOOK_SECRETS_FILE")
+	defer os.Unsetenv("WEBHOOK_SECRETS_KEY")
+	defer os.Unsetenv("WEBHOOK_SECRETS_REFRESH")
+
+	config = loadConfig()
+	if config.WebhookSecretsFile != "/etc/github-dispatcher/webhook-secrets.json" {
+		t.Errorf("Expected WebhookSecretsFile to be '/etc/github-dispatcher/webhook-secrets.json', got '%s'", config.WebhookSecretsFile)
+	}
+	if config.WebhookSecretsKey != "github-dispatcher:webhook-secrets" {
+		t.Errorf("Expected WebhookSecretsKey to be 'github-dispatcher:webhook-secrets', got '%s'", config.WebhookSecretsKey)
+	}
+	if config.WebhookSecretsRefresh != 30*time.Second {
+		t.Errorf("Expected WebhookSecretsRefresh to be 30s, got %s", config.WebhookSecretsRefresh)
+	}
+	if !verifiesSignatures(config, nil) {
+		t.Error("Expected the secret registry to enable signature verification")
+	}
+}
+
+func TestValidateSecretRegistryConfig(t *testing.T) {
+	if err := validateSecretRegistryConfig(Config{}); err != nil {
+		t.Errorf("Expected valid config without a registry, got %v", err)
+	}
+	if err := validateSecretRegistryConfig(Config{WebhookSecretsFile: "secrets.json", WebhookSecretsRefresh: time.Minute}); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateSecretRegistryConfig(Config{WebhookSecretsFile: "secrets.json"}); err == nil {
+		t.Error("Expected error for a non-positive refresh, got nil")
+	}
+	if err := validateSecretRegistryConfig(Config{WebhookSecretsKey: "secrets", WebhookSecretsRefresh: time.Minute, InputMode: "nats", OutputMode: "nats"}); err == nil {
+		t.Error("Expected error for WEBHOOK_SECRETS_KEY without Redis, got nil")
+	}
+}
+
+func TestSecretRegistry_Rotation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secrets.json")
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	os.WriteFile(file, []byte(`{
+		"owner/rotating": {"secret": "new", "previous": "old", "previous_expires_at": "`+expires+`"},
+		"owner/expired": {"secret": "new", "previous": "old", "previous_expires_at": "2020-01-01T00:00:00Z"}
+	}`), 0o600)
+
+	registry := newSecretRegistry(nil, Config{WebhookSecretsFile: file})
+	if err := registry.load(context.Background()); err != nil {
+		t.Fatalf("Failed to load secrets: %v", err)
+	}
+	rules := []FilterRule{{Repo: "owner/rotating", WebhookSecret: "rule"}}
+
+	rotating := `{"ref":"refs/heads/main","repository":{"full_name":"owner/rotating"}}`
+	expired := `{"ref":"refs/heads/main","repository":{"full_name":"owner/expired"}}`
+	other := `{"ref":"refs/heads/main","repository":{"full_name":"owner/other"}}`
+
+	tests := []struct {
+		name    string
+		payload string
+		valid   bool
+	}{
+		{"current secret", signedEnvelope(t, sign("new", rotating), rotating), true},
+		{"previous secret before it expires", signedEnvelope(t, sign("old", rotating), rotating), true},
+		{"previous secret after it expired", signedEnvelope(t, sign("old", expired), expired), false},
+		{"rule secret of a repository in the registry", signedEnvelope(t, sign("rule", rotating), rotating), false},
+		{"global secret of a repository not in the registry", signedEnvelope(t, sign("global", other), other), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifySignature(Config{WebhookSecret: "global"}, rules, registry, tt.payload)
+			if tt.valid && err != nil {
+				t.Errorf("Expected a valid signature, got %v", err)
+			} else if !tt.valid && !errors.Is(err, errInvalidSignature) {
+				t.Errorf("Expected errInvalidSignature, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSecretRegistry_KeepsSecretsOnInvalidReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secrets.json")
+	os.WriteFile(file, []byte(`{"owner/repo": {"secret": "s3cret"}}`), 0o600)
+
+	registry := newSecretRegistry(nil, Config{WebhookSecretsFile: file})
+	if err := registry.load(context.Background()); err != nil {
+		t.Fatalf("Failed to load secrets: %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"not JSON":                `{`,
+		"missing secret":          `{"owner/repo": {"previous": "old"}}`,
+		"previous without expiry": `{"owner/repo": {"secret": "new", "previous": "old"}}`,
+	} {
+		os.WriteFile(file, []byte(content), 0o600)
+		if err := registry.load(context.Background()); err == nil {
+			t.Errorf("Expected error for %s, got nil", name)
+		}
+	}
+	if secret, ok := registry.lookup("owner/repo"); !ok || secret.Secret != "s3cret" {
+		t.Errorf("Expected the secret loaded last to stay in use, got %+v", secret)
+	}
+}
+
+func TestSecretRegistry_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	file := filepath.Join(t.TempDir(), "secrets.json")
+	os.WriteFile(file, []byte(`{"owner/repo": {"secret": "from-file"}, "owner/other": {"secret": "other"}}`), 0o600)
+	config := Config{WebhookSecretsFile: file, WebhookSecretsKey: "test-webhook-secrets"}
+
+	// Clean up before test
+	rdb.Del(ctx, config.WebhookSecretsKey)
+	defer rdb.Del(ctx, config.WebhookSecretsKey)
+	rdb.HSet(ctx, config.WebhookSecretsKey, "owner/repo", `{"secret":"from-redis"}`)
+
+	registry := newSecretRegistry(rdb, config)
+	if err := registry.load(ctx); err != nil {
+		t.Fatalf("Failed to load secrets: %v", err)
+	}
+	if secret, _ := registry.lookup("owner/repo"); secret.Secret != "from-redis" {
+		t.Errorf("Expected the Redis entry to win, got '%s'", secret.Secret)
+	}
+	if secret, _ := registry.lookup("owner/other"); secret.Secret != "other" {
+		t.Errorf("Expected the file entry, got '%s'", secret.Secret)
+	}
+}
+
+func TestHandleWebhookMessage_SignsWithRegistrySecret(t *testing.T) {
+	var signatures, bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signatures = append(signatures, r.Header.Get(outboundSignatureHeader))
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "secrets.json")
+	os.WriteFile(file, []byte(`{"owner/repo": {"secret": "s3cret"}}`), 0o600)
+	config := Config{
+		PipelineQueueName:      "pipeline",
+		JobSchemaVersion:       currentJobSchemaVersion,
+		OutboundWebhookSecret:  "global",
+		OutboundWebhookTimeout: time.Second,
+		WebhookSecretsFile:     file,
+	}
+	rules := []FilterRule{{
+		Repo:        "owner/repo",
+		Branch:      "refs/heads/main",
+		Commands:    []Command{{Run: "make build"}},
+		WebhookURL:  server.URL,
+		WebhookOnly: true,
+	}}
+
+	d := newDispatcher(nil, config, rules)
+	if err := d.secrets.load(context.Background()); err != nil {
+		t.Fatalf("Failed to load secrets: %v", err)
+	}
+	body := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+	if err := d.handleWebhookMessage(context.Background(), signedEnvelope(t, sign("s3cret", body), body)); err != nil {
+		t.Fatalf("Failed to handle webhook: %v", err)
+	}
+	if len(bodies) != 1 || !validSignature("s3cret", bodies[0], signatures[0]) {
+		t.Errorf("Expected the delivery to be signed with the registry secret, got %v", signatures)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// selfCheckPings is the number of round trips the Redis latency is averaged
+// over
+const selfCheckPings = 3
+
+// selfCheckReport is the result of the diagnostics run on startup
+type selfCheckReport struct {
+	// RedisLatency is the average round trip to Redis, zero when Redis is not
+	// used
+	RedisLatency time.Duration
+	RulesByType  map[string]int
+	Templates    int
+
+	// Problems fail the startup with SELF_CHECK_STRICT
+	Problems []string
+}
+
+// runSelfCheck measures the Redis latency and checks that the directories of
+// the rules exist and that their templates and conditions compile
+func runSelfCheck(ctx context.Context, rdb redis.UniversalClient, config Config, rules []FilterRule) selfCheckReport {
+	report := selfCheckReport{RulesByType: map[string]int{}}
+
+	if rdb != nil {
+		latency, err := measureRedisLatency(ctx, rdb)
+		if err != nil {
+			report.problem("Redis ping failed: %v", err)
+		} else {
+			report.RedisLatency = latency
+			if config.SelfCheckMaxRedisLatency > 0 && latency > config.SelfCheckMaxRedisLatency {
+				report.problem("Redis round trip of %s exceeds SELF_CHECK_MAX_REDIS_LATENCY %s", latency, config.SelfCheckMaxRedisLatency)
+			}
+		}
+	}
+
+	if len(rules) == 0 {
+		report.problem("no rules loaded from %s", config.ConfigFilePath)
+	}
+	for _, rule := range rules {
+		ruleType := rule.Type
+		if ruleType == "" {
+			ruleType = "(none)"
+		}
+		report.RulesByType[ruleType]++
+
+		if rule.Dir != "" {
+			if info, err := os.Stat(rule.Dir); err != nil {
+				report.problem("rule %s: dir '%s' does not exist", rule.ID, rule.Dir)
+			} else if !info.IsDir() {
+				report.problem("rule %s: dir '%s' is not a directory", rule.ID, rule.Dir)
+			}
+		}
+
+		for _, text := range ruleTemplates(rule) {
+			report.Templates++
+			if _, err := template.New("").Parse(text); err != nil {
+				report.problem("rule %s: template %q does not compile: %v", rule.ID, text, err)
+			}
+		}
+		for _, commands := range [][]Command{rule.Commands, rule.CommandsPush, rule.CommandsPR, rule.CommandsTag} {
+			for _, command := range commands {
+				if command.When == "" {
+					continue
+				}
+				report.Templates++
+				if _, err := parseCondition(command.When); err != nil {
+					report.problem("rule %s: condition %q does not compile: %v", rule.ID, command.When, err)
+				}
+			}
+		}
+	}
+	return report
+}
+
+func (r *selfCheckReport) problem(format string, v ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, v...))
+}
+
+// ruleTemplates returns the texts of the rule rendered as templates when
+// dispatching: the queue names and, for templated rules, the commands,
+// metadata and environment
+func ruleTemplates(rule FilterRule) []string {
+	texts := append([]string(nil), rule.Queues...)
+	if rule.Template {
+		for _, commands := range [][]Command{rule.Commands, rule.CommandsPush, rule.CommandsPR, rule.CommandsTag} {
+			for _, command := range commands {
+				texts = append(texts, command.Run)
+			}
+		}
+		for _, values := range []map[string]string{rule.Metadata, rule.Env} {
+			for _, value := range values {
+				texts = append(texts, value)
+			}
+		}
+	}
+
+	templates := texts[:0]
+	for _, text := range texts {
+		if strings.Contains(text, "{{") {
+			templates = append(templates, text)
+		}
+	}
+	return templates
+}
+
+func measureRedisLatency(ctx context.Context, rdb redis.UniversalClient) (time.Duration, error) {
+	var total time.Duration
+	for i := 0; i < selfCheckPings; i++ {
+		start := time.Now()
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			return 0, err
+		}
+		total += time.Since(start)
+	}
+	return total / selfCheckPings, nil
+}
+
+// log writes the report, a warning for each problem
+func (r selfCheckReport) log() {
+	if r.RedisLatency > 0 {
+		logInfo("Self-check: Redis round trip %s", r.RedisLatency.Round(time.Microsecond))
+	}
+
+	types := make([]string, 0, len(r.RulesByType))
+	rules := 0
+	for ruleType, count := range r.RulesByType {
+		types = append(types, fmt.Sprintf("%s=%d", ruleType, count))
+		rules += count
+	}
+	sort.Strings(types)
+	logInfo("Self-check: %d rule(s) loaded by type: %s", rules, strings.Join(types, ", "))
+	logInfo("Self-check: %d template(s) and condition(s) compiled", r.Templates)
+
+	for _, problem := range r.Problems {
+		logWarn("Self-check: %s", problem)
+	}
+	if len(r.Problems) == 0 {
+		logInfo("Self-check passed")
+	}
+}
+
+// err returns the problems found, nil when there are none
+func (r selfCheckReport) err() error {
+	if len(r.Problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d problem(s) found: %s", len(r.Problems), strings.Join(r.Problems, "; "))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_SelfCheck(t *testing.T) {
+	config := loadConfig()
+
+	if config.SelfCheckStrict {
+		t.Error("Expected SelfCheckStrict to be false")
+	}
+	if config.SelfCheckMaxRedisLatency != 0 {
+		t.Errorf("Expected SelfCheckMaxRedisLatency to be 0, got %s", config.SelfCheckMaxRedisLatency)
+	}
+
+	os.Setenv("SELF_CHECK_STRICT", "true")
+	os.Setenv("SELF_CHECK_MAX_REDIS_LATENCY", "20ms")
+	defer os.Unsetenv("SELF_CHECK_STRICT")
+	defer os.Unsetenv("SELF_CHECK_MAX_REDIS_LATENCY")
+
+	config = loadConfig()
+
+	if !config.SelfCheckStrict {
+		t.Error("Expected SelfCheckStrict to be true")
+	}
+	if config.SelfCheckMaxRedisLatency != 20*time.Millisecond {
+		t.Errorf("Expected SelfCheckMaxRedisLatency to be 20ms, got %s", config.SelfCheckMaxRedisLatency)
+	}
+}
+
+func TestRunSelfCheck(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0o600)
+
+	rules := []FilterRule{
+		{ID: "build", Type: "build", Dir: dir, Template: true, Commands: []Command{{Run: "make {{.RepoName}}", When: `eq .Ref "refs/heads/main"`}}},
+		{ID: "test", Type: "build", Dir: filepath.Join(dir, "missing"), Commands: []Command{{Run: "make test"}}},
+		{ID: "deploy", Type: "deploy", Dir: file, Template: true, Env: map[string]string{"TAG": "{{.Tag"}},
+		{ID: "lint", Template: true, Metadata: map[string]string{"sha": "{{.SHA}}"}},
+		// Passed through verbatim without template
+		{ID: "inspect", Type: "build", Commands: []Command{{Run: "docker inspect --format '{{.Id}' image"}}},
+	}
+
+	report := runSelfCheck(context.Background(), nil, Config{}, rules)
+
+	if report.RulesByType["build"] != 3 || report.RulesByType["deploy"] != 1 || report.RulesByType["(none)"] != 1 {
+		t.Errorf("Expected rules counted by type, got %v", report.RulesByType)
+	}
+	// make {{.RepoName}}, the when condition, {{.Tag and {{.SHA}}
+	if report.Templates != 4 {
+		t.Errorf("Expected 4 templates and conditions, got %d", report.Templates)
+	}
+	if report.RedisLatency != 0 {
+		t.Errorf("Expected no Redis latency without Redis, got %s", report.RedisLatency)
+	}
+
+	if len(report.Problems) != 3 {
+		t.Fatalf("Expected 3 problems, got %v", report.Problems)
+	}
+	for i, want := range []string{"rule test: dir", "rule deploy: dir", "rule deploy: template"} {
+		if !strings.HasPrefix(report.Problems[i], want) {
+			t.Errorf("Expected problem %d to start with '%s', got '%s'", i, want, report.Problems[i])
+		}
+	}
+	if err := report.err(); err == nil || !strings.Contains(err.Error(), "3 problem(s)") {
+		t.Errorf("Expected the problems as an error, got %v", err)
+	}
+}
+
+func TestRunSelfCheck_Passed(t *testing.T) {
+	rules := []FilterRule{{ID: "build", Commands: []Command{{Run: "make build"}}}}
+	report := runSelfCheck(context.Background(), nil, Config{}, rules)
+	if err := report.err(); err != nil {
+		t.Errorf("Expected the self-check to pass, got %v", err)
+	}
+
+	report = runSelfCheck(context.Background(), nil, Config{ConfigFilePath: "config.json"}, nil)
+	if err := report.err(); err == nil || !strings.Contains(err.Error(), "no rules loaded") {
+		t.Errorf("Expected a problem without rules, got %v", err)
+	}
+}
+
+func TestRunSelfCheck_RedisUnreachable(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+
+	report := runSelfCheck(context.Background(), rdb, Config{}, []FilterRule{{ID: "build"}})
+	if len(report.Problems) != 1 || !strings.HasPrefix(report.Problems[0], "Redis ping failed") {
+		t.Errorf("Expected the failed ping to be a problem, got %v", report.Problems)
+	}
+}
+
+func TestRunSelfCheck_Integration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	report := runSelfCheck(ctx, rdb, Config{}, []FilterRule{{ID: "build"}})
+	if report.RedisLatency <= 0 || len(report.Problems) != 0 {
+		t.Errorf("Expected the Redis latency without problems, got %s and %v", report.RedisLatency, report.Problems)
+	}
+
+	// Any round trip exceeds a nanosecond
+	report = runSelfCheck(ctx, rdb, Config{SelfCheckMaxRedisLatency: time.Nanosecond}, []FilterRule{{ID: "build"}})
+	if len(report.Problems) != 1 || !strings.Contains(report.Problems[0], "SELF_CHECK_MAX_REDIS_LATENCY") {
+		t.Errorf("Expected the latency to be a problem, got %v", report.Problems)
+	}
+}
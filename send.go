@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// sendCommand is the subcommand publishing a synthetic push event, e.g. to
+// kick a pipeline manually: github-dispatcher send --repo owner/x --ref
+// refs/heads/main --sha 3f786850e387550fdab836ed7e6dc881de23001b
+const sendCommand = "send"
+
+// commitSHAPattern matches full commit SHAs; abbreviated ones are refused, as
+// they would be passed on to the runners as they are
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// sendSender is the sender login of the events of the send subcommand
+const sendSender = "github-dispatcher"
+
+// pushEvent is the push webhook payload published by the send subcommand,
+// with the fields of a GitHub push event the dispatcher and most receivers
+// read
+type pushEvent struct {
+	Ref        string           `json:"ref"`
+	After      string           `json:"after"`
+	Created    bool             `json:"created"`
+	Deleted    bool             `json:"deleted"`
+	Forced     bool             `json:"forced"`
+	HeadCommit *pushEventCommit `json:"head_commit,omitempty"`
+	Repository struct {
+		Name     string `json:"name"`
+		FullName string `json:"full_name"`
+		Owner    struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+}
+
+type pushEventCommit struct {
+	ID        string `json:"id"`
+	Message   string `json:"message"`
+	Timestamp string `json:"timestamp"`
+}
+
+// sendRequest is the event of the send subcommand and where it goes
+type sendRequest struct {
+	event pushEvent
+	// direct dispatches the event in this process, as a replayed webhook,
+	// instead of publishing it to the input of the running dispatchers
+	direct bool
+}
+
+func parseSendFlags(args []string) (sendRequest, error) {
+	flags := flag.NewFlagSet("github-dispatcher "+sendCommand, flag.ContinueOnError)
+	repo := flags.String("repo", "", "full name of the repository, e.g. owner/repo")
+	ref := flags.String("ref", "", "pushed ref, e.g. refs/heads/main or refs/tags/v1.0.0")
+	sha := flags.String("sha", "", "full SHA of the pushed commit")
+	message := flags.String("message", "Sent with github-dispatcher send", "message of the pushed commit")
+	direct := flags.Bool("direct", false, "dispatch the event in this process and enqueue its jobs, instead of publishing it to INPUT_MODE")
+	if err := flags.Parse(args); err != nil {
+		return sendRequest{}, err
+	}
+
+	owner, name, ok := strings.Cut(*repo, "/")
+	if !ok || owner == "" || name == "" {
+		return sendRequest{}, fmt.Errorf("invalid --repo '%s', must be owner/repo", *repo)
+	}
+	if !strings.HasPrefix(*ref, branchRefPrefix) && !strings.HasPrefix(*ref, tagRefPrefix) {
+		return sendRequest{}, fmt.Errorf("invalid --ref '%s', must start with %s or %s", *ref, branchRefPrefix, tagRefPrefix)
+	}
+	if !commitSHAPattern.MatchString(*sha) {
+		return sendRequest{}, fmt.Errorf("invalid --sha '%s', must be a full commit SHA of 40 hexadecimal digits", *sha)
+	}
+
+	request := sendRequest{direct: *direct}
+	event := &request.event
+	event.Ref, event.After = *ref, *sha
+	event.HeadCommit = &pushEventCommit{ID: *sha, Message: *message, Timestamp: time.Now().UTC().Format(time.RFC3339)}
+	event.Repository.Name, event.Repository.FullName = name, *repo
+	event.Repository.Owner.Login = owner
+	event.Sender.Login = sendSender
+	return request, nil
+}
+
+// sendPayload returns the payload of the event as the input receives it:
+// the webhook itself or, when webhooks must be signed, a signed envelope
+// with the current secret of the repository
+func sendPayload(ctx context.Context, rdb redis.UniversalClient, config Config, event pushEvent) (string, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize event: %w", err)
+	}
+	rules, err := loadVerifiedFilterRules(config)
+	if err != nil {
+		return "", err
+	}
+	if !verifiesSignatures(config, rules) {
+		return string(body), nil
+	}
+
+	var registry *secretRegistry
+	if config.WebhookSecretsFile != "" || config.WebhookSecretsKey != "" {
+		registry = newSecretRegistry(rdb, config)
+		if err := registry.load(ctx); err != nil {
+			return "", fmt.Errorf("failed to load webhook secrets: %w", err)
+		}
+	}
+	secrets := webhookSecrets(config, rules, registry, event.Repository.FullName)
+	if len(secrets) == 0 {
+		return "", fmt.Errorf("webhooks must be signed, but there is no secret for repository '%s'", event.Repository.FullName)
+	}
+	envelope, err := json.Marshal(signedWebhook{Signature: signWebhook(secrets[0], string(body)), Body: string(body), Delivery: newUUID()})
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize envelope: %w", err)
+	}
+	return string(envelope), nil
+}
+
+// signWebhook returns the X-Hub-Signature-256 of the body with the secret
+func signWebhook(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// publishEvent publishes the payload to the input of the running
+// dispatchers and returns where it was published
+func publishEvent(ctx context.Context, rdb redis.UniversalClient, config Config, payload string) (string, error) {
+	switch config.InputMode {
+	case inputModePubSub:
+		channel, err := sendChannel(config)
+		if err != nil {
+			return "", err
+		}
+		receivers, err := rdb.Publish(ctx, channel, payload).Result()
+		if err != nil {
+			return "", fmt.Errorf("failed to publish to channel '%s': %w", channel, err)
+		}
+		if receivers == 0 {
+			return "", fmt.Errorf("no dispatcher is subscribed to channel '%s', the event was lost", channel)
+		}
+		return fmt.Sprintf("channel '%s' (%d subscriber(s))", channel, receivers), nil
+	case inputModeStream:
+		id, err := rdb.XAdd(ctx, &redis.XAddArgs{Stream: config.InputStream, Values: map[string]any{config.InputStreamField: payload}}).Result()
+		if err != nil {
+			return "", fmt.Errorf("failed to add to stream '%s': %w", config.InputStream, err)
+		}
+		return fmt.Sprintf("stream '%s' (message %s)", config.InputStream, id), nil
+	case inputModeList:
+		if err := rdb.RPush(ctx, config.InputList, payload).Err(); err != nil {
+			return "", fmt.Errorf("failed to push to list '%s': %w", config.InputList, err)
+		}
+		return fmt.Sprintf("list '%s'", config.InputList), nil
+	default:
+		return "", fmt.Errorf("send publishes to the pubsub, stream and list inputs, not to INPUT_MODE %s; use --direct", config.InputMode)
+	}
+}
+
+// sendChannel returns the channel of REDIS_CHANNEL push events are received
+// on: the first channel that is not a pattern and handles pushes
+func sendChannel(config Config) (string, error) {
+	channels, err := parseRedisChannels(config.RedisChannel)
+	if err != nil {
+		return "", err
+	}
+	for _, channel := range channels {
+		if !channel.pattern && (channel.eventType == "" || channel.eventType == eventTypePush) {
+			return channel.name, nil
+		}
+	}
+	return "", fmt.Errorf("REDIS_CHANNEL '%s' has no channel receiving push events that is not a pattern", config.RedisChannel)
+}
+
+// runSend publishes the event of the request to the input of the running
+// dispatchers
+func runSend(config Config, request sendRequest) error {
+	ctx := context.Background()
+	rdb, err := newRedisClient(config)
+	if err != nil {
+		return fmt.Errorf("failed to create Redis client: %w", err)
+	}
+	defer rdb.Close()
+
+	payload, err := sendPayload(ctx, rdb, config, request.event)
+	if err != nil {
+		return err
+	}
+	target, err := publishEvent(ctx, rdb, config, payload)
+	if err != nil {
+		return err
+	}
+	logInfo("Sent push of %s to %s of %s to %s", shortSHA(request.event.After), request.event.Ref, request.event.Repository.FullName, target)
+	return nil
+}
+
+// runSendDirect dispatches the event of the request in this process and
+// enqueues its jobs to the output, without starting the dispatcher
+func runSendDirect(config Config, request sendRequest) error {
+	ctx := context.Background()
+	rules, err := loadVerifiedFilterRules(config)
+	if err != nil {
+		return err
+	}
+
+	// send has no input, so only the brokers of the output are connected
+	connections, closeBrokers, err := connectBrokers(config, "", config.OutputMode)
+	if err != nil {
+		return err
+	}
+	defer closeBrokers()
+	if !brokerOutput(config.OutputMode) || config.WebhookSecretsKey != "" || config.PauseKey != "" {
+		rdb, err := newRedisClient(config)
+		if err != nil {
+			return fmt.Errorf("failed to create Redis client: %w", err)
+		}
+		defer rdb.Close()
+		connections.rdb = rdb
+	}
+	sink, err := newJobSink(config, connections)
+	if err != nil {
+		return err
+	}
+
+	d := newDispatcher(connections.rdb, config, rules)
+	d.sink = sink
+	if d.secrets != nil {
+		if err := d.secrets.load(ctx); err != nil {
+			return fmt.Errorf("failed to load webhook secrets: %w", err)
+		}
+	}
+	if d.pause != nil {
+		if _, err := d.pause.refresh(ctx); err != nil {
+			return fmt.Errorf("failed to read pause state: %w", err)
+		}
+	}
+	if d.auditLog, err = openAuditLog(connections.rdb, config); err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if d.auditLog != nil {
+		defer d.auditLog.close()
+	}
+
+	rule, jobs, err := sendDirect(ctx, d, request.event)
+	if err != nil {
+		return err
+	}
+	logInfo("Dispatched push of %s to %s of %s with rule %s (%d job(s))", shortSHA(request.event.After), request.event.Ref, request.event.Repository.FullName, rule.ID, len(jobs))
+	return nil
+}
+
+// sendDirect dispatches the event like a webhook received from the input.
+// The event is trusted, so it is not signed.
+func sendDirect(ctx context.Context, d *Dispatcher, event pushEvent) (*FilterRule, []Job, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to serialize event: %w", err)
+	}
+	var webhook GitHubEvent
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+
+	rule, jobs, err := d.dispatch(ctx, webhook)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to dispatch event: %w", err)
+	}
+	if rule == nil || len(jobs) == 0 {
+		return nil, nil, errors.New("no job was dispatched, see the log for the reason")
+	}
+	return rule, jobs, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParseSendFlags(t *testing.T) {
+	request, err := parseSendFlags([]string{"--repo", "owner/repo", "--ref", "refs/heads/main", "--sha", "3f786850e387550fdab836ed7e6dc881de23001b"})
+	if err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	event := request.event
+	if request.direct || event.Ref != "refs/heads/main" || event.After != "3f786850e387550fdab836ed7e6dc881de23001b" || event.HeadCommit.ID != "3f786850e387550fdab836ed7e6dc881de23001b" {
+		t.Errorf("Expected a push of 3f78685 to main, got %+v", request)
+	}
+	if event.Repository.FullName != "owner/repo" || event.Repository.Name != "repo" || event.Repository.Owner.Login != "owner" {
+		t.Errorf("Expected the repository owner/repo, got %+v", event.Repository)
+	}
+
+	for _, args := range [][]string{
+		{"--repo", "repo", "--ref", "refs/heads/main", "--sha", "abc123"},
+		{"--repo", "owner/repo", "--ref", "main", "--sha", "abc123"},
+		{"--repo", "owner/repo", "--ref", "refs/heads/main"},
+		{"--repo", "owner/repo", "--ref", "refs/heads/main", "--sha", "not-a-sha"},
+		{"--repo", "owner/repo", "--ref", "refs/heads/main", "--sha", "abc12"},
+		{"--repo", "owner/repo", "--ref", "refs/heads/main", "--sha", "3f78685"},
+		{"--repo", "owner/repo", "--ref", "refs/heads/main", "--sha", "3f786850e387550fdab836ed7e6dc881de23001bff"},
+	} {
+		if _, err := parseSendFlags(args); err == nil {
+			t.Errorf("Expected error for %v, got nil", args)
+		}
+	}
+}
+
+func TestSendPayload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`[{"repo": "owner/repo", "branch": "refs/heads/main", "commands": ["make build"]}]`), 0o600)
+	request, _ := parseSendFlags([]string{"--repo", "owner/repo", "--ref", "refs/heads/main", "--sha", "3f786850e387550fdab836ed7e6dc881de23001b"})
+	ctx := context.Background()
+
+	config := Config{ConfigFilePath: path, PipelineQueueName: "pipeline"}
+	payload, err := sendPayload(ctx, nil, config, request.event)
+	if err != nil {
+		t.Fatalf("Failed to build payload: %v", err)
+	}
+	var event GitHubEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil || event.After != "3f786850e387550fdab836ed7e6dc881de23001b" || event.Repository.FullName != "owner/repo" {
+		t.Errorf("Expected the push event, got %s (%v)", payload, err)
+	}
+
+	// The event is dispatched like a webhook
+	config.WebhookSecret = "s3cret"
+	payload, err = sendPayload(ctx, nil, config, request.event)
+	if err != nil {
+		t.Fatalf("Failed to build payload: %v", err)
+	}
+	rules, _ := loadFilterRules(path)
+	d := newDispatcher(nil, config, rules)
+	sink := &recordingSink{}
+	d.sink = sink
+	if err := d.handleWebhookMessage(ctx, payload); err != nil || len(sink.jobs) != 1 {
+		t.Errorf("Expected the signed event to be dispatched, got %d job(s) (%v)", len(sink.jobs), err)
+	}
+
+	config.WebhookSecret = ""
+	config.WebhookSecretsFile = filepath.Join(t.TempDir(), "secrets.json")
+	os.WriteFile(config.WebhookSecretsFile, []byte(`{"owner/other": {"secret": "other"}}`), 0o600)
+	if _, err := sendPayload(ctx, nil, config, request.event); err == nil {
+		t.Error("Expected error without a secret for the repository, got nil")
+	}
+}
+
+func TestSendDirect(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline", WebhookSecret: "s3cret"}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	sink := &recordingSink{}
+	d.sink = sink
+
+	// The event is dispatched without a signature, even if webhooks must be signed
+	request, _ := parseSendFlags([]string{"--repo", "owner/repo", "--ref", "refs/heads/main", "--sha", "3f786850e387550fdab836ed7e6dc881de23001b"})
+	rule, jobs, err := sendDirect(context.Background(), d, request.event)
+	if err != nil || rule.ID != "build" || len(jobs) != 1 || len(sink.jobs) != 1 {
+		t.Fatalf("Expected a job of rule 'build' to be enqueued, got %v %d (%v)", rule, len(sink.jobs), err)
+	}
+
+	request, _ = parseSendFlags([]string{"--repo", "owner/repo", "--ref", "refs/heads/develop", "--sha", "3f786850e387550fdab836ed7e6dc881de23001b"})
+	if _, _, err := sendDirect(context.Background(), d, request.event); err == nil {
+		t.Error("Expected error when no rule matches, got nil")
+	}
+}
+
+func TestSendChannel(t *testing.T) {
+	if channel, err := sendChannel(Config{RedisChannel: "github-webhook-*, github-releases=release, github-webhook"}); err != nil || channel != "github-webhook" {
+		t.Errorf("Expected channel 'github-webhook', got '%s' (%v)", channel, err)
+	}
+	if _, err := sendChannel(Config{RedisChannel: "github-*"}); err == nil {
+		t.Error("Expected error for a pattern alone, got nil")
+	}
+}
+
+func TestPublishEvent_Integration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{InputMode: inputModeList, InputList: "test-send-intake"}
+	rdb.Del(ctx, config.InputList)
+	defer rdb.Del(ctx, config.InputList)
+	if _, err := publishEvent(ctx, rdb, config, `{"ref":"refs/heads/main"}`); err != nil {
+		t.Fatalf("Failed to publish event: %v", err)
+	}
+	if payload, err := rdb.LPop(ctx, config.InputList).Result(); err != nil || payload != `{"ref":"refs/heads/main"}` {
+		t.Errorf("Expected the event in the intake list, got '%s' (%v)", payload, err)
+	}
+
+	config = Config{InputMode: inputModeStream, InputStream: "test-send-stream", InputStreamField: "payload"}
+	rdb.Del(ctx, config.InputStream)
+	defer rdb.Del(ctx, config.InputStream)
+	if _, err := publishEvent(ctx, rdb, config, `{"ref":"refs/heads/main"}`); err != nil {
+		t.Fatalf("Failed to publish event: %v", err)
+	}
+	if length := rdb.XLen(ctx, config.InputStream).Val(); length != 1 {
+		t.Errorf("Expected the event in the stream, got %d message(s)", length)
+	}
+
+	config = Config{InputMode: inputModePubSub, RedisChannel: "test-send-nobody"}
+	if _, err := publishEvent(ctx, rdb, config, `{"ref":"refs/heads/main"}`); err == nil {
+		t.Error("Expected error without subscribers, got nil")
+	}
+	if _, err := publishEvent(ctx, rdb, Config{InputMode: inputModeNATS}, "{}"); err == nil {
+		t.Error("Expected error for the NATS input, got nil")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/redis/go-redis/v9"
+)
+
+// sentryFlushTimeout bounds sending the pending Sentry events on shutdown
+const sentryFlushTimeout = 2 * time.Second
+
+// setupSentry reports errors to SENTRY_DSN, if set. Without it, reporting
+// does nothing.
+func setupSentry(config Config) error {
+	if config.SentryDSN == "" {
+		return nil
+	}
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:         config.SentryDSN,
+		Environment: config.SentryEnvironment,
+		Release:     "github-dispatcher@" + version,
+		ServerName:  config.InputStreamConsumer,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up Sentry: %w", err)
+	}
+	return nil
+}
+
+// eventHub returns a hub whose reports about the dispatch of the event carry
+// the fields of its log messages as tags. Hubs are cloned as dispatches run
+// concurrently.
+func eventHub(record *auditRecord) *sentry.Hub {
+	hub := sentry.CurrentHub().Clone()
+	hub.Scope().SetTags(map[string]string{
+		"event_id":   record.EventID,
+		"event_type": record.EventType,
+		"repo":       record.Repo,
+		"ref":        record.Ref,
+		"rule_id":    record.RuleID,
+		"team":       record.Team,
+		"service":    record.Service,
+	})
+	return hub
+}
+
+// reportDispatchError reports a failed dispatch with the event it failed for
+func reportDispatchError(err error, record *auditRecord) {
+	hub := eventHub(record)
+	hub.Scope().SetContext("event", sentry.Context{
+		"sha":     record.SHA,
+		"outcome": record.Outcome,
+		"output":  record.Output,
+		"job_ids": record.JobIDs,
+	})
+	hub.CaptureException(err)
+}
+
+// reportError reports an error that is not tied to an event
+func reportError(err error) {
+	sentry.CaptureException(err)
+}
+
+// reportPanic reports a panic while dispatching the event and panics again.
+// It must be deferred directly to recover the panic.
+func reportPanic(record *auditRecord) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	eventHub(record).Recover(r)
+	sentry.Flush(sentryFlushTimeout)
+	panic(r)
+}
+
+// sentryRedisHook reports Redis once the commands failed
+// SENTRY_REDIS_FAILURE_THRESHOLD times in a row, and again after a command
+// succeeded and they fail again
+type sentryRedisHook struct {
+	threshold int64
+	failures  *atomic.Int64
+}
+
+func newSentryRedisHook(threshold int) sentryRedisHook {
+	return sentryRedisHook{threshold: int64(threshold), failures: new(atomic.Int64)}
+}
+
+func (h sentryRedisHook) observe(command string, err error) {
+	if err == nil || errors.Is(err, redis.Nil) {
+		h.failures.Store(0)
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if h.failures.Add(1) == h.threshold {
+		hub := sentry.CurrentHub().Clone()
+		hub.Scope().SetTag("redis_command", command)
+		hub.CaptureException(fmt.Errorf("%d Redis commands failed in a row, last %s: %w", h.threshold, command, err))
+	}
+}
+
+// DialHook leaves failed dials to the commands that needed the connection
+func (h sentryRedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h sentryRedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		h.observe(cmd.Name(), err)
+		return err
+	}
+}
+
+func (h sentryRedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		name := "pipeline"
+		if len(cmds) > 0 {
+			name = cmds[0].Name()
+		}
+		h.observe(name, err)
+		return err
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/redis/go-redis/v9"
+)
+
+// recordingTransport keeps the Sentry events instead of sending them
+type recordingTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *recordingTransport) Configure(options sentry.ClientOptions) {}
+
+func (t *recordingTransport) Flush(timeout time.Duration) bool {
+	return true
+}
+
+func (t *recordingTransport) FlushWithContext(ctx context.Context) bool {
+	return true
+}
+
+func (t *recordingTransport) Close() {}
+
+func (t *recordingTransport) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+func (t *recordingTransport) sent() []*sentry.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*sentry.Event(nil), t.events...)
+}
+
+// captureSentry records the events reported to Sentry until the test ends
+func captureSentry(t *testing.T) *recordingTransport {
+	t.Helper()
+	transport := &recordingTransport{}
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:       "https://public@sentry.example.com/1",
+		Transport: transport,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Sentry client: %v", err)
+	}
+
+	hub := sentry.CurrentHub()
+	previous := hub.Client()
+	hub.BindClient(client)
+	t.Cleanup(func() { hub.BindClient(previous) })
+	return transport
+}
+
+func TestLoadConfig_Sentry(t *testing.T) {
+	config := loadConfig()
+
+	if config.SentryDSN != "" || config.SentryEnvironment != "" {
+		t.Errorf("Expected Sentry to be disabled, got DSN '%s' and environment '%s'", config.SentryDSN, config.SentryEnvironment)
+	}
+	if config.SentryRedisFailureThreshold != 5 {
+		t.Errorf("Expected SentryRedisFailureThreshold to be 5, got %d", config.SentryRedisFailureThreshold)
+	}
+
+	os.Setenv("SENTRY_DSN", "https://public@sentry.example.com/1")
+	os.Setenv("SENTRY_ENVIRONMENT", "production")
+	os.Setenv("SENTRY_REDIS_FAILURE_THRESHOLD", "10")
+	defer os.Unsetenv("SENTRY_DSN")
+	defer os.Unsetenv("SENTRY_ENVIRONMENT")
+	defer os.Unsetenv("SENTRY_REDIS_FAILURE_THRESHOLD")
+
+	config = loadConfig()
+
+	if config.SentryDSN != "https://public@sentry.example.com/1" {
+		t.Errorf("Expected SentryDSN to be set, got '%s'", config.SentryDSN)
+	}
+	if config.SentryEnvironment != "production" {
+		t.Errorf("Expected SentryEnvironment to be 'production', got '%s'", config.SentryEnvironment)
+	}
+	if config.SentryRedisFailureThreshold != 10 {
+		t.Errorf("Expected SentryRedisFailureThreshold to be 10, got %d", config.SentryRedisFailureThreshold)
+	}
+}
+
+func TestSentry_DispatchError(t *testing.T) {
+	transport := captureSentry(t)
+
+	config := Config{OutputMode: outputModeList, QueuePushCommand: queuePushRight, PipelineQueueName: "pipeline"}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Team: "platform", Commands: []Command{{Run: "make build"}}}}
+	// Enqueueing to an unreachable Redis fails
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+	d := newDispatcher(rdb, config, rules)
+
+	ctx := context.Background()
+	payload := `{"ref":"refs/heads/main","after":"abc123","repository":{"full_name":"owner/repo"}}`
+	if err := d.handleWebhookMessage(ctx, payload); err == nil {
+		t.Fatal("Expected enqueueing to fail, got nil")
+	}
+	// Unmatched events are not errors
+	if err := d.handleWebhookMessage(ctx, `{"ref":"refs/heads/develop","repository":{"full_name":"owner/repo"}}`); err != nil {
+		t.Fatalf("Failed to handle webhook: %v", err)
+	}
+
+	events := transport.sent()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 reported error, got %d", len(events))
+	}
+	event := events[0]
+	if event.Tags["repo"] != "owner/repo" || event.Tags["ref"] != "refs/heads/main" || event.Tags["rule_id"] != "build" || event.Tags["team"] != "platform" || event.Tags["event_id"] == "" {
+		t.Errorf("Expected the event to be tagged, got %v", event.Tags)
+	}
+	if event.Contexts["event"]["sha"] != "abc123" {
+		t.Errorf("Expected the commit in the event context, got %v", event.Contexts["event"])
+	}
+	if len(event.Exception) == 0 || !strings.Contains(event.Exception[len(event.Exception)-1].Value, "failed to enqueue jobs") {
+		t.Errorf("Expected the enqueue error to be reported, got %+v", event.Exception)
+	}
+}
+
+func TestSentry_ParseError(t *testing.T) {
+	transport := captureSentry(t)
+	d := newDispatcher(nil, Config{}, nil)
+
+	if err := d.handleWebhookMessage(context.Background(), "not json"); err == nil {
+		t.Fatal("Expected error for an invalid payload, got nil")
+	}
+	if events := transport.sent(); len(events) != 1 {
+		t.Errorf("Expected the parse error to be reported, got %d events", len(events))
+	}
+}
+
+func TestReportPanic(t *testing.T) {
+	transport := captureSentry(t)
+
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		record := auditRecord{EventID: "1", Repo: "owner/repo", RuleID: "build"}
+		defer reportPanic(&record)
+		panic("boom")
+	}()
+
+	if recovered != "boom" {
+		t.Errorf("Expected the panic to continue, got %v", recovered)
+	}
+	events := transport.sent()
+	if len(events) != 1 {
+		t.Fatalf("Expected the panic to be reported, got %d events", len(events))
+	}
+	if events[0].Message != "boom" || events[0].Tags["rule_id"] != "build" {
+		t.Errorf("Expected the tagged panic, got message '%s' and tags %v", events[0].Message, events[0].Tags)
+	}
+}
+
+func TestSentryRedisHook(t *testing.T) {
+	transport := captureSentry(t)
+
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+	hook := newSentryRedisHook(2)
+	rdb.AddHook(hook)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		rdb.Get(ctx, "key")
+	}
+	// Reported once the threshold is reached, not for every failure
+	if events := transport.sent(); len(events) != 1 {
+		t.Fatalf("Expected 1 report after 3 failures, got %d", len(events))
+	}
+
+	// A success starts a new streak, misses are not failures
+	hook.observe("get", redis.Nil)
+	hook.observe("get", errors.New("connection refused"))
+	if events := transport.sent(); len(events) != 1 {
+		t.Fatalf("Expected no report after 1 failure, got %d", len(events)-1)
+	}
+	hook.observe("get", errors.New("connection refused"))
+	events := transport.sent()
+	if len(events) != 2 {
+		t.Fatalf("Expected a second report, got %d", len(events))
+	}
+	if events[1].Tags["redis_command"] != "get" {
+		t.Errorf("Expected the command to be tagged, got %v", events[1].Tags)
+	}
+}
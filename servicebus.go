@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+const outputModeServiceBus = "servicebus"
+
+func init() {
+	registerJobSink(outputModeServiceBus, func(config Config, c clients) JobSink {
+		// The connection string was validated on startup
+		conn, _ := parseServiceBusConnectionString(config.ServiceBusConnectionString)
+		return &serviceBusSink{
+			newSender: func(entity string) (serviceBusSender, error) {
+				return c.servicebus.NewSender(entity, nil)
+			},
+			entityPath: conn.entityPath,
+			sessions:   config.ServiceBusSessions,
+			timeout:    config.ServiceBusTimeout,
+			senders:    map[string]serviceBusSender{},
+		}
+	})
+}
+
+// newServiceBusClient returns the client of the namespace of
+// SERVICEBUS_CONNECTION_STRING, which connects on the first send
+func newServiceBusClient(config Config) (*azservicebus.Client, error) {
+	return azservicebus.NewClientFromConnectionString(config.ServiceBusConnectionString, nil)
+}
+
+// serviceBusConnection is a parsed Azure Service Bus connection string
+type serviceBusConnection struct {
+	endpoint   *url.URL
+	keyName    string
+	key        string
+	entityPath string
+}
+
+// parseServiceBusConnectionString parses a shared access connection string
+// such as "Endpoint=sb://<namespace>.servicebus.windows.net/;
+// SharedAccessKeyName=<name>;SharedAccessKey=<key>[;EntityPath=<entity>]"
+func parseServiceBusConnectionString(value string) (serviceBusConnection, error) {
+	var conn serviceBusConnection
+	for _, part := range strings.Split(value, ";") {
+		name, setting, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(name) {
+		case "endpoint":
+			endpoint, err := url.Parse(setting)
+			if err != nil || endpoint.Host == "" {
+				return conn, errors.New("the Endpoint must be a URL such as sb://<namespace>.servicebus.windows.net/")
+			}
+			conn.endpoint = endpoint
+		case "sharedaccesskeyname":
+			conn.keyName = setting
+		case "sharedaccesskey":
+			conn.key = setting
+		case "entitypath":
+			conn.entityPath = setting
+		}
+	}
+	if conn.endpoint == nil || conn.keyName == "" || conn.key == "" {
+		return conn, errors.New("Endpoint, SharedAccessKeyName and SharedAccessKey are required")
+	}
+	return conn, nil
+}
+
+// validateServiceBusConfig checks the Service Bus settings when the Service
+// Bus output is used
+func validateServiceBusConfig(config Config) error {
+	if config.OutputMode != outputModeServiceBus {
+		return nil
+	}
+	if _, err := parseServiceBusConnectionString(config.ServiceBusConnectionString); err != nil {
+		return fmt.Errorf("invalid SERVICEBUS_CONNECTION_STRING: %w", err)
+	}
+	if config.ServiceBusTimeout <= 0 {
+		return errors.New("SERVICEBUS_TIMEOUT must be positive")
+	}
+	return nil
+}
+
+// serviceBusSender sends messages to a queue or topic
+type serviceBusSender interface {
+	SendMessage(ctx context.Context, message *azservicebus.Message, options *azservicebus.SendMessageOptions) error
+}
+
+// serviceBusSink sends jobs to Azure Service Bus queues or topics over AMQP,
+// using the queue names as entity names
+type serviceBusSink struct {
+	newSender  func(entity string) (serviceBusSender, error)
+	entityPath string
+	sessions   bool
+	timeout    time.Duration
+
+	mu      sync.Mutex
+	senders map[string]serviceBusSender
+}
+
+func (s *serviceBusSink) enqueue(ctx context.Context, config Config, queues []string, priority int, jobs [][]byte) error {
+	if len(queues) == 0 {
+		// A connection string scoped to an entity can only send to it
+		entity := config.PipelineQueueName
+		if s.entityPath != "" {
+			entity = s.entityPath
+		}
+		queues = []string{entity}
+	}
+
+	for _, entity := range queues {
+		for _, job := range jobs {
+			if err := s.send(ctx, entity, job); err != nil {
+				return fmt.Errorf("failed to send job to Service Bus entity '%s': %w", entity, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *serviceBusSink) send(ctx context.Context, entity string, job []byte) error {
+	message, err := s.message(job)
+	if err != nil {
+		return err
+	}
+	sender, err := s.sender(entity)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return sender.SendMessage(ctx, message, nil)
+}
+
+// sender returns the sender of an entity, which is kept for the following
+// jobs
+func (s *serviceBusSink) sender(entity string) (serviceBusSender, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sender, ok := s.senders[entity]; ok {
+		return sender, nil
+	}
+	sender, err := s.newSender(entity)
+	if err != nil {
+		return nil, err
+	}
+	s.senders[entity] = sender
+	return sender, nil
+}
+
+// message returns the message of a job: its job_id as message ID for
+// duplicate detection and, with SERVICEBUS_SESSIONS, its repository as
+// session ID so the jobs of a repository are received in order
+func (s *serviceBusSink) message(job []byte) (*azservicebus.Message, error) {
+	var identified struct {
+		ID   string `json:"job_id"`
+		Repo string `json:"repo"`
+	}
+	json.Unmarshal(job, &identified)
+
+	message := &azservicebus.Message{Body: job, ContentType: to.Ptr("application/json")}
+	if identified.ID != "" {
+		message.MessageID = to.Ptr(identified.ID)
+	}
+	if s.sessions {
+		if identified.Repo == "" {
+			return nil, errors.New("sessions require jobs with a repo")
+		}
+		message.SessionID = to.Ptr(identified.Repo)
+	}
+	return message, nil
+}
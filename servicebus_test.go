@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+const testServiceBusConnectionString = "Endpoint=sb://ci-runners.servicebus.windows.net/;SharedAccessKeyName=dispatcher;SharedAccessKey=c2VjcmV0"
+
+func TestLoadConfig_ServiceBus(t *testing.T) {
+	config := loadConfig()
+
+	if config.ServiceBusConnectionString != "" {
+		t.Errorf("Expected ServiceBusConnectionString to be empty, got '%s'", config.ServiceBusConnectionString)
+	}
+	if config.ServiceBusSessions {
+		t.Error("Expected ServiceBusSessions to be false by default")
+	}
+	if config.ServiceBusTimeout != 10*time.Second {
+		t.Errorf("Expected ServiceBusTimeout to be 10s, got %s", config.ServiceBusTimeout)
+	}
+
+	os.Setenv("SERVICEBUS_CONNECTION_STRING", testServiceBusConnectionString)
+	os.Setenv("SERVICEBUS_SESSIONS", "true")
+	os.Setenv("SERVICEBUS_TIMEOUT", "30s")
+	defer os.Unsetenv("SERVICEBUS_CONNECTION_STRING")
+	defer os.Unsetenv("SERVICEBUS_SESSIONS")
+	defer os.Unsetenv("SERVICEBUS_TIMEOUT")
+
+	config = loadConfig()
+
+	if config.ServiceBusConnectionString != testServiceBusConnectionString {
+		t.Errorf("Expected ServiceBusConnectionString to be set, got '%s'", config.ServiceBusConnectionString)
+	}
+	if !config.ServiceBusSessions {
+		t.Error("Expected ServiceBusSessions to be true")
+	}
+	if config.ServiceBusTimeout != 30*time.Second {
+		t.Errorf("Expected ServiceBusTimeout to be 30s, got %s", config.ServiceBusTimeout)
+	}
+}
+
+func TestParseServiceBusConnectionString(t *testing.T) {
+	conn, err := parseServiceBusConnectionString(testServiceBusConnectionString + ";EntityPath=jobs")
+	if err != nil {
+		t.Fatalf("Failed to parse connection string: %v", err)
+	}
+	if conn.endpoint.Host != "ci-runners.servicebus.windows.net" {
+		t.Errorf("Expected the endpoint of the namespace, got '%s'", conn.endpoint)
+	}
+	if conn.keyName != "dispatcher" || conn.key != "c2VjcmV0" || conn.entityPath != "jobs" {
+		t.Errorf("Unexpected connection %+v", conn)
+	}
+
+	for _, value := range []string{
+		"",
+		"Endpoint=sb://ci-runners.servicebus.windows.net/;SharedAccessKeyName=dispatcher",
+		"Endpoint=ci-runners;SharedAccessKeyName=dispatcher;SharedAccessKey=c2VjcmV0",
+	} {
+		if _, err := parseServiceBusConnectionString(value); err == nil {
+			t.Errorf("Expected connection string '%s' to be rejected", value)
+		}
+	}
+}
+
+func TestValidateServiceBusConfig(t *testing.T) {
+	config := Config{OutputMode: outputModeServiceBus, ServiceBusConnectionString: testServiceBusConnectionString, ServiceBusTimeout: 10 * time.Second}
+	if err := validateServiceBusConfig(config); err != nil {
+		t.Errorf("Expected Service Bus config to be valid, got %v", err)
+	}
+
+	invalid := config
+	invalid.ServiceBusConnectionString = ""
+	if err := validateServiceBusConfig(invalid); err == nil {
+		t.Error("Expected error for a missing connection string, got nil")
+	}
+
+	invalid = config
+	invalid.ServiceBusTimeout = 0
+	if err := validateServiceBusConfig(invalid); err == nil {
+		t.Error("Expected error for a zero timeout, got nil")
+	}
+
+	// The Service Bus settings are ignored with the other outputs
+	if err := validateServiceBusConfig(Config{OutputMode: outputModeList}); err != nil {
+		t.Errorf("Expected Service Bus settings to be ignored with the list output, got %v", err)
+	}
+
+	broker := Config{InputMode: inputModePubSub, OutputMode: outputModeServiceBus, SpillPath: "/tmp/spill.db"}
+	if err := validateBrokerOutput(broker, nil); err == nil || !strings.Contains(err.Error(), "OUTPUT_MODE servicebus") {
+		t.Errorf("Expected error for the spill buffer with the Service Bus output, got %v", err)
+	}
+}
+
+func TestDescribeOutput_ServiceBus(t *testing.T) {
+	config := Config{OutputMode: outputModeServiceBus, PipelineQueueName: "jobs"}
+	if output := describeOutput(config); output != "Azure Service Bus entity 'jobs'" {
+		t.Errorf("Expected Service Bus entity, got '%s'", output)
+	}
+	if output := describeOutput(config, "jobs-queue", "deploy"); output != "Azure Service Bus entities 'jobs-queue', 'deploy'" {
+		t.Errorf("Expected Service Bus entities, got '%s'", output)
+	}
+}
+
+// fakeServiceBusSender records the messages sent to an entity, and fails
+// for the entity "missing"
+type fakeServiceBusSender struct {
+	entity string
+	sent   *[]serviceBusMessage
+}
+
+type serviceBusMessage struct {
+	entity  string
+	message *azservicebus.Message
+}
+
+func (f *fakeServiceBusSender) SendMessage(ctx context.Context, message *azservicebus.Message, options *azservicebus.SendMessageOptions) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("no timeout")
+	}
+	if f.entity == "missing" {
+		return errors.New("entity not found")
+	}
+	*f.sent = append(*f.sent, serviceBusMessage{f.entity, message})
+	return nil
+}
+
+func newFakeServiceBusSink(entityPath string, sessions bool) (*serviceBusSink, *[]serviceBusMessage, *int) {
+	var sent []serviceBusMessage
+	created := 0
+	sink := &serviceBusSink{
+		newSender: func(entity string) (serviceBusSender, error) {
+			created++
+			return &fakeServiceBusSender{entity: entity, sent: &sent}, nil
+		},
+		entityPath: entityPath,
+		sessions:   sessions,
+		timeout:    time.Second,
+		senders:    map[string]serviceBusSender{},
+	}
+	return sink, &sent, &created
+}
+
+func TestServiceBusSink_Enqueue(t *testing.T) {
+	sink, sent, created := newFakeServiceBusSink("", true)
+
+	ctx := context.Background()
+	config := Config{PipelineQueueName: "jobs"}
+	job := `{"job_id":"3f0c2a6e","repo":"owner/repo"}`
+	if err := sink.enqueue(ctx, config, nil, 0, [][]byte{[]byte(job)}); err != nil {
+		t.Fatalf("Failed to send job: %v", err)
+	}
+	if err := sink.enqueue(ctx, config, []string{"deploy"}, 0, [][]byte{[]byte(job)}); err != nil {
+		t.Fatalf("Failed to send job to a rule queue: %v", err)
+	}
+	if err := sink.enqueue(ctx, config, nil, 0, [][]byte{[]byte(job)}); err != nil {
+		t.Fatalf("Failed to send job: %v", err)
+	}
+
+	if len(*sent) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(*sent))
+	}
+	if (*sent)[0].entity != "jobs" || (*sent)[1].entity != "deploy" {
+		t.Errorf("Expected jobs sent to the entities, got %s and %s", (*sent)[0].entity, (*sent)[1].entity)
+	}
+	// The senders are kept
+	if *created != 2 {
+		t.Errorf("Expected 2 senders, got %d", *created)
+	}
+	message := (*sent)[0].message
+	if message.MessageID == nil || *message.MessageID != "3f0c2a6e" || message.SessionID == nil || *message.SessionID != "owner/repo" {
+		t.Errorf("Expected the job ID as message ID and the repo as session ID, got %+v", message)
+	}
+	if string(message.Body) != job || message.ContentType == nil || *message.ContentType != "application/json" {
+		t.Errorf("Expected the job as JSON body, got %s", message.Body)
+	}
+
+	if err := sink.enqueue(ctx, config, []string{"missing"}, 0, [][]byte{[]byte(job)}); err == nil || !strings.Contains(err.Error(), "entity 'missing'") {
+		t.Errorf("Expected error for a missing entity, got %v", err)
+	}
+	if err := sink.enqueue(ctx, config, nil, 0, [][]byte{[]byte(`{"job_id":"1"}`)}); err == nil {
+		t.Error("Expected error for a job without repo with sessions enabled, got nil")
+	}
+
+	// Without sessions no session ID is set
+	sink.sessions = false
+	if err := sink.enqueue(ctx, config, nil, 0, [][]byte{[]byte(job)}); err != nil {
+		t.Fatalf("Failed to send job: %v", err)
+	}
+	if last := (*sent)[len(*sent)-1].message; last.SessionID != nil {
+		t.Errorf("Expected no session ID, got '%s'", *last.SessionID)
+	}
+}
+
+func TestServiceBusSink_EntityPath(t *testing.T) {
+	conn, _ := parseServiceBusConnectionString(testServiceBusConnectionString + ";EntityPath=scoped")
+	sink, sent, _ := newFakeServiceBusSink(conn.entityPath, false)
+
+	if err := sink.enqueue(context.Background(), Config{PipelineQueueName: "jobs"}, nil, 0, [][]byte{[]byte(`{"job_id":"1"}`)}); err != nil {
+		t.Fatalf("Failed to send job: %v", err)
+	}
+	if len(*sent) != 1 || (*sent)[0].entity != "scoped" {
+		t.Errorf("Expected the job sent to the entity of the connection string, got %v", *sent)
+	}
+}
+
+func TestNewServiceBusClient(t *testing.T) {
+	client, err := newServiceBusClient(Config{ServiceBusConnectionString: testServiceBusConnectionString})
+	if err != nil {
+		t.Fatalf("Failed to create Service Bus client: %v", err)
+	}
+	client.Close(context.Background())
+}
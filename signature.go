@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const signaturePrefix = "sha256="
+
+// errInvalidSignature is returned for webhooks whose signature is missing or
+// does not match the secret of their repository
+var errInvalidSignature = errors.New("invalid webhook signature")
+
+// rejectedWebhooks counts the webhooks rejected for an invalid signature
+var rejectedWebhooks atomic.Int64
+
+// signedWebhook is the envelope of a webhook whose signature is verified: the
+// raw request body and the value of its X-Hub-Signature-256 header, and
+// optionally of its X-GitHub-Delivery header. The body is a string so it is
+// verified byte for byte as GitHub signed it.
+type signedWebhook struct {
+	Signature string `json:"signature_256"`
+	Body      string `json:"body"`
+	Delivery  string `json:"delivery,omitempty"`
+}
+
+// verifiesSignatures reports whether webhooks must be signed, which is the
+// case once WEBHOOK_SECRET, the secret registry or the webhook_secret of any
+// rule is set
+func verifiesSignatures(config Config, rules []FilterRule) bool {
+	if config.WebhookSecret != "" || config.WebhookSecretsFile != "" || config.WebhookSecretsKey != "" {
+		return true
+	}
+	for _, rule := range rules {
+		if rule.WebhookSecret != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookSecrets returns the secrets webhooks of the repository may be
+// signed with: its secret in the registry, and the previous one while it is
+// rotated, otherwise the webhook_secret of its rules, falling back to
+// WEBHOOK_SECRET
+func webhookSecrets(config Config, rules []FilterRule, registry *secretRegistry, repo string) []string {
+	if secret, ok := registry.lookup(repo); ok {
+		return secret.verifying(time.Now())
+	}
+	for _, rule := range rules {
+		if rule.Repo == repo && rule.WebhookSecret != "" {
+			return []string{rule.WebhookSecret}
+		}
+	}
+	if config.WebhookSecret != "" {
+		return []string{config.WebhookSecret}
+	}
+	return nil
+}
+
+// verifySignature unwraps a signed webhook envelope and returns it once the
+// X-Hub-Signature-256 signature of its body matches a secret of the
+// repository
+func verifySignature(config Config, rules []FilterRule, registry *secretRegistry, payload string) (signedWebhook, error) {
+	var envelope signedWebhook
+	if err := json.Unmarshal([]byte(payload), &envelope); err != nil || envelope.Body == "" {
+		return signedWebhook{}, fmt.Errorf("%w: message is not a signed webhook envelope", errInvalidSignature)
+	}
+	if envelope.Signature == "" {
+		return signedWebhook{}, fmt.Errorf("%w: no signature", errInvalidSignature)
+	}
+
+	// The repository is read from the unverified body only to pick the
+	// secret; nothing else is used before the signature is checked
+	var event struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	json.Unmarshal([]byte(envelope.Body), &event)
+
+	secrets := webhookSecrets(config, rules, registry, event.Repository.FullName)
+	if len(secrets) == 0 {
+		return signedWebhook{}, fmt.Errorf("%w: no secret for repository '%s'", errInvalidSignature, event.Repository.FullName)
+	}
+	for _, secret := range secrets {
+		if validSignature(secret, envelope.Body, envelope.Signature) {
+			return envelope, nil
+		}
+	}
+	return signedWebhook{}, fmt.Errorf("%w: signature mismatch for repository '%s'", errInvalidSignature, event.Repository.FullName)
+}
+
+// validSignature reports whether signature is the sha256= HMAC of the body
+// with the secret, comparing in constant time
+func validSignature(secret, body, signature string) bool {
+	digest, ok := strings.CutPrefix(signature, signaturePrefix)
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hmac.Equal(mac.Sum(nil), expected)
+}
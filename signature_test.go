@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func signedEnvelope(t *testing.T, signature, body string) string {
+	t.Helper()
+	payload, err := json.Marshal(signedWebhook{Signature: signature, Body: body})
+	if err != nil {
+		t.Fatalf("Failed to build envelope: %v", err)
+	}
+	return string(payload)
+}
+
+func TestLoadConfig_WebhookSecret(t *testing.T) {
+	config := loadConfig()
+	if config.WebhookSecret != "" {
+		t.Errorf("Expected WebhookSecret to be empty, got '%s'", config.WebhookSecret)
+	}
+
+	os.Setenv("WEBHOOK_SECRET", "global-secret")
+	defer os.Unsetenv("WEBHOOK_SECRET")
+
+	config = loadConfig()
+	if config.WebhookSecret != "global-secret" {
+		t.Errorf("Expected WebhookSecret to be 'global-secret', got '%s'", config.WebhookSecret)
+	}
+}
+
+func TestValidSignature(t *testing.T) {
+	body := `{"ref":"refs/heads/main"}`
+
+	// Example from the GitHub webhook documentation
+	if !validSignature("It's a Secret to Everybody", "Hello, World!", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17") {
+		t.Error("Expected the documented example signature to be valid")
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		expected  bool
+	}{
+		{"valid", sign("secret", body), true},
+		{"wrong secret", sign("other", body), false},
+		{"missing prefix", sign("secret", body)[len("sha256="):], false},
+		{"not hex", "sha256=zz", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := validSignature("secret", body, tt.signature); result != tt.expected {
+				t.Errorf("validSignature(%q) = %v, expected %v", tt.signature, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	config := Config{WebhookSecret: "global-secret"}
+	rules := []FilterRule{{Repo: "owner/private", WebhookSecret: "repo-secret"}}
+
+	public := `{"ref":"refs/heads/main","repository":{"full_name":"owner/public"}}`
+	private := `{"ref":"refs/heads/main","repository":{"full_name":"owner/private"}}`
+
+	tests := []struct {
+		name    string
+		payload string
+		valid   bool
+	}{
+		{"global secret", signedEnvelope(t, sign("global-secret", public), public), true},
+		{"repository secret", signedEnvelope(t, sign("repo-secret", private), private), true},
+		{"global secret for repository with its own", signedEnvelope(t, sign("global-secret", private), private), false},
+		{"forged", signedEnvelope(t, sign("guess", public), public), false},
+		{"unsigned", signedEnvelope(t, "", public), false},
+		{"raw payload", public, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified, err := verifySignature(config, rules, nil, tt.payload)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("Expected a valid signature, got %v", err)
+				}
+				var envelope signedWebhook
+				json.Unmarshal([]byte(tt.payload), &envelope)
+				if verified.Body != envelope.Body {
+					t.Errorf("Expected the envelope body, got %s", verified.Body)
+				}
+			} else if !errors.Is(err, errInvalidSignature) {
+				t.Errorf("Expected errInvalidSignature, got %v", err)
+			}
+		})
+	}
+
+	// Without a global secret, repositories without their own are rejected
+	if _, err := verifySignature(Config{}, rules, nil, signedEnvelope(t, sign("", public), public)); !errors.Is(err, errInvalidSignature) {
+		t.Errorf("Expected errInvalidSignature without a secret, got %v", err)
+	}
+}
+
+func TestLoadFilterRules_WebhookSecret(t *testing.T) {
+	os.Setenv("TEST_WEBHOOK_SECRET", "from-env")
+	defer os.Unsetenv("TEST_WEBHOOK_SECRET")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `[{"repo":"owner/repo","branch":"refs/heads/main","webhook_secret":"${TEST_WEBHOOK_SECRET}"}]`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	rules, err := loadFilterRules(path)
+	if err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+	if rules[0].WebhookSecret != "from-env" {
+		t.Errorf("Expected the secret to be resolved from the environment, got '%s'", rules[0].WebhookSecret)
+	}
+	if !verifiesSignatures(Config{}, rules) {
+		t.Error("Expected signatures to be verified with a rule secret")
+	}
+	if verifiesSignatures(Config{}, []FilterRule{{Repo: "owner/repo"}}) {
+		t.Error("Expected signatures not to be verified without secrets")
+	}
+}
+
+func TestHandleWebhookMessage_RejectsForgedWebhook(t *testing.T) {
+	d := newDispatcher(nil, Config{WebhookSecret: "secret"}, []FilterRule{{Repo: "owner/repo", Branch: "refs/heads/main"}})
+	body := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+
+	before := rejectedWebhooks.Load()
+	if err := d.handleWebhookMessage(context.Background(), signedEnvelope(t, sign("forged", body), body)); err != nil {
+		t.Errorf("Expected forged webhooks to be dropped without error, got %v", err)
+	}
+	if err := d.handleWebhookMessage(context.Background(), body); err != nil {
+		t.Errorf("Expected unsigned webhooks to be dropped without error, got %v", err)
+	}
+	if rejected := rejectedWebhooks.Load() - before; rejected != 2 {
+		t.Errorf("Expected 2 rejected webhooks to be counted, got %d", rejected)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+const (
+	slackDefaultDispatchTemplate = "Dispatched {{.Jobs}} job(s) of rule {{.RuleID}} for {{.Repo}}@{{.Branch}} ({{.ShortSHA}}) to {{.Output}}"
+	slackDefaultErrorTemplate    = "Failed to dispatch {{.EventType}} event for {{.Repo}}@{{.Branch}} ({{.ShortSHA}}): {{.Error}}"
+)
+
+// slackQueueSize bounds the messages waiting to be sent. Further messages are
+// dropped while Slack is slow or unreachable, so dispatching never waits.
+const slackQueueSize = 100
+
+// SlackMessageData is the data available to the SLACK_DISPATCH_TEMPLATE and
+// SLACK_ERROR_TEMPLATE templates: the fields of command templates, the rule
+// and its labels, and the outcome of the dispatch
+type SlackMessageData struct {
+	TemplateData
+	// Branch is the ref without the refs/heads/ or refs/tags/ prefix
+	Branch  string
+	RuleID  string
+	Team    string
+	Service string
+	Outcome string
+	Output  string
+	Jobs    int
+	Error   string
+}
+
+// slackNotifier posts a message to a Slack incoming webhook when a rule
+// dispatched jobs, if SLACK_NOTIFY_DISPATCH is set, and whenever a dispatch
+// failed
+type slackNotifier struct {
+	client           *http.Client
+	url              string
+	notifyDispatch   bool
+	dispatchTemplate *template.Template
+	errorTemplate    *template.Template
+	pending          chan string
+	done             chan struct{}
+}
+
+// newSlackNotifier returns the notifier of SLACK_WEBHOOK_URL. The templates
+// are checked by validateSlackConfig.
+func newSlackNotifier(config Config) *slackNotifier {
+	return &slackNotifier{
+		client:           &http.Client{Timeout: config.SlackTimeout},
+		url:              config.SlackWebhookURL,
+		notifyDispatch:   config.SlackNotifyDispatch,
+		dispatchTemplate: template.Must(parseSlackTemplate(config.SlackDispatchTemplate)),
+		errorTemplate:    template.Must(parseSlackTemplate(config.SlackErrorTemplate)),
+		pending:          make(chan string, slackQueueSize),
+		done:             make(chan struct{}),
+	}
+}
+
+func parseSlackTemplate(text string) (*template.Template, error) {
+	return template.New("").Option("missingkey=error").Parse(text)
+}
+
+func validateSlackConfig(config Config) error {
+	if config.SlackWebhookURL == "" {
+		return nil
+	}
+	if err := validateWebhookURL(config.SlackWebhookURL); err != nil {
+		return fmt.Errorf("invalid SLACK_WEBHOOK_URL: %w", err)
+	}
+	if config.SlackTimeout <= 0 {
+		return fmt.Errorf("SLACK_TIMEOUT must be positive, got %s", config.SlackTimeout)
+	}
+	if _, err := parseSlackTemplate(config.SlackDispatchTemplate); err != nil {
+		return fmt.Errorf("invalid SLACK_DISPATCH_TEMPLATE: %w", err)
+	}
+	if _, err := parseSlackTemplate(config.SlackErrorTemplate); err != nil {
+		return fmt.Errorf("invalid SLACK_ERROR_TEMPLATE: %w", err)
+	}
+	return nil
+}
+
+// notify queues the message about the dispatch of the event, if there is one
+// to send
+func (n *slackNotifier) notify(ctx context.Context, event GitHubEvent, record auditRecord) {
+	tmpl := n.dispatchTemplate
+	switch {
+	case record.Error != "":
+		tmpl = n.errorTemplate
+	case !n.notifyDispatch || record.Decision != auditMatched || len(record.JobIDs) == 0:
+		return
+	}
+
+	ref := event.MatchRef()
+	data := SlackMessageData{
+		TemplateData: newTemplateData(event),
+		Branch:       strings.TrimPrefix(strings.TrimPrefix(ref, branchRefPrefix), tagRefPrefix),
+		RuleID:       record.RuleID,
+		Team:         record.Team,
+		Service:      record.Service,
+		Outcome:      record.Outcome,
+		Output:       record.Output,
+		Jobs:         len(record.JobIDs),
+		Error:        record.Error,
+	}
+	var text strings.Builder
+	if err := tmpl.Execute(&text, data); err != nil {
+		logWarnContext(ctx, "Failed to render Slack message: %v", err)
+		return
+	}
+
+	select {
+	case n.pending <- text.String():
+	default:
+		logWarnContext(ctx, "Dropped Slack message, %d message(s) are waiting to be sent", slackQueueSize)
+	}
+}
+
+// run sends the queued messages until the context is cancelled, then sends
+// the messages still queued and stops
+func (n *slackNotifier) run(ctx context.Context) {
+	defer close(n.done)
+	for {
+		select {
+		case text := <-n.pending:
+			n.send(context.WithoutCancel(ctx), text)
+		case <-ctx.Done():
+			for {
+				select {
+				case text := <-n.pending:
+					n.send(context.WithoutCancel(ctx), text)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// wait blocks until the notifier has sent its last messages after shutdown
+func (n *slackNotifier) wait() {
+	<-n.done
+}
+
+// send posts the message. Failures are logged and not retried.
+func (n *slackNotifier) send(ctx context.Context, text string) {
+	if err := n.post(ctx, text); err != nil {
+		logWarn("Failed to send Slack message: %v", err)
+	}
+}
+
+func (n *slackNotifier) post(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "github-dispatcher/"+version)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The URL of an incoming webhook is its credential
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		response, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutboundResponseLog))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, response)
+	}
+	return nil
+}
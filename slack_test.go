@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_Slack(t *testing.T) {
+	config := loadConfig()
+
+	if config.SlackWebhookURL != "" {
+		t.Errorf("Expected SlackWebhookURL to be empty, got '%s'", config.SlackWebhookURL)
+	}
+	if !config.SlackNotifyDispatch {
+		t.Error("Expected SlackNotifyDispatch to be true")
+	}
+	if config.SlackDispatchTemplate != slackDefaultDispatchTemplate || config.SlackErrorTemplate != slackDefaultErrorTemplate {
+		t.Errorf("Expected the default templates, got %q and %q", config.SlackDispatchTemplate, config.SlackErrorTemplate)
+	}
+	if config.SlackTimeout != 5*time.Second {
+		t.Errorf("Expected SlackTimeout to be 5s, got %s", config.SlackTimeout)
+	}
+
+	os.Setenv("SLACK_WEBHOOK_URL", "https://hooks.slack.com/services/T000/B000/XXXX")
+	os.Setenv("SLACK_NOTIFY_DISPATCH", "false")
+	os.Setenv("SLACK_DISPATCH_TEMPLATE", "{{.Repo}} dispatched")
+	os.Setenv("SLACK_ERROR_TEMPLATE", "{{.Repo}} failed")
+	os.Setenv("SLACK_TIMEOUT", "2s")
+	defer os.Unsetenv("SLACK_WEBHOOK_URL")
+	defer os.Unsetenv("SLACK_NOTIFY_DISPATCH")
+	defer os.Unsetenv("SLACK_DISPATCH_TEMPLATE")
+	defer os.Unsetenv("SLACK_ERROR_TEMPLATE")
+	defer os.Unsetenv("SLACK_TIMEOUT")
+
+	config = loadConfig()
+
+	if config.SlackWebhookURL != "https://hooks.slack.com/services/T000/B000/XXXX" {
+		t.Errorf("Expected SlackWebhookURL to be set, got '%s'", config.SlackWebhookURL)
+	}
+	if config.SlackNotifyDispatch {
+		t.Error("Expected SlackNotifyDispatch to be false")
+	}
+	if config.SlackDispatchTemplate != "{{.Repo}} dispatched" || config.SlackErrorTemplate != "{{.Repo}} failed" {
+		t.Errorf("Expected the templates to be set, got %q and %q", config.SlackDispatchTemplate, config.SlackErrorTemplate)
+	}
+	if config.SlackTimeout != 2*time.Second {
+		t.Errorf("Expected SlackTimeout to be 2s, got %s", config.SlackTimeout)
+	}
+}
+
+func TestValidateSlackConfig(t *testing.T) {
+	valid := Config{
+		SlackWebhookURL:       "https://hooks.slack.com/services/T000/B000/XXXX",
+		SlackDispatchTemplate: slackDefaultDispatchTemplate,
+		SlackErrorTemplate:    slackDefaultErrorTemplate,
+		SlackTimeout:          5 * time.Second,
+	}
+	if err := validateSlackConfig(valid); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateSlackConfig(Config{}); err != nil {
+		t.Errorf("Expected disabled notifications to be valid, got %v", err)
+	}
+
+	invalid := map[string]func(*Config){
+		"relative URL": func(c *Config) { c.SlackWebhookURL = "hooks.slack.com/services" },
+		"zero timeout": func(c *Config) { c.SlackTimeout = 0 },
+		"dispatch":     func(c *Config) { c.SlackDispatchTemplate = "{{.Repo" },
+		"error":        func(c *Config) { c.SlackErrorTemplate = "{{end}}" },
+	}
+	for name, modify := range invalid {
+		config := valid
+		modify(&config)
+		if err := validateSlackConfig(config); err == nil {
+			t.Errorf("Expected %s to be invalid, got nil", name)
+		}
+	}
+}
+
+// slackServer records the text of the messages posted to it
+type slackServer struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (s *slackServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var message struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.texts = append(s.texts, message.Text)
+	s.mu.Unlock()
+	w.Write([]byte("ok"))
+}
+
+func TestSlackNotifier(t *testing.T) {
+	slack := &slackServer{}
+	server := httptest.NewServer(slack)
+	defer server.Close()
+
+	config := Config{
+		PipelineQueueName:     "pipeline",
+		SlackWebhookURL:       server.URL,
+		SlackNotifyDispatch:   true,
+		SlackDispatchTemplate: slackDefaultDispatchTemplate,
+		SlackErrorTemplate:    slackDefaultErrorTemplate,
+		SlackTimeout:          5 * time.Second,
+	}
+	rules := []FilterRule{
+		{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}},
+		// Rendering the command fails
+		{ID: "broken", Repo: "owner/repo", Branch: "refs/heads/broken", Commands: []Command{{Run: "make {{.Missing}}"}}, Template: true},
+	}
+	d := newDispatcher(nil, config, rules)
+	d.sink = &recordingSink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.run(ctx)
+
+	for _, payload := range []string{
+		`{"ref":"refs/heads/main","after":"abc1234567","repository":{"full_name":"owner/repo"}}`,
+		`{"ref":"refs/heads/develop","repository":{"full_name":"owner/repo"}}`,
+		`{"ref":"refs/heads/broken","after":"def1234567","repository":{"full_name":"owner/repo"}}`,
+	} {
+		d.handleWebhookMessage(ctx, payload)
+	}
+	// The queued messages are sent on shutdown
+	cancel()
+	d.wait()
+
+	if len(slack.texts) != 2 {
+		t.Fatalf("Expected 2 messages, got %q", slack.texts)
+	}
+	if slack.texts[0] != "Dispatched 1 job(s) of rule build for owner/repo@main (abc1234) to queue 'pipeline'" {
+		t.Errorf("Expected the dispatch message, got %q", slack.texts[0])
+	}
+	if !strings.HasPrefix(slack.texts[1], "Failed to dispatch push event for owner/repo@broken (def1234): failed to build jobs") {
+		t.Errorf("Expected the error message, got %q", slack.texts[1])
+	}
+}
+
+func TestSlackNotifier_ErrorsOnly(t *testing.T) {
+	config := Config{SlackNotifyDispatch: false, SlackDispatchTemplate: slackDefaultDispatchTemplate, SlackErrorTemplate: "{{.Team}}/{{.RuleID}}: {{.Error}}"}
+	n := newSlackNotifier(config)
+
+	event := GitHubEvent{Ref: "refs/heads/main"}
+	n.notify(context.Background(), event, auditRecord{Decision: auditMatched, RuleID: "build", JobIDs: []string{"1"}})
+	n.notify(context.Background(), event, auditRecord{Decision: auditFailed, RuleID: "build", Team: "platform", Error: "boom"})
+
+	if len(n.pending) != 1 {
+		t.Fatalf("Expected only the error to be queued, got %d message(s)", len(n.pending))
+	}
+	if text := <-n.pending; text != "platform/build: boom" {
+		t.Errorf("Expected the rendered error, got %q", text)
+	}
+}
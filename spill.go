@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	spillBucket = []byte("jobs")
+	retryBucket = []byte("retries")
+)
+
+// spillBuffer is a local bbolt file keeping the jobs that could not be
+// enqueued because Redis was unreachable. The jobs are enqueued in the order
+// they were spilled once Redis recovers.
+type spillBuffer struct {
+	db     *bolt.DB
+	rdb    redis.UniversalClient
+	config Config
+}
+
+func openSpillBuffer(rdb redis.UniversalClient, config Config) (*spillBuffer, error) {
+	db, err := bolt.Open(config.SpillPath, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spill buffer '%s': %w", config.SpillPath, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{spillBucket, retryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize spill buffer '%s': %w", config.SpillPath, err)
+	}
+	return &spillBuffer{db: db, rdb: rdb, config: config}, nil
+}
+
+func (s *spillBuffer) close() error {
+	return s.db.Close()
+}
+
+// pending returns the number of spilled jobs waiting to be enqueued
+func (s *spillBuffer) pending() int {
+	count := 0
+	s.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(spillBucket).Stats().KeyN
+		return nil
+	})
+	return count
+}
+
+// store appends the jobs to the buffer, remembering where they are enqueued
+func (s *spillBuffer) store(config Config, queues []string, priority int, jobs [][]byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putSpilledJobs(tx.Bucket(spillBucket), deferredJobs(config, queues, priority, jobs))
+	})
+}
+
+// deferredJobs returns the jobs with the queues they are enqueued to
+func deferredJobs(config Config, queues []string, priority int, jobs [][]byte) []deferredJob {
+	if len(queues) == 0 {
+		queues = []string{config.PipelineQueueName}
+	}
+	deferred := make([]deferredJob, len(jobs))
+	for i, job := range jobs {
+		deferred[i] = deferredJob{
+			Queues:        queues,
+			OverflowQueue: config.QueueOverflowName,
+			Priority:      priority,
+			Job:           job,
+		}
+	}
+	return deferred
+}
+
+func putSpilledJobs(bucket *bolt.Bucket, jobs []deferredJob) error {
+	for _, job := range jobs {
+		entry, err := json.Marshal(job)
+		if err != nil {
+			return fmt.Errorf("failed to serialize spilled job: %w", err)
+		}
+
+		// Big-endian sequence keys keep the jobs in the order they were spilled
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return fmt.Errorf("failed to spill job: %w", err)
+		}
+		if err := bucket.Put(sequenceKey(seq), entry); err != nil {
+			return fmt.Errorf("failed to spill job: %w", err)
+		}
+	}
+	return nil
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// track keeps the jobs in the buffer while their push is retried, so they
+// are not lost when the dispatcher stops mid-retry, and returns the func
+// forgetting them once their push succeeded or they were spilled or
+// dead-lettered. Jobs still tracked on startup are spilled by resume.
+func (s *spillBuffer) track(jobs []deferredJob) (release func()) {
+	var key []byte
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		entry, err := json.Marshal(jobs)
+		if err != nil {
+			return err
+		}
+		bucket := tx.Bucket(retryBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		key = sequenceKey(seq)
+		return bucket.Put(key, entry)
+	})
+	if err != nil {
+		logError("Failed to keep %d job(s) being retried in '%s': %v", len(jobs), s.config.SpillPath, err)
+		return func() {}
+	}
+
+	return func() {
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(retryBucket).Delete(key)
+		})
+		if err != nil {
+			logError("Failed to remove retried job(s) from '%s': %v", s.config.SpillPath, err)
+		}
+	}
+}
+
+// resume spills the jobs whose push was being retried when the dispatcher
+// stopped, so they are enqueued with the other spilled jobs, and returns
+// their number
+func (s *spillBuffer) resume() (int, error) {
+	resumed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		retries := tx.Bucket(retryBucket)
+		cursor := retries.Cursor()
+		for key, entry := cursor.First(); key != nil; key, entry = cursor.First() {
+			var jobs []deferredJob
+			if err := json.Unmarshal(entry, &jobs); err != nil {
+				logError("Dropping malformed retried job(s) from '%s': %v", s.config.SpillPath, err)
+			} else if err := putSpilledJobs(tx.Bucket(spillBucket), jobs); err != nil {
+				return err
+			}
+			resumed += len(jobs)
+			if err := retries.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to resume retried jobs from '%s': %w", s.config.SpillPath, err)
+	}
+	return resumed, nil
+}
+
+// run tries to enqueue the spilled jobs every SPILL_DRAIN_INTERVAL until the
+// context is cancelled. Spilled jobs stay in the buffer while the dispatcher
+// is paused.
+func (s *spillBuffer) run(ctx context.Context, paused func() bool) {
+	ticker := time.NewTicker(s.config.SpillDrainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if paused() {
+				continue
+			}
+			drained, err := s.drain(ctx)
+			if err != nil && ctx.Err() == nil {
+				logDebug("Spill buffer not drained yet: %v", err)
+			}
+			if drained > 0 {
+				logInfo("Enqueued %d spilled job(s), %d still buffered in '%s'", drained, s.pending(), s.config.SpillPath)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// drain enqueues the spilled jobs in the order they were spilled until the
+// buffer is empty, stopping at the first job that cannot be enqueued
+func (s *spillBuffer) drain(ctx context.Context) (int, error) {
+	drained := 0
+	for ctx.Err() == nil {
+		var key, entry []byte
+		s.db.View(func(tx *bolt.Tx) error {
+			k, v := tx.Bucket(spillBucket).Cursor().First()
+			// Values are only valid inside the transaction
+			key = append([]byte(nil), k...)
+			entry = append([]byte(nil), v...)
+			return nil
+		})
+		if len(key) == 0 {
+			return drained, nil
+		}
+
+		var spilled deferredJob
+		if err := json.Unmarshal(entry, &spilled); err != nil {
+			logError("Dropping malformed spilled job from '%s': %v", s.config.SpillPath, err)
+		} else {
+			target := s.config
+			target.QueueOverflowName = spilled.OverflowQueue
+			err := enqueueJobs(context.WithoutCancel(ctx), s.rdb, target, spilled.Queues, spilled.Priority, [][]byte{spilled.Job})
+			if err != nil && !errors.Is(err, errJobsDropped) {
+				return drained, fmt.Errorf("failed to enqueue spilled job to %s: %w", describeOutput(target, spilled.Queues...), err)
+			}
+			if err == nil {
+				drained++
+			}
+		}
+
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(spillBucket).Delete(key)
+		})
+		if err != nil {
+			return drained, fmt.Errorf("failed to remove spilled job from '%s': %w", s.config.SpillPath, err)
+		}
+	}
+	return drained, nil
+}
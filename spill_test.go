@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_Spill(t *testing.T) {
+	config := loadConfig()
+
+	if config.SpillPath != "" {
+		t.Errorf("Expected SpillPath to be empty, got '%s'", config.SpillPath)
+	}
+	if config.SpillDrainInterval != 5*time.Second {
+		t.Errorf("Expected SpillDrainInterval to be 5s, got %s", config.SpillDrainInterval)
+	}
+
+	os.Setenv("SPILL_PATH", "/var/lib/github-dispatcher/spill.db")
+	os.Setenv("SPILL_DRAIN_INTERVAL", "30s")
+	defer os.Unsetenv("SPILL_PATH")
+	defer os.Unsetenv("SPILL_DRAIN_INTERVAL")
+
+	config = loadConfig()
+
+	if config.SpillPath != "/var/lib/github-dispatcher/spill.db" {
+		t.Errorf("Expected SpillPath to be '/var/lib/github-dispatcher/spill.db', got '%s'", config.SpillPath)
+	}
+	if config.SpillDrainInterval != 30*time.Second {
+		t.Errorf("Expected SpillDrainInterval to be 30s, got %s", config.SpillDrainInterval)
+	}
+}
+
+// unreachableRedis returns a client for an address nothing listens on
+func unreachableRedis() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.1:1",
+		DialTimeout: 100 * time.Millisecond,
+		MaxRetries:  -1,
+	})
+}
+
+func TestSpillBuffer_KeepsJobsWhileRedisIsDown(t *testing.T) {
+	rdb := unreachableRedis()
+	defer rdb.Close()
+
+	config := Config{
+		OutputMode:        outputModeList,
+		PipelineQueueName: "pipeline",
+		SpillPath:         filepath.Join(t.TempDir(), "spill.db"),
+	}
+
+	spill, err := openSpillBuffer(rdb, config)
+	if err != nil {
+		t.Fatalf("Failed to open spill buffer: %v", err)
+	}
+
+	jobs := [][]byte{[]byte(`{"job_id":"1"}`), []byte(`{"job_id":"2"}`)}
+	if err := spill.store(config, nil, 0, jobs); err != nil {
+		t.Fatalf("Failed to spill jobs: %v", err)
+	}
+
+	drained, err := spill.drain(context.Background())
+	if err == nil {
+		t.Error("Expected draining to fail while Redis is unreachable")
+	}
+	if drained != 0 {
+		t.Errorf("Expected no jobs to be drained, got %d", drained)
+	}
+	if pending := spill.pending(); pending != 2 {
+		t.Errorf("Expected 2 spilled jobs to be kept, got %d", pending)
+	}
+
+	// Spilled jobs survive a restart
+	spill.close()
+	spill, err = openSpillBuffer(rdb, config)
+	if err != nil {
+		t.Fatalf("Failed to reopen spill buffer: %v", err)
+	}
+	defer spill.close()
+	if pending := spill.pending(); pending != 2 {
+		t.Errorf("Expected 2 spilled jobs after reopening, got %d", pending)
+	}
+}
+
+func TestJobBatcher_SpillsFailedBatch(t *testing.T) {
+	rdb := unreachableRedis()
+	defer rdb.Close()
+
+	config := Config{
+		OutputMode:        outputModeList,
+		PipelineQueueName: "pipeline",
+		SpillPath:         filepath.Join(t.TempDir(), "spill.db"),
+		BatchSize:         10,
+	}
+
+	spill, err := openSpillBuffer(rdb, config)
+	if err != nil {
+		t.Fatalf("Failed to open spill buffer: %v", err)
+	}
+	defer spill.close()
+
+	batcher := newJobBatcher(rdb, config)
+	batcher.spill = spill
+	batcher.flush([]pendingJobs{
+		{config: config, queues: []string{"pipeline"}, jobs: [][]byte{[]byte(`{"job_id":"1"}`)}},
+		{config: config, queues: []string{"pipeline"}, jobs: [][]byte{[]byte(`{"job_id":"2"}`)}},
+	}, 2)
+
+	if pending := spill.pending(); pending != 2 {
+		t.Errorf("Expected the failed batch to be spilled, got %d job(s)", pending)
+	}
+}
+
+func TestSpillBuffer_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		OutputMode:        outputModeList,
+		PipelineQueueName: "test-pipeline-spill",
+		SpillPath:         filepath.Join(t.TempDir(), "spill.db"),
+	}
+
+	// Clean up before test
+	rdb.Del(ctx, config.PipelineQueueName)
+	defer rdb.Del(ctx, config.PipelineQueueName)
+
+	spill, err := openSpillBuffer(rdb, config)
+	if err != nil {
+		t.Fatalf("Failed to open spill buffer: %v", err)
+	}
+	defer spill.close()
+
+	jobs := [][]byte{[]byte(`{"job_id":"1"}`), []byte(`{"job_id":"2"}`)}
+	if err := spill.store(config, nil, 0, jobs); err != nil {
+		t.Fatalf("Failed to spill jobs: %v", err)
+	}
+
+	drained, err := spill.drain(ctx)
+	if err != nil {
+		t.Fatalf("Failed to drain spill buffer: %v", err)
+	}
+	if drained != 2 {
+		t.Errorf("Expected 2 jobs to be drained, got %d", drained)
+	}
+	if pending := spill.pending(); pending != 0 {
+		t.Errorf("Expected the spill buffer to be empty, got %d", pending)
+	}
+
+	queued := rdb.LRange(ctx, config.PipelineQueueName, 0, -1).Val()
+	if len(queued) != 2 || queued[0] != `{"job_id":"1"}` {
+		t.Errorf("Expected the spilled jobs in order, got %v", queued)
+	}
+}
+
+func TestSpillBuffer_ResumesRetriedJobs(t *testing.T) {
+	rdb := unreachableRedis()
+	defer rdb.Close()
+
+	config := Config{
+		OutputMode:        outputModeList,
+		PipelineQueueName: "pipeline",
+		SpillPath:         filepath.Join(t.TempDir(), "spill.db"),
+	}
+
+	spill, err := openSpillBuffer(rdb, config)
+	if err != nil {
+		t.Fatalf("Failed to open spill buffer: %v", err)
+	}
+	release := spill.track(deferredJobs(config, nil, 0, [][]byte{[]byte(`{"job_id":"1"}`)}))
+	release()
+	spill.track(deferredJobs(config, []string{"deploy"}, 5, [][]byte{[]byte(`{"job_id":"2"}`), []byte(`{"job_id":"3"}`)}))
+	if pending := spill.pending(); pending != 0 {
+		t.Errorf("Expected jobs being retried not to be spilled yet, got %d", pending)
+	}
+
+	// The dispatcher stops mid-retry
+	spill.close()
+	spill, err = openSpillBuffer(rdb, config)
+	if err != nil {
+		t.Fatalf("Failed to reopen spill buffer: %v", err)
+	}
+	defer spill.close()
+
+	resumed, err := spill.resume()
+	if err != nil {
+		t.Fatalf("Failed to resume retried jobs: %v", err)
+	}
+	if resumed != 2 || spill.pending() != 2 {
+		t.Errorf("Expected the 2 unreleased jobs to be spilled, got %d resumed and %d pending", resumed, spill.pending())
+	}
+	if resumed, _ := spill.resume(); resumed != 0 {
+		t.Errorf("Expected the retried jobs to be resumed once, got %d more", resumed)
+	}
+}
+
+func TestDispatch_ReleasesRetriedJobs(t *testing.T) {
+	config := Config{
+		OutputMode:          outputModeList,
+		PipelineQueueName:   "pipeline",
+		SpillPath:           filepath.Join(t.TempDir(), "spill.db"),
+		EnqueueRetries:      2,
+		EnqueueRetryBackoff: time.Millisecond,
+	}
+	spill, err := openSpillBuffer(nil, config)
+	if err != nil {
+		t.Fatalf("Failed to open spill buffer: %v", err)
+	}
+	defer spill.close()
+
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	d.useSpillBuffer(spill)
+	sink := &flakySink{failures: 1}
+	d.sink = sink
+
+	payload := `{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`
+	if err := d.handleWebhookMessage(context.Background(), payload); err != nil {
+		t.Fatalf("Expected the push to succeed once retried, got %v", err)
+	}
+	if resumed, _ := spill.resume(); resumed != 0 || spill.pending() != 0 {
+		t.Errorf("Expected the pushed job to be released, got %d tracked and %d spilled", resumed, spill.pending())
+	}
+}
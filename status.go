@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// dispatcherStatus is the body of /status: what the dispatcher has been doing
+type dispatcherStatus struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	// Locked tells whether the configuration can be changed at runtime
+	Locked bool `json:"locked"`
+
+	// RuleStats tells whether the rule hits are the totals kept in Redis or
+	// the hits of this instance
+	RuleStats string       `json:"rule_stats"`
+	Rules     []ruleStatus `json:"rules"`
+
+	// RecentEvents are the last dispatched events, the most recent first
+	RecentEvents []recentEvent `json:"recent_events"`
+
+	// Unmatched counts the events no rule matched per repo/ref, the most
+	// frequent first
+	Unmatched []unmatchedRef `json:"unmatched"`
+}
+
+// recentEvent is the decision taken for a dispatched event and how long
+// dispatching it took
+type recentEvent struct {
+	auditRecord
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// recentEvents is a ring buffer of the last dispatched events
+type recentEvents struct {
+	mu     sync.Mutex
+	events []recentEvent
+	next   int
+	full   bool
+}
+
+// newRecentEvents keeps the last size events, or none when size is not
+// positive
+func newRecentEvents(size int) *recentEvents {
+	return &recentEvents{events: make([]recentEvent, max(size, 0))}
+}
+
+func (r *recentEvents) add(record auditRecord, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) == 0 {
+		return
+	}
+	r.events[r.next] = recentEvent{auditRecord: record, LatencyMS: float64(latency.Microseconds()) / 1000}
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the kept events, the most recent first
+func (r *recentEvents) list() []recentEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := r.next
+	if r.full {
+		count = len(r.events)
+	}
+	events := make([]recentEvent, 0, count)
+	for i := 1; i <= count; i++ {
+		events = append(events, r.events[(r.next-i+len(r.events))%len(r.events)])
+	}
+	return events
+}
+
+// statusHandler reports the hits of every loaded rule, so rules that never
+// or no longer match can be found, the last dispatched events, and the
+// events no rule matched
+func (d *Dispatcher) statusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules, source := d.ruleStats.status(r.Context(), d.rules.Load().rules)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dispatcherStatus{
+			Version:      version,
+			Commit:       buildCommit(),
+			BuildDate:    buildTime(),
+			Locked:       d.config.Locked,
+			RuleStats:    source,
+			Rules:        rules,
+			RecentEvents: d.recentEvents.list(),
+			Unmatched:    d.unmatched.list(),
+		})
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_StatusRecentEvents(t *testing.T) {
+	config := loadConfig()
+
+	if config.StatusRecentEvents != 100 {
+		t.Errorf("Expected StatusRecentEvents to be 100, got %d", config.StatusRecentEvents)
+	}
+
+	os.Setenv("STATUS_RECENT_EVENTS", "20")
+	defer os.Unsetenv("STATUS_RECENT_EVENTS")
+
+	config = loadConfig()
+
+	if config.StatusRecentEvents != 20 {
+		t.Errorf("Expected StatusRecentEvents to be 20, got %d", config.StatusRecentEvents)
+	}
+}
+
+func TestRecentEvents(t *testing.T) {
+	recent := newRecentEvents(3)
+	if events := recent.list(); len(events) != 0 {
+		t.Fatalf("Expected no events, got %d", len(events))
+	}
+
+	for i := 1; i <= 2; i++ {
+		recent.add(auditRecord{EventID: strconv.Itoa(i)}, time.Millisecond)
+	}
+	assertEventIDs(t, recent.list(), "2", "1")
+
+	// The oldest events are overwritten once the buffer is full
+	for i := 3; i <= 5; i++ {
+		recent.add(auditRecord{EventID: strconv.Itoa(i)}, time.Millisecond)
+	}
+	assertEventIDs(t, recent.list(), "5", "4", "3")
+
+	if latency := recent.list()[0].LatencyMS; latency != 1 {
+		t.Errorf("Expected a latency of 1 ms, got %v", latency)
+	}
+}
+
+func TestRecentEvents_Disabled(t *testing.T) {
+	recent := newRecentEvents(0)
+	recent.add(auditRecord{EventID: "1"}, time.Millisecond)
+	if events := recent.list(); len(events) != 0 {
+		t.Errorf("Expected no events to be kept, got %d", len(events))
+	}
+}
+
+func assertEventIDs(t *testing.T, events []recentEvent, ids ...string) {
+	t.Helper()
+	if len(events) != len(ids) {
+		t.Fatalf("Expected %d events, got %d", len(ids), len(events))
+	}
+	for i, id := range ids {
+		if events[i].EventID != id {
+			t.Errorf("Expected event %d to be %s, got %s", i, id, events[i].EventID)
+		}
+	}
+}
+
+func TestStatus_RecentEvents(t *testing.T) {
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, Config{PipelineQueueName: "pipeline", StatusRecentEvents: 10}, rules)
+	d.sink = &recordingSink{}
+
+	ctx := context.Background()
+	for _, payload := range []string{
+		`{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`,
+		`{"ref":"refs/heads/develop","repository":{"full_name":"owner/repo"}}`,
+	} {
+		if err := d.handleWebhookMessage(ctx, payload); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+
+	events := getStatus(t, d).RecentEvents
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 recent events, got %d", len(events))
+	}
+	if unmatched := events[0]; unmatched.Decision != auditUnmatched || unmatched.Ref != "refs/heads/develop" {
+		t.Errorf("Expected the unmatched event first, got %+v", unmatched)
+	}
+	matched := events[1]
+	if matched.Decision != auditMatched || matched.RuleID != "build" || matched.Outcome != outcomeDispatched {
+		t.Errorf("Expected the dispatched match of rule build, got %+v", matched)
+	}
+	if matched.Time.IsZero() || matched.LatencyMS < 0 {
+		t.Errorf("Expected the time and latency of the event, got %+v", matched)
+	}
+}
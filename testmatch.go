@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// testMatchCommand is the subcommand printing what a single event would
+// dispatch: github-dispatcher test-match --repo owner/x --ref refs/heads/main
+const testMatchCommand = "test-match"
+
+// testMatchResult is the match result of test-match
+type testMatchResult struct {
+	matchResult
+	// Shadowed are the other rules matching the event, which never fire as
+	// the first matching rule wins
+	Shadowed []string `json:"shadowed,omitempty"`
+	// Payloads are the values that would be enqueued, one per job
+	Payloads []json.RawMessage `json:"payloads,omitempty"`
+}
+
+// runTestMatch loads the rules, matches the event of the arguments against
+// them and prints the result as indented JSON, without connecting to
+// anything. It reports whether a rule matched.
+func runTestMatch(config Config, args []string, out io.Writer) (bool, error) {
+	flags := flag.NewFlagSet("github-dispatcher "+testMatchCommand, flag.ContinueOnError)
+	repo := flags.String("repo", "", "full name of the repository of the event, e.g. owner/repo")
+	ref := flags.String("ref", "", "ref of the event, e.g. refs/heads/main; the base branch of a pull request or the tag of a release")
+	eventType := flags.String("event", eventTypePush, "type of the event: push, pull_request, pull_request_review_comment or release")
+	payload := flags.String("payload", "", "file with the webhook payload of the event; --repo and --ref override its values")
+	if err := flags.Parse(args); err != nil {
+		return false, err
+	}
+
+	event, err := testMatchEvent(*eventType, *repo, *ref, *payload)
+	if err != nil {
+		return false, err
+	}
+	rules, err := loadVerifiedFilterRules(config)
+	if err != nil {
+		return false, err
+	}
+	d := newDispatcher(nil, config, rules)
+	if d.secrets != nil {
+		if err := d.secrets.load(context.Background()); err != nil {
+			return false, fmt.Errorf("failed to load webhook secrets: %w", err)
+		}
+	}
+
+	match, err := d.match(context.Background(), event)
+	if err != nil {
+		match.Reason = err.Error()
+	}
+	result := testMatchResult{matchResult: match}
+	if match.Matched {
+		rule := findMatchingRule(rules, event.Type(), event.Repository.FullName, event.MatchRef())
+		delay := time.Duration(rule.DelaySeconds) * time.Second
+		if result.Payloads, err = testMatchPayloads(config, delay, match.Jobs); err != nil {
+			return false, err
+		}
+		result.Jobs = nil
+		for i := range rules {
+			if &rules[i] != rule && rules[i].Repo == event.Repository.FullName &&
+				ruleMatchesRef(&rules[i], event.Type(), event.MatchRef()) && ruleHandlesEvent(&rules[i], event.Type()) {
+				result.Shadowed = append(result.Shadowed, rules[i].ID)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprintln(out, string(data))
+	return match.Matched, nil
+}
+
+// testMatchEvent returns the event of the payload file, or of the repository
+// and ref alone
+func testMatchEvent(eventType, repo, ref, payload string) (GitHubEvent, error) {
+	var event GitHubEvent
+	if payload != "" {
+		data, err := os.ReadFile(payload)
+		if err != nil {
+			return event, fmt.Errorf("failed to read payload: %w", err)
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return event, fmt.Errorf("failed to parse payload: %w", err)
+		}
+	}
+
+	// A pull request payload is a pull_request event, or a review comment,
+	// whatever --event says
+	if event.PullRequest != nil {
+		eventType = event.Type()
+	}
+	switch eventType {
+	case eventTypePush:
+	case eventTypePullRequest, eventTypeReviewComment:
+		if event.PullRequest == nil {
+			event.PullRequest = &GitHubPullRequest{}
+			event.Action = "opened"
+		}
+		if eventType == eventTypeReviewComment && event.Comment == nil {
+			event.Comment = &GitHubComment{}
+			event.Action = "created"
+		}
+		if ref != "" {
+			event.PullRequest.Base.Ref = strings.TrimPrefix(ref, branchRefPrefix)
+		}
+		ref = ""
+	case eventTypeRelease:
+		if event.Release == nil {
+			event.Release = &GitHubRelease{}
+			event.Action = "published"
+		}
+		if ref != "" {
+			event.Release.TagName = strings.TrimPrefix(ref, tagRefPrefix)
+		}
+		ref = ""
+	default:
+		return event, fmt.Errorf("invalid --event '%s', must be push, pull_request, pull_request_review_comment or release", eventType)
+	}
+	event.TypeHint = eventType
+	if repo != "" {
+		event.Repository.FullName = repo
+	}
+	if ref != "" {
+		event.Ref = ref
+	}
+
+	if event.Repository.FullName == "" || event.MatchRef() == "" {
+		return event, errors.New("--repo and --ref are required without a --payload holding them")
+	}
+	return event, nil
+}
+
+// testMatchPayloads serializes the jobs as they would be enqueued after the
+// delay of their rule
+func testMatchPayloads(config Config, delay time.Duration, jobs []Job) ([]json.RawMessage, error) {
+	var expiresAt string
+	if config.JobTTL > 0 {
+		expiresAt = time.Now().Add(delay + config.JobTTL).UTC().Format(time.RFC3339)
+	}
+
+	payloads := make([]json.RawMessage, 0, len(jobs))
+	for _, job := range jobs {
+		job.ExpiresAt = expiresAt
+		jobJSON, err := encodeJob(config, &job)
+		if err != nil {
+			return nil, err
+		}
+		value, err := compressJob(config, job, jobJSON)
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, value)
+	}
+	return payloads, nil
+}
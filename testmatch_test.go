@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestMatchConfig(t *testing.T, rules string) Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(rules), 0o600)
+	return Config{ConfigFilePath: path, PipelineQueueName: "pipeline", JobSchemaVersion: currentJobSchemaVersion}
+}
+
+func TestRunTestMatch(t *testing.T) {
+	config := writeTestMatchConfig(t, `[
+		{"id": "build", "repo": "owner/repo", "branch": "refs/heads/main", "commands": ["make build {{.ShortSHA}}"], "template": true},
+		{"id": "deploy", "repo": "owner/repo", "branch": "refs/heads/main", "commands": ["make deploy"]},
+		{"id": "pr", "repo": "owner/repo", "branch": "refs/heads/main", "events": ["pull_request"], "commands": ["make test"]}
+	]`)
+
+	var out bytes.Buffer
+	matched, err := runTestMatch(config, []string{"--repo", "owner/repo", "--ref", "refs/heads/main"}, &out)
+	if err != nil || !matched {
+		t.Fatalf("Expected a match, got %t (%v)", matched, err)
+	}
+	var result struct {
+		RuleID   string            `json:"rule_id"`
+		Queues   []string          `json:"queues"`
+		Shadowed []string          `json:"shadowed"`
+		Jobs     []Job             `json:"jobs"`
+		Payloads []json.RawMessage `json:"payloads"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse output %s: %v", out.String(), err)
+	}
+	if result.RuleID != "build" || len(result.Queues) != 1 || result.Queues[0] != "pipeline" {
+		t.Errorf("Expected rule 'build' to fire on 'pipeline', got %+v", result)
+	}
+	if len(result.Shadowed) != 1 || result.Shadowed[0] != "deploy" {
+		t.Errorf("Expected rule 'deploy' to be shadowed, got %v", result.Shadowed)
+	}
+	if result.Jobs != nil || len(result.Payloads) != 1 {
+		t.Fatalf("Expected one payload, got %s", out.String())
+	}
+	var job Job
+	json.Unmarshal(result.Payloads[0], &job)
+	if job.SchemaVersion != currentJobSchemaVersion || job.RuleID != "build" || job.Commands[0] != "make build " {
+		t.Errorf("Expected the enqueued job, got %+v", job)
+	}
+}
+
+func TestRunTestMatch_Payload(t *testing.T) {
+	config := writeTestMatchConfig(t, `[{"id": "pr", "repo": "owner/repo", "branch": "refs/heads/main", "commands_pr": ["make test"]}]`)
+	payload := filepath.Join(t.TempDir(), "payload.json")
+	os.WriteFile(payload, []byte(`{"action": "opened", "pull_request": {"number": 7, "base": {"ref": "main"}}, "repository": {"full_name": "owner/repo"}}`), 0o600)
+
+	var out bytes.Buffer
+	if matched, err := runTestMatch(config, []string{"--payload", payload}, &out); err != nil || !matched {
+		t.Errorf("Expected the pull request to match, got %t (%v): %s", matched, err, out.String())
+	}
+
+	out.Reset()
+	matched, err := runTestMatch(config, []string{"--payload", payload, "--ref", "refs/heads/develop"}, &out)
+	if err != nil || matched || !strings.Contains(out.String(), "no rule matches") {
+		t.Errorf("Expected no match for another base branch, got %t (%v): %s", matched, err, out.String())
+	}
+}
+
+func TestTestMatchEvent(t *testing.T) {
+	event, err := testMatchEvent(eventTypeRelease, "owner/repo", "refs/tags/v1.0.0", "")
+	if err != nil || event.Type() != eventTypeRelease || event.MatchRef() != "refs/tags/v1.0.0" || !event.IsDispatchable() {
+		t.Errorf("Expected a published release, got %+v (%v)", event, err)
+	}
+	if _, err := testMatchEvent(eventTypePush, "owner/repo", "", ""); err == nil {
+		t.Error("Expected error without a ref, got nil")
+	}
+	if _, err := testMatchEvent("issues", "owner/repo", "refs/heads/main", ""); err == nil {
+		t.Error("Expected error for an unknown event type, got nil")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// messageTimeouts counts the messages given up on after MESSAGE_TIMEOUT
+var messageTimeouts atomic.Int64
+
+func validateMessageTimeoutConfig(config Config) error {
+	if config.MessageTimeout < 0 {
+		return fmt.Errorf("MESSAGE_TIMEOUT must not be negative, got %s", config.MessageTimeout)
+	}
+	return nil
+}
+
+// withMessageDeadline bounds the handling of a message by MESSAGE_TIMEOUT,
+// if set
+func withMessageDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// messageTimedOut reports the failure of a message that ran out of
+// MESSAGE_TIMEOUT as such, and counts it
+func messageTimedOut(ctx context.Context, timeout time.Duration, err error) error {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	timeouts := messageTimeouts.Add(1)
+	logErrorContext(ctx, "Gave up on the message after %s (%d timed out in total)", timeout, timeouts)
+	return fmt.Errorf("message timed out after %s: %w", timeout, err)
+}
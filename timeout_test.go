@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// hangingSink blocks every push until the context is done
+type hangingSink struct{}
+
+func (hangingSink) enqueue(ctx context.Context, config Config, queues []string, priority int, jobs [][]byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestLoadConfig_MessageTimeout(t *testing.T) {
+	config := loadConfig()
+
+	if config.MessageTimeout != 0 {
+		t.Errorf("Expected MessageTimeout to be 0, got %s", config.MessageTimeout)
+	}
+
+	os.Setenv("MESSAGE_TIMEOUT", "30s")
+	defer os.Unsetenv("MESSAGE_TIMEOUT")
+
+	config = loadConfig()
+	if config.MessageTimeout != 30*time.Second {
+		t.Errorf("Expected MessageTimeout to be 30s, got %s", config.MessageTimeout)
+	}
+	if err := validateMessageTimeoutConfig(config); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateMessageTimeoutConfig(Config{MessageTimeout: -time.Second}); err == nil {
+		t.Error("Expected error for negative MESSAGE_TIMEOUT, got nil")
+	}
+}
+
+func TestHandleWebhookMessage_Timeout(t *testing.T) {
+	config := Config{PipelineQueueName: "pipeline", MessageTimeout: 50 * time.Millisecond}
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, config, rules)
+	d.sink = hangingSink{}
+
+	payload := `{"ref":"refs/heads/main","after":"abc123","repository":{"full_name":"owner/repo"}}`
+	timeouts := messageTimeouts.Load()
+	start := time.Now()
+	err := d.handleWebhookMessage(context.Background(), payload)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the message to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the message to be given up on after 50ms, took %s", elapsed)
+	}
+	if got := messageTimeouts.Load() - timeouts; got != 1 {
+		t.Errorf("Expected one timeout to be counted, got %d", got)
+	}
+
+	// The next message gets a deadline of its own
+	sink := &recordingSink{}
+	d.sink = sink
+	if err := d.handleWebhookMessage(context.Background(), payload); err != nil {
+		t.Fatalf("Expected the next message to be dispatched, got %v", err)
+	}
+	if len(sink.jobs) != 1 {
+		t.Errorf("Expected 1 job, got %d", len(sink.jobs))
+	}
+	if got := messageTimeouts.Load() - timeouts; got != 1 {
+		t.Errorf("Expected no further timeout to be counted, got %d", got)
+	}
+}
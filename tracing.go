@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	traceparentKey = "traceparent"
+	tracestateKey  = "tracestate"
+)
+
+const tracerName = "github.com/its-the-vibe/github-dispatcher"
+
+var tracePropagator = propagation.TraceContext{}
+
+// setupTracing installs the global tracer provider. Spans are exported over
+// OTLP/HTTP when an OTLP endpoint is configured through the standard
+// OTEL_EXPORTER_OTLP_* environment variables; otherwise trace IDs are still
+// generated so the trace context can be propagated to queued jobs.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", getEnv("OTEL_SERVICE_NAME", "github-dispatcher")),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	options := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+		logInfo("Exporting traces over OTLP")
+	}
+
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(tracePropagator)
+
+	return provider.Shutdown, nil
+}
+
+// startDispatchSpan starts the span covering the handling of one webhook,
+// continuing the trace of the webhook receiver when the message carries a
+// traceparent
+func startDispatchSpan(ctx context.Context, event *GitHubEvent) (context.Context, trace.Span) {
+	if event.TraceParent != "" {
+		ctx = tracePropagator.Extract(ctx, propagation.MapCarrier{
+			traceparentKey: event.TraceParent,
+			tracestateKey:  event.TraceState,
+		})
+	}
+
+	return otel.Tracer(tracerName).Start(ctx, "dispatch",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("github.event", event.Type()),
+			attribute.String("github.repository", event.Repository.FullName),
+			attribute.String("github.ref", event.MatchRef()),
+		),
+	)
+}
+
+// injectTraceContext adds the W3C trace context of ctx to the job metadata so
+// downstream consumers can continue the trace
+func injectTraceContext(ctx context.Context, job *Job) {
+	carrier := propagation.MapCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+
+	for _, key := range []string{traceparentKey, tracestateKey} {
+		if value := carrier.Get(key); value != "" {
+			job.Metadata[key] = value
+		}
+	}
+}
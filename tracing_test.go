@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestInjectTraceContext(t *testing.T) {
+	ctx := context.Background()
+	os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	os.Unsetenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+
+	shutdown, err := setupTracing(ctx)
+	if err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdown(ctx)
+
+	traceparentPattern := regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-0[01]$`)
+
+	// Webhooks carrying a traceparent continue the receiver's trace
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	event := GitHubEvent{TraceParent: incoming}
+	event.Repository.FullName = "owner/test-repo"
+
+	spanCtx, span := startDispatchSpan(ctx, &event)
+	job := Job{Metadata: map[string]string{}}
+	injectTraceContext(spanCtx, &job)
+	span.End()
+
+	traceparent := job.Metadata[traceparentKey]
+	if !traceparentPattern.MatchString(traceparent) {
+		t.Fatalf("Expected a W3C traceparent, got '%s'", traceparent)
+	}
+	if !strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") {
+		t.Errorf("Expected trace ID of the incoming traceparent, got '%s'", traceparent)
+	}
+	if traceparent == incoming {
+		t.Error("Expected the dispatch span to be the parent of the job, got the incoming span")
+	}
+
+	// Webhooks without a traceparent start a new trace
+	spanCtx, span = startDispatchSpan(ctx, &GitHubEvent{})
+	job = Job{Metadata: map[string]string{}}
+	injectTraceContext(spanCtx, &job)
+	span.End()
+
+	if !traceparentPattern.MatchString(job.Metadata[traceparentKey]) {
+		t.Errorf("Expected a W3C traceparent for a new trace, got '%s'", job.Metadata[traceparentKey])
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// unmatchedMaxRefs bounds the repo/ref pairs counted, as every pushed branch
+// is a new pair. The least recently seen pair is forgotten first.
+const unmatchedMaxRefs = 1000
+
+// unmatchedRef is how often events of a repo/ref matched no rule
+type unmatchedRef struct {
+	Repo     string    `json:"repo"`
+	Ref      string    `json:"ref"`
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+type unmatchedKey struct {
+	repo, ref string
+}
+
+// unmatchedEvents counts the events no rule matched per repo/ref and, with
+// UNMATCHED_LIST set, pushes them to that Redis list, so repos sending
+// webhooks nobody configured rules for can be found
+type unmatchedEvents struct {
+	mu   sync.Mutex
+	refs map[unmatchedKey]*unmatchedRef
+
+	rdb    redis.UniversalClient
+	key    string
+	maxLen int64
+}
+
+func newUnmatchedEvents(rdb redis.UniversalClient, config Config) *unmatchedEvents {
+	u := &unmatchedEvents{refs: map[unmatchedKey]*unmatchedRef{}}
+	if rdb != nil && config.UnmatchedList != "" {
+		u.rdb, u.key, u.maxLen = rdb, config.UnmatchedList, config.UnmatchedListMaxLen
+	}
+	return u
+}
+
+func validateUnmatchedConfig(config Config) error {
+	if config.UnmatchedList == "" {
+		return nil
+	}
+	if !usesRedis(config) {
+		return fmt.Errorf("UNMATCHED_LIST requires Redis, which is not used with INPUT_MODE %s and OUTPUT_MODE %s", config.InputMode, config.OutputMode)
+	}
+	if config.UnmatchedListMaxLen <= 0 {
+		return fmt.Errorf("UNMATCHED_LIST_MAXLEN must be positive, got %d", config.UnmatchedListMaxLen)
+	}
+	return nil
+}
+
+// add records an event no rule matched. Failing to push it to Redis does not
+// fail the dispatch.
+func (u *unmatchedEvents) add(ctx context.Context, record auditRecord) {
+	now := time.Now().UTC()
+	u.count(unmatchedKey{record.Repo, record.Ref}, now)
+
+	if u.rdb == nil {
+		return
+	}
+	record.Time = now
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		logErrorContext(ctx, "Failed to encode unmatched event: %v", err)
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	_, err = u.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, u.key, encoded)
+		pipe.LTrim(ctx, u.key, 0, u.maxLen-1)
+		return nil
+	})
+	if err != nil {
+		logWarnContext(ctx, "Failed to push unmatched event to '%s': %v", u.key, err)
+	}
+}
+
+func (u *unmatchedEvents) count(key unmatchedKey, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	ref, ok := u.refs[key]
+	if !ok {
+		if len(u.refs) >= unmatchedMaxRefs {
+			u.forgetOldest()
+		}
+		ref = &unmatchedRef{Repo: key.repo, Ref: key.ref}
+		u.refs[key] = ref
+	}
+	ref.Count++
+	ref.LastSeen = now
+}
+
+func (u *unmatchedEvents) forgetOldest() {
+	var oldest unmatchedKey
+	var oldestSeen time.Time
+	for key, ref := range u.refs {
+		if oldestSeen.IsZero() || ref.LastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = key, ref.LastSeen
+		}
+	}
+	delete(u.refs, oldest)
+}
+
+// list returns the counts, the most frequent first
+func (u *unmatchedEvents) list() []unmatchedRef {
+	u.mu.Lock()
+	refs := make([]unmatchedRef, 0, len(u.refs))
+	for _, ref := range u.refs {
+		refs = append(refs, *ref)
+	}
+	u.mu.Unlock()
+
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Count != refs[j].Count {
+			return refs[i].Count > refs[j].Count
+		}
+		if refs[i].Repo != refs[j].Repo {
+			return refs[i].Repo < refs[j].Repo
+		}
+		return refs[i].Ref < refs[j].Ref
+	})
+	return refs
+}
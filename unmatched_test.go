@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_Unmatched(t *testing.T) {
+	config := loadConfig()
+
+	if config.UnmatchedList != "" {
+		t.Errorf("Expected UnmatchedList to be empty, got '%s'", config.UnmatchedList)
+	}
+	if config.UnmatchedListMaxLen != 1000 {
+		t.Errorf("Expected UnmatchedListMaxLen to be 1000, got %d", config.UnmatchedListMaxLen)
+	}
+
+	os.Setenv("UNMATCHED_LIST", "unmatched")
+	os.Setenv("UNMATCHED_LIST_MAXLEN", "50")
+	defer os.Unsetenv("UNMATCHED_LIST")
+	defer os.Unsetenv("UNMATCHED_LIST_MAXLEN")
+
+	config = loadConfig()
+
+	if config.UnmatchedList != "unmatched" {
+		t.Errorf("Expected UnmatchedList to be 'unmatched', got '%s'", config.UnmatchedList)
+	}
+	if config.UnmatchedListMaxLen != 50 {
+		t.Errorf("Expected UnmatchedListMaxLen to be 50, got %d", config.UnmatchedListMaxLen)
+	}
+}
+
+func TestValidateUnmatchedConfig(t *testing.T) {
+	valid := []Config{
+		{},
+		{UnmatchedList: "unmatched", UnmatchedListMaxLen: 10, OutputMode: outputModeList},
+	}
+	for _, config := range valid {
+		if err := validateUnmatchedConfig(config); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", config, err)
+		}
+	}
+
+	invalid := []Config{
+		{UnmatchedList: "unmatched", UnmatchedListMaxLen: 0, OutputMode: outputModeList},
+		{UnmatchedList: "unmatched", UnmatchedListMaxLen: 10, InputMode: inputModeNATS, OutputMode: outputModeNATS},
+	}
+	for _, config := range invalid {
+		if err := validateUnmatchedConfig(config); err == nil {
+			t.Errorf("Expected %+v to be invalid, got nil", config)
+		}
+	}
+}
+
+func TestStatus_Unmatched(t *testing.T) {
+	rules := []FilterRule{{ID: "build", Repo: "owner/repo", Branch: "refs/heads/main", Commands: []Command{{Run: "make build"}}}}
+	d := newDispatcher(nil, Config{PipelineQueueName: "pipeline"}, rules)
+	d.sink = &recordingSink{}
+
+	ctx := context.Background()
+	for _, payload := range []string{
+		`{"ref":"refs/heads/main","repository":{"full_name":"owner/repo"}}`,
+		`{"ref":"refs/heads/main","repository":{"full_name":"owner/unknown"}}`,
+		`{"ref":"refs/heads/main","repository":{"full_name":"owner/unknown"}}`,
+		`{"ref":"refs/heads/develop","repository":{"full_name":"owner/repo"}}`,
+		// Ignored events are not unmatched
+		`{"action":"closed","pull_request":{"number":1},"repository":{"full_name":"owner/other"}}`,
+	} {
+		if err := d.handleWebhookMessage(ctx, payload); err != nil {
+			t.Fatalf("Failed to handle webhook: %v", err)
+		}
+	}
+
+	unmatched := getStatus(t, d).Unmatched
+	if len(unmatched) != 2 {
+		t.Fatalf("Expected 2 unmatched repo/refs, got %+v", unmatched)
+	}
+	if first := unmatched[0]; first.Repo != "owner/unknown" || first.Ref != "refs/heads/main" || first.Count != 2 || first.LastSeen.IsZero() {
+		t.Errorf("Expected 2 unmatched events of owner/unknown first, got %+v", first)
+	}
+	if second := unmatched[1]; second.Repo != "owner/repo" || second.Ref != "refs/heads/develop" || second.Count != 1 {
+		t.Errorf("Expected 1 unmatched event of owner/repo develop, got %+v", second)
+	}
+}
+
+func TestUnmatchedEvents_Bounded(t *testing.T) {
+	u := newUnmatchedEvents(nil, Config{})
+	start := time.Now()
+	for i := 0; i <= unmatchedMaxRefs; i++ {
+		u.count(unmatchedKey{"owner/repo", fmt.Sprintf("refs/heads/%d", i)}, start.Add(time.Duration(i)*time.Second))
+	}
+
+	refs := u.list()
+	if len(refs) != unmatchedMaxRefs {
+		t.Fatalf("Expected %d repo/refs, got %d", unmatchedMaxRefs, len(refs))
+	}
+	// The least recently seen ref is forgotten
+	for _, ref := range refs {
+		if ref.Ref == "refs/heads/0" {
+			t.Error("Expected refs/heads/0 to be forgotten")
+		}
+	}
+}
+
+func TestUnmatchedList_Integration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{UnmatchedList: "test-unmatched", UnmatchedListMaxLen: 2}
+	rdb.Del(ctx, config.UnmatchedList)
+	defer rdb.Del(ctx, config.UnmatchedList)
+
+	u := newUnmatchedEvents(rdb, config)
+	for _, ref := range []string{"refs/heads/a", "refs/heads/b", "refs/heads/c"} {
+		u.add(ctx, auditRecord{Repo: "owner/unknown", Ref: ref, Decision: auditUnmatched})
+	}
+
+	values, err := rdb.LRange(ctx, config.UnmatchedList, 0, -1).Result()
+	if err != nil {
+		t.Fatalf("Failed to read unmatched list: %v", err)
+	}
+	// Trimmed to the most recent events
+	if len(values) != 2 {
+		t.Fatalf("Expected 2 unmatched events, got %d", len(values))
+	}
+	var record auditRecord
+	if err := json.Unmarshal([]byte(values[0]), &record); err != nil {
+		t.Fatalf("Failed to decode unmatched event: %v", err)
+	}
+	if record.Ref != "refs/heads/c" || record.Time.IsZero() {
+		t.Errorf("Expected the most recent event first, got %+v", record)
+	}
+}
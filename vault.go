@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// envNamePattern matches the names of the environment variables Vault
+// secrets are exported as
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// vaultClient reads the secrets of the dispatcher from HashiCorp Vault and
+// keeps its token and the lease of the secrets renewed
+type vaultClient struct {
+	client *api.Client
+	path   string
+
+	// auth holds the token and secret the secret read, set by login and
+	// readSecrets for the renewal
+	auth   *api.Secret
+	secret *api.Secret
+}
+
+func newVaultClient(config Config) (*vaultClient, error) {
+	cfg := api.DefaultConfig()
+	if cfg.Error != nil {
+		return nil, cfg.Error
+	}
+	cfg.Address = strings.TrimSuffix(config.VaultAddr, "/")
+	cfg.Timeout = config.VaultTimeout
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if config.VaultNamespace != "" {
+		client.SetNamespace(config.VaultNamespace)
+	}
+	client.SetToken(config.VaultToken)
+	return &vaultClient{client: client, path: strings.Trim(config.VaultSecretPath, "/")}, nil
+}
+
+func validateVaultConfig(config Config) error {
+	if config.VaultAddr == "" {
+		return nil
+	}
+	if u, err := url.Parse(config.VaultAddr); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("VAULT_ADDR '%s' must be an absolute http or https URL", config.VaultAddr)
+	}
+	if config.VaultSecretPath == "" {
+		return errors.New("VAULT_SECRET_PATH is required when VAULT_ADDR is set")
+	}
+	if config.VaultToken == "" && config.VaultRoleID == "" {
+		return errors.New("VAULT_TOKEN or VAULT_ROLE_ID is required when VAULT_ADDR is set")
+	}
+	if config.VaultToken != "" && config.VaultRoleID != "" {
+		return errors.New("VAULT_TOKEN and VAULT_ROLE_ID cannot both be set")
+	}
+	if config.VaultTimeout <= 0 {
+		return fmt.Errorf("VAULT_TIMEOUT must be positive, got %s", config.VaultTimeout)
+	}
+	return nil
+}
+
+// loadVaultSecrets logs in to Vault and exports the keys of the secret at
+// VAULT_SECRET_PATH as environment variables, e.g. REDIS_PASSWORD, so they
+// are picked up by the configuration and the ${NAME} references of the rules.
+// Only the keys of VAULT_SECRET_NAMES, if set, are exported, and variables
+// that are already set are never overwritten. It returns the client to renew
+// the token and the lease with.
+func loadVaultSecrets(ctx context.Context, config Config) (*vaultClient, error) {
+	if err := validateVaultConfig(config); err != nil {
+		return nil, err
+	}
+	v, err := newVaultClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault client: %w", err)
+	}
+	if err := v.login(ctx, config); err != nil {
+		return nil, fmt.Errorf("failed to log in to Vault: %w", err)
+	}
+	secrets, err := v.readSecrets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret '%s' from Vault: %w", v.path, err)
+	}
+
+	exported := 0
+	for name, value := range secrets {
+		if reason := vaultSecretSkipped(name, config.VaultSecretNames); reason != "" {
+			logWarn("Not exporting secret '%s' from Vault: %s", name, reason)
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return nil, fmt.Errorf("failed to export secret '%s': %w", name, err)
+		}
+		exported++
+	}
+	logInfo("Loaded %d of %d secret(s) from Vault at '%s'", exported, len(secrets), v.path)
+	return v, nil
+}
+
+// vaultSecretSkipped returns why a key of the Vault secret is not exported
+// as an environment variable, or an empty string if it is
+func vaultSecretSkipped(name string, allowed []string) string {
+	if !envNamePattern.MatchString(name) {
+		return "not a valid environment variable name"
+	}
+	if len(allowed) > 0 && !slices.Contains(allowed, name) {
+		return "not listed in VAULT_SECRET_NAMES"
+	}
+	// An empty variable, e.g. FOO= in a manifest, does not hide the secret
+	if os.Getenv(name) != "" {
+		return "the environment variable is already set"
+	}
+	return ""
+}
+
+// login gets a token with the AppRole credentials, or looks up VAULT_TOKEN
+func (v *vaultClient) login(ctx context.Context, config Config) error {
+	if config.VaultRoleID != "" {
+		secret, err := v.client.Logical().WriteWithContext(ctx, "auth/approle/login", map[string]any{"role_id": config.VaultRoleID, "secret_id": config.VaultSecretID})
+		if err != nil {
+			return err
+		}
+		if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+			return errors.New("Vault returned no token")
+		}
+		v.client.SetToken(secret.Auth.ClientToken)
+		v.auth = secret
+		return nil
+	}
+
+	token, err := v.client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	ttl, err := token.TokenTTL()
+	if err != nil {
+		return fmt.Errorf("failed to decode token: %w", err)
+	}
+	renewable, err := token.TokenIsRenewable()
+	if err != nil {
+		return fmt.Errorf("failed to decode token: %w", err)
+	}
+	v.auth = &api.Secret{Auth: &api.SecretAuth{ClientToken: v.client.Token(), LeaseDuration: int(ttl.Seconds()), Renewable: renewable}}
+	return nil
+}
+
+// readSecrets reads the string values of the secret, unwrapping the data of
+// a KV version 2 secret
+func (v *vaultClient) readSecrets(ctx context.Context) (map[string]string, error) {
+	secret, err := v.client.Logical().ReadWithContext(ctx, v.path)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, errors.New("secret not found")
+	}
+	v.secret = secret
+
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, kv2 := data["metadata"]; kv2 {
+			data = nested
+		}
+	}
+
+	secrets := make(map[string]string, len(data))
+	for name, value := range data {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("value of '%s' is not a string", name)
+		}
+		secrets[name] = s
+	}
+	return secrets, nil
+}
+
+// startRenewal keeps the token and the lease of the secret renewed until
+// the context is done. The secret is only read on startup: values rotated in
+// Vault, e.g. a new version of a KV secret, are used after a restart.
+func (v *vaultClient) startRenewal(ctx context.Context) {
+	if v.auth.Auth.Renewable && v.auth.Auth.LeaseDuration > 0 {
+		go v.keepRenewed(ctx, "token", v.auth)
+	}
+	if v.secret.Renewable && v.secret.LeaseID != "" && v.secret.LeaseDuration > 0 {
+		go v.keepRenewed(ctx, "lease of '"+v.path+"'", v.secret)
+	}
+}
+
+// keepRenewed renews the token or the lease of a secret with a lifetime
+// watcher, which renews it when about two thirds of it have passed and
+// retries failed renewals with a backoff. Once it cannot be renewed any more,
+// the dispatcher must be restarted to get new secrets.
+func (v *vaultClient) keepRenewed(ctx context.Context, what string, secret *api.Secret) {
+	watcher, err := v.client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: secret})
+	if err != nil {
+		logError("Failed to renew the Vault %s: %v", what, err)
+		return
+	}
+	go watcher.Start()
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case renewal := <-watcher.RenewCh():
+			lease := renewal.Secret.LeaseDuration
+			if renewal.Secret.Auth != nil {
+				lease = renewal.Secret.Auth.LeaseDuration
+			}
+			logDebug("Renewed the Vault %s for %s", what, time.Duration(lease)*time.Second)
+		case err := <-watcher.DoneCh():
+			if err != nil {
+				logError("Failed to renew the Vault %s, which expires now; restart the dispatcher to get new secrets: %v", what, err)
+				return
+			}
+			logError("The Vault %s reached its maximum TTL; restart the dispatcher to get new secrets", what)
+			return
+		}
+	}
+}
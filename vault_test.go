@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// fakeVault serves an AppRole login, a KV version 2 secret at
+// secret/data/dispatcher, a dynamic secret at database/creds/redis and the
+// renewals, for the token "token"
+func fakeVault(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/approle/login" {
+			var login map[string]string
+			json.NewDecoder(r.Body).Decode(&login)
+			if login["role_id"] != "role" || login["secret_id"] != "secret" {
+				http.Error(w, `{"errors":["invalid role or secret ID"]}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"auth":{"client_token":"token","lease_duration":3600,"renewable":true}}`))
+			return
+		}
+		if r.Header.Get("X-Vault-Token") != "token" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/auth/token/lookup-self":
+			w.Write([]byte(`{"data":{"ttl":0,"renewable":false}}`))
+		case "/v1/auth/token/renew-self":
+			w.Write([]byte(`{"auth":{"client_token":"token","lease_duration":1800,"renewable":true}}`))
+		case "/v1/secret/data/dispatcher":
+			w.Write([]byte(`{"data":{"data":{"TEST_VAULT_REDIS_PASSWORD":"hunter2","TEST_VAULT_WEBHOOK_SECRET":"webhook"},"metadata":{"version":3}}}`))
+		case "/v1/database/creds/redis":
+			w.Write([]byte(`{"lease_id":"database/creds/redis/abc","lease_duration":600,"renewable":true,"data":{"TEST_VAULT_REDIS_USERNAME":"v-dispatcher","TEST_VAULT_REDIS_PASSWORD":"dynamic"}}`))
+		case "/v1/sys/leases/renew":
+			w.Write([]byte(`{"lease_id":"database/creds/redis/abc","lease_duration":300,"renewable":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestLoadConfig_Vault(t *testing.T) {
+	config := loadConfig()
+
+	if config.VaultAddr != "" || config.VaultSecretPath != "" || config.VaultToken != "" || config.VaultRoleID != "" {
+		t.Errorf("Expected Vault to be disabled, got address '%s' and path '%s'", config.VaultAddr, config.VaultSecretPath)
+	}
+	if config.VaultTimeout != 10*time.Second {
+		t.Errorf("Expected VaultTimeout to be 10s, got %s", config.VaultTimeout)
+	}
+	if config.VaultSecretNames != nil {
+		t.Errorf("Expected all secrets to be exported, got %v", config.VaultSecretNames)
+	}
+
+	os.Setenv("VAULT_ADDR", "https://vault.example.com:8200")
+	os.Setenv("VAULT_SECRET_PATH", "secret/data/github-dispatcher")
+	os.Setenv("VAULT_ROLE_ID", "role")
+	os.Setenv("VAULT_SECRET_ID", "secret")
+	os.Setenv("VAULT_NAMESPACE", "ci")
+	os.Setenv("VAULT_TIMEOUT", "5s")
+	os.Setenv("VAULT_SECRET_NAMES", "REDIS_PASSWORD, WEBHOOK_SECRET")
+	defer os.Unsetenv("VAULT_SECRET_NAMES")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_SECRET_PATH")
+	defer os.Unsetenv("VAULT_ROLE_ID")
+	defer os.Unsetenv("VAULT_SECRET_ID")
+	defer os.Unsetenv("VAULT_NAMESPACE")
+	defer os.Unsetenv("VAULT_TIMEOUT")
+
+	config = loadConfig()
+	if config.VaultAddr != "https://vault.example.com:8200" {
+		t.Errorf("Expected VaultAddr to be 'https://vault.example.com:8200', got '%s'", config.VaultAddr)
+	}
+	if config.VaultSecretPath != "secret/data/github-dispatcher" {
+		t.Errorf("Expected VaultSecretPath to be 'secret/data/github-dispatcher', got '%s'", config.VaultSecretPath)
+	}
+	if config.VaultRoleID != "role" || config.VaultSecretID != "secret" {
+		t.Errorf("Expected the AppRole 'role' and 'secret', got '%s' and '%s'", config.VaultRoleID, config.VaultSecretID)
+	}
+	if config.VaultNamespace != "ci" {
+		t.Errorf("Expected VaultNamespace to be 'ci', got '%s'", config.VaultNamespace)
+	}
+	if config.VaultTimeout != 5*time.Second {
+		t.Errorf("Expected VaultTimeout to be 5s, got %s", config.VaultTimeout)
+	}
+	if len(config.VaultSecretNames) != 2 || config.VaultSecretNames[0] != "REDIS_PASSWORD" || config.VaultSecretNames[1] != "WEBHOOK_SECRET" {
+		t.Errorf("Expected VaultSecretNames to be [REDIS_PASSWORD WEBHOOK_SECRET], got %v", config.VaultSecretNames)
+	}
+	if err := validateVaultConfig(config); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+}
+
+func TestValidateVaultConfig(t *testing.T) {
+	valid := Config{VaultAddr: "https://vault.example.com", VaultSecretPath: "secret/data/dispatcher", VaultToken: "token", VaultTimeout: time.Second}
+	if err := validateVaultConfig(valid); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+
+	for name, mutate := range map[string]func(*Config){
+		"relative address":     func(c *Config) { c.VaultAddr = "vault.example.com" },
+		"missing path":         func(c *Config) { c.VaultSecretPath = "" },
+		"no credentials":       func(c *Config) { c.VaultToken = "" },
+		"token and AppRole":    func(c *Config) { c.VaultRoleID = "role" },
+		"non-positive timeout": func(c *Config) { c.VaultTimeout = 0 },
+	} {
+		invalid := valid
+		mutate(&invalid)
+		if err := validateVaultConfig(invalid); err == nil {
+			t.Errorf("Expected error for %s, got nil", name)
+		}
+	}
+}
+
+func TestLoadVaultSecrets(t *testing.T) {
+	server := fakeVault(t)
+	defer server.Close()
+	defer os.Unsetenv("TEST_VAULT_REDIS_PASSWORD")
+	defer os.Unsetenv("TEST_VAULT_WEBHOOK_SECRET")
+	defer os.Unsetenv("TEST_VAULT_REDIS_USERNAME")
+
+	// AppRole and a KV version 2 secret
+	config := Config{VaultAddr: server.URL + "/", VaultSecretPath: "/secret/data/dispatcher", VaultRoleID: "role", VaultSecretID: "secret", VaultTimeout: time.Second}
+	vault, err := loadVaultSecrets(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Failed to load secrets: %v", err)
+	}
+	if got := os.Getenv("TEST_VAULT_REDIS_PASSWORD"); got != "hunter2" {
+		t.Errorf("Expected TEST_VAULT_REDIS_PASSWORD to be 'hunter2', got '%s'", got)
+	}
+	if got := os.Getenv("TEST_VAULT_WEBHOOK_SECRET"); got != "webhook" {
+		t.Errorf("Expected TEST_VAULT_WEBHOOK_SECRET to be 'webhook', got '%s'", got)
+	}
+	if !vault.auth.Auth.Renewable || vault.auth.Auth.LeaseDuration != 3600 {
+		t.Errorf("Expected a renewable token of 1h, got %+v", vault.auth.Auth)
+	}
+
+	// A token and a dynamic secret
+	os.Unsetenv("TEST_VAULT_REDIS_PASSWORD")
+	config = Config{VaultAddr: server.URL, VaultSecretPath: "database/creds/redis", VaultToken: "token", VaultTimeout: time.Second}
+	vault, err = loadVaultSecrets(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Failed to load secrets: %v", err)
+	}
+	if got := os.Getenv("TEST_VAULT_REDIS_PASSWORD"); got != "dynamic" {
+		t.Errorf("Expected TEST_VAULT_REDIS_PASSWORD to be 'dynamic', got '%s'", got)
+	}
+	if vault.auth.Auth.Renewable || vault.auth.Auth.ClientToken != "token" {
+		t.Errorf("Expected the token not to be renewable, got %+v", vault.auth.Auth)
+	}
+	if vault.secret.LeaseID != "database/creds/redis/abc" || vault.secret.LeaseDuration != 600 || !vault.secret.Renewable {
+		t.Errorf("Expected the renewable lease 'database/creds/redis/abc' of 10m, got '%s' of %ds", vault.secret.LeaseID, vault.secret.LeaseDuration)
+	}
+
+	config.VaultToken = "wrong"
+	if _, err := loadVaultSecrets(context.Background(), config); err == nil {
+		t.Error("Expected error for a denied token, got nil")
+	}
+}
+
+func TestLoadVaultSecrets_Filtered(t *testing.T) {
+	server := fakeVault(t)
+	defer server.Close()
+	defer os.Unsetenv("TEST_VAULT_REDIS_PASSWORD")
+	defer os.Unsetenv("TEST_VAULT_WEBHOOK_SECRET")
+
+	// Only the listed names are exported
+	config := Config{VaultAddr: server.URL, VaultSecretPath: "secret/data/dispatcher", VaultToken: "token", VaultTimeout: time.Second, VaultSecretNames: []string{"TEST_VAULT_WEBHOOK_SECRET"}}
+	if _, err := loadVaultSecrets(context.Background(), config); err != nil {
+		t.Fatalf("Failed to load secrets: %v", err)
+	}
+	if _, set := os.LookupEnv("TEST_VAULT_REDIS_PASSWORD"); set {
+		t.Error("Expected TEST_VAULT_REDIS_PASSWORD not to be exported")
+	}
+	if got := os.Getenv("TEST_VAULT_WEBHOOK_SECRET"); got != "webhook" {
+		t.Errorf("Expected TEST_VAULT_WEBHOOK_SECRET to be 'webhook', got '%s'", got)
+	}
+
+	// Variables that are set are not overwritten
+	os.Setenv("TEST_VAULT_REDIS_PASSWORD", "from-env")
+	os.Unsetenv("TEST_VAULT_WEBHOOK_SECRET")
+	config.VaultSecretNames = nil
+	if _, err := loadVaultSecrets(context.Background(), config); err != nil {
+		t.Fatalf("Failed to load secrets: %v", err)
+	}
+	if got := os.Getenv("TEST_VAULT_REDIS_PASSWORD"); got != "from-env" {
+		t.Errorf("Expected TEST_VAULT_REDIS_PASSWORD to be kept, got '%s'", got)
+	}
+	if got := os.Getenv("TEST_VAULT_WEBHOOK_SECRET"); got != "webhook" {
+		t.Errorf("Expected TEST_VAULT_WEBHOOK_SECRET to be 'webhook', got '%s'", got)
+	}
+}
+
+func TestVaultSecretSkipped(t *testing.T) {
+	os.Setenv("TEST_VAULT_SET", "value")
+	os.Setenv("TEST_VAULT_EMPTY", "")
+	defer os.Unsetenv("TEST_VAULT_SET")
+	defer os.Unsetenv("TEST_VAULT_EMPTY")
+
+	for name, skipped := range map[string]bool{
+		"TEST_VAULT_UNSET": false,
+		"TEST_VAULT_EMPTY": false,
+		"TEST_VAULT_SET":   true,
+		"LD_PRELOAD=x":     true,
+		"1PASSWORD":        true,
+		"":                 true,
+	} {
+		if reason := vaultSecretSkipped(name, nil); (reason != "") != skipped {
+			t.Errorf("Expected '%s' skipped to be %t, got '%s'", name, skipped, reason)
+		}
+	}
+	if reason := vaultSecretSkipped("TEST_VAULT_UNSET", []string{"REDIS_PASSWORD"}); reason == "" {
+		t.Error("Expected a name not listed to be skipped")
+	}
+}
+
+func TestVaultKeepRenewed(t *testing.T) {
+	var renewals atomic.Int32
+	var lease atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/renew-self" || r.Header.Get("X-Vault-Token") != "token" {
+			http.NotFound(w, r)
+			return
+		}
+		renewals.Add(1)
+		fmt.Fprintf(w, `{"auth":{"client_token":"token","lease_duration":%d,"renewable":true}}`, lease.Load())
+	}))
+	defer server.Close()
+
+	vault, err := newVaultClient(Config{VaultAddr: server.URL, VaultToken: "token", VaultTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to create Vault client: %v", err)
+	}
+	token := &api.Secret{Auth: &api.SecretAuth{ClientToken: "token", LeaseDuration: 3600, Renewable: true}}
+	run := func(ctx context.Context) <-chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			vault.keepRenewed(ctx, "token", token)
+		}()
+		return done
+	}
+
+	// The renewal stops once the lease cannot be extended
+	done := run(context.Background())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the renewal to stop once the lease cannot be extended")
+	}
+	if got := renewals.Load(); got != 1 {
+		t.Errorf("Expected 1 renewal, got %d", got)
+	}
+
+	// A renewed token is renewed again later, until the context is done
+	renewals.Store(0)
+	lease.Store(1800)
+	ctx, cancel := context.WithCancel(context.Background())
+	done = run(ctx)
+	for deadline := time.Now().Add(time.Second); renewals.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the renewal to stop with the context")
+	}
+	if got := renewals.Load(); got != 1 {
+		t.Errorf("Expected 1 renewal, got %d", got)
+	}
+}
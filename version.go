@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Build information, set at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=..."
+var (
+	version   = "dev"
+	commit    string
+	buildDate string
+)
+
+// errVersionRequested is returned by parseFlags for --version, which prints
+// the build information instead of starting the dispatcher
+var errVersionRequested = errors.New("version requested")
+
+// buildCommit returns the commit the dispatcher was built from, falling back
+// to the one go build records for a git checkout, or "unknown"
+var buildCommit = sync.OnceValue(func() string {
+	if commit != "" {
+		return commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		var revision, modified string
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.modified":
+				modified = setting.Value
+			}
+		}
+		if len(revision) > 12 {
+			revision = revision[:12]
+		}
+		if revision != "" && modified == "true" {
+			revision += "-dirty"
+		}
+		if revision != "" {
+			return revision
+		}
+	}
+	return "unknown"
+})
+
+// buildTime returns when the dispatcher was built, or "unknown"
+func buildTime() string {
+	if buildDate == "" {
+		return "unknown"
+	}
+	return buildDate
+}
+
+// versionString describes the build, as printed by --version
+func versionString() string {
+	return fmt.Sprintf("github-dispatcher %s (commit %s, built %s, %s)", version, buildCommit(), buildTime(), runtime.Version())
+}
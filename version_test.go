@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseFlags_Version(t *testing.T) {
+	config := Config{InputMode: inputModePubSub}
+	if _, err := parseFlags(&config, []string{"--version"}); !errors.Is(err, errVersionRequested) {
+		t.Errorf("Expected --version to request the version, got %v", err)
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	defer func(v, d string) { version, buildDate = v, d }(version, buildDate)
+	version, buildDate = "v1.4.0", ""
+
+	got := versionString()
+	if !strings.HasPrefix(got, "github-dispatcher v1.4.0 (commit ") {
+		t.Errorf("Expected the version first, got '%s'", got)
+	}
+	if !strings.Contains(got, "built unknown") || !strings.Contains(got, runtime.Version()) {
+		t.Errorf("Expected an unknown build date and the Go version, got '%s'", got)
+	}
+
+	buildDate = "2026-10-16T09:00:00Z"
+	if got := versionString(); !strings.Contains(got, "built 2026-10-16T09:00:00Z") {
+		t.Errorf("Expected the build date, got '%s'", got)
+	}
+}
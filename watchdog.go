@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// pubsubWatchdogTimeouts counts the subscriptions torn down because their
+// probe did not arrive
+var pubsubWatchdogTimeouts atomic.Int64
+
+// subscriptionWatchdog detects pub/sub subscriptions that silently stopped
+// receiving, e.g. behind a proxy that dropped them: when no message was
+// received for PUBSUB_WATCHDOG_INTERVAL, it publishes a probe on
+// PUBSUB_WATCHDOG_CHANNEL, which the subscription also subscribes to, and
+// tears the subscription down if the probe is not received within
+// PUBSUB_WATCHDOG_TIMEOUT
+type subscriptionWatchdog struct {
+	rdb      redis.UniversalClient
+	channel  string
+	interval time.Duration
+	timeout  time.Duration
+	// probe is the payload of the probes of this instance; probes of
+	// other instances only count as received messages
+	probe string
+
+	last     atomic.Int64
+	received chan struct{}
+}
+
+func newSubscriptionWatchdog(rdb redis.UniversalClient, config Config) *subscriptionWatchdog {
+	if config.PubSubWatchdogInterval == 0 {
+		return nil
+	}
+	return &subscriptionWatchdog{
+		rdb:      rdb,
+		channel:  config.PubSubWatchdogChannel,
+		interval: config.PubSubWatchdogInterval,
+		timeout:  config.PubSubWatchdogTimeout,
+		probe:    "probe:" + config.InputStreamConsumer,
+		received: make(chan struct{}, 1),
+	}
+}
+
+func validatePubSubWatchdogConfig(config Config) error {
+	if config.PubSubWatchdogInterval < 0 {
+		return fmt.Errorf("PUBSUB_WATCHDOG_INTERVAL must not be negative, got %s", config.PubSubWatchdogInterval)
+	}
+	if config.PubSubWatchdogInterval == 0 || config.InputMode != inputModePubSub {
+		return nil
+	}
+	if config.PubSubWatchdogTimeout <= 0 {
+		return fmt.Errorf("PUBSUB_WATCHDOG_TIMEOUT must be positive, got %s", config.PubSubWatchdogTimeout)
+	}
+	if config.PubSubWatchdogChannel == "" {
+		return errors.New("PUBSUB_WATCHDOG_CHANNEL must not be empty")
+	}
+	channels, err := parseRedisChannels(config.RedisChannel)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(channels, func(c pubsubChannel) bool { return c.name == config.PubSubWatchdogChannel }) {
+		return fmt.Errorf("PUBSUB_WATCHDOG_CHANNEL '%s' must not be a webhook channel of REDIS_CHANNEL", config.PubSubWatchdogChannel)
+	}
+	return nil
+}
+
+// seen records that a message was received on the subscription
+func (w *subscriptionWatchdog) seen() {
+	w.last.Store(time.Now().UnixNano())
+}
+
+// observe handles a message of the watchdog channel
+func (w *subscriptionWatchdog) observe(payload string) {
+	if payload != w.probe {
+		return
+	}
+	select {
+	case w.received <- struct{}{}:
+	default:
+	}
+}
+
+// watch probes the subscription while it is idle until the context is
+// cancelled, or a probe is not received; then it flips readiness to
+// not-ready and calls teardown
+func (w *subscriptionWatchdog) watch(ctx context.Context, teardown func()) {
+	w.seen()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if time.Since(time.Unix(0, w.last.Load())) < w.interval {
+			continue
+		}
+
+		if err := w.check(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			timeouts := pubsubWatchdogTimeouts.Add(1)
+			inputActive.Store(false)
+			logWarn("Subscription watchdog: %v; rebuilding the subscription (%d timeout(s) in total)", err, timeouts)
+			teardown()
+			return
+		}
+		logDebug("Subscription watchdog probe received on '%s'", w.channel)
+	}
+}
+
+// check publishes a probe and waits for it to be received
+func (w *subscriptionWatchdog) check(ctx context.Context) error {
+	// Drop a probe that arrived after the previous check gave up
+	select {
+	case <-w.received:
+	default:
+	}
+
+	if err := w.rdb.Publish(ctx, w.channel, w.probe).Err(); err != nil {
+		return fmt.Errorf("failed to publish probe on '%s': %w", w.channel, err)
+	}
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	select {
+	case <-w.received:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("probe published on '%s' not received within %s", w.channel, w.timeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfig_PubSubWatchdog(t *testing.T) {
+	config := loadConfig()
+
+	if config.PubSubWatchdogInterval != 0 {
+		t.Errorf("Expected PubSubWatchdogInterval to be 0, got %s", config.PubSubWatchdogInterval)
+	}
+	if config.PubSubWatchdogTimeout != 5*time.Second {
+		t.Errorf("Expected PubSubWatchdogTimeout to be 5s, got %s", config.PubSubWatchdogTimeout)
+	}
+	if config.PubSubWatchdogChannel != "github-dispatcher:watchdog" {
+		t.Errorf("Expected PubSubWatchdogChannel to be 'github-dispatcher:watchdog', got '%s'", config.PubSubWatchdogChannel)
+	}
+
+	os.Setenv("PUBSUB_WATCHDOG_INTERVAL", "1m")
+	os.Setenv("PUBSUB_WATCHDOG_TIMEOUT", "10s")
+	os.Setenv("PUBSUB_WATCHDOG_CHANNEL", "watchdog")
+	defer os.Unsetenv("PUBSUB_WATCHDOG_INTERVAL")
+	defer os.Unsetenv("PUBSUB_WATCHDOG_TIMEOUT")
+	defer os.Unsetenv("PUBSUB_WATCHDOG_CHANNEL")
+
+	config = loadConfig()
+	if config.PubSubWatchdogInterval != time.Minute {
+		t.Errorf("Expected PubSubWatchdogInterval to be 1m, got %s", config.PubSubWatchdogInterval)
+	}
+	if config.PubSubWatchdogTimeout != 10*time.Second {
+		t.Errorf("Expected PubSubWatchdogTimeout to be 10s, got %s", config.PubSubWatchdogTimeout)
+	}
+	if config.PubSubWatchdogChannel != "watchdog" {
+		t.Errorf("Expected PubSubWatchdogChannel to be 'watchdog', got '%s'", config.PubSubWatchdogChannel)
+	}
+}
+
+func TestValidatePubSubWatchdogConfig(t *testing.T) {
+	valid := Config{InputMode: inputModePubSub, RedisChannel: "github-webhook-push", PubSubWatchdogInterval: time.Minute, PubSubWatchdogTimeout: 5 * time.Second, PubSubWatchdogChannel: "github-dispatcher:watchdog"}
+	if err := validatePubSubWatchdogConfig(valid); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+
+	invalid := valid
+	invalid.PubSubWatchdogInterval = -time.Minute
+	if err := validatePubSubWatchdogConfig(invalid); err == nil {
+		t.Error("Expected error for negative interval, got nil")
+	}
+	invalid = valid
+	invalid.PubSubWatchdogTimeout = 0
+	if err := validatePubSubWatchdogConfig(invalid); err == nil {
+		t.Error("Expected error for non-positive timeout, got nil")
+	}
+	invalid = valid
+	invalid.PubSubWatchdogChannel = "github-webhook-push"
+	if err := validatePubSubWatchdogConfig(invalid); err == nil {
+		t.Error("Expected error for a watchdog channel receiving webhooks, got nil")
+	}
+
+	// The watchdog only applies to the pub/sub input
+	other := invalid
+	other.InputMode = inputModeStream
+	if err := validatePubSubWatchdogConfig(other); err != nil {
+		t.Errorf("Expected the watchdog to be ignored with the stream input, got %v", err)
+	}
+}
+
+func TestSubscriptionWatchdog_Integration(t *testing.T) {
+	// Skip this test if Redis is not available
+	// This is an integration test that requires a Redis instance
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	defer rdb.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("Redis not available, skipping integration test")
+	}
+
+	config := Config{
+		InputStreamConsumer:    "test",
+		PubSubWatchdogInterval: 100 * time.Millisecond,
+		PubSubWatchdogTimeout:  500 * time.Millisecond,
+		PubSubWatchdogChannel:  "test-dispatcher-watchdog",
+	}
+	channels, err := parseRedisChannels("test-webhook-watchdog")
+	if err != nil {
+		t.Fatalf("Failed to parse channels: %v", err)
+	}
+
+	// A working subscription receives its probes and stays up
+	timeouts := pubsubWatchdogTimeouts.Load()
+	consumeCtx, stop := context.WithCancel(ctx)
+	go consumePubSub(consumeCtx, rdb, channels, newSubscriptionWatchdog(rdb, config), func(ctx context.Context, payload string) error {
+		return nil
+	})
+	time.Sleep(time.Second)
+	stop()
+	if got := pubsubWatchdogTimeouts.Load() - timeouts; got != 0 {
+		t.Errorf("Expected no watchdog timeout on a working subscription, got %d", got)
+	}
+
+	// Without a subscription receiving the probe, the watchdog tears down
+	torn := make(chan struct{})
+	go newSubscriptionWatchdog(rdb, config).watch(ctx, func() { close(torn) })
+	select {
+	case <-torn:
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the watchdog to tear the subscription down")
+	}
+	if got := pubsubWatchdogTimeouts.Load() - timeouts; got != 1 {
+		t.Errorf("Expected one watchdog timeout, got %d", got)
+	}
+	if inputActive.Load() {
+		t.Error("Expected the input not to be ready after a watchdog timeout")
+	}
+}